@@ -0,0 +1,321 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HostResolution est la boutique servie par un host (sous-domaine store_slug
+// ou domaine personnalisé vérifié), telle que renvoyée par l'auth-service
+type HostResolution struct {
+	MerchantID     string   `json:"merchant_id"`
+	StoreSlug      string   `json:"store_slug"`
+	Hostname       string   `json:"hostname"`
+	AllowedOrigins []string `json:"allowed_origins"`
+}
+
+type hostCacheEntry struct {
+	host       string
+	resolution *HostResolution
+	expiresAt  time.Time
+}
+
+// hostResolver résout les hosts auprès de l'auth-service avec un cache mémoire
+// LRU borné. Les hosts inconnus sont mis en cache moins longtemps (negativeTTL) ;
+// comme les hosts viennent du client, le nombre de résolutions simultanées est
+// limité pour ne pas submerger l'auth-service.
+type hostResolver struct {
+	mu          sync.Mutex
+	entries     map[string]*list.Element
+	order       *list.List // du plus récemment utilisé au plus ancien
+	maxEntries  int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	lookups     chan struct{}
+	client      *http.Client
+}
+
+var merchantHosts = newHostResolver()
+
+func newHostResolver() *hostResolver {
+	maxEntries, err := strconv.Atoi(getEnv("HOST_RESOLUTION_CACHE_SIZE", "10000"))
+	if err != nil || maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	maxLookups, err := strconv.Atoi(getEnv("HOST_RESOLUTION_MAX_LOOKUPS", "32"))
+	if err != nil || maxLookups <= 0 {
+		maxLookups = 32
+	}
+	return &hostResolver{
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+		maxEntries:  maxEntries,
+		ttl:         envDuration("HOST_RESOLUTION_TTL", time.Minute),
+		negativeTTL: envDuration("HOST_RESOLUTION_NEGATIVE_TTL", 10*time.Second),
+		lookups:     make(chan struct{}, maxLookups),
+		client:      &http.Client{Timeout: 3 * time.Second},
+	}
+}
+
+// envDuration lit une durée strictement positive, ou retourne la valeur par défaut
+func envDuration(key string, defaultValue time.Duration) time.Duration {
+	d, err := time.ParseDuration(getEnv(key, defaultValue.String()))
+	if err != nil || d <= 0 {
+		return defaultValue
+	}
+	return d
+}
+
+// normalizeHost met un host en minuscules, sans port ni point final
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// validHostname vérifie qu'un host est un nom de domaine syntaxiquement valide :
+// inutile d'interroger l'auth-service pour le reste
+func validHostname(host string) bool {
+	if len(host) > 253 || !strings.Contains(host, ".") {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, ch := range label {
+			if (ch < 'a' || ch > 'z') && (ch < '0' || ch > '9') && ch != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Resolve retourne la boutique servie par un host, ou nil si aucune
+func (r *hostResolver) Resolve(host string) *HostResolution {
+	host = normalizeHost(host)
+	if host == "" || host == "localhost" || net.ParseIP(host) != nil || !validHostname(host) {
+		return nil
+	}
+
+	if resolution, ok := r.cached(host); ok {
+		return resolution
+	}
+
+	// Trop de résolutions en cours : la requête est transmise sans résolution
+	select {
+	case r.lookups <- struct{}{}:
+		defer func() { <-r.lookups }()
+	default:
+		log.Printf("Résolution du host %s différée: trop de résolutions en cours", host)
+		return nil
+	}
+
+	resolution, err := r.fetch(host)
+	if err != nil {
+		// L'auth-service est injoignable : ne rien mettre en cache
+		log.Printf("Résolution du host %s impossible: %v", host, err)
+		return nil
+	}
+
+	ttl := r.ttl
+	if resolution == nil {
+		ttl = r.negativeTTL
+	}
+	r.store(host, resolution, ttl)
+	return resolution
+}
+
+// cached retourne la résolution en cache d'un host si elle n'a pas expiré
+func (r *hostResolver) cached(host string) (*HostResolution, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	element, ok := r.entries[host]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*hostCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		r.order.Remove(element)
+		delete(r.entries, host)
+		return nil, false
+	}
+	r.order.MoveToFront(element)
+	return entry.resolution, true
+}
+
+// store met une résolution en cache en évinçant au besoin le host le moins récemment utilisé
+func (r *hostResolver) store(host string, resolution *HostResolution, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry := &hostCacheEntry{host: host, resolution: resolution, expiresAt: time.Now().Add(ttl)}
+	if element, ok := r.entries[host]; ok {
+		element.Value = entry
+		r.order.MoveToFront(element)
+		return
+	}
+	r.entries[host] = r.order.PushFront(entry)
+	for r.order.Len() > r.maxEntries {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.entries, oldest.Value.(*hostCacheEntry).host)
+	}
+}
+
+func (r *hostResolver) fetch(host string) (*HostResolution, error) {
+	target := getServiceURL("auth-service") + "/api/v1/merchants/resolve?host=" + url.QueryEscape(host)
+	resp, err := r.client.Get(target)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var resolution HostResolution
+		if err := json.NewDecoder(resp.Body).Decode(&resolution); err != nil {
+			return nil, err
+		}
+		return &resolution, nil
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("statut inattendu de l'auth-service: %d", resp.StatusCode)
+	}
+}
+
+// originHost retourne le host d'un en-tête Origin
+func originHost(origin string) string {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// parseTrustedProxies lit une liste d'adresses IP ou de plages CIDR séparées par des virgules
+func parseTrustedProxies(value string) []*net.IPNet {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("TRUSTED_PROXIES: entrée ignorée %q: %v", entry, err)
+			continue
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies
+}
+
+// isTrustedProxy indique si l'adresse appartient à un proxy de confiance
+func isTrustedProxy(remoteIP string, proxies []*net.IPNet) bool {
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+	for _, network := range proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostMerchantMiddleware identifie la boutique à partir du host de la requête
+// (X-Forwarded-Host, Host, puis Origin pour les appels cross-origin du
+// storefront) et impose son merchant_id aux routes publiques. X-Forwarded-Host
+// n'est pris en compte que s'il est posé par un proxy de TRUSTED_PROXIES.
+func hostMerchantMiddleware() gin.HandlerFunc {
+	trustedProxies := parseTrustedProxies(getEnv("TRUSTED_PROXIES", ""))
+
+	return func(c *gin.Context) {
+		candidates := []string{c.Request.Host, originHost(c.GetHeader("Origin"))}
+		if forwarded := c.GetHeader("X-Forwarded-Host"); forwarded != "" {
+			if isTrustedProxy(c.RemoteIP(), trustedProxies) {
+				candidates = append([]string{forwarded}, candidates...)
+			} else {
+				c.Request.Header.Del("X-Forwarded-Host")
+			}
+		}
+
+		var resolution *HostResolution
+		for _, candidate := range candidates {
+			// X-Forwarded-Host peut contenir une liste de proxies : garder le client
+			candidate = strings.TrimSpace(strings.Split(candidate, ",")[0])
+			if resolution = merchantHosts.Resolve(candidate); resolution != nil {
+				break
+			}
+		}
+
+		if resolution != nil {
+			// En-tête distinct de X-Merchant-ID : la boutique consultée n'est pas
+			// un marchand authentifié
+			c.Set("storefront_merchant_id", resolution.MerchantID)
+			query := c.Request.URL.Query()
+			query.Set("merchant_id", resolution.MerchantID)
+			c.Request.URL.RawQuery = query.Encode()
+			c.Set("store_slug", resolution.StoreSlug)
+		}
+
+		c.Next()
+	}
+}
+
+// isAllowedOrigin vérifie qu'une origine est configurée explicitement ou
+// correspond à un domaine de boutique
+func isAllowedOrigin(origin string, staticOrigins map[string]bool) bool {
+	origin = strings.TrimSuffix(strings.ToLower(origin), "/")
+	if staticOrigins[origin] {
+		return true
+	}
+
+	resolution := merchantHosts.Resolve(originHost(origin))
+	if resolution == nil {
+		return false
+	}
+	for _, allowed := range resolution.AllowedOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOrigins lit une liste d'origines séparées par des virgules
+func parseOrigins(value string) map[string]bool {
+	origins := make(map[string]bool)
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+		if origin != "" {
+			origins[origin] = true
+		}
+	}
+	return origins
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHostResolverCacheIsBounded(t *testing.T) {
+	r := &hostResolver{entries: make(map[string]*list.Element), order: list.New(), maxEntries: 3}
+
+	for i := 0; i < 10; i++ {
+		r.store(fmt.Sprintf("shop%d.example.com", i), nil, time.Minute)
+	}
+	if r.order.Len() != 3 || len(r.entries) != 3 {
+		t.Fatalf("cache de %d entrées, attendu 3", len(r.entries))
+	}
+	if _, ok := r.cached("shop0.example.com"); ok {
+		t.Error("le host le plus ancien aurait dû être évincé")
+	}
+
+	// Un host consulté redevient le plus récent et survit à l'éviction suivante
+	if _, ok := r.cached("shop7.example.com"); !ok {
+		t.Fatal("shop7.example.com absent du cache")
+	}
+	r.store("shop10.example.com", nil, time.Minute)
+	if _, ok := r.cached("shop7.example.com"); !ok {
+		t.Error("shop7.example.com évincé alors qu'il vient d'être consulté")
+	}
+	if _, ok := r.cached("shop8.example.com"); ok {
+		t.Error("shop8.example.com aurait dû être évincé")
+	}
+}
+
+func TestHostResolverEntriesExpire(t *testing.T) {
+	r := &hostResolver{entries: make(map[string]*list.Element), order: list.New(), maxEntries: 10}
+
+	r.store("unknown.example.com", nil, -time.Second)
+	if _, ok := r.cached("unknown.example.com"); ok {
+		t.Error("une entrée expirée ne doit pas être servie")
+	}
+	if len(r.entries) != 0 {
+		t.Error("une entrée expirée doit être retirée du cache")
+	}
+}
+
+func TestValidHostname(t *testing.T) {
+	tests := map[string]bool{
+		"shop.example.com":     true,
+		"my-shop.example.co":   true,
+		"example":              false,
+		"-shop.example.com":    false,
+		"shop..example.com":    false,
+		"shop_1.example.com":   false,
+		"shop.example.com/../": false,
+	}
+	for host, want := range tests {
+		if got := validHostname(host); got != want {
+			t.Errorf("validHostname(%q) = %v, attendu %v", host, got, want)
+		}
+	}
+}
+
+func TestIsTrustedProxy(t *testing.T) {
+	proxies := parseTrustedProxies("10.0.0.0/8, 192.168.1.10, invalide")
+
+	tests := map[string]bool{
+		"10.1.2.3":     true,
+		"192.168.1.10": true,
+		"192.168.1.11": false,
+		"203.0.113.5":  false,
+		"":             false,
+	}
+	for ip, want := range tests {
+		if got := isTrustedProxy(ip, proxies); got != want {
+			t.Errorf("isTrustedProxy(%q) = %v, attendu %v", ip, got, want)
+		}
+	}
+}
@@ -11,9 +11,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func main() {
-	port := getEnv("PORT", "8080")
-	
+// newRouter déclare les middlewares et les routes du gateway
+func newRouter() *gin.Engine {
 	router := gin.Default()
 	
 	// Middleware global
@@ -26,6 +25,7 @@ func main() {
 	
 	// Routes API publiques (sans authentification)
 	public := router.Group("/api/v1")
+	public.Use(hostMerchantMiddleware())
 	{
 		// Auth routes
 		public.POST("/auth/login", proxyToService("auth-service", "/api/v1/auth/login"))
@@ -37,10 +37,29 @@ func main() {
 		public.GET("/products", proxyToService("catalogue-service", "/api/v1/products"))
 		public.GET("/products/:id", proxyToService("catalogue-service", "/api/v1/products/:id"))
 		public.POST("/search", proxyToService("catalogue-service", "/api/v1/search"))
+		public.GET("/search/autocomplete", proxyToService("catalogue-service", "/api/v1/search/autocomplete"))
+		public.POST("/search/clicks", proxyToService("catalogue-service", "/api/v1/search/clicks"))
+		public.POST("/search/conversions", proxyToService("catalogue-service", "/api/v1/search/conversions"))
+		public.GET("/feeds/:token/:file", proxyToService("catalogue-service", "/api/v1/feeds/:token/:file"))
+		public.GET("/inventory/:productId/availability", proxyToService("catalogue-service", "/api/v1/inventory/:productId/availability"))
+		public.GET("/locales", proxyToService("catalogue-service", "/api/v1/locales"))
+		public.GET("/collections", proxyToService("catalogue-service", "/api/v1/collections"))
+		public.GET("/collections/:id", proxyToService("catalogue-service", "/api/v1/collections/:id"))
+		public.GET("/collections/:id/products", proxyToService("catalogue-service", "/api/v1/collections/:id/products"))
+		public.GET("/products/:id/recommendations", proxyToService("catalogue-service", "/api/v1/products/:id/recommendations"))
+		public.GET("/recommendations/cart", proxyToService("catalogue-service", "/api/v1/recommendations/cart"))
+		public.POST("/recommendations/views", proxyToService("catalogue-service", "/api/v1/recommendations/views"))
+		public.GET("/products/:id/reviews", proxyToService("catalogue-service", "/api/v1/products/:id/reviews"))
+		public.GET("/products/:id/structured-data", proxyToService("catalogue-service", "/api/v1/products/:id/structured-data"))
+		public.GET("/downloads/:token", transferMiddleware(), proxyToService("catalogue-service", "/api/v1/downloads/:token"))
 		
 		// Store Builder routes (publiques pour le storefront)
 		public.GET("/store-builder/config", proxyToService("catalogue-service", "/api/v1/store-builder/config"))
 		public.GET("/store-builder/theme", proxyToService("catalogue-service", "/api/v1/store-builder/theme"))
+		public.GET("/store-builder/section-types", proxyToService("catalogue-service", "/api/v1/store-builder/section-types"))
+		public.GET("/store-builder/resolve", proxyToService("catalogue-service", "/api/v1/store-builder/resolve"))
+		public.GET("/store-builder/theme.css", proxyToService("catalogue-service", "/api/v1/store-builder/theme.css"))
+		public.GET("/store-builder/theme-presets", proxyToService("catalogue-service", "/api/v1/store-builder/theme-presets"))
 	}
 	
 	// Routes API protégées (avec authentification)
@@ -49,12 +68,103 @@ func main() {
 	{
 		// Auth routes protégées
 		protected.GET("/auth/me", proxyToService("auth-service", "/api/v1/auth/me"))
+		protected.GET("/domains", proxyToService("auth-service", "/api/v1/domains"))
+		protected.POST("/domains", proxyToService("auth-service", "/api/v1/domains"))
+		protected.POST("/domains/:id/verify", proxyToService("auth-service", "/api/v1/domains/:id/verify"))
+		protected.DELETE("/domains/:id", proxyToService("auth-service", "/api/v1/domains/:id"))
 		
 		// Catalogue routes protégées
 		protected.POST("/products", proxyToService("catalogue-service", "/api/v1/products"))
 		protected.PUT("/products/:id", proxyToService("catalogue-service", "/api/v1/products/:id"))
 		protected.DELETE("/products/:id", proxyToService("catalogue-service", "/api/v1/products/:id"))
+		protected.POST("/products/bulk", proxyToService("catalogue-service", "/api/v1/products/bulk"))
+		protected.GET("/products/export", transferMiddleware(), proxyToService("catalogue-service", "/api/v1/products/export"))
+		protected.PUT("/locales", proxyToService("catalogue-service", "/api/v1/locales"))
+		protected.GET("/products/:id/translations", proxyToService("catalogue-service", "/api/v1/products/:id/translations"))
+		protected.PUT("/products/:id/translations/:locale", proxyToService("catalogue-service", "/api/v1/products/:id/translations/:locale"))
+		protected.DELETE("/products/:id/translations/:locale", proxyToService("catalogue-service", "/api/v1/products/:id/translations/:locale"))
+		protected.GET("/categories/:id/translations", proxyToService("catalogue-service", "/api/v1/categories/:id/translations"))
+		protected.PUT("/categories/:id/translations/:locale", proxyToService("catalogue-service", "/api/v1/categories/:id/translations/:locale"))
+		protected.DELETE("/categories/:id/translations/:locale", proxyToService("catalogue-service", "/api/v1/categories/:id/translations/:locale"))
+		protected.POST("/collections", proxyToService("catalogue-service", "/api/v1/collections"))
+		protected.PUT("/collections/:id", proxyToService("catalogue-service", "/api/v1/collections/:id"))
+		protected.DELETE("/collections/:id", proxyToService("catalogue-service", "/api/v1/collections/:id"))
+		protected.POST("/products/:id/reviews", proxyToService("catalogue-service", "/api/v1/products/:id/reviews"))
+		protected.GET("/reviews", proxyToService("catalogue-service", "/api/v1/reviews"))
+		protected.GET("/reviews/settings", proxyToService("catalogue-service", "/api/v1/reviews/settings"))
+		protected.PUT("/reviews/settings", proxyToService("catalogue-service", "/api/v1/reviews/settings"))
+		protected.POST("/reviews/:id/moderate", proxyToService("catalogue-service", "/api/v1/reviews/:id/moderate"))
+		protected.PUT("/reviews/:id/reply", proxyToService("catalogue-service", "/api/v1/reviews/:id/reply"))
+		protected.DELETE("/reviews/:id", proxyToService("catalogue-service", "/api/v1/reviews/:id"))
+		protected.PUT("/products/:id/variants/:variantId/delivery", proxyToService("catalogue-service", "/api/v1/products/:id/variants/:variantId/delivery"))
+		protected.GET("/products/:id/assets", proxyToService("catalogue-service", "/api/v1/products/:id/assets"))
+		protected.POST("/products/:id/assets", transferMiddleware(), proxyToService("catalogue-service", "/api/v1/products/:id/assets"))
+		protected.DELETE("/products/:id/assets/:assetId", proxyToService("catalogue-service", "/api/v1/products/:id/assets/:assetId"))
+		protected.GET("/products/:id/license-keys", proxyToService("catalogue-service", "/api/v1/products/:id/license-keys"))
+		protected.POST("/products/:id/license-keys", proxyToService("catalogue-service", "/api/v1/products/:id/license-keys"))
+		protected.DELETE("/products/:id/license-keys/:keyId", proxyToService("catalogue-service", "/api/v1/products/:id/license-keys/:keyId"))
+		protected.GET("/digital/orders/:orderId", proxyToService("catalogue-service", "/api/v1/digital/orders/:orderId"))
+		protected.GET("/feeds", proxyToService("catalogue-service", "/api/v1/feeds"))
+		protected.POST("/feeds", proxyToService("catalogue-service", "/api/v1/feeds"))
+		protected.POST("/search/admin", proxyToService("catalogue-service", "/api/v1/search/admin"))
+		protected.GET("/search/synonyms", proxyToService("catalogue-service", "/api/v1/search/synonyms"))
+		protected.POST("/search/synonyms", proxyToService("catalogue-service", "/api/v1/search/synonyms"))
+		protected.PUT("/search/synonyms/:id", proxyToService("catalogue-service", "/api/v1/search/synonyms/:id"))
+		protected.DELETE("/search/synonyms/:id", proxyToService("catalogue-service", "/api/v1/search/synonyms/:id"))
+		protected.GET("/search/analytics", proxyToService("catalogue-service", "/api/v1/search/analytics"))
+		protected.GET("/search/rules", proxyToService("catalogue-service", "/api/v1/search/rules"))
+		protected.POST("/search/rules", proxyToService("catalogue-service", "/api/v1/search/rules"))
+		protected.PUT("/search/rules/:id", proxyToService("catalogue-service", "/api/v1/search/rules/:id"))
+		protected.DELETE("/search/rules/:id", proxyToService("catalogue-service", "/api/v1/search/rules/:id"))
 		protected.PUT("/inventory/:productId", proxyToService("catalogue-service", "/api/v1/inventory/:productId"))
+		protected.GET("/inventory/:productId/movements", proxyToService("catalogue-service", "/api/v1/inventory/:productId/movements"))
+		protected.POST("/inventory/:productId/reconcile", proxyToService("catalogue-service", "/api/v1/inventory/:productId/reconcile"))
+		protected.POST("/inventory/sync", proxyToService("catalogue-service", "/api/v1/inventory/sync"))
+		protected.POST("/inventory/sync/csv", proxyToService("catalogue-service", "/api/v1/inventory/sync/csv"))
+		protected.GET("/locations", proxyToService("catalogue-service", "/api/v1/locations"))
+		protected.POST("/locations", proxyToService("catalogue-service", "/api/v1/locations"))
+		protected.PUT("/locations/:id", proxyToService("catalogue-service", "/api/v1/locations/:id"))
+		protected.GET("/transfers", proxyToService("catalogue-service", "/api/v1/transfers"))
+		protected.POST("/transfers", proxyToService("catalogue-service", "/api/v1/transfers"))
+		protected.GET("/transfers/:id", proxyToService("catalogue-service", "/api/v1/transfers/:id"))
+		protected.POST("/transfers/:id/ship", proxyToService("catalogue-service", "/api/v1/transfers/:id/ship"))
+		protected.POST("/transfers/:id/receive", proxyToService("catalogue-service", "/api/v1/transfers/:id/receive"))
+		protected.POST("/transfers/:id/cancel", proxyToService("catalogue-service", "/api/v1/transfers/:id/cancel"))
+		protected.GET("/allocation-settings", proxyToService("catalogue-service", "/api/v1/allocation-settings"))
+		protected.PUT("/allocation-settings", proxyToService("catalogue-service", "/api/v1/allocation-settings"))
+		protected.GET("/inventory/low-stock", proxyToService("catalogue-service", "/api/v1/inventory/low-stock"))
+		protected.PUT("/inventory/:productId/reorder", proxyToService("catalogue-service", "/api/v1/inventory/:productId/reorder"))
+		protected.PUT("/inventory/:productId/policy", proxyToService("catalogue-service", "/api/v1/inventory/:productId/policy"))
+		protected.GET("/inventory/backorders", proxyToService("catalogue-service", "/api/v1/inventory/backorders"))
+		protected.POST("/inventory/backorders/:id/fulfil", proxyToService("catalogue-service", "/api/v1/inventory/backorders/:id/fulfil"))
+		protected.GET("/stock-alerts", proxyToService("catalogue-service", "/api/v1/stock-alerts"))
+		protected.GET("/stock-alerts/settings", proxyToService("catalogue-service", "/api/v1/stock-alerts/settings"))
+		protected.PUT("/stock-alerts/settings", proxyToService("catalogue-service", "/api/v1/stock-alerts/settings"))
+		protected.GET("/suppliers", proxyToService("catalogue-service", "/api/v1/suppliers"))
+		protected.POST("/suppliers", proxyToService("catalogue-service", "/api/v1/suppliers"))
+		protected.PUT("/suppliers/:id", proxyToService("catalogue-service", "/api/v1/suppliers/:id"))
+		protected.DELETE("/suppliers/:id", proxyToService("catalogue-service", "/api/v1/suppliers/:id"))
+		protected.GET("/purchase-orders", proxyToService("catalogue-service", "/api/v1/purchase-orders"))
+		protected.POST("/purchase-orders", proxyToService("catalogue-service", "/api/v1/purchase-orders"))
+		protected.POST("/purchase-orders/generate", proxyToService("catalogue-service", "/api/v1/purchase-orders/generate"))
+		protected.GET("/purchase-orders/:id", proxyToService("catalogue-service", "/api/v1/purchase-orders/:id"))
+		protected.POST("/purchase-orders/:id/submit", proxyToService("catalogue-service", "/api/v1/purchase-orders/:id/submit"))
+		protected.POST("/purchase-orders/:id/receive", proxyToService("catalogue-service", "/api/v1/purchase-orders/:id/receive"))
+		protected.POST("/purchase-orders/:id/cancel", proxyToService("catalogue-service", "/api/v1/purchase-orders/:id/cancel"))
+		protected.POST("/products/generate-description", proxyToService("catalogue-service", "/api/v1/products/generate-description"))
+		protected.GET("/ai/settings", proxyToService("catalogue-service", "/api/v1/ai/settings"))
+		protected.PUT("/ai/settings", proxyToService("catalogue-service", "/api/v1/ai/settings"))
+		protected.GET("/ai/usage", proxyToService("catalogue-service", "/api/v1/ai/usage"))
+		protected.POST("/ai/jobs", proxyToService("catalogue-service", "/api/v1/ai/jobs"))
+		protected.GET("/ai/jobs", proxyToService("catalogue-service", "/api/v1/ai/jobs"))
+		protected.GET("/ai/jobs/:id", proxyToService("catalogue-service", "/api/v1/ai/jobs/:id"))
+		protected.GET("/ai/jobs/:id/items", proxyToService("catalogue-service", "/api/v1/ai/jobs/:id/items"))
+		protected.POST("/ai/jobs/:id/cancel", proxyToService("catalogue-service", "/api/v1/ai/jobs/:id/cancel"))
+		protected.POST("/ai/jobs/:id/resume", proxyToService("catalogue-service", "/api/v1/ai/jobs/:id/resume"))
+		protected.POST("/ai/jobs/:id/accept", proxyToService("catalogue-service", "/api/v1/ai/jobs/:id/accept"))
+		protected.POST("/ai/jobs/:id/items/:itemId/accept", proxyToService("catalogue-service", "/api/v1/ai/jobs/:id/items/:itemId/accept"))
+		protected.POST("/ai/jobs/:id/items/:itemId/reject", proxyToService("catalogue-service", "/api/v1/ai/jobs/:id/items/:itemId/reject"))
+		protected.POST("/ai/translations", proxyToService("catalogue-service", "/api/v1/ai/translations"))
 		
 		// Checkout routes
 		protected.GET("/cart", proxyToService("checkout-service", "/api/v1/cart"))
@@ -97,18 +207,41 @@ func main() {
 		// Migration routes
 				protected.POST("/migration/import", proxyToService("migration-tool", "/api/v1/migration/import"))
 				protected.GET("/migration/status/:id", proxyToService("migration-tool", "/api/v1/migration/status/:id"))
-				protected.GET("/store-builder/config", proxyToService("catalogue-service", "/api/v1/store-builder/config"))
 				protected.POST("/store-builder/config", proxyToService("catalogue-service", "/api/v1/store-builder/config"))
-				protected.GET("/store-builder/theme", proxyToService("catalogue-service", "/api/v1/store-builder/theme"))
 				protected.POST("/store-builder/theme", proxyToService("catalogue-service", "/api/v1/store-builder/theme"))
+				protected.POST("/store-builder/theme-presets/:id/apply", proxyToService("catalogue-service", "/api/v1/store-builder/theme-presets/:id/apply"))
+				protected.GET("/store-builder/theme/export", proxyToService("catalogue-service", "/api/v1/store-builder/theme/export"))
+				protected.POST("/store-builder/theme/import", proxyToService("catalogue-service", "/api/v1/store-builder/theme/import"))
+				protected.GET("/store-builder/draft", proxyToService("catalogue-service", "/api/v1/store-builder/draft"))
+				protected.POST("/store-builder/publish", proxyToService("catalogue-service", "/api/v1/store-builder/publish"))
+				protected.POST("/store-builder/preview-token", proxyToService("catalogue-service", "/api/v1/store-builder/preview-token"))
+				protected.GET("/store-builder/versions", proxyToService("catalogue-service", "/api/v1/store-builder/versions"))
+				protected.GET("/store-builder/versions/diff", proxyToService("catalogue-service", "/api/v1/store-builder/versions/diff"))
+				protected.GET("/store-builder/versions/:version", proxyToService("catalogue-service", "/api/v1/store-builder/versions/:version"))
+				protected.POST("/store-builder/versions/:version/rollback", proxyToService("catalogue-service", "/api/v1/store-builder/versions/:version/rollback"))
+				protected.DELETE("/store-builder/versions/:version/schedule", proxyToService("catalogue-service", "/api/v1/store-builder/versions/:version/schedule"))
+				protected.GET("/store-builder/pages", proxyToService("catalogue-service", "/api/v1/store-builder/pages"))
+				protected.POST("/store-builder/pages", proxyToService("catalogue-service", "/api/v1/store-builder/pages"))
+				protected.GET("/store-builder/pages/:handle", proxyToService("catalogue-service", "/api/v1/store-builder/pages/:handle"))
+				protected.PUT("/store-builder/pages/:handle", proxyToService("catalogue-service", "/api/v1/store-builder/pages/:handle"))
+				protected.DELETE("/store-builder/pages/:handle", proxyToService("catalogue-service", "/api/v1/store-builder/pages/:handle"))
+				protected.GET("/store-builder/menus", proxyToService("catalogue-service", "/api/v1/store-builder/menus"))
+				protected.PUT("/store-builder/menus/:handle", proxyToService("catalogue-service", "/api/v1/store-builder/menus/:handle"))
+				protected.DELETE("/store-builder/menus/:handle", proxyToService("catalogue-service", "/api/v1/store-builder/menus/:handle"))
 			}
 	
 	// Webhooks (sans authentification mais avec signature)
 	router.POST("/api/v1/webhooks/stripe", proxyToService("checkout-service", "/api/v1/checkout/stripe/webhook"))
 	
+	return router
+}
+
+func main() {
+	port := getEnv("PORT", "8080")
+	
 	srv := &http.Server{
 		Addr:         ":" + port,
-		Handler:      router,
+		Handler:      newRouter(),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeService démarre un faux service backend vers lequel le gateway proxy
+func fakeService(t *testing.T, serviceName string, handler http.HandlerFunc) {
+	t.Helper()
+	backend := httptest.NewServer(handler)
+	t.Cleanup(backend.Close)
+
+	host, port, err := net.SplitHostPort(backend.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(strings.ToUpper(serviceName)+"_HOST", host)
+	t.Setenv(strings.ToUpper(serviceName)+"_PORT", port)
+}
+
+// testToken signe un JWT de marchand avec JWT_SECRET
+func testToken(t *testing.T, merchantID string) string {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":     "user-1",
+		"merchant_id": merchantID,
+		"role":        "owner",
+	}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestExportOutlivesServerWriteTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Un export qui dure plus longtemps que le WriteTimeout du serveur
+	const chunks = 5
+	fakeService(t, "catalogue-service", func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < chunks; i++ {
+			io.WriteString(w, "ligne\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+
+	gateway := httptest.NewUnstartedServer(newRouter())
+	gateway.Config.WriteTimeout = 100 * time.Millisecond
+	gateway.Start()
+	defer gateway.Close()
+
+	req, err := http.NewRequest(http.MethodGet, gateway.URL+"/api/v1/products/export?format=csv", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken(t, "merchant-1"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("export interrompu après %d octets: %v", len(body), err)
+	}
+	if got := strings.Count(string(body), "ligne\n"); got != chunks {
+		t.Errorf("%d lignes exportées, attendu %d", got, chunks)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -9,11 +10,17 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// corsMiddleware gère les en-têtes CORS
+// corsMiddleware gère les en-têtes CORS : seules les origines configurées
+// (CORS_ALLOWED_ORIGINS) et les domaines des boutiques sont autorisés
 func corsMiddleware() gin.HandlerFunc {
+	staticOrigins := parseOrigins(getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:3000,http://localhost:3001"))
+
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		c.Writer.Header().Add("Vary", "Origin")
+		if origin := c.GetHeader("Origin"); origin != "" && isAllowedOrigin(origin, staticOrigins) {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
 
@@ -77,3 +84,24 @@ func authenticateMiddleware() gin.HandlerFunc {
 	}
 }
 
+// transferMiddleware remplace les délais de lecture et d'écriture du serveur
+// (15s) pour les routes de transfert longues : export du catalogue,
+// téléversement et téléchargement des produits numériques (TRANSFER_TIMEOUT)
+func transferMiddleware() gin.HandlerFunc {
+	timeout, err := time.ParseDuration(getEnv("TRANSFER_TIMEOUT", "30m"))
+	if err != nil || timeout <= 0 {
+		timeout = 30 * time.Minute
+	}
+
+	return func(c *gin.Context) {
+		deadline := time.Now().Add(timeout)
+		rc := http.NewResponseController(c.Writer)
+		if err := rc.SetReadDeadline(deadline); err != nil {
+			log.Printf("Délai de lecture non modifiable pour %s: %v", c.Request.URL.Path, err)
+		}
+		if err := rc.SetWriteDeadline(deadline); err != nil {
+			log.Printf("Délai d'écriture non modifiable pour %s: %v", c.Request.URL.Path, err)
+		}
+		c.Next()
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"io"
 	"net/http"
 	"strings"
@@ -33,6 +32,15 @@ func getServiceURL(serviceName string) string {
 	return "http://" + host + ":" + port
 }
 
+// isIdentityHeader indique si un en-tête porte une identité posée par le gateway
+func isIdentityHeader(key string) bool {
+	switch http.CanonicalHeaderKey(key) {
+	case "X-User-Id", "X-Merchant-Id", "X-Storefront-Merchant-Id":
+		return true
+	}
+	return false
+}
+
 // proxyToService crée un handler qui proxy les requêtes vers un service backend
 func proxyToService(serviceName, path string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -43,23 +51,31 @@ func proxyToService(serviceName, path string) gin.HandlerFunc {
 		for _, param := range c.Params {
 			targetURL = strings.Replace(targetURL, ":"+param.Key, param.Value, -1)
 		}
+		if c.Request.URL.RawQuery != "" {
+			targetURL += "?" + c.Request.URL.RawQuery
+		}
 
-		// Copier le body de la requête
-		var bodyBytes []byte
-		if c.Request.Body != nil {
-			bodyBytes, _ = io.ReadAll(c.Request.Body)
-			c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+		// Transmettre le body en streaming : un téléversement n'est pas chargé en mémoire
+		body := c.Request.Body
+		if body == nil || c.Request.ContentLength == 0 {
+			body = http.NoBody
 		}
 
 		// Créer la requête vers le service backend
-		req, err := http.NewRequest(c.Request.Method, targetURL, bytes.NewBuffer(bodyBytes))
+		req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, targetURL, body)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la création de la requête"})
 			return
 		}
 
-		// Copier les en-têtes
+		req.ContentLength = c.Request.ContentLength
+
+		// Copier les en-têtes, sauf ceux d'identité : seul le gateway les pose,
+		// un client ne doit pas pouvoir se faire passer pour un marchand
 		for key, values := range c.Request.Header {
+			if isIdentityHeader(key) {
+				continue
+			}
 			for _, value := range values {
 				req.Header.Add(key, value)
 			}
@@ -72,6 +88,9 @@ func proxyToService(serviceName, path string) gin.HandlerFunc {
 		if merchantID, exists := c.Get("merchant_id"); exists {
 			req.Header.Set("X-Merchant-ID", merchantID.(string))
 		}
+		if storefrontMerchantID, exists := c.Get("storefront_merchant_id"); exists {
+			req.Header.Set("X-Storefront-Merchant-ID", storefrontMerchantID.(string))
+		}
 
 		// Exécuter la requête
 		client := &http.Client{
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// backendRecorder démarre un faux catalogue-service qui enregistre les en-têtes reçus
+func backendRecorder(t *testing.T) *http.Header {
+	t.Helper()
+	received := &http.Header{}
+	fakeService(t, "catalogue-service", func(w http.ResponseWriter, r *http.Request) {
+		*received = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	})
+	return received
+}
+
+func TestProxyStripsClientIdentityHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	received := backendRecorder(t)
+
+	router := gin.New()
+	router.POST("/search", proxyToService("catalogue-service", "/api/v1/search"))
+
+	req := httptest.NewRequest(http.MethodPost, "/search", nil)
+	req.Header.Set("X-Merchant-ID", "merchant-usurpe")
+	req.Header.Set("x-user-id", "user-usurpe")
+	req.Header.Set("Accept-Language", "fr")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := received.Get("X-Merchant-ID"); got != "" {
+		t.Errorf("X-Merchant-ID transmis au service : %q", got)
+	}
+	if got := received.Get("X-User-ID"); got != "" {
+		t.Errorf("X-User-ID transmis au service : %q", got)
+	}
+	if got := received.Get("Accept-Language"); got != "fr" {
+		t.Errorf("Accept-Language = %q, attendu fr", got)
+	}
+}
+
+func TestProxySetsIdentityFromToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	received := backendRecorder(t)
+
+	router := gin.New()
+	router.POST("/search/admin", func(c *gin.Context) {
+		c.Set("user_id", "user-1")
+		c.Set("merchant_id", "merchant-1")
+	}, proxyToService("catalogue-service", "/api/v1/search/admin"))
+
+	req := httptest.NewRequest(http.MethodPost, "/search/admin", nil)
+	req.Header.Set("X-Merchant-ID", "merchant-usurpe")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := received.Values("X-Merchant-ID"); len(got) != 1 || got[0] != "merchant-1" {
+		t.Errorf("X-Merchant-ID = %v, attendu [merchant-1]", got)
+	}
+	if got := received.Get("X-User-ID"); got != "user-1" {
+		t.Errorf("X-User-ID = %q, attendu user-1", got)
+	}
+}
+
+func TestStorefrontMerchantIsNotAnIdentity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	received := backendRecorder(t)
+	merchantHosts.store("shop.example.com", &HostResolution{MerchantID: "merchant-1", StoreSlug: "shop"}, time.Minute)
+
+	router := gin.New()
+	router.POST("/search", hostMerchantMiddleware(), proxyToService("catalogue-service", "/api/v1/search"))
+
+	req := httptest.NewRequest(http.MethodPost, "http://shop.example.com/search", nil)
+	req.Header.Set("X-Storefront-Merchant-ID", "merchant-usurpe")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := received.Get("X-Storefront-Merchant-ID"); got != "merchant-1" {
+		t.Errorf("X-Storefront-Merchant-ID = %q, attendu merchant-1", got)
+	}
+	if got := received.Get("X-Merchant-ID"); got != "" {
+		t.Errorf("X-Merchant-ID = %q sur une route publique", got)
+	}
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Domain verification statuses
+const (
+	DomainStatusPending  = "pending"
+	DomainStatusVerified = "verified"
+	DomainStatusFailed   = "failed"
+)
+
+const (
+	// domainVerificationPrefix is the DNS label holding the ownership TXT record
+	domainVerificationPrefix = "_omnisphere-verify"
+	// domainVerificationValue prefixes the token in the TXT record value
+	domainVerificationValue = "omnisphere-verify="
+	// dnsLookupTimeout bounds a single TXT lookup
+	dnsLookupTimeout = 5 * time.Second
+	// maxMerchantDomains limits the number of domains per merchant
+	maxMerchantDomains = 10
+)
+
+var (
+	errDomainNotFound      = errors.New("domain not found")
+	errDomainInvalid       = errors.New("invalid hostname")
+	errDomainReserved      = errors.New("subdomains of the platform domain cannot be attached")
+	errDomainTaken         = errors.New("domain is already attached to another store")
+	errDomainExists        = errors.New("domain is already attached to this store")
+	errDomainLimit         = errors.New("domain limit reached")
+	errNoMerchantAccount   = errors.New("no merchant account for this user")
+	errDomainNotResolvable = errors.New("no store for this host")
+)
+
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// TXTResolver looks up DNS TXT records. net.DefaultResolver satisfies it; tests
+// and offline environments can swap dnsResolver for a stub.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+var dnsResolver TXTResolver = net.DefaultResolver
+
+// MerchantDomain is a custom domain attached to a merchant storefront
+type MerchantDomain struct {
+	ID                string     `json:"id"`
+	MerchantID        string     `json:"merchant_id"`
+	Hostname          string     `json:"hostname"`
+	Status            string     `json:"status"`
+	VerificationToken string     `json:"verification_token"`
+	VerificationName  string     `json:"verification_record_name"`
+	VerificationValue string     `json:"verification_record_value"`
+	VerifiedAt        *time.Time `json:"verified_at,omitempty"`
+	LastCheckedAt     *time.Time `json:"last_checked_at,omitempty"`
+	LastError         string     `json:"last_error,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// HostResolution is the merchant serving a given host, with the origins its
+// storefront is reachable from (used by the gateway for CORS)
+type HostResolution struct {
+	MerchantID     string   `json:"merchant_id"`
+	StoreSlug      string   `json:"store_slug"`
+	Hostname       string   `json:"hostname"`
+	AllowedOrigins []string `json:"allowed_origins"`
+}
+
+// storefrontBaseDomain is the platform domain serving <store_slug>.<base> subdomains
+func storefrontBaseDomain() string {
+	return strings.ToLower(getEnv("STOREFRONT_BASE_DOMAIN", "localhost"))
+}
+
+// normalizeHostname lowercases a host and strips the port and trailing dot
+func normalizeHostname(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+func newVerificationToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+const merchantDomainColumns = `id, merchant_id, hostname, status, verification_token, verified_at,
+	last_checked_at, COALESCE(last_error, ''), created_at`
+
+func scanMerchantDomain(row interface{ Scan(...interface{}) error }) (*MerchantDomain, error) {
+	var d MerchantDomain
+	var verifiedAt, lastCheckedAt sql.NullTime
+	err := row.Scan(&d.ID, &d.MerchantID, &d.Hostname, &d.Status, &d.VerificationToken, &verifiedAt,
+		&lastCheckedAt, &d.LastError, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if verifiedAt.Valid {
+		d.VerifiedAt = &verifiedAt.Time
+	}
+	if lastCheckedAt.Valid {
+		d.LastCheckedAt = &lastCheckedAt.Time
+	}
+	d.VerificationName = domainVerificationPrefix + "." + d.Hostname
+	d.VerificationValue = domainVerificationValue + d.VerificationToken
+	return &d, nil
+}
+
+// CreateMerchantDomain attaches a domain to a merchant, pending DNS verification.
+// Several stores may claim the same pending domain; only one can verify it.
+func CreateMerchantDomain(merchantID, hostname string) (*MerchantDomain, error) {
+	hostname = normalizeHostname(hostname)
+	if !hostnamePattern.MatchString(hostname) || len(hostname) > 253 {
+		return nil, errDomainInvalid
+	}
+	base := storefrontBaseDomain()
+	if hostname == base || strings.HasSuffix(hostname, "."+base) {
+		return nil, errDomainReserved
+	}
+
+	var count int
+	var exists, taken bool
+	err := db.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE merchant_id = $1),
+		       COALESCE(BOOL_OR(merchant_id = $1 AND hostname = $2), false),
+		       COALESCE(BOOL_OR(merchant_id <> $1 AND hostname = $2 AND status = 'verified'), false)
+		FROM merchant_domains WHERE merchant_id = $1 OR hostname = $2
+	`, merchantID, hostname).Scan(&count, &exists, &taken)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case exists:
+		return nil, errDomainExists
+	case taken:
+		return nil, errDomainTaken
+	case count >= maxMerchantDomains:
+		return nil, errDomainLimit
+	}
+
+	token, err := newVerificationToken()
+	if err != nil {
+		return nil, err
+	}
+	return scanMerchantDomain(db.QueryRow(`
+		INSERT INTO merchant_domains (merchant_id, hostname, verification_token)
+		VALUES ($1, $2, $3)
+		RETURNING `+merchantDomainColumns,
+		merchantID, hostname, token,
+	))
+}
+
+// ListMerchantDomains returns the domains of a merchant
+func ListMerchantDomains(merchantID string) ([]*MerchantDomain, error) {
+	rows, err := db.Query(`SELECT `+merchantDomainColumns+` FROM merchant_domains
+		WHERE merchant_id = $1 ORDER BY created_at`, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := []*MerchantDomain{}
+	for rows.Next() {
+		d, err := scanMerchantDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+	return domains, rows.Err()
+}
+
+func getMerchantDomain(merchantID, id string) (*MerchantDomain, error) {
+	d, err := scanMerchantDomain(db.QueryRow(`SELECT `+merchantDomainColumns+` FROM merchant_domains
+		WHERE id = $1 AND merchant_id = $2`, id, merchantID))
+	if err == sql.ErrNoRows {
+		return nil, errDomainNotFound
+	}
+	return d, err
+}
+
+// checkDomainTXT looks for the verification record of a domain
+func checkDomainTXT(ctx context.Context, resolver TXTResolver, d *MerchantDomain) error {
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+
+	records, err := resolver.LookupTXT(ctx, d.VerificationName)
+	if err != nil {
+		return fmt.Errorf("TXT lookup for %s failed: %w", d.VerificationName, err)
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == d.VerificationValue {
+			return nil
+		}
+	}
+	return fmt.Errorf("TXT record %s=%q not found", d.VerificationName, d.VerificationValue)
+}
+
+// VerifyMerchantDomain checks the DNS TXT record proving ownership of a domain.
+// The lookup result is recorded either way; a domain verified by another store
+// in the meantime cannot be verified. Two stores verifying the same hostname
+// concurrently race on the unique index of verified hostnames: the loser gets
+// errDomainTaken.
+func VerifyMerchantDomain(ctx context.Context, resolver TXTResolver, merchantID, id string) (*MerchantDomain, error) {
+	d, err := getMerchantDomain(merchantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	status, lastError := DomainStatusVerified, ""
+	if err := checkDomainTXT(ctx, resolver, d); err != nil {
+		status, lastError = DomainStatusFailed, err.Error()
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if status == DomainStatusVerified {
+		var taken bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM merchant_domains
+			WHERE hostname = $1 AND merchant_id <> $2 AND status = 'verified')`, d.Hostname, merchantID).Scan(&taken)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, errDomainTaken
+		}
+	}
+
+	d, err = scanMerchantDomain(tx.QueryRow(`
+		UPDATE merchant_domains
+		SET status = CASE WHEN $3 = 'verified' THEN 'verified'
+		                  WHEN status = 'verified' THEN status ELSE $3 END,
+		    verified_at = CASE WHEN $3 = 'verified' THEN COALESCE(verified_at, NOW()) ELSE verified_at END,
+		    last_checked_at = NOW(), last_error = NULLIF($4, ''), updated_at = NOW()
+		WHERE id = $1 AND merchant_id = $2
+		RETURNING `+merchantDomainColumns,
+		id, merchantID, status, lastError,
+	))
+	if isUniqueViolation(err) {
+		return nil, errDomainTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, tx.Commit()
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// DeleteMerchantDomain detaches a domain from a merchant
+func DeleteMerchantDomain(merchantID, id string) error {
+	result, err := db.Exec(`DELETE FROM merchant_domains WHERE id = $1 AND merchant_id = $2`, id, merchantID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errDomainNotFound
+	}
+	return nil
+}
+
+// ResolveMerchantByHost finds the merchant serving a host: a <store_slug>
+// subdomain of the platform domain or a verified custom domain
+func ResolveMerchantByHost(host string) (*HostResolution, error) {
+	hostname := normalizeHostname(host)
+	resolution := &HostResolution{Hostname: hostname}
+
+	var err error
+	base := storefrontBaseDomain()
+	if slug := strings.TrimSuffix(hostname, "."+base); slug != hostname && !strings.Contains(slug, ".") {
+		err = db.QueryRow(`SELECT id, store_slug FROM merchant_accounts WHERE store_slug = $1`, slug).
+			Scan(&resolution.MerchantID, &resolution.StoreSlug)
+	} else {
+		err = db.QueryRow(`
+			SELECT m.id, m.store_slug FROM merchant_domains d
+			JOIN merchant_accounts m ON m.id = d.merchant_id
+			WHERE d.hostname = $1 AND d.status = 'verified'
+		`, hostname).Scan(&resolution.MerchantID, &resolution.StoreSlug)
+	}
+	if err == sql.ErrNoRows {
+		return nil, errDomainNotResolvable
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	origins, err := merchantOrigins(resolution.MerchantID, resolution.StoreSlug)
+	if err != nil {
+		return nil, err
+	}
+	resolution.AllowedOrigins = origins
+	return resolution, nil
+}
+
+// merchantOrigins lists the storefront origins of a merchant: its platform
+// subdomain and its verified custom domains
+func merchantOrigins(merchantID, storeSlug string) ([]string, error) {
+	origins := []string{"https://" + storeSlug + "." + storefrontBaseDomain()}
+
+	rows, err := db.Query(`SELECT hostname FROM merchant_domains
+		WHERE merchant_id = $1 AND status = 'verified' ORDER BY hostname`, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hostname string
+		if err := rows.Scan(&hostname); err != nil {
+			return nil, err
+		}
+		origins = append(origins, "https://"+hostname)
+	}
+	return origins, rows.Err()
+}
+
+// currentMerchantID returns the merchant account of the authenticated user
+func currentMerchantID(c *gin.Context) (string, error) {
+	userID, _ := c.Get("user_id")
+	id, _ := userID.(string)
+	account, err := GetMerchantAccount(id)
+	if err != nil {
+		return "", err
+	}
+	if account == nil {
+		return "", errNoMerchantAccount
+	}
+	return account.ID, nil
+}
+
+func respondDomainError(c *gin.Context, err error) {
+	switch err {
+	case errDomainNotFound, errDomainNotResolvable:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errNoMerchantAccount:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errDomainTaken, errDomainExists, errDomainLimit:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errDomainInvalid, errDomainReserved:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+}
+
+func handleListDomains(c *gin.Context) {
+	merchantID, err := currentMerchantID(c)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	domains, err := ListMerchantDomains(merchantID)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"domains":         domains,
+		"platform_domain": "https://*." + storefrontBaseDomain(),
+	})
+}
+
+func handleCreateDomain(c *gin.Context) {
+	var req struct {
+		Hostname string `json:"hostname" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	merchantID, err := currentMerchantID(c)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	domain, err := CreateMerchantDomain(merchantID, req.Hostname)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, domain)
+}
+
+func handleVerifyDomain(c *gin.Context) {
+	merchantID, err := currentMerchantID(c)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	domain, err := VerifyMerchantDomain(c.Request.Context(), dnsResolver, merchantID, c.Param("id"))
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	status := http.StatusOK
+	if domain.Status != DomainStatusVerified {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, domain)
+}
+
+func handleDeleteDomain(c *gin.Context) {
+	merchantID, err := currentMerchantID(c)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	if err := DeleteMerchantDomain(merchantID, c.Param("id")); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Domain removed"})
+}
+
+// handleResolveHost is called by the api-gateway to map a Host header to a merchant
+func handleResolveHost(c *gin.Context) {
+	host := c.Query("host")
+	if host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing host"})
+		return
+	}
+
+	resolution, err := ResolveMerchantByHost(host)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resolution)
+}
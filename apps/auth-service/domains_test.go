@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubResolver answers TXT lookups from a fixed table, without network access
+type stubResolver struct {
+	records map[string][]string
+	err     error
+}
+
+func (r stubResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.records[name], nil
+}
+
+// matchingResolver publishes the verification record of a domain
+func matchingResolver(d *MerchantDomain) stubResolver {
+	return stubResolver{records: map[string][]string{
+		d.VerificationName: {"v=spf1 -all", " " + d.VerificationValue + " "},
+	}}
+}
+
+func TestCheckDomainTXT(t *testing.T) {
+	domain := &MerchantDomain{
+		Hostname:          "shop.example.com",
+		VerificationName:  domainVerificationPrefix + ".shop.example.com",
+		VerificationValue: domainVerificationValue + "abc123",
+	}
+
+	tests := []struct {
+		name     string
+		resolver stubResolver
+		wantErr  string
+	}{
+		{"match", matchingResolver(domain), ""},
+		{"no match", stubResolver{records: map[string][]string{
+			domain.VerificationName: {domainVerificationValue + "another-token"},
+		}}, "not found"},
+		{"record on the wrong name", stubResolver{records: map[string][]string{
+			"shop.example.com": {domain.VerificationValue},
+		}}, "not found"},
+		{"dns error", stubResolver{err: errors.New("no such host")}, "no such host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDomainTXT(context.Background(), tt.resolver, domain)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyMerchantDomain(t *testing.T) {
+	openTestDB(t)
+
+	tests := []struct {
+		name       string
+		resolver   func(d *MerchantDomain) TXTResolver
+		takenFirst bool
+		wantStatus string
+		wantErr    error
+	}{
+		{
+			name:       "match",
+			resolver:   func(d *MerchantDomain) TXTResolver { return matchingResolver(d) },
+			wantStatus: DomainStatusVerified,
+		},
+		{
+			name:       "no match",
+			resolver:   func(d *MerchantDomain) TXTResolver { return stubResolver{} },
+			wantStatus: DomainStatusFailed,
+		},
+		{
+			name:       "dns error",
+			resolver:   func(d *MerchantDomain) TXTResolver { return stubResolver{err: errors.New("server misbehaving")} },
+			wantStatus: DomainStatusFailed,
+		},
+		{
+			name:       "taken by another store",
+			resolver:   func(d *MerchantDomain) TXTResolver { return matchingResolver(d) },
+			takenFirst: true,
+			wantErr:    errDomainTaken,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostname := fmt.Sprintf("shop%d.example.com", i)
+			if tt.takenFirst {
+				other := createTestMerchant(t)
+				d, err := CreateMerchantDomain(other, hostname)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := VerifyMerchantDomain(context.Background(), matchingResolver(d), other, d.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			merchantID := createTestMerchant(t)
+			d, err := createPendingDomain(merchantID, hostname)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			verified, err := VerifyMerchantDomain(context.Background(), tt.resolver(d), merchantID, d.ID)
+			if tt.wantErr != nil {
+				if err != tt.wantErr {
+					t.Fatalf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if verified.Status != tt.wantStatus {
+				t.Errorf("status %s, want %s", verified.Status, tt.wantStatus)
+			}
+			if tt.wantStatus == DomainStatusFailed && verified.LastError == "" {
+				t.Error("a failed verification must record the lookup error")
+			}
+		})
+	}
+}
+
+func TestVerifyMerchantDomainConcurrently(t *testing.T) {
+	openTestDB(t)
+
+	const stores = 2
+	type claim struct {
+		merchantID string
+		domain     *MerchantDomain
+	}
+	claims := make([]claim, stores)
+	for i := range claims {
+		merchantID := createTestMerchant(t)
+		d, err := CreateMerchantDomain(merchantID, "contested.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims[i] = claim{merchantID, d}
+	}
+
+	errs := make([]error, stores)
+	var wg sync.WaitGroup
+	for i, c := range claims {
+		wg.Add(1)
+		go func(i int, c claim) {
+			defer wg.Done()
+			_, errs[i] = VerifyMerchantDomain(context.Background(), matchingResolver(c.domain), c.merchantID, c.domain.ID)
+		}(i, c)
+	}
+	wg.Wait()
+
+	verified, taken := 0, 0
+	for _, err := range errs {
+		switch err {
+		case nil:
+			verified++
+		case errDomainTaken:
+			taken++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if verified != 1 || taken != stores-1 {
+		t.Errorf("%d verified and %d taken, want 1 and %d", verified, taken, stores-1)
+	}
+}
+
+// createPendingDomain attaches a domain even when another store already
+// verified it, to exercise the verification-time check
+func createPendingDomain(merchantID, hostname string) (*MerchantDomain, error) {
+	token, err := newVerificationToken()
+	if err != nil {
+		return nil, err
+	}
+	return scanMerchantDomain(db.QueryRow(`
+		INSERT INTO merchant_domains (merchant_id, hostname, verification_token)
+		VALUES ($1, $2, $3)
+		RETURNING `+merchantDomainColumns,
+		merchantID, hostname, token,
+	))
+}
+
+// openTestDB points db at AUTH_TEST_DATABASE_URL, inside a schema created for
+// the test. merchant_accounts comes from the Supabase schema, so only the
+// columns domains rely on are created before the service migrations run.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	url := os.Getenv("AUTH_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("AUTH_TEST_DATABASE_URL not set")
+	}
+
+	admin, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("connecting to the test database: %v", err)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatalf("creating the test schema: %v", err)
+	}
+
+	separator := "?"
+	if strings.Contains(url, "?") {
+		separator = "&"
+	}
+	conn, err := sql.Open("postgres", url+separator+"search_path="+schema+",public")
+	if err != nil {
+		t.Fatalf("connecting to the test schema: %v", err)
+	}
+
+	previous := db
+	db = conn
+	t.Cleanup(func() {
+		db = previous
+		conn.Close()
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	if _, err := db.Exec(`CREATE TABLE merchant_accounts (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		store_slug VARCHAR(255) UNIQUE NOT NULL
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob("../../shared/database_migrations/auth-service/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(migration)); err != nil {
+			t.Fatalf("migration %s: %v", filepath.Base(file), err)
+		}
+	}
+}
+
+// createTestMerchant creates a merchant account and returns its id
+func createTestMerchant(t *testing.T) string {
+	t.Helper()
+	var id string
+	slug := fmt.Sprintf("store-%d", time.Now().UnixNano())
+	if err := db.QueryRow("INSERT INTO merchant_accounts (store_slug) VALUES ($1) RETURNING id", slug).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
@@ -29,6 +29,14 @@ func main() {
 		api.POST("/auth/refresh", handleRefreshToken)
 		api.GET("/auth/me", authenticateMiddleware(), handleGetMe)
 		api.POST("/auth/delete-account", authenticateMiddleware(), handleDeleteAccount)
+
+		api.GET("/domains", authenticateMiddleware(), handleListDomains)
+		api.POST("/domains", authenticateMiddleware(), handleCreateDomain)
+		api.POST("/domains/:id/verify", authenticateMiddleware(), handleVerifyDomain)
+		api.DELETE("/domains/:id", authenticateMiddleware(), handleDeleteDomain)
+
+		// Internal: host-based merchant resolution for the api-gateway
+		api.GET("/merchants/resolve", handleResolveHost)
 	}
 
 	srv := &http.Server{
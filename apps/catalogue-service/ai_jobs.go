@@ -0,0 +1,1223 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Statuts d'un job de génération
+const (
+	AIJobQueued    = "queued"
+	AIJobRunning   = "running"
+	AIJobPaused    = "paused"
+	AIJobCompleted = "completed"
+	AIJobCancelled = "cancelled"
+)
+
+// Statuts d'un produit dans un job
+const (
+	AIItemPending   = "pending"
+	AIItemGenerated = "generated"
+	AIItemFailed    = "failed"
+	AIItemAccepted  = "accepted"
+	AIItemRejected  = "rejected"
+)
+
+// Types de job : génération de contenus ou traduction dans la langue du job
+const (
+	AIJobKindContent     = "content"
+	AIJobKindTranslation = "translation"
+)
+
+// Champs produit générables (le nom n'est que traduit)
+const (
+	AIFieldName            = "name"
+	AIFieldDescription     = "description"
+	AIFieldSEOTitle        = "seo_title"
+	AIFieldMetaDescription = "meta_description"
+	AIFieldTags            = "tags"
+)
+
+// aiFieldInstructions décrit chaque champ générable dans le prompt
+var aiFieldInstructions = map[string]string{
+	AIFieldDescription:     "description SEO de 150 à 300 mots, formatée en paragraphes courts",
+	AIFieldSEOTitle:        "titre SEO de 60 caractères maximum",
+	AIFieldMetaDescription: "meta description de 160 caractères maximum",
+	AIFieldTags:            "liste de 3 à 8 mots-clés courts",
+}
+
+// aiJobFieldOrder fixe l'ordre des champs dans le prompt
+var aiJobFieldOrder = []string{AIFieldName, AIFieldDescription, AIFieldSEOTitle, AIFieldMetaDescription, AIFieldTags}
+
+const (
+	// maxAIJobProducts limite le nombre de produits sélectionnés par job
+	maxAIJobProducts = 10000
+	// aiJobBatchSize est le nombre de produits réservés par lot
+	aiJobBatchSize = 20
+	// aiJobLease est la durée pendant laquelle un job est réservé par un worker ;
+	// passé ce délai (arrêt du service), un autre worker le reprend
+	aiJobLease = 2 * time.Minute
+	// aiItemMaxAttempts au-delà duquel un produit est marqué en échec
+	aiItemMaxAttempts = 3
+	// Longueurs maximales appliquées au contenu généré
+	maxSEOTitleLength        = 70
+	maxMetaDescriptionLength = 320
+	maxGeneratedTags         = 10
+)
+
+var (
+	errAIJobNotFound      = errors.New("job introuvable")
+	errAIJobEmpty         = errors.New("aucun produit ne correspond au filtre")
+	errAIJobTooLarge      = fmt.Errorf("le filtre sélectionne plus de %d produits", maxAIJobProducts)
+	errAIJobState         = errors.New("action impossible dans l'état actuel du job")
+	errAIItemNotFound     = errors.New("produit introuvable dans ce job")
+	errAIItemNotAvailable = errors.New("aucun contenu généré à valider pour ce produit")
+)
+
+// aiJobWake réveille le worker de génération sans attendre le prochain tick
+var aiJobWake = make(chan struct{}, 1)
+
+// AIJobFilter sélectionne les produits d'un job ; les critères se cumulent
+type AIJobFilter struct {
+	ProductIDs         []string `json:"product_ids,omitempty"`
+	Status             string   `json:"status,omitempty"`
+	CategoryID         string   `json:"category_id,omitempty"`
+	Tag                string   `json:"tag,omitempty"`
+	Query              string   `json:"query,omitempty"`
+	MissingDescription bool     `json:"missing_description,omitempty"`
+	// MissingTranslation ne retient que les produits sans traduction dans cette langue
+	MissingTranslation string `json:"missing_translation,omitempty"`
+}
+
+// CreateAIJobRequest représente une demande de génération en masse
+type CreateAIJobRequest struct {
+	Filter AIJobFilter `json:"filter"`
+	Fields []string    `json:"fields"`
+	// Language et Tone remplacent les réglages du marchand pour ce job
+	Language string `json:"language,omitempty"`
+	Tone     string `json:"tone,omitempty"`
+	// TokenBudget plafonne les tokens consommés par le job (nil : plafond mensuel seul)
+	TokenBudget *int `json:"token_budget,omitempty"`
+}
+
+// AIJobProgress est l'avancement d'un job, calculé à partir de ses produits
+type AIJobProgress struct {
+	Total     int `json:"total"`
+	Pending   int `json:"pending"`
+	Generated int `json:"generated"`
+	Failed    int `json:"failed"`
+	Accepted  int `json:"accepted"`
+	Rejected  int `json:"rejected"`
+}
+
+// AIGenerationJob est un job de génération de contenus sur une sélection de produits
+type AIGenerationJob struct {
+	ID          string        `json:"id"`
+	MerchantID  string        `json:"merchant_id"`
+	Kind        string        `json:"kind"`
+	Status      string        `json:"status"`
+	Fields      []string      `json:"fields"`
+	Filter      AIJobFilter   `json:"filter"`
+	Language    string        `json:"language"`
+	Tone        string        `json:"tone"`
+	TokenBudget *int          `json:"token_budget,omitempty"`
+	TokensUsed  int           `json:"tokens_used"`
+	Error       string        `json:"error,omitempty"`
+	CreatedBy   string        `json:"created_by"`
+	Progress    AIJobProgress `json:"progress"`
+	CreatedAt   time.Time     `json:"created_at"`
+	StartedAt   *time.Time    `json:"started_at,omitempty"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+}
+
+// AIGeneratedContent est le contenu généré (ou actuel) d'un produit
+type AIGeneratedContent struct {
+	Name            string   `json:"name,omitempty"`
+	Description     string   `json:"description,omitempty"`
+	SEOTitle        string   `json:"seo_title,omitempty"`
+	MetaDescription string   `json:"meta_description,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+	// Variants contient le nom traduit des variantes, par identifiant
+	Variants map[string]string `json:"variants,omitempty"`
+}
+
+// AIGenerationItem est un produit d'un job, avec son contenu actuel pour la relecture
+type AIGenerationItem struct {
+	ID          string              `json:"id"`
+	ProductID   string              `json:"product_id"`
+	ProductName string              `json:"product_name"`
+	Status      string              `json:"status"`
+	Current     AIGeneratedContent  `json:"current"`
+	Generated   *AIGeneratedContent `json:"generated,omitempty"`
+	Error       string              `json:"error,omitempty"`
+	Attempts    int                 `json:"attempts"`
+	TokensUsed  int                 `json:"tokens_used"`
+	ReviewedBy  string              `json:"reviewed_by,omitempty"`
+	ReviewedAt  *time.Time          `json:"reviewed_at,omitempty"`
+}
+
+// aiJobFilterClause construit la condition SQL de sélection des produits du marchand
+func aiJobFilterClause(merchantID string, f *AIJobFilter) (string, []interface{}) {
+	conditions := []string{"merchant_id = $1"}
+	args := []interface{}{merchantID}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if len(f.ProductIDs) > 0 {
+		add("id = ANY($%d::uuid[])", pq.Array(f.ProductIDs))
+	}
+	if f.Status != "" {
+		add("status = $%d", f.Status)
+	}
+	if f.CategoryID != "" {
+		add("category_id = $%d", f.CategoryID)
+	}
+	if f.Tag != "" {
+		add("$%d = ANY(tags)", f.Tag)
+	}
+	if f.Query != "" {
+		add("name ILIKE '%%' || $%d || '%%'", f.Query)
+	}
+	if f.MissingDescription {
+		conditions = append(conditions, "COALESCE(description, '') = ''")
+	}
+	if f.MissingTranslation != "" {
+		add("NOT EXISTS (SELECT 1 FROM product_translations t WHERE t.product_id = products.id AND t.locale = $%d)", f.MissingTranslation)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// validateAIJobRequest vérifie les champs, la langue, le ton et le budget d'un job
+func validateAIJobRequest(req *CreateAIJobRequest) ValidationErrors {
+	errs := aiService.validateAISettings(&AISettings{Language: req.Language, Tone: req.Tone})
+	if len(req.Fields) == 0 {
+		req.Fields = []string{AIFieldDescription}
+	}
+	for i, field := range req.Fields {
+		if _, ok := aiFieldInstructions[field]; !ok || field == AIFieldName {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("fields[%d]", i), Message: "Champ non générable"})
+		}
+	}
+	if req.TokenBudget != nil && *req.TokenBudget <= 0 {
+		errs = append(errs, FieldError{Field: "token_budget", Message: "Doit être strictement positif"})
+	}
+	if len(req.Filter.ProductIDs) > maxAIJobProducts {
+		errs = append(errs, FieldError{Field: "filter.product_ids", Message: fmt.Sprintf("%d produits maximum", maxAIJobProducts)})
+	}
+	return errs
+}
+
+// orderedAIFields retourne les champs demandés, dédoublonnés et dans l'ordre du prompt
+func orderedAIFields(fields []string) []string {
+	requested := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		requested[field] = true
+	}
+	ordered := make([]string, 0, len(requested))
+	for _, field := range aiJobFieldOrder {
+		if requested[field] {
+			ordered = append(ordered, field)
+		}
+	}
+	return ordered
+}
+
+// CreateAIJob sélectionne les produits du filtre et crée le job en attente du worker
+func CreateAIJob(merchantID, author string, req *CreateAIJobRequest) (*AIGenerationJob, error) {
+	settings, err := aiService.GetAISettings(db, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	language := firstNonEmpty(req.Language, settings.Language)
+	tone := firstNonEmpty(req.Tone, settings.Tone)
+
+	jobID, err := insertAIJob(merchantID, author, AIJobKindContent, req.Fields, &req.Filter, language, tone, req.TokenBudget)
+	if err != nil {
+		return nil, err
+	}
+
+	notifyAIJobWorker()
+	return GetAIJob(db, merchantID, jobID)
+}
+
+// insertAIJob crée un job et ses produits, sélectionnés par le filtre
+func insertAIJob(merchantID, author, kind string, fields []string, f *AIJobFilter, language, tone string, tokenBudget *int) (string, error) {
+	filter, err := json.Marshal(f)
+	if err != nil {
+		return "", err
+	}
+
+	where, args := aiJobFilterClause(merchantID, f)
+	var jobID string
+	err = withTx(func(tx *sql.Tx) error {
+		var count int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM products WHERE "+where, args...).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			return errAIJobEmpty
+		}
+		if count > maxAIJobProducts {
+			return errAIJobTooLarge
+		}
+
+		err := tx.QueryRow(
+			`INSERT INTO ai_generation_jobs (merchant_id, kind, fields, filter, language, tone, token_budget, created_by)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+			merchantID, kind, pq.Array(orderedAIFields(fields)), filter, language, tone, tokenBudget, author,
+		).Scan(&jobID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			fmt.Sprintf("INSERT INTO ai_generation_items (job_id, product_id) SELECT $%d, id FROM products WHERE %s", len(args)+1, where),
+			append(args, jobID)...,
+		)
+		return err
+	})
+	return jobID, err
+}
+
+const aiJobSelect = `
+	SELECT j.id, j.merchant_id, j.kind, j.status, j.fields, j.filter, j.language, j.tone, j.token_budget,
+	       j.tokens_used, COALESCE(j.error, ''), j.created_by, j.created_at, j.started_at, j.completed_at,
+	       c.total, c.pending, c.generated, c.failed, c.accepted, c.rejected
+	FROM ai_generation_jobs j,
+	LATERAL (
+		SELECT COUNT(*) AS total,
+		       COUNT(*) FILTER (WHERE status = 'pending') AS pending,
+		       COUNT(*) FILTER (WHERE status = 'generated') AS generated,
+		       COUNT(*) FILTER (WHERE status = 'failed') AS failed,
+		       COUNT(*) FILTER (WHERE status = 'accepted') AS accepted,
+		       COUNT(*) FILTER (WHERE status = 'rejected') AS rejected
+		FROM ai_generation_items WHERE job_id = j.id
+	) c`
+
+func scanAIJob(row interface{ Scan(...interface{}) error }) (*AIGenerationJob, error) {
+	var job AIGenerationJob
+	var fields pq.StringArray
+	var filter []byte
+	var budget sql.NullInt64
+	var startedAt, completedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.MerchantID, &job.Kind, &job.Status, &fields, &filter, &job.Language, &job.Tone, &budget,
+		&job.TokensUsed, &job.Error, &job.CreatedBy, &job.CreatedAt, &startedAt, &completedAt,
+		&job.Progress.Total, &job.Progress.Pending, &job.Progress.Generated, &job.Progress.Failed,
+		&job.Progress.Accepted, &job.Progress.Rejected)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Fields = []string(fields)
+	if err := json.Unmarshal(filter, &job.Filter); err != nil {
+		return nil, err
+	}
+	if budget.Valid {
+		value := int(budget.Int64)
+		job.TokenBudget = &value
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	return &job, nil
+}
+
+// GetAIJob retourne un job du marchand et son avancement
+func GetAIJob(q queryer, merchantID, jobID string) (*AIGenerationJob, error) {
+	job, err := scanAIJob(q.QueryRow(aiJobSelect+" WHERE j.id = $1 AND j.merchant_id = $2", jobID, merchantID))
+	if err == sql.ErrNoRows {
+		return nil, errAIJobNotFound
+	}
+	return job, err
+}
+
+// ListAIJobs retourne les jobs du marchand, du plus récent au plus ancien
+func ListAIJobs(merchantID string, limit, offset int) ([]*AIGenerationJob, error) {
+	rows, err := db.Query(aiJobSelect+" WHERE j.merchant_id = $1 ORDER BY j.created_at DESC LIMIT $2 OFFSET $3",
+		merchantID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*AIGenerationJob{}
+	for rows.Next() {
+		job, err := scanAIJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// ListAIJobItems retourne les produits d'un job, filtrés par statut
+func ListAIJobItems(merchantID, jobID, status string, limit, offset int) ([]*AIGenerationItem, error) {
+	if _, err := GetAIJob(db, merchantID, jobID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT i.id, i.product_id, p.name, i.status, COALESCE(p.description, ''), COALESCE(p.seo_title, ''),
+	                 COALESCE(p.meta_description, ''), p.tags, i.generated, COALESCE(i.error, ''), i.attempts,
+	                 i.prompt_tokens + i.completion_tokens, COALESCE(i.reviewed_by, ''), i.reviewed_at
+	          FROM ai_generation_items i
+	          JOIN products p ON p.id = i.product_id
+	          WHERE i.job_id = $1`
+	args := []interface{}{jobID}
+	if status != "" {
+		args = append(args, status)
+		query += " AND i.status = $2"
+	}
+	args = append(args, limit, offset)
+	query += fmt.Sprintf(" ORDER BY p.name, i.id LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*AIGenerationItem{}
+	for rows.Next() {
+		var item AIGenerationItem
+		var tags pq.StringArray
+		var generated []byte
+		var reviewedAt sql.NullTime
+		err := rows.Scan(&item.ID, &item.ProductID, &item.ProductName, &item.Status, &item.Current.Description,
+			&item.Current.SEOTitle, &item.Current.MetaDescription, &tags, &generated, &item.Error, &item.Attempts,
+			&item.TokensUsed, &item.ReviewedBy, &reviewedAt)
+		if err != nil {
+			return nil, err
+		}
+		item.Current.Tags = []string(tags)
+		if generated != nil {
+			if err := json.Unmarshal(generated, &item.Generated); err != nil {
+				return nil, err
+			}
+		}
+		if reviewedAt.Valid {
+			item.ReviewedAt = &reviewedAt.Time
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+// CancelAIJob arrête un job ; les contenus déjà générés restent à valider
+func CancelAIJob(merchantID, jobID string) error {
+	result, err := db.Exec(
+		`UPDATE ai_generation_jobs SET status = 'cancelled', lease_until = NULL, completed_at = NOW(), updated_at = NOW()
+		 WHERE id = $1 AND merchant_id = $2 AND status IN ('queued', 'running', 'paused')`,
+		jobID, merchantID,
+	)
+	return expectAIJobUpdated(result, err, merchantID, jobID)
+}
+
+// ResumeAIJob relance un job en pause (plafond atteint, fournisseur indisponible) ;
+// retryFailed remet en file les produits en échec
+func ResumeAIJob(merchantID, jobID string, retryFailed bool) error {
+	return withTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(
+			`UPDATE ai_generation_jobs SET status = 'queued', error = NULL, completed_at = NULL, updated_at = NOW()
+			 WHERE id = $1 AND merchant_id = $2 AND (status = 'paused' OR ($3 AND status = 'completed'))`,
+			jobID, merchantID, retryFailed,
+		)
+		if err := expectAIJobUpdated(result, err, merchantID, jobID); err != nil {
+			return err
+		}
+		if retryFailed {
+			_, err = tx.Exec(
+				`UPDATE ai_generation_items SET status = 'pending', attempts = 0, error = NULL, updated_at = NOW()
+				 WHERE job_id = $1 AND status = 'failed'`,
+				jobID,
+			)
+		}
+		return err
+	})
+}
+
+// expectAIJobUpdated distingue un job inexistant d'un job dans un état incompatible
+func expectAIJobUpdated(result sql.Result, err error, merchantID, jobID string) error {
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+	if _, err := GetAIJob(db, merchantID, jobID); err != nil {
+		return err
+	}
+	return errAIJobState
+}
+
+// reviewAIItem applique ou rejette le contenu généré d'un produit dans la transaction fournie
+func reviewAIItem(tx *sql.Tx, merchantID, jobID, itemID, reviewer string, accept bool, edited *AIGeneratedContent) error {
+	var productID, status, kind, language string
+	var fields pq.StringArray
+	var generated []byte
+	err := tx.QueryRow(
+		`SELECT i.product_id, i.status, j.kind, j.language, j.fields, i.generated
+		 FROM ai_generation_items i JOIN ai_generation_jobs j ON j.id = i.job_id
+		 WHERE i.id = $1 AND i.job_id = $2 AND j.merchant_id = $3
+		 FOR UPDATE OF i`,
+		itemID, jobID, merchantID,
+	).Scan(&productID, &status, &kind, &language, &fields, &generated)
+	if err == sql.ErrNoRows {
+		return errAIItemNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if !accept {
+		if status != AIItemGenerated && status != AIItemFailed {
+			return errAIItemNotAvailable
+		}
+		_, err = tx.Exec(
+			`UPDATE ai_generation_items SET status = 'rejected', reviewed_by = $2, reviewed_at = NOW(), updated_at = NOW()
+			 WHERE id = $1`,
+			itemID, reviewer,
+		)
+		return err
+	}
+
+	if status != AIItemGenerated || generated == nil {
+		return errAIItemNotAvailable
+	}
+	var content AIGeneratedContent
+	if err := json.Unmarshal(generated, &content); err != nil {
+		return err
+	}
+	if edited != nil {
+		// Les corrections du relecteur remplacent le texte généré champ par champ
+		content.Name = firstNonEmpty(edited.Name, content.Name)
+		content.Description = firstNonEmpty(edited.Description, content.Description)
+		content.SEOTitle = firstNonEmpty(edited.SEOTitle, content.SEOTitle)
+		content.MetaDescription = firstNonEmpty(edited.MetaDescription, content.MetaDescription)
+		if len(edited.Tags) > 0 {
+			content.Tags = edited.Tags
+		}
+		for variantID, name := range edited.Variants {
+			if content.Variants == nil {
+				content.Variants = map[string]string{}
+			}
+			content.Variants[variantID] = name
+		}
+	}
+
+	if kind == AIJobKindTranslation {
+		if err := applyAITranslation(tx, productID, language, fields, &content); err != nil {
+			return err
+		}
+	} else if err := applyAIContent(tx, productID, fields, &content); err != nil {
+		return err
+	}
+
+	final, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`UPDATE ai_generation_items SET status = 'accepted', generated = $2, reviewed_by = $3, reviewed_at = NOW(), updated_at = NOW()
+		 WHERE id = $1`,
+		itemID, final, reviewer,
+	)
+	return err
+}
+
+// applyAIContent écrit le contenu généré dans les champs du produit
+func applyAIContent(tx *sql.Tx, productID string, fields []string, content *AIGeneratedContent) error {
+	update := &UpdateProductRequest{}
+	for _, field := range fields {
+		switch field {
+		case AIFieldDescription:
+			update.Description = &content.Description
+		case AIFieldSEOTitle:
+			update.SEOTitle = &content.SEOTitle
+		case AIFieldMetaDescription:
+			update.MetaDescription = &content.MetaDescription
+		case AIFieldTags:
+			update.Tags = &content.Tags
+		}
+	}
+	if _, err := updateProduct(tx, productID, update); err != nil {
+		return err
+	}
+	return enqueueSearchOutbox(tx, productID, OutboxOpIndex)
+}
+
+// ReviewAIItem valide (le contenu est appliqué au produit) ou rejette un produit d'un job
+func ReviewAIItem(merchantID, jobID, itemID, reviewer string, accept bool, edited *AIGeneratedContent) error {
+	err := withTx(func(tx *sql.Tx) error {
+		return reviewAIItem(tx, merchantID, jobID, itemID, reviewer, accept, edited)
+	})
+	if err == nil && accept {
+		notifySearchIndexer()
+	}
+	return err
+}
+
+// AcceptAllAIItems applique tous les contenus générés d'un job en attente de relecture
+func AcceptAllAIItems(merchantID, jobID, reviewer string) (int, error) {
+	if _, err := GetAIJob(db, merchantID, jobID); err != nil {
+		return 0, err
+	}
+
+	accepted := 0
+	err := withTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT id FROM ai_generation_items WHERE job_id = $1 AND status = 'generated' ORDER BY id`, jobID)
+		if err != nil {
+			return err
+		}
+		var itemIDs []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			itemIDs = append(itemIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, itemID := range itemIDs {
+			if err := reviewAIItem(tx, merchantID, jobID, itemID, reviewer, true, nil); err != nil {
+				return err
+			}
+			accepted++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if accepted > 0 {
+		notifySearchIndexer()
+	}
+	return accepted, nil
+}
+
+// notifyAIJobWorker réveille le worker de génération
+func notifyAIJobWorker() {
+	select {
+	case aiJobWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartAIJobWorker traite les jobs de génération en file ; chaque job traite
+// jusqu'à concurrency produits en parallèle et un seul job par marchand
+// s'exécute à la fois
+func StartAIJobWorker(interval time.Duration, concurrency int) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-aiJobWake:
+			}
+
+			for {
+				processed, err := ProcessNextAIJob(context.Background(), concurrency)
+				if err != nil {
+					log.Printf("Erreur du worker de génération AI: %v", err)
+					break
+				}
+				if !processed {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// claimAIJob réserve le plus ancien job à traiter. Un job en cours dont la
+// réservation a expiré (arrêt du worker) est repris là où il s'était arrêté.
+func claimAIJob() (*AIGenerationJob, error) {
+	var jobID, merchantID string
+	err := db.QueryRow(`
+		UPDATE ai_generation_jobs
+		SET status = 'running', started_at = COALESCE(started_at, NOW()),
+		    lease_until = NOW() + $1 * INTERVAL '1 second', updated_at = NOW()
+		WHERE id = (
+			SELECT j.id FROM ai_generation_jobs j
+			WHERE j.status IN ('queued', 'running')
+			  AND (j.lease_until IS NULL OR j.lease_until < NOW())
+			  AND NOT EXISTS (
+				SELECT 1 FROM ai_generation_jobs o
+				WHERE o.merchant_id = j.merchant_id AND o.id <> j.id
+				  AND o.status = 'running' AND o.lease_until >= NOW()
+			  )
+			ORDER BY j.created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, merchant_id
+	`, int(aiJobLease.Seconds())).Scan(&jobID, &merchantID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetAIJob(db, merchantID, jobID)
+}
+
+// aiJobItem est un produit réservé pour génération
+type aiJobItem struct {
+	ID              string
+	ProductID       string
+	Name            string
+	Description     string
+	SEOTitle        string
+	MetaDescription string
+	Tags            []string
+	Price           float64
+	Currency        string
+	Attempts        int
+	// Variants n'est chargé que pour les jobs de traduction
+	Variants []ProductVariant
+}
+
+// ProcessNextAIJob traite un job par lots jusqu'à ce qu'il soit terminé, mis en
+// pause ou annulé. Retourne false si aucun job n'était à traiter.
+func ProcessNextAIJob(ctx context.Context, concurrency int) (bool, error) {
+	job, err := claimAIJob()
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	settings, err := aiService.GetAISettings(db, job.MerchantID)
+	if err != nil {
+		return true, err
+	}
+	settings.Language, settings.Tone = job.Language, job.Tone
+	budget, err := newAIJobBudget(job)
+	if err != nil {
+		return true, err
+	}
+
+	for {
+		// Le marchand a pu annuler le job entre deux lots
+		var status string
+		if err := db.QueryRow("SELECT status FROM ai_generation_jobs WHERE id = $1", job.ID).Scan(&status); err != nil {
+			return true, err
+		}
+		if status != AIJobRunning {
+			return true, nil
+		}
+
+		items, err := nextAIJobItems(job.ID)
+		if err != nil {
+			return true, err
+		}
+		if len(items) == 0 {
+			_, err := db.Exec(
+				`UPDATE ai_generation_jobs SET status = 'completed', completed_at = NOW(), lease_until = NULL, updated_at = NOW()
+				 WHERE id = $1 AND status = 'running'`,
+				job.ID,
+			)
+			return true, err
+		}
+
+		pauseReason, batchTokens := processAIJobBatch(ctx, job, settings, items, budget, concurrency)
+
+		_, err = db.Exec(
+			`UPDATE ai_generation_jobs SET tokens_used = tokens_used + $2,
+			     lease_until = NOW() + $3 * INTERVAL '1 second', updated_at = NOW()
+			 WHERE id = $1`,
+			job.ID, batchTokens, int(aiJobLease.Seconds()),
+		)
+		if err != nil {
+			return true, err
+		}
+
+		if pauseReason != "" {
+			_, err := db.Exec(
+				`UPDATE ai_generation_jobs SET status = 'paused', error = $2, lease_until = NULL, updated_at = NOW()
+				 WHERE id = $1 AND status = 'running'`,
+				job.ID, pauseReason,
+			)
+			log.Printf("Job de génération AI %s en pause: %s", job.ID, pauseReason)
+			return true, err
+		}
+	}
+}
+
+// nextAIJobItems retourne le prochain lot de produits à générer
+func nextAIJobItems(jobID string) ([]aiJobItem, error) {
+	rows, err := db.Query(`
+		SELECT i.id, i.product_id, p.name, COALESCE(p.description, ''), COALESCE(p.seo_title, ''),
+		       COALESCE(p.meta_description, ''), p.tags, p.price, p.currency, i.attempts
+		FROM ai_generation_items i
+		JOIN products p ON p.id = i.product_id
+		WHERE i.job_id = $1 AND i.status = 'pending'
+		ORDER BY i.attempts, i.id
+		LIMIT $2
+	`, jobID, aiJobBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []aiJobItem
+	for rows.Next() {
+		var item aiJobItem
+		var tags pq.StringArray
+		err := rows.Scan(&item.ID, &item.ProductID, &item.Name, &item.Description, &item.SEOTitle, &item.MetaDescription,
+			&tags, &item.Price, &item.Currency, &item.Attempts)
+		if err != nil {
+			return nil, err
+		}
+		item.Tags = []string(tags)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// aiJobBudget suit la consommation d'un job et les tokens réservés par ses
+// générations en cours, pour ne lancer une génération que si le budget restant
+// la couvre
+type aiJobBudget struct {
+	limit    *int
+	used     int
+	reserved int
+	// estimate est la plus forte consommation observée pour un produit (0 : inconnue)
+	estimate int
+}
+
+// newAIJobBudget reprend la consommation du job ; l'estimation part de la plus
+// forte consommation par tentative de ses produits déjà générés
+func newAIJobBudget(job *AIGenerationJob) (*aiJobBudget, error) {
+	budget := &aiJobBudget{limit: job.TokenBudget, used: job.TokensUsed}
+	if budget.limit == nil {
+		return budget, nil
+	}
+	err := db.QueryRow(
+		`SELECT COALESCE(MAX((prompt_tokens + completion_tokens) / attempts), 0)
+		 FROM ai_generation_items WHERE job_id = $1 AND attempts > 0`,
+		job.ID,
+	).Scan(&budget.estimate)
+	return budget, err
+}
+
+// reserve réserve les tokens d'une génération : l'estimation, ou tout le budget
+// restant tant qu'aucune consommation n'a été observée (une seule génération à
+// la fois). Retourne wait si les réservations en cours empêchent de la lancer
+// et exhausted si le budget restant ne la couvre pas.
+func (b *aiJobBudget) reserve() (amount int, wait, exhausted bool) {
+	if b.limit == nil {
+		return 0, false, false
+	}
+	remaining := *b.limit - b.used
+	amount = b.estimate
+	if amount == 0 {
+		amount = remaining
+	}
+	switch {
+	case remaining <= 0 || amount > remaining:
+		return 0, false, true
+	case b.reserved+amount > remaining:
+		return 0, true, false
+	}
+	b.reserved += amount
+	return amount, false, false
+}
+
+// settle remplace la réservation d'une génération terminée par sa consommation réelle
+func (b *aiJobBudget) settle(amount, tokens int) {
+	b.reserved -= amount
+	b.used += tokens
+	if tokens > b.estimate {
+		b.estimate = tokens
+	}
+}
+
+// processAIJobBatch génère un lot de produits en parallèle. Chaque génération
+// réserve sa consommation estimée sur le budget du job avant d'être lancée : le
+// budget n'est dépassé que si une génération consomme plus que la plus coûteuse
+// observée jusque-là. Retourne le motif de mise en pause (budget du job, plafond
+// mensuel, fournisseur indisponible) et les tokens consommés.
+func processAIJobBatch(ctx context.Context, job *AIGenerationJob, settings *AISettings, items []aiJobItem, budget *aiJobBudget, concurrency int) (string, int) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var pauseReason string
+	batchTokens := 0
+	sem := make(chan struct{}, concurrency)
+
+	for _, item := range items {
+		var reservation int
+		mu.Lock()
+		for pauseReason == "" {
+			var wait, exhausted bool
+			reservation, wait, exhausted = budget.reserve()
+			if exhausted {
+				pauseReason = "Budget de tokens du job atteint"
+			}
+			if !wait {
+				break
+			}
+			// Attendre que les générations en cours libèrent leur réservation
+			mu.Unlock()
+			wg.Wait()
+			mu.Lock()
+		}
+		stop := pauseReason != ""
+		mu.Unlock()
+		if stop {
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(item aiJobItem, reservation int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			tokens, err := generateAIJobItem(ctx, job, settings, &item)
+
+			mu.Lock()
+			defer mu.Unlock()
+			batchTokens += tokens
+			budget.settle(reservation, tokens)
+			switch {
+			case err == errAIQuotaExceeded:
+				pauseReason = "Plafond mensuel de tokens atteint"
+			case err == errLLMNotConfigured:
+				pauseReason = "Aucun fournisseur AI n'est configuré"
+			case err != nil:
+				log.Printf("Génération AI du produit %s (job %s) en échec: %v", item.ProductID, job.ID, err)
+			}
+		}(item, reservation)
+	}
+
+	wg.Wait()
+	return pauseReason, batchTokens
+}
+
+// generateAIJobItem génère et enregistre le contenu d'un produit. Les erreurs
+// de génération sont consignées sur le produit, retenté jusqu'à aiItemMaxAttempts fois ;
+// les erreurs de plafond et de configuration le laissent en attente.
+func generateAIJobItem(ctx context.Context, job *AIGenerationJob, settings *AISettings, item *aiJobItem) (int, error) {
+	fields := job.Fields
+	var generated *GeneratedText
+	var err error
+	if job.Kind == AIJobKindTranslation {
+		// Seuls les champs renseignés dans la langue par défaut sont traduits
+		fields = translatableFields(job.Fields, item)
+		if item.Variants, err = GetProductVariants(db, item.ProductID); err == nil {
+			generated, err = aiService.TranslateProductContent(ctx, job.MerchantID, settings, fields, item)
+		}
+	} else {
+		generated, err = aiService.GenerateProductContent(ctx, job.MerchantID, settings, fields, item)
+	}
+	if err == errAIQuotaExceeded || err == errLLMNotConfigured {
+		return 0, err
+	}
+
+	tokens := 0
+	if generated != nil {
+		tokens = generated.Usage.PromptTokens + generated.Usage.CompletionTokens
+	}
+
+	var content *AIGeneratedContent
+	if err == nil {
+		content, err = parseAIGeneratedContent(generated.Text, fields)
+	}
+	if err == nil && job.Kind == AIJobKindTranslation {
+		content.Variants = translatedVariantNames(content.Variants, item.Variants)
+	}
+	if err != nil {
+		status := AIItemPending
+		if item.Attempts+1 >= aiItemMaxAttempts {
+			status = AIItemFailed
+		}
+		var usage TokenUsage
+		if generated != nil {
+			usage = generated.Usage
+		}
+		_, dbErr := db.Exec(
+			`UPDATE ai_generation_items SET status = $2, attempts = attempts + 1, error = $3,
+			     prompt_tokens = prompt_tokens + $4, completion_tokens = completion_tokens + $5, updated_at = NOW()
+			 WHERE id = $1`,
+			item.ID, status, err.Error(), usage.PromptTokens, usage.CompletionTokens,
+		)
+		if dbErr != nil {
+			return tokens, dbErr
+		}
+		return tokens, err
+	}
+
+	payload, err := json.Marshal(content)
+	if err != nil {
+		return tokens, err
+	}
+	_, err = db.Exec(
+		`UPDATE ai_generation_items SET status = 'generated', generated = $2, attempts = attempts + 1, error = NULL,
+		     prompt_tokens = prompt_tokens + $3, completion_tokens = completion_tokens + $4, updated_at = NOW()
+		 WHERE id = $1`,
+		item.ID, payload, generated.Usage.PromptTokens, generated.Usage.CompletionTokens,
+	)
+	return tokens, err
+}
+
+// GenerateProductContent génère les champs demandés d'un produit sous forme d'objet JSON
+func (ai *AIService) GenerateProductContent(ctx context.Context, merchantID string, settings *AISettings, fields []string, item *aiJobItem) (*GeneratedText, error) {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Produit: %s\n", item.Name)
+	if item.Description != "" {
+		fmt.Fprintf(&prompt, "Description actuelle: %s\n", item.Description)
+	}
+	if len(item.Tags) > 0 {
+		fmt.Fprintf(&prompt, "Tags actuels: %s\n", strings.Join(item.Tags, ", "))
+	}
+	fmt.Fprintf(&prompt, "Prix: %.2f %s\n\n", item.Price, item.Currency)
+	fmt.Fprintf(&prompt, "Rédige en %s, sur un ton %s, un objet JSON contenant uniquement les clés suivantes:\n",
+		aiLanguages[settings.Language], aiTones[settings.Tone])
+	for _, field := range fields {
+		fmt.Fprintf(&prompt, "- %s: %s\n", field, aiFieldInstructions[field])
+	}
+
+	return ai.generate(ctx, merchantID, AIFeatureBulkGeneration, settings, &CompletionRequest{
+		System:      "Tu es un expert en rédaction e-commerce et SEO. Tu réponds uniquement par un objet JSON valide.",
+		Prompt:      prompt.String(),
+		MaxTokens:   800,
+		Temperature: 0.7,
+		JSON:        true,
+	})
+}
+
+// parseAIGeneratedContent extrait l'objet JSON de la réponse (éventuellement
+// entourée de texte ou d'un bloc de code) et ne garde que les champs demandés
+func parseAIGeneratedContent(text string, fields []string) (*AIGeneratedContent, error) {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("réponse sans objet JSON")
+	}
+
+	var raw AIGeneratedContent
+	if err := json.Unmarshal([]byte(text[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("réponse JSON invalide: %v", err)
+	}
+
+	content := &AIGeneratedContent{Variants: raw.Variants}
+	for _, field := range fields {
+		switch field {
+		case AIFieldName:
+			content.Name = truncateRunes(strings.TrimSpace(raw.Name), 255)
+		case AIFieldDescription:
+			content.Description = strings.TrimSpace(raw.Description)
+		case AIFieldSEOTitle:
+			content.SEOTitle = truncateRunes(strings.TrimSpace(raw.SEOTitle), maxSEOTitleLength)
+		case AIFieldMetaDescription:
+			content.MetaDescription = truncateRunes(strings.TrimSpace(raw.MetaDescription), maxMetaDescriptionLength)
+		case AIFieldTags:
+			content.Tags = normalizeGeneratedTags(raw.Tags)
+		}
+	}
+
+	for _, field := range fields {
+		missing := (field == AIFieldName && content.Name == "") ||
+			(field == AIFieldDescription && content.Description == "") ||
+			(field == AIFieldSEOTitle && content.SEOTitle == "") ||
+			(field == AIFieldMetaDescription && content.MetaDescription == "") ||
+			(field == AIFieldTags && len(content.Tags) == 0)
+		if missing {
+			return nil, fmt.Errorf("champ %s absent de la réponse", field)
+		}
+	}
+	return content, nil
+}
+
+// normalizeGeneratedTags nettoie, dédoublonne et limite les tags générés
+func normalizeGeneratedTags(tags []string) []string {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, truncateRunes(tag, 50))
+		if len(normalized) == maxGeneratedTags {
+			break
+		}
+	}
+	return normalized
+}
+
+// truncateRunes coupe une chaîne à max caractères
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return strings.TrimSpace(string([]rune(s)[:max]))
+}
+
+func respondAIJobError(c *gin.Context, err error, message string) {
+	switch err {
+	case errAIJobNotFound, errAIItemNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errAIJobEmpty, errAIJobTooLarge:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errAIJobState, errAIItemNotAvailable:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// handleCreateAIJob crée un job de génération en masse (traité en arrière-plan)
+func handleCreateAIJob(c *gin.Context) {
+	var req CreateAIJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errs := validateAIJobRequest(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	job, err := CreateAIJob(c.GetHeader("X-Merchant-ID"), storefrontAuthor(c), &req)
+	if err != nil {
+		respondAIJobError(c, err, "Erreur lors de la création du job de génération")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// handleListAIJobs retourne les jobs de génération du marchand
+func handleListAIJobs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	jobs, err := ListAIJobs(c.GetHeader("X-Merchant-ID"), limit, offset)
+	if err != nil {
+		respondAIJobError(c, err, "Erreur lors de la récupération des jobs de génération")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+// handleGetAIJob retourne un job et son avancement
+func handleGetAIJob(c *gin.Context) {
+	job, err := GetAIJob(db, c.GetHeader("X-Merchant-ID"), c.Param("id"))
+	if err != nil {
+		respondAIJobError(c, err, "Erreur lors de la récupération du job de génération")
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// handleListAIJobItems retourne les produits d'un job pour relecture (?status=generated)
+func handleListAIJobItems(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	items, err := ListAIJobItems(c.GetHeader("X-Merchant-ID"), c.Param("id"), c.Query("status"), limit, offset)
+	if err != nil {
+		respondAIJobError(c, err, "Erreur lors de la récupération des produits du job")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handleCancelAIJob annule un job
+func handleCancelAIJob(c *gin.Context) {
+	if err := CancelAIJob(c.GetHeader("X-Merchant-ID"), c.Param("id")); err != nil {
+		respondAIJobError(c, err, "Erreur lors de l'annulation du job")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Job annulé"})
+}
+
+// handleResumeAIJob relance un job en pause (?retry_failed=true pour retenter les échecs)
+func handleResumeAIJob(c *gin.Context) {
+	retryFailed := c.Query("retry_failed") == "true"
+	if err := ResumeAIJob(c.GetHeader("X-Merchant-ID"), c.Param("id"), retryFailed); err != nil {
+		respondAIJobError(c, err, "Erreur lors de la reprise du job")
+		return
+	}
+
+	notifyAIJobWorker()
+	c.JSON(http.StatusOK, gin.H{"message": "Job relancé"})
+}
+
+// handleAcceptAIItem applique au produit le contenu généré, éventuellement corrigé
+func handleAcceptAIItem(c *gin.Context) {
+	var edited *AIGeneratedContent
+	if c.Request.ContentLength > 0 {
+		edited = &AIGeneratedContent{}
+		if err := c.ShouldBindJSON(edited); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err := ReviewAIItem(c.GetHeader("X-Merchant-ID"), c.Param("id"), c.Param("itemId"), storefrontAuthor(c), true, edited)
+	if err != nil {
+		respondAIJobError(c, err, "Erreur lors de l'application du contenu généré")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Contenu appliqué au produit"})
+}
+
+// handleRejectAIItem écarte le contenu généré d'un produit
+func handleRejectAIItem(c *gin.Context) {
+	err := ReviewAIItem(c.GetHeader("X-Merchant-ID"), c.Param("id"), c.Param("itemId"), storefrontAuthor(c), false, nil)
+	if err != nil {
+		respondAIJobError(c, err, "Erreur lors du rejet du contenu généré")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Contenu rejeté"})
+}
+
+// handleAcceptAllAIItems applique tous les contenus générés en attente de relecture
+func handleAcceptAllAIItems(c *gin.Context) {
+	accepted, err := AcceptAllAIItems(c.GetHeader("X-Merchant-ID"), c.Param("id"), storefrontAuthor(c))
+	if err != nil {
+		respondAIJobError(c, err, "Erreur lors de l'application des contenus générés")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accepted": accepted})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAIJobBudgetReserve(t *testing.T) {
+	unlimited := &aiJobBudget{}
+	if _, wait, exhausted := unlimited.reserve(); wait || exhausted {
+		t.Fatal("un job sans budget ne doit jamais être retenu")
+	}
+
+	limit := 250
+	budget := &aiJobBudget{limit: &limit, used: 10}
+
+	// Sans consommation observée, la première génération réserve tout le reste
+	probe, wait, exhausted := budget.reserve()
+	if probe != 240 || wait || exhausted {
+		t.Fatalf("première réservation %d (wait %v, exhausted %v), attendu 240", probe, wait, exhausted)
+	}
+	if _, wait, _ := budget.reserve(); !wait {
+		t.Fatal("une génération doit attendre la fin de la première")
+	}
+	budget.settle(probe, 60)
+
+	// Ensuite chaque génération réserve la plus forte consommation observée
+	reserved := 0
+	for {
+		amount, wait, exhausted := budget.reserve()
+		if exhausted {
+			t.Fatal("le budget restant couvre encore une génération")
+		}
+		if wait {
+			break
+		}
+		if amount != 60 {
+			t.Fatalf("réservation de %d, attendu 60", amount)
+		}
+		reserved += amount
+	}
+	if reserved != 180 {
+		t.Fatalf("%d tokens réservés en parallèle, attendu 180", reserved)
+	}
+
+	for i := 0; i < 3; i++ {
+		budget.settle(60, 55)
+	}
+	if budget.used != 235 || budget.reserved != 0 {
+		t.Fatalf("consommation %d, réservé %d ; attendu 235 et 0", budget.used, budget.reserved)
+	}
+	if _, wait, exhausted := budget.reserve(); wait || !exhausted {
+		t.Error("le budget restant (15) ne couvre plus une génération (60)")
+	}
+}
+
+func TestProcessAIJobStaysWithinTokenBudget(t *testing.T) {
+	openTestDB(t)
+	previous := aiService
+	aiService = newTestAIService(&fakeLLMProvider{})
+	t.Cleanup(func() { aiService = previous })
+
+	merchantID := testMerchantID(t)
+	for i := 0; i < 30; i++ {
+		createTestProduct(t, merchantID)
+	}
+	budget := 1000
+	job, err := CreateAIJob(merchantID, "test", &CreateAIJobRequest{Fields: []string{AIFieldDescription}, TokenBudget: &budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ProcessNextAIJob(context.Background(), 8); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err = GetAIJob(db, merchantID, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generated, itemTokens, maxItemTokens int
+	if err := db.QueryRow(
+		`SELECT COUNT(*) FILTER (WHERE status = 'generated'), COALESCE(SUM(prompt_tokens + completion_tokens), 0),
+		        COALESCE(MAX(prompt_tokens + completion_tokens), 0)
+		 FROM ai_generation_items WHERE job_id = $1`,
+		job.ID,
+	).Scan(&generated, &itemTokens, &maxItemTokens); err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != AIJobPaused {
+		t.Errorf("job %s, attendu %s", job.Status, AIJobPaused)
+	}
+	if job.TokensUsed > budget {
+		t.Errorf("%d tokens consommés pour un budget de %d", job.TokensUsed, budget)
+	}
+	if generated < 2 || budget-job.TokensUsed >= maxItemTokens {
+		t.Errorf("%d produits générés pour %d tokens : le budget restant couvrait encore une génération", generated, job.TokensUsed)
+	}
+	if itemTokens != job.TokensUsed {
+		t.Errorf("tokens du job %d, somme des produits %d", job.TokensUsed, itemTokens)
+	}
+}
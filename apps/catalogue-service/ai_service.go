@@ -1,119 +1,364 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"io"
+	"log"
+	"net"
 	"net/http"
-	"os"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AIService gère les interactions avec l'API OpenAI pour générer des descriptions produits
+// Fonctionnalités dont la consommation est comptabilisée dans ai_usage
+const (
+	AIFeatureProductDescription = "product_description"
+	AIFeatureBulkGeneration     = "bulk_generation"
+	AIFeatureTranslation        = "translation"
+)
+
+var errAIQuotaExceeded = errors.New("plafond mensuel de tokens atteint")
+
+// aiLanguages associe les langues de génération proposées à leur nom dans le prompt
+var aiLanguages = map[string]string{
+	"fr": "français",
+	"en": "anglais",
+	"es": "espagnol",
+	"de": "allemand",
+	"it": "italien",
+	"pt": "portugais",
+	"nl": "néerlandais",
+}
+
+// aiTones associe les tons proposés à leur consigne dans le prompt
+var aiTones = map[string]string{
+	"persuasive":   "attrayant et persuasif",
+	"professional": "professionnel et informatif",
+	"friendly":     "chaleureux et accessible",
+	"luxury":       "raffiné et haut de gamme",
+	"playful":      "léger et ludique",
+	"technical":    "précis et technique",
+}
+
+// aiService est le service de génération partagé par les handlers
+var aiService *AIService
+
+// AIService génère les contenus produits via le fournisseur LLM choisi par le marchand
 type AIService struct {
-	APIKey  string
-	BaseURL string
-	Client  *http.Client
+	providers       map[string]LLMProvider
+	defaultProvider string
+	maxRetries      int
 }
 
-// NewAIService crée un nouveau service AI
-func NewAIService() *AIService {
-	apiKey := getEnv("OPENAI_API_KEY", "")
-	baseURL := getEnv("OPENAI_BASE_URL", "https://api.openai.com/v1")
-	
+// NewAIService crée le service AI à partir des fournisseurs configurés ; les appels
+// sont bornés par LLM_TIMEOUT et réessayés LLM_MAX_RETRIES fois
+func NewAIService() (*AIService, error) {
+	timeout, err := time.ParseDuration(getEnv("LLM_TIMEOUT", "30s"))
+	if err != nil {
+		return nil, fmt.Errorf("LLM_TIMEOUT invalide: %v", err)
+	}
+	maxRetries, err := strconv.Atoi(getEnv("LLM_MAX_RETRIES", "2"))
+	if err != nil || maxRetries < 0 {
+		return nil, fmt.Errorf("LLM_MAX_RETRIES invalide: %s", getEnv("LLM_MAX_RETRIES", "2"))
+	}
+
 	return &AIService{
-		APIKey:  apiKey,
-		BaseURL: baseURL,
-		Client:  &http.Client{},
+		providers:       newLLMProviders(&http.Client{Timeout: timeout}),
+		defaultProvider: getEnv("LLM_PROVIDER", LLMProviderOpenAI),
+		maxRetries:      maxRetries,
+	}, nil
+}
+
+// ProviderNames retourne les fournisseurs disponibles, triés
+func (ai *AIService) ProviderNames() []string {
+	names := make([]string, 0, len(ai.providers))
+	for name := range ai.providers {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
 }
 
-// GenerateProductDescription génère une description SEO optimisée pour un produit
-func (ai *AIService) GenerateProductDescription(productName string, productDetails map[string]interface{}) (string, error) {
-	if ai.APIKey == "" {
-		return "", fmt.Errorf("OPENAI_API_KEY non configuré")
+// AISettings sont les réglages de génération d'un marchand ; les champs vides
+// reprennent les valeurs par défaut du service
+type AISettings struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Language string `json:"language"`
+	Tone     string `json:"tone"`
+	// MonthlyTokenLimit plafonne les tokens consommés par mois civil (nil : illimité)
+	MonthlyTokenLimit *int `json:"monthly_token_limit"`
+}
+
+// GetAISettings retourne les réglages du marchand, complétés par les valeurs par défaut
+func (ai *AIService) GetAISettings(q queryer, merchantID string) (*AISettings, error) {
+	settings := &AISettings{}
+	var limit sql.NullInt64
+	err := q.QueryRow(
+		"SELECT provider, model, language, tone, monthly_token_limit FROM ai_settings WHERE merchant_id = $1",
+		merchantID,
+	).Scan(&settings.Provider, &settings.Model, &settings.Language, &settings.Tone, &limit)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if limit.Valid {
+		value := int(limit.Int64)
+		settings.MonthlyTokenLimit = &value
 	}
 
-	// Construire le prompt
+	if _, ok := ai.providers[settings.Provider]; !ok {
+		// Fournisseur absent ou retiré de la configuration : son modèle ne s'applique plus
+		settings.Provider, settings.Model = ai.defaultProvider, ""
+	}
+	if provider, ok := ai.providers[settings.Provider]; ok && settings.Model == "" {
+		settings.Model = provider.DefaultModel()
+	}
+	if settings.Language == "" {
+		settings.Language = "fr"
+	}
+	if settings.Tone == "" {
+		settings.Tone = "persuasive"
+	}
+	return settings, nil
+}
+
+// validateAISettings vérifie les réglages soumis par le marchand
+func (ai *AIService) validateAISettings(settings *AISettings) ValidationErrors {
+	var errs ValidationErrors
+	if _, ok := ai.providers[settings.Provider]; settings.Provider != "" && !ok {
+		errs = append(errs, FieldError{Field: "provider", Message: "Fournisseur non disponible"})
+	}
+	if len(settings.Model) > 100 {
+		errs = append(errs, FieldError{Field: "model", Message: "100 caractères maximum"})
+	}
+	if _, ok := aiLanguages[settings.Language]; settings.Language != "" && !ok {
+		errs = append(errs, FieldError{Field: "language", Message: "Langue non prise en charge"})
+	}
+	if _, ok := aiTones[settings.Tone]; settings.Tone != "" && !ok {
+		errs = append(errs, FieldError{Field: "tone", Message: "Ton non pris en charge"})
+	}
+	if settings.MonthlyTokenLimit != nil && *settings.MonthlyTokenLimit < 0 {
+		errs = append(errs, FieldError{Field: "monthly_token_limit", Message: "Doit être positif"})
+	}
+	return errs
+}
+
+// GeneratedText est un contenu généré avec le fournisseur utilisé et sa consommation
+type GeneratedText struct {
+	Text     string     `json:"text"`
+	Provider string     `json:"provider"`
+	Model    string     `json:"model"`
+	Usage    TokenUsage `json:"usage"`
+}
+
+// monthlyTokensUsed retourne les tokens consommés par le marchand depuis le début du mois
+func monthlyTokensUsed(q queryer, merchantID string) (int, error) {
+	var used int
+	err := q.QueryRow(
+		`SELECT COALESCE(SUM(prompt_tokens + completion_tokens), 0) FROM ai_usage
+		 WHERE merchant_id = $1 AND created_at >= DATE_TRUNC('month', CURRENT_TIMESTAMP)`,
+		merchantID,
+	).Scan(&used)
+	return used, err
+}
+
+// estimatedTokens estime la consommation d'un appel avant de l'exécuter :
+// environ 4 caractères par token de prompt, plus la réponse maximale
+func estimatedTokens(req *CompletionRequest) int {
+	return (len(req.System)+len(req.Prompt))/4 + req.MaxTokens
+}
+
+// reserveAIQuota vérifie le plafond mensuel du marchand et y inscrit l'estimation
+// de l'appel, sous verrou des réglages du marchand : des appels concurrents voient
+// la réservation et ne franchissent pas le plafond ensemble. Retourne la ligne de
+// consommation à régler après l'appel ("" sans plafond).
+func reserveAIQuota(merchantID, provider, model, feature string, estimate int) (string, error) {
+	var reservationID string
+	err := withTx(func(tx *sql.Tx) error {
+		var limit sql.NullInt64
+		err := tx.QueryRow(
+			"SELECT monthly_token_limit FROM ai_settings WHERE merchant_id = $1 FOR UPDATE",
+			merchantID,
+		).Scan(&limit)
+		if err == sql.ErrNoRows || (err == nil && !limit.Valid) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		used, err := monthlyTokensUsed(tx, merchantID)
+		if err != nil {
+			return err
+		}
+		if used >= int(limit.Int64) {
+			return errAIQuotaExceeded
+		}
+		return tx.QueryRow(
+			`INSERT INTO ai_usage (merchant_id, provider, model, feature, prompt_tokens)
+			 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+			merchantID, provider, model, feature, estimate,
+		).Scan(&reservationID)
+	})
+	return reservationID, err
+}
+
+// settleAIUsage remplace la réservation par la consommation réelle de l'appel
+func settleAIUsage(reservationID, merchantID, provider, model, feature string, usage TokenUsage) error {
+	if reservationID == "" {
+		return recordAIUsage(db, merchantID, provider, model, feature, usage)
+	}
+	_, err := db.Exec(
+		"UPDATE ai_usage SET model = $1, prompt_tokens = $2, completion_tokens = $3 WHERE id = $4",
+		model, usage.PromptTokens, usage.CompletionTokens, reservationID,
+	)
+	return err
+}
+
+// releaseAIQuota libère la réservation d'un appel qui n'a rien consommé
+func releaseAIQuota(reservationID string) {
+	if reservationID == "" {
+		return
+	}
+	if _, err := db.Exec("DELETE FROM ai_usage WHERE id = $1", reservationID); err != nil {
+		log.Printf("Erreur lors de la libération de la réservation AI %s: %v", reservationID, err)
+	}
+}
+
+// generate appelle le fournisseur du marchand et comptabilise la consommation.
+// Avec un plafond mensuel, l'estimation de l'appel est réservée avant l'appel
+// puis remplacée par la consommation réelle.
+func (ai *AIService) generate(ctx context.Context, merchantID, feature string, settings *AISettings, req *CompletionRequest) (*GeneratedText, error) {
+	provider, ok := ai.providers[settings.Provider]
+	if !ok {
+		return nil, errLLMNotConfigured
+	}
+	req.Model = settings.Model
+
+	var reservationID string
+	if settings.MonthlyTokenLimit != nil {
+		var err error
+		reservationID, err = reserveAIQuota(merchantID, provider.Name(), req.Model, feature, estimatedTokens(req))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := completeWithRetry(ctx, provider, req, ai.maxRetries)
+	if err != nil {
+		releaseAIQuota(reservationID)
+		return nil, err
+	}
+
+	if err := settleAIUsage(reservationID, merchantID, provider.Name(), resp.Model, feature, resp.Usage); err != nil {
+		// La génération a abouti : ne pas la perdre pour un échec de comptabilisation
+		log.Printf("Erreur lors de l'enregistrement de la consommation AI (%s): %v", merchantID, err)
+	}
+
+	return &GeneratedText{Text: resp.Text, Provider: provider.Name(), Model: resp.Model, Usage: resp.Usage}, nil
+}
+
+// GenerateProductDescription génère une description SEO optimisée pour un produit
+func (ai *AIService) GenerateProductDescription(ctx context.Context, merchantID string, settings *AISettings, productName string, productDetails map[string]interface{}) (*GeneratedText, error) {
 	prompt := fmt.Sprintf(
 		"Génère une description SEO optimisée pour le produit suivant:\n\n"+
 			"Nom: %s\n"+
 			"Détails: %v\n\n"+
 			"La description doit être:\n"+
-			"- Attrayante et persuasive\n"+
+			"- Rédigée sur un ton %s\n"+
 			"- Optimisée pour le SEO (inclure des mots-clés pertinents)\n"+
 			"- Entre 150 et 300 mots\n"+
-			"- En français\n"+
+			"- Rédigée en %s\n"+
 			"- Formatée en paragraphes courts",
-		productName, productDetails,
+		productName, productDetails, aiTones[settings.Tone], aiLanguages[settings.Language],
 	)
 
-	// Préparer la requête vers l'API OpenAI
-	requestBody := map[string]interface{}{
-		"model": "gpt-4",
-		"messages": []map[string]string{
-			{
-				"role":    "system",
-				"content": "Tu es un expert en rédaction e-commerce et SEO. Tu génères des descriptions produits optimisées.",
-			},
-			{
-				"role":    "user",
-				"content": prompt,
-			},
-		},
-		"max_tokens": 500,
-		"temperature": 0.7,
-	}
-
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", err
-	}
+	return ai.generate(ctx, merchantID, AIFeatureProductDescription, settings, &CompletionRequest{
+		System:      "Tu es un expert en rédaction e-commerce et SEO. Tu génères des descriptions produits optimisées.",
+		Prompt:      prompt,
+		MaxTokens:   500,
+		Temperature: 0.7,
+	})
+}
 
-	req, err := http.NewRequest("POST", ai.BaseURL+"/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
-	}
+// recordAIUsage comptabilise les tokens consommés par un appel
+func recordAIUsage(q queryer, merchantID, provider, model, feature string, usage TokenUsage) error {
+	_, err := q.Exec(
+		`INSERT INTO ai_usage (merchant_id, provider, model, feature, prompt_tokens, completion_tokens)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		merchantID, provider, model, feature, usage.PromptTokens, usage.CompletionTokens,
+	)
+	return err
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+ai.APIKey)
+// AIUsageSummary est la consommation agrégée par jour, fournisseur, modèle et fonctionnalité
+type AIUsageSummary struct {
+	Day              string `json:"day"`
+	Provider         string `json:"provider"`
+	Model            string `json:"model"`
+	Feature          string `json:"feature"`
+	Requests         int    `json:"requests"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+}
 
-	resp, err := ai.Client.Do(req)
+// GetAIUsage retourne la consommation du marchand sur une période
+func GetAIUsage(merchantID string, from, to time.Time) ([]AIUsageSummary, error) {
+	rows, err := db.Query(`
+		SELECT TO_CHAR(created_at, 'YYYY-MM-DD') AS day, provider, model, feature,
+		       COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0)
+		FROM ai_usage
+		WHERE merchant_id = $1 AND created_at >= $2 AND created_at < $3
+		GROUP BY day, provider, model, feature
+		ORDER BY day, provider, model, feature
+	`, merchantID, from, to)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
+	defer rows.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("erreur API OpenAI: %s", string(bodyBytes))
+	usage := []AIUsageSummary{}
+	for rows.Next() {
+		var u AIUsageSummary
+		if err := rows.Scan(&u.Day, &u.Provider, &u.Model, &u.Feature, &u.Requests, &u.PromptTokens, &u.CompletionTokens); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
 	}
-
-	var response struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", err
-	}
-
-	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("aucune réponse de l'API")
-	}
-
-	return response.Choices[0].Message.Content, nil
+	return usage, rows.Err()
 }
 
-// GenerateProductDescriptionRequest représente une demande de génération
+// GenerateProductDescriptionRequest représente une demande de génération ;
+// la langue et le ton remplacent ponctuellement les réglages du marchand
 type GenerateProductDescriptionRequest struct {
 	ProductName string                 `json:"product_name" binding:"required"`
 	Details     map[string]interface{} `json:"details,omitempty"`
+	Language    string                 `json:"language,omitempty"`
+	Tone        string                 `json:"tone,omitempty"`
+}
+
+// respondAIError traduit les erreurs de génération en réponse HTTP
+func respondAIError(c *gin.Context, err error) {
+	switch {
+	case err == errLLMNotConfigured:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Aucun fournisseur AI n'est configuré"})
+	case err == errAIQuotaExceeded:
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Plafond mensuel de tokens AI atteint"})
+	case errors.Is(err, context.DeadlineExceeded) || isTimeout(err):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Le fournisseur AI n'a pas répondu à temps"})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Erreur lors de la génération: " + err.Error()})
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
 // HandleGenerateDescription gère la requête de génération de description
@@ -130,15 +375,132 @@ func HandleGenerateDescription(c *gin.Context) {
 		return
 	}
 
-	aiService := NewAIService()
-	description, err := aiService.GenerateProductDescription(req.ProductName, req.Details)
+	settings, err := aiService.GetAISettings(db, merchantID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la génération: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des réglages AI"})
+		return
+	}
+	override := &AISettings{Language: req.Language, Tone: req.Tone}
+	if errs := aiService.validateAISettings(override); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+	settings.Language = firstNonEmpty(req.Language, settings.Language)
+	settings.Tone = firstNonEmpty(req.Tone, settings.Tone)
+
+	generated, err := aiService.GenerateProductDescription(c.Request.Context(), merchantID, settings, req.ProductName, req.Details)
+	if err != nil {
+		respondAIError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"description": generated.Text,
+		"provider":    generated.Provider,
+		"model":       generated.Model,
+		"usage":       generated.Usage,
+	})
+}
+
+// handleGetAISettings retourne les réglages AI du marchand et les options disponibles
+func handleGetAISettings(c *gin.Context) {
+	settings, err := aiService.GetAISettings(db, c.GetHeader("X-Merchant-ID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des réglages AI"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"description": description,
+		"settings":  settings,
+		"providers": aiService.ProviderNames(),
+		"languages": aiLanguages,
+		"tones":     aiTones,
 	})
 }
 
+// handleSaveAISettings enregistre les réglages AI du marchand
+func handleSaveAISettings(c *gin.Context) {
+	var settings AISettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errs := aiService.validateAISettings(&settings); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	merchantID := c.GetHeader("X-Merchant-ID")
+	_, err := db.Exec(
+		`INSERT INTO ai_settings (merchant_id, provider, model, language, tone, monthly_token_limit) VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (merchant_id) DO UPDATE SET provider = $2, model = $3, language = $4, tone = $5,
+		     monthly_token_limit = $6, updated_at = CURRENT_TIMESTAMP`,
+		merchantID, settings.Provider, settings.Model, settings.Language, settings.Tone, settings.MonthlyTokenLimit,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement des réglages AI"})
+		return
+	}
+
+	resolved, err := aiService.GetAISettings(db, merchantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des réglages AI"})
+		return
+	}
+	c.JSON(http.StatusOK, resolved)
+}
+
+// handleGetAIUsage retourne la consommation de tokens du marchand (30 derniers jours par défaut)
+func handleGetAIUsage(c *gin.Context) {
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from invalide (AAAA-MM-JJ)"})
+			return
+		}
+		from = parsed
+	}
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to invalide (AAAA-MM-JJ)"})
+			return
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+
+	merchantID := c.GetHeader("X-Merchant-ID")
+	usage, err := GetAIUsage(merchantID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération de la consommation AI"})
+		return
+	}
+	settings, err := aiService.GetAISettings(db, merchantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des réglages AI"})
+		return
+	}
+	monthToDate, err := monthlyTokensUsed(db, merchantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération de la consommation AI"})
+		return
+	}
+
+	var totals TokenUsage
+	for _, u := range usage {
+		totals.PromptTokens += u.PromptTokens
+		totals.CompletionTokens += u.CompletionTokens
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":   from.Format("2006-01-02"),
+		"to":     to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"usage":  usage,
+		"totals": totals,
+		// Consommation du mois civil en cours, comparée au plafond du marchand
+		"month_to_date":       monthToDate,
+		"monthly_token_limit": settings.MonthlyTokenLimit,
+	})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// newTestAIService crée un service AI branché sur le fournisseur indiqué
+func newTestAIService(provider LLMProvider) *AIService {
+	return &AIService{
+		providers:       map[string]LLMProvider{provider.Name(): provider},
+		defaultProvider: provider.Name(),
+		maxRetries:      2,
+	}
+}
+
+// setTestTokenLimit fixe le plafond mensuel du marchand
+func setTestTokenLimit(t *testing.T, merchantID string, limit int) {
+	t.Helper()
+	if _, err := db.Exec(
+		"INSERT INTO ai_settings (merchant_id, monthly_token_limit) VALUES ($1, $2)",
+		merchantID, limit,
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerateRecordsTokenUsage(t *testing.T) {
+	openTestDB(t)
+	ai := newTestAIService(&fakeLLMProvider{})
+	merchantID := testMerchantID(t)
+	settings, err := ai.GetAISettings(db, merchantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, name := range []string{"Lampe de bureau", "Chaise en chêne"} {
+		generated, err := ai.GenerateProductDescription(context.Background(), merchantID, settings, name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += generated.Usage.PromptTokens + generated.Usage.CompletionTokens
+	}
+
+	used, err := monthlyTokensUsed(db, merchantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total == 0 || used != total {
+		t.Errorf("%d tokens comptabilisés, attendu %d", used, total)
+	}
+	var provider, feature string
+	if err := db.QueryRow("SELECT provider, feature FROM ai_usage WHERE merchant_id = $1 LIMIT 1", merchantID).Scan(&provider, &feature); err != nil {
+		t.Fatal(err)
+	}
+	if provider != LLMProviderFake || feature != AIFeatureProductDescription {
+		t.Errorf("consommation inscrite pour %s/%s", provider, feature)
+	}
+}
+
+func TestMonthlyTokenLimitIsPerMerchant(t *testing.T) {
+	openTestDB(t)
+	provider := &flakyProvider{}
+	ai := newTestAIService(provider)
+	capped, uncapped := testMerchantID(t), testMerchantID(t)
+	setTestTokenLimit(t, capped, 1)
+
+	// La consommation du mois précédent ne compte pas dans le plafond
+	if _, err := db.Exec(
+		`INSERT INTO ai_usage (merchant_id, provider, model, feature, prompt_tokens, created_at)
+		 VALUES ($1, 'fake', 'fake-1', 'product_description', 1000, DATE_TRUNC('month', CURRENT_TIMESTAMP) - INTERVAL '1 day')`,
+		capped,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	generate := func(merchantID string) error {
+		settings, err := ai.GetAISettings(db, merchantID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ai.GenerateProductDescription(context.Background(), merchantID, settings, "Lampe", nil)
+		return err
+	}
+
+	// Le plafond est vérifié avant l'appel : le premier appel passe et le dépasse
+	if err := generate(capped); err != nil {
+		t.Fatalf("premier appel sous le plafond: %v", err)
+	}
+	if err := generate(capped); err != errAIQuotaExceeded {
+		t.Errorf("appel au-delà du plafond: erreur %v, attendu errAIQuotaExceeded", err)
+	}
+	if len(provider.calls) != 1 {
+		t.Errorf("%d appels au fournisseur, attendu 1 (le refus précède l'appel)", len(provider.calls))
+	}
+
+	// Le plafond d'un marchand ne limite pas les autres
+	for i := 0; i < 3; i++ {
+		if err := generate(uncapped); err != nil {
+			t.Fatalf("marchand sans plafond: %v", err)
+		}
+	}
+}
+
+func TestConcurrentGenerationsRespectMonthlyLimit(t *testing.T) {
+	openTestDB(t)
+	provider := &flakyProvider{}
+	ai := newTestAIService(provider)
+	merchantID := testMerchantID(t)
+	setTestTokenLimit(t, merchantID, 1)
+	settings, err := ai.GetAISettings(db, merchantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sans réservation, tous les appels verraient le plafond libre avant le
+	// premier enregistrement de consommation
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ai.GenerateProductDescription(context.Background(), merchantID, settings, "Lampe", nil)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			succeeded++
+		case errAIQuotaExceeded:
+		default:
+			t.Fatal(err)
+		}
+	}
+	if succeeded != 1 || len(provider.calls) != 1 {
+		t.Errorf("%d générations, %d appels au fournisseur, attendu 1", succeeded, len(provider.calls))
+	}
+
+	// La réservation est remplacée par la consommation réelle
+	var rows, used int
+	if err := db.QueryRow(
+		"SELECT COUNT(*), COALESCE(SUM(prompt_tokens + completion_tokens), 0) FROM ai_usage WHERE merchant_id = $1",
+		merchantID,
+	).Scan(&rows, &used); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 || used >= estimatedTokens(&CompletionRequest{MaxTokens: 500}) {
+		t.Errorf("%d lignes pour %d tokens : la réservation n'a pas été réglée", rows, used)
+	}
+}
+
+func TestFailedGenerationReleasesReservation(t *testing.T) {
+	openTestDB(t)
+	provider := &flakyProvider{errs: []error{&llmProviderError{Provider: "test", Status: http.StatusBadRequest}}}
+	ai := newTestAIService(provider)
+	merchantID := testMerchantID(t)
+	setTestTokenLimit(t, merchantID, 1)
+	settings, err := ai.GetAISettings(db, merchantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ai.GenerateProductDescription(context.Background(), merchantID, settings, "Lampe", nil); err == nil {
+		t.Fatal("l'appel aurait dû échouer")
+	}
+	// La réservation libérée, le plafond n'est pas consommé
+	if _, err := ai.GenerateProductDescription(context.Background(), merchantID, settings, "Lampe", nil); err != nil {
+		t.Fatalf("appel après un échec: %v", err)
+	}
+}
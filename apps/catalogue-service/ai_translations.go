@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// aiTranslationFields sont les champs produit traduisibles ; le nom des
+// variantes est toujours traduit avec le produit
+var aiTranslationFields = map[string]bool{
+	AIFieldName:            true,
+	AIFieldDescription:     true,
+	AIFieldSEOTitle:        true,
+	AIFieldMetaDescription: true,
+}
+
+// CreateTranslationJobsRequest demande la traduction du catalogue dans une ou
+// plusieurs langues ; un job est créé par langue
+type CreateTranslationJobsRequest struct {
+	// Locales vaut par défaut toutes les langues proposées hors langue par défaut
+	Locales []string    `json:"locales"`
+	Filter  AIJobFilter `json:"filter"`
+	Fields  []string    `json:"fields"`
+	// Overwrite retraduit aussi les produits déjà traduits dans la langue
+	Overwrite bool `json:"overwrite"`
+	// TokenBudget plafonne les tokens consommés par chaque job
+	TokenBudget *int `json:"token_budget,omitempty"`
+}
+
+// validateTranslationJobsRequest vérifie les langues, les champs et le budget
+func validateTranslationJobsRequest(req *CreateTranslationJobsRequest, locales *MerchantLocales) ValidationErrors {
+	var errs ValidationErrors
+	if len(req.Locales) == 0 {
+		req.Locales = locales.TranslatedLocales()
+		if len(req.Locales) == 0 {
+			errs = append(errs, FieldError{Field: "locales", Message: "Aucune langue à traduire n'est proposée par la boutique"})
+		}
+	}
+	for i, locale := range req.Locales {
+		locale = normalizeLocale(locale)
+		req.Locales[i] = locale
+		switch {
+		case !locales.Supports(locale):
+			errs = append(errs, FieldError{Field: fmt.Sprintf("locales[%d]", i), Message: "Langue non proposée par la boutique"})
+		case locale == locales.DefaultLocale:
+			errs = append(errs, FieldError{Field: fmt.Sprintf("locales[%d]", i), Message: "La langue par défaut n'est pas traduite"})
+		}
+	}
+
+	if len(req.Fields) == 0 {
+		req.Fields = []string{AIFieldName, AIFieldDescription}
+	}
+	for i, field := range req.Fields {
+		if !aiTranslationFields[field] {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("fields[%d]", i), Message: "Champ non traduisible"})
+		}
+	}
+	if req.TokenBudget != nil && *req.TokenBudget <= 0 {
+		errs = append(errs, FieldError{Field: "token_budget", Message: "Doit être strictement positif"})
+	}
+	if len(req.Filter.ProductIDs) > maxAIJobProducts {
+		errs = append(errs, FieldError{Field: "filter.product_ids", Message: fmt.Sprintf("%d produits maximum", maxAIJobProducts)})
+	}
+	return errs
+}
+
+// CreateTranslationJobs crée un job de traduction par langue. Sans Overwrite,
+// seuls les produits sans traduction dans la langue sont sélectionnés ; une
+// langue déjà entièrement traduite ne crée pas de job.
+func CreateTranslationJobs(merchantID, author string, req *CreateTranslationJobsRequest) ([]*AIGenerationJob, error) {
+	settings, err := aiService.GetAISettings(db, merchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []*AIGenerationJob{}
+	for _, locale := range req.Locales {
+		filter := req.Filter
+		if !req.Overwrite {
+			filter.MissingTranslation = locale
+		}
+
+		jobID, err := insertAIJob(merchantID, author, AIJobKindTranslation, req.Fields, &filter, locale, settings.Tone, req.TokenBudget)
+		if err == errAIJobEmpty {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		job, err := GetAIJob(db, merchantID, jobID)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if len(jobs) == 0 {
+		return nil, errAIJobEmpty
+	}
+
+	notifyAIJobWorker()
+	return jobs, nil
+}
+
+// translatableFields retourne les champs du job renseignés sur le produit
+func translatableFields(fields []string, item *aiJobItem) []string {
+	source := map[string]string{
+		AIFieldName:            item.Name,
+		AIFieldDescription:     item.Description,
+		AIFieldSEOTitle:        item.SEOTitle,
+		AIFieldMetaDescription: item.MetaDescription,
+	}
+	result := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if strings.TrimSpace(source[field]) != "" {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+// translatedVariantNames ne garde que les noms traduits des variantes du produit
+func translatedVariantNames(names map[string]string, variants []ProductVariant) map[string]string {
+	result := map[string]string{}
+	for _, v := range variants {
+		if name := truncateRunes(strings.TrimSpace(names[v.ID]), 255); name != "" {
+			result[v.ID] = name
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// TranslateProductContent traduit les champs d'un produit et le nom de ses
+// variantes depuis la langue par défaut du marchand vers la langue du job
+func (ai *AIService) TranslateProductContent(ctx context.Context, merchantID string, settings *AISettings, fields []string, item *aiJobItem) (*GeneratedText, error) {
+	locales, err := GetMerchantLocales(db, merchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	source := map[string]interface{}{}
+	for _, field := range fields {
+		switch field {
+		case AIFieldName:
+			source[field] = item.Name
+		case AIFieldDescription:
+			source[field] = item.Description
+		case AIFieldSEOTitle:
+			source[field] = item.SEOTitle
+		case AIFieldMetaDescription:
+			source[field] = item.MetaDescription
+		}
+	}
+	if len(item.Variants) > 0 {
+		variants := map[string]string{}
+		for _, v := range item.Variants {
+			variants[v.ID] = v.Name
+		}
+		source["variants"] = variants
+	}
+	payload, err := json.Marshal(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Produit: %s\n", item.Name)
+	fmt.Fprintf(&prompt, "Langue source: %s\nLangue cible: %s\n\n", aiLanguages[locales.DefaultLocale], aiLanguages[settings.Language])
+	fmt.Fprintf(&prompt, "Traduis la fiche produit suivante sur un ton %s, sans rien ajouter ni omettre.\n", aiTones[settings.Tone])
+	prompt.WriteString("Réponds par un objet JSON ayant exactement les mêmes clés ; la clé variants associe chaque identifiant au nom traduit de la variante.\n\n")
+	prompt.Write(payload)
+
+	return ai.generate(ctx, merchantID, AIFeatureTranslation, settings, &CompletionRequest{
+		System:      "Tu es un traducteur professionnel spécialisé en e-commerce. Tu réponds uniquement par un objet JSON valide.",
+		Prompt:      prompt.String(),
+		MaxTokens:   1200,
+		Temperature: 0.3,
+		JSON:        true,
+	})
+}
+
+// applyAITranslation écrit la traduction relue dans les traductions du produit
+// sans toucher aux champs traduits hors du job
+func applyAITranslation(tx *sql.Tx, productID, locale string, fields []string, content *AIGeneratedContent) error {
+	t := &ProductTranslation{}
+	err := tx.QueryRow(
+		`SELECT COALESCE(name, ''), COALESCE(description, ''), COALESCE(seo_title, ''), COALESCE(meta_description, '')
+		 FROM product_translations WHERE product_id = $1 AND locale = $2
+		 FOR UPDATE`,
+		productID, locale,
+	).Scan(&t.Name, &t.Description, &t.SEOTitle, &t.MetaDescription)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	for _, field := range fields {
+		switch field {
+		case AIFieldName:
+			t.Name = firstNonEmpty(content.Name, t.Name)
+		case AIFieldDescription:
+			t.Description = firstNonEmpty(content.Description, t.Description)
+		case AIFieldSEOTitle:
+			t.SEOTitle = firstNonEmpty(content.SEOTitle, t.SEOTitle)
+		case AIFieldMetaDescription:
+			t.MetaDescription = firstNonEmpty(content.MetaDescription, t.MetaDescription)
+		}
+	}
+
+	// Une variante supprimée depuis la génération est ignorée
+	variants, err := GetProductVariants(tx, productID)
+	if err != nil {
+		return err
+	}
+	t.Variants = translatedVariantNames(content.Variants, variants)
+
+	return saveProductTranslation(tx, productID, locale, TranslationSourceAI, t)
+}
+
+// handleCreateTranslationJobs crée les jobs de traduction des langues manquantes
+func handleCreateTranslationJobs(c *gin.Context) {
+	var req CreateTranslationJobsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	merchantID := c.GetHeader("X-Merchant-ID")
+	locales, err := GetMerchantLocales(db, merchantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors du chargement des langues"})
+		return
+	}
+	if errs := validateTranslationJobsRequest(&req, locales); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	jobs, err := CreateTranslationJobs(merchantID, storefrontAuthor(c), &req)
+	if err != nil {
+		respondAIJobError(c, err, "Erreur lors de la création des jobs de traduction")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"jobs": jobs})
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBulkOperations limite le nombre d'opérations par requête bulk
+const maxBulkOperations = 5000
+
+// Modes d'exécution d'une requête bulk
+const (
+	BulkModeAtomic  = "atomic"  // tout ou rien
+	BulkModePartial = "partial" // chaque opération est appliquée indépendamment
+)
+
+var (
+	errBulkProductNotFound = errors.New("produit introuvable")
+	errBulkForbidden       = errors.New("accès non autorisé")
+)
+
+// BulkProductOperation représente une opération unitaire sur un produit
+type BulkProductOperation struct {
+	Action    string                `json:"action" binding:"required,oneof=create update delete status"`
+	ProductID string                `json:"product_id,omitempty"`
+	Create    *CreateProductRequest `json:"create,omitempty"`
+	Update    *UpdateProductRequest `json:"update,omitempty"`
+	Status    string                `json:"status,omitempty"`
+}
+
+// BulkProductRequest représente une demande d'opérations en masse
+type BulkProductRequest struct {
+	Mode       string                 `json:"mode"`
+	Operations []BulkProductOperation `json:"operations" binding:"required,min=1,dive"`
+}
+
+// BulkItemResult représente le résultat d'une opération bulk
+type BulkItemResult struct {
+	Index     int    `json:"index"`
+	Action    string `json:"action"`
+	ProductID string `json:"product_id,omitempty"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BulkProductResponse représente le rapport d'exécution d'une requête bulk
+type BulkProductResponse struct {
+	Mode      string           `json:"mode"`
+	Committed bool             `json:"committed"`
+	Total     int              `json:"total"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+// handleBulkProducts applique des créations, mises à jour, suppressions et
+// changements de statut en une seule transaction
+func handleBulkProducts(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	var req BulkProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = BulkModeAtomic
+	}
+	if req.Mode != BulkModeAtomic && req.Mode != BulkModePartial {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode invalide (atomic ou partial)"})
+		return
+	}
+
+	if len(req.Operations) > maxBulkOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("maximum %d opérations par requête", maxBulkOperations)})
+		return
+	}
+
+	report, err := ApplyBulkProductOperations(merchantID, &req)
+	if err != nil {
+		log.Printf("Erreur lors de l'opération bulk: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'opération bulk"})
+		return
+	}
+
+	// Le worker d'indexation regroupe les entrées de l'outbox en appels _bulk
+	if report.Committed {
+		notifySearchIndexer()
+	}
+
+	status := http.StatusOK
+	if !report.Committed {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, report)
+}
+
+// ApplyBulkProductOperations exécute les opérations dans une transaction.
+// En mode atomic, la première erreur annule l'ensemble ; en mode partial,
+// chaque opération est isolée par un savepoint.
+func ApplyBulkProductOperations(merchantID string, req *BulkProductRequest) (*BulkProductResponse, error) {
+	report := &BulkProductResponse{
+		Mode:    req.Mode,
+		Total:   len(req.Operations),
+		Results: make([]BulkItemResult, 0, len(req.Operations)),
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for i, op := range req.Operations {
+		result := BulkItemResult{Index: i, Action: op.Action, ProductID: op.ProductID}
+
+		if req.Mode == BulkModePartial {
+			if _, err := tx.Exec("SAVEPOINT bulk_item"); err != nil {
+				return nil, err
+			}
+		}
+
+		productID, opErr := applyBulkProductOperation(tx, merchantID, &op)
+		if opErr != nil {
+			result.Error = opErr.Error()
+			report.Failed++
+			report.Results = append(report.Results, result)
+
+			if req.Mode == BulkModeAtomic {
+				// La transaction est annulée : les opérations déjà appliquées
+				// sont marquées annulées et les suivantes ne sont pas tentées
+				for j := range report.Results[:len(report.Results)-1] {
+					report.Results[j].Success = false
+					report.Results[j].Error = "annulé (transaction atomique)"
+				}
+				report.Succeeded = 0
+				report.Failed = len(report.Results)
+				return report, nil
+			}
+			if _, err := tx.Exec("ROLLBACK TO SAVEPOINT bulk_item"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if req.Mode == BulkModePartial {
+			if _, err := tx.Exec("RELEASE SAVEPOINT bulk_item"); err != nil {
+				return nil, err
+			}
+		}
+
+		result.Success = true
+		result.ProductID = productID
+		report.Succeeded++
+		report.Results = append(report.Results, result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	report.Committed = true
+
+	return report, nil
+}
+
+// applyBulkProductOperation applique une opération, l'inscrit dans l'outbox
+// d'indexation et retourne l'ID du produit concerné
+func applyBulkProductOperation(tx *sql.Tx, merchantID string, op *BulkProductOperation) (string, error) {
+	if op.Action == "create" {
+		if op.Create == nil {
+			return "", errors.New("champ create requis")
+		}
+		if op.Create.Name == "" || op.Create.SKU == "" || op.Create.Currency == "" {
+			return "", errors.New("name, sku et currency requis")
+		}
+		product, err := createProduct(tx, merchantID, op.Create)
+		if err != nil {
+			return "", err
+		}
+		if err := syncProductCollections(tx, product.ID); err != nil {
+			return "", err
+		}
+		return product.ID, enqueueSearchOutbox(tx, product.ID, OutboxOpIndex)
+	}
+
+	if op.ProductID == "" {
+		return "", errors.New("product_id requis")
+	}
+	if err := lockProductForMerchant(tx, op.ProductID, merchantID); err != nil {
+		return "", err
+	}
+
+	switch op.Action {
+	case "update":
+		if op.Update == nil {
+			return "", errors.New("champ update requis")
+		}
+		if op.Update.Status != nil && !isValidProductStatus(*op.Update.Status) {
+			return "", errors.New("statut invalide")
+		}
+		if _, err := updateProduct(tx, op.ProductID, op.Update); err != nil {
+			return "", err
+		}
+		if err := syncProductCollections(tx, op.ProductID); err != nil {
+			return "", err
+		}
+		return op.ProductID, enqueueSearchOutbox(tx, op.ProductID, OutboxOpIndex)
+
+	case "status":
+		if !isValidProductStatus(op.Status) {
+			return "", errors.New("statut invalide")
+		}
+		if _, err := updateProduct(tx, op.ProductID, &UpdateProductRequest{Status: &op.Status}); err != nil {
+			return "", err
+		}
+		if err := syncProductCollections(tx, op.ProductID); err != nil {
+			return "", err
+		}
+		return op.ProductID, enqueueSearchOutbox(tx, op.ProductID, OutboxOpIndex)
+
+	case "delete":
+		if err := deleteProduct(tx, op.ProductID); err != nil {
+			return "", err
+		}
+		return op.ProductID, enqueueSearchOutbox(tx, op.ProductID, OutboxOpDelete)
+	}
+
+	return "", fmt.Errorf("action inconnue: %s", op.Action)
+}
+
+// lockProductForMerchant verrouille le produit et vérifie qu'il appartient au marchand
+func lockProductForMerchant(tx *sql.Tx, productID, merchantID string) error {
+	var ownerID string
+	err := tx.QueryRow("SELECT merchant_id FROM products WHERE id = $1 FOR UPDATE", productID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return errBulkProductNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if ownerID != merchantID {
+		return errBulkForbidden
+	}
+	return nil
+}
+
+// isValidProductStatus vérifie qu'un statut produit est reconnu
+func isValidProductStatus(status string) bool {
+	return status == "active" || status == "inactive" || status == "draft"
+}
@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestBulkStatusSyncsSmartCollections(t *testing.T) {
+	openTestDB(t)
+	merchantID := testMerchantID(t)
+
+	col, err := SaveCollection(merchantID, "", &CollectionRequest{
+		Handle:    "soldes",
+		Title:     "Soldes",
+		Type:      CollectionTypeSmart,
+		SortOrder: "newest",
+		Rules:     []CollectionRule{{Type: RuleTagContains, Value: "soldes"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Produit créé hors de l'API, pas encore rattaché à la collection
+	productID, _ := createTestProduct(t, merchantID)
+	if _, err := db.Exec("UPDATE products SET tags = ARRAY['soldes'] WHERE id = $1", productID); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := ApplyBulkProductOperations(merchantID, &BulkProductRequest{
+		Mode:       BulkModeAtomic,
+		Operations: []BulkProductOperation{{Action: "status", ProductID: productID, Status: "active"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Committed {
+		t.Fatalf("opérations non validées: %+v", report.Results)
+	}
+
+	var member bool
+	if err := db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM collection_products WHERE collection_id = $1 AND product_id = $2)",
+		col.ID, productID,
+	).Scan(&member); err != nil {
+		t.Fatal(err)
+	}
+	if !member {
+		t.Error("le changement de statut en masse n'a pas réévalué les collections smart")
+	}
+}
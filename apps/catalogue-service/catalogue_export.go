@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// exportFlushEvery définit la fréquence de flush des réponses en streaming
+const exportFlushEvery = 100
+
+// ExportProduct représente un produit complet pour l'export (variantes, stock, catégorie)
+type ExportProduct struct {
+	ID           string          `json:"id"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description"`
+	SKU          string          `json:"sku"`
+	Price        float64         `json:"price"`
+	Currency     string          `json:"currency"`
+	Status       string          `json:"status"`
+	CategoryName string          `json:"category,omitempty"`
+	CategorySlug string          `json:"category_slug,omitempty"`
+	Images       []string        `json:"images"`
+	Tags         []string        `json:"tags"`
+	Quantity     int             `json:"quantity"`
+	Available    int             `json:"available"`
+	Variants     []ExportVariant `json:"variants"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// ExportVariant représente une variante exportée avec son stock
+type ExportVariant struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	SKU       string   `json:"sku"`
+	Price     *float64 `json:"price"`
+	Quantity  int      `json:"quantity"`
+	Available int      `json:"available"`
+}
+
+// exportCSVHeader liste les colonnes de l'export CSV (une ligne par variante)
+var exportCSVHeader = []string{
+	"product_id", "variant_id", "sku", "name", "variant_name", "description",
+	"price", "currency", "status", "category", "category_slug",
+	"tags", "images", "quantity", "available",
+}
+
+// forEachExportProduct parcourt les produits d'un marchand ligne par ligne,
+// sans charger le catalogue entier en mémoire
+func forEachExportProduct(merchantID string, fn func(*ExportProduct) error) error {
+	rows, err := db.Query(
+		`SELECT p.id, p.name, COALESCE(p.description, ''), p.sku, p.price, p.currency, p.status,
+		        COALESCE(c.name, ''), COALESCE(c.slug, ''), p.images, p.tags,
+		        COALESCE(i.quantity, 0), COALESCE(i.available, 0),
+		        COALESCE((
+		            SELECT json_agg(json_build_object(
+		                'id', v.id, 'name', v.name, 'sku', v.sku, 'price', v.price,
+		                'quantity', COALESCE(vi.quantity, 0),
+		                'available', COALESCE(vi.quantity - vi.reserved, 0)
+		            ) ORDER BY v.created_at)
+		            FROM product_variants v
+		            LEFT JOIN inventory vi ON vi.product_id = v.product_id AND vi.variant_id = v.id
+		            WHERE v.product_id = p.id
+		        ), '[]'),
+		        p.created_at, p.updated_at
+		 FROM products p
+		 LEFT JOIN categories c ON c.id = p.category_id
+		 LEFT JOIN (
+		     SELECT product_id, SUM(quantity) AS quantity, SUM(GREATEST(quantity - reserved, 0)) AS available
+		     FROM inventory GROUP BY product_id
+		 ) i ON i.product_id = p.id
+		 WHERE p.merchant_id = $1
+		 ORDER BY p.created_at`,
+		merchantID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p ExportProduct
+		var imagesArray pq.StringArray
+		var tagsArray pq.StringArray
+		var variantsJSON []byte
+
+		err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.SKU, &p.Price, &p.Currency, &p.Status,
+			&p.CategoryName, &p.CategorySlug, &imagesArray, &tagsArray,
+			&p.Quantity, &p.Available, &variantsJSON, &p.CreatedAt, &p.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		p.Images = []string(imagesArray)
+		p.Tags = []string(tagsArray)
+		if err := json.Unmarshal(variantsJSON, &p.Variants); err != nil {
+			return err
+		}
+
+		if err := fn(&p); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// handleExportProducts exporte le catalogue du marchand en CSV ou JSON (streaming)
+func handleExportProducts(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+	format := c.DefaultQuery("format", "json")
+
+	// Un gros catalogue dépasse le WriteTimeout du serveur : pas de délai d'écriture
+	extendDeadlines(c, 0, 0)
+
+	filename := "products-" + time.Now().Format("20060102")
+
+	switch format {
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", "attachment; filename=\""+filename+".csv\"")
+		c.Status(http.StatusOK)
+
+		if err := writeProductsCSV(c, merchantID); err != nil {
+			// Les en-têtes sont déjà envoyés, on ne peut que tronquer la réponse
+			log.Printf("Erreur lors de l'export CSV: %v", err)
+		}
+
+	case "json":
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Header("Content-Disposition", "attachment; filename=\""+filename+".json\"")
+		c.Status(http.StatusOK)
+
+		if err := writeProductsJSON(c, merchantID); err != nil {
+			log.Printf("Erreur lors de l'export JSON: %v", err)
+		}
+
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format invalide (csv ou json)"})
+	}
+}
+
+// extendDeadlines remplace les délais de lecture et d'écriture du serveur pour
+// une requête longue (export, transfert de fichier) ; une durée nulle supprime
+// le délai. Sans effet si la connexion ne le permet pas.
+func extendDeadlines(c *gin.Context, read, write time.Duration) {
+	deadline := func(d time.Duration) time.Time {
+		if d == 0 {
+			return time.Time{}
+		}
+		return time.Now().Add(d)
+	}
+
+	rc := http.NewResponseController(c.Writer)
+	if err := rc.SetReadDeadline(deadline(read)); err != nil {
+		log.Printf("Délai de lecture non modifiable pour %s: %v", c.Request.URL.Path, err)
+	}
+	if err := rc.SetWriteDeadline(deadline(write)); err != nil {
+		log.Printf("Délai d'écriture non modifiable pour %s: %v", c.Request.URL.Path, err)
+	}
+}
+
+// writeProductsCSV écrit le catalogue en CSV, une ligne par variante
+// (ou une ligne par produit sans variante)
+func writeProductsCSV(c *gin.Context, merchantID string) error {
+	w := csv.NewWriter(c.Writer)
+	if err := w.Write(exportCSVHeader); err != nil {
+		return err
+	}
+
+	count := 0
+	err := forEachExportProduct(merchantID, func(p *ExportProduct) error {
+		base := []string{
+			p.ID, "", p.SKU, p.Name, "", p.Description,
+			strconv.FormatFloat(p.Price, 'f', 2, 64), p.Currency, p.Status,
+			p.CategoryName, p.CategorySlug,
+			strings.Join(p.Tags, "|"), strings.Join(p.Images, "|"),
+			strconv.Itoa(p.Quantity), strconv.Itoa(p.Available),
+		}
+
+		if len(p.Variants) == 0 {
+			if err := w.Write(base); err != nil {
+				return err
+			}
+		}
+
+		for _, v := range p.Variants {
+			row := make([]string, len(base))
+			copy(row, base)
+			row[1] = v.ID
+			row[2] = v.SKU
+			row[4] = v.Name
+			if v.Price != nil {
+				row[6] = strconv.FormatFloat(*v.Price, 'f', 2, 64)
+			}
+			row[13] = strconv.Itoa(v.Quantity)
+			row[14] = strconv.Itoa(v.Available)
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+
+		count++
+		if count%exportFlushEvery == 0 {
+			w.Flush()
+			c.Writer.Flush()
+		}
+		return w.Error()
+	})
+
+	w.Flush()
+	if err != nil {
+		return err
+	}
+	return w.Error()
+}
+
+// writeProductsJSON écrit le catalogue sous forme de tableau JSON
+func writeProductsJSON(c *gin.Context, merchantID string) error {
+	if _, err := c.Writer.WriteString("["); err != nil {
+		return err
+	}
+
+	count := 0
+	err := forEachExportProduct(merchantID, func(p *ExportProduct) error {
+		if count > 0 {
+			if _, err := c.Writer.WriteString(","); err != nil {
+				return err
+			}
+		}
+
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if _, err := c.Writer.Write(data); err != nil {
+			return err
+		}
+
+		count++
+		if count%exportFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Writer.WriteString("]")
+	return err
+}
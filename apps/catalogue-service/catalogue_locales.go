@@ -0,0 +1,768 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// catalogueLocales associe les langues du catalogue à leur configuration plein
+// texte Postgres ; l'index Elasticsearch a un analyseur product_text_<langue> par langue
+var catalogueLocales = map[string]string{
+	"fr": "french",
+	"en": "english",
+	"de": "german",
+	"nl": "dutch",
+}
+
+// defaultCatalogueLocale est la langue des champs produit d'un marchand sans réglage
+const defaultCatalogueLocale = "fr"
+
+// Origine d'une traduction
+const (
+	TranslationSourceManual = "manual"
+	TranslationSourceAI     = "ai"
+)
+
+var (
+	errTranslationNotFound = errors.New("traduction introuvable")
+	errVariantNotFound     = errors.New("variante introuvable pour ce produit")
+	errCategoryNotFound    = errors.New("catégorie introuvable")
+)
+
+// MerchantLocales décrit les langues proposées par un marchand. Les champs des
+// produits, variantes et catégories sont rédigés dans la langue par défaut ;
+// les autres langues proviennent des tables de traduction.
+type MerchantLocales struct {
+	DefaultLocale string   `json:"default_locale"`
+	Locales       []string `json:"locales"`
+}
+
+// Supports indique si la langue est proposée par le marchand
+func (l *MerchantLocales) Supports(locale string) bool {
+	for _, value := range l.Locales {
+		if value == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// TranslatedLocales retourne les langues proposées hors langue par défaut
+func (l *MerchantLocales) TranslatedLocales() []string {
+	locales := []string{}
+	for _, value := range l.Locales {
+		if value != l.DefaultLocale {
+			locales = append(locales, value)
+		}
+	}
+	return locales
+}
+
+// GetMerchantLocales retourne les langues du marchand (langue par défaut seule sans réglage)
+func GetMerchantLocales(q queryer, merchantID string) (*MerchantLocales, error) {
+	settings := &MerchantLocales{}
+	var locales pq.StringArray
+	err := q.QueryRow(
+		"SELECT default_locale, locales FROM merchant_locales WHERE merchant_id = $1",
+		merchantID,
+	).Scan(&settings.DefaultLocale, &locales)
+	if err == sql.ErrNoRows {
+		return &MerchantLocales{DefaultLocale: defaultCatalogueLocale, Locales: []string{defaultCatalogueLocale}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	settings.Locales = []string(locales)
+	return settings, nil
+}
+
+// validateMerchantLocales vérifie les langues soumises ; la langue par défaut
+// est ajoutée à la liste si elle n'y figure pas
+func validateMerchantLocales(settings *MerchantLocales) ValidationErrors {
+	var errs ValidationErrors
+	settings.DefaultLocale = normalizeLocale(settings.DefaultLocale)
+	if _, ok := catalogueLocales[settings.DefaultLocale]; !ok {
+		errs = append(errs, FieldError{Field: "default_locale", Message: "Langue non prise en charge"})
+	}
+
+	seen := map[string]bool{settings.DefaultLocale: true}
+	locales := []string{settings.DefaultLocale}
+	for i, locale := range settings.Locales {
+		locale = normalizeLocale(locale)
+		if _, ok := catalogueLocales[locale]; !ok {
+			errs = append(errs, FieldError{Field: "locales[" + strconv.Itoa(i) + "]", Message: "Langue non prise en charge"})
+			continue
+		}
+		if !seen[locale] {
+			seen[locale] = true
+			locales = append(locales, locale)
+		}
+	}
+	settings.Locales = locales
+	return errs
+}
+
+// normalizeLocale ramène une étiquette de langue (fr-BE, de_DE, EN) à la langue du catalogue
+func normalizeLocale(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
+
+// parseAcceptLanguage retourne les langues d'un en-tête Accept-Language, par
+// préférence décroissante (q=0 exclut la langue)
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if value, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = value
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag: tag, q: q})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	result := make([]string, 0, len(tags))
+	for _, t := range tags {
+		result = append(result, t.tag)
+	}
+	return result
+}
+
+// requestLocale choisit la langue de la réponse : ?locale=, puis Accept-Language,
+// puis la langue par défaut du marchand. Seules les langues proposées par le
+// marchand sont retenues.
+func requestLocale(c *gin.Context, settings *MerchantLocales) string {
+	if locale := normalizeLocale(c.Query("locale")); settings.Supports(locale) {
+		return locale
+	}
+	for _, tag := range parseAcceptLanguage(c.GetHeader("Accept-Language")) {
+		if locale := normalizeLocale(tag); settings.Supports(locale) {
+			return locale
+		}
+	}
+	return settings.DefaultLocale
+}
+
+// negotiateLocale résout la langue de la réponse pour un marchand et
+// l'annonce dans l'en-tête Content-Language. Retourne aussi les réglages du
+// marchand ; en cas d'erreur, la langue par défaut du catalogue est utilisée.
+func negotiateLocale(c *gin.Context, merchantID string) (string, *MerchantLocales) {
+	settings, err := GetMerchantLocales(db, merchantID)
+	if err != nil {
+		log.Printf("Erreur lors du chargement des langues du marchand: %v", err)
+		settings = &MerchantLocales{DefaultLocale: defaultCatalogueLocale, Locales: []string{defaultCatalogueLocale}}
+	}
+	locale := requestLocale(c, settings)
+	c.Header("Content-Language", locale)
+	c.Header("Vary", "Accept-Language")
+	return locale, settings
+}
+
+// localizeProducts remplace les champs des produits par leur traduction dans la
+// langue demandée ; un champ non traduit garde la valeur de la langue par défaut
+func localizeProducts(q queryer, locale string, products []*Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+
+	rows, err := q.Query(
+		`SELECT product_id, COALESCE(name, ''), COALESCE(description, ''), COALESCE(seo_title, ''), COALESCE(meta_description, '')
+		 FROM product_translations WHERE product_id = ANY($1) AND locale = $2`,
+		pq.Array(ids), locale,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	translations := map[string]*ProductTranslation{}
+	for rows.Next() {
+		var productID string
+		var t ProductTranslation
+		if err := rows.Scan(&productID, &t.Name, &t.Description, &t.SEOTitle, &t.MetaDescription); err != nil {
+			return err
+		}
+		translations[productID] = &t
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, product := range products {
+		t, ok := translations[product.ID]
+		if !ok {
+			continue
+		}
+		product.Name = firstNonEmpty(t.Name, product.Name)
+		product.Description = firstNonEmpty(t.Description, product.Description)
+		product.SEOTitle = firstNonEmpty(t.SEOTitle, product.SEOTitle)
+		product.MetaDescription = firstNonEmpty(t.MetaDescription, product.MetaDescription)
+	}
+	return nil
+}
+
+// GetProductVariants retourne les variantes d'un produit, avec leur stock disponible
+func GetProductVariants(q queryer, productID string) ([]ProductVariant, error) {
+	rows, err := q.Query(
+		`SELECT v.id, v.product_id, v.name, v.sku, COALESCE(v.price, p.price),
+		        COALESCE((SELECT SUM(i.quantity - i.reserved) FROM inventory i WHERE i.variant_id = v.id), 0),
+		        v.created_at, v.updated_at, COALESCE(v.is_digital, p.is_digital), COALESCE(v.requires_shipping, p.requires_shipping)
+		 FROM product_variants v JOIN products p ON p.id = v.product_id
+		 WHERE v.product_id = $1
+		 ORDER BY v.created_at, v.name`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []ProductVariant{}
+	for rows.Next() {
+		var v ProductVariant
+		if err := rows.Scan(&v.ID, &v.ProductID, &v.Name, &v.SKU, &v.Price, &v.Stock, &v.CreatedAt, &v.UpdatedAt, &v.IsDigital, &v.RequiresShipping); err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
+
+// localizeVariants remplace le nom des variantes par leur traduction
+func localizeVariants(q queryer, locale string, variants []ProductVariant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(variants))
+	for _, v := range variants {
+		ids = append(ids, v.ID)
+	}
+
+	names, err := queryNames(q, "SELECT variant_id, name FROM variant_translations WHERE variant_id = ANY($1) AND locale = $2", pq.Array(ids), locale)
+	if err != nil {
+		return err
+	}
+	for i := range variants {
+		variants[i].Name = firstNonEmpty(names[variants[i].ID], variants[i].Name)
+	}
+	return nil
+}
+
+// categoryNames retourne le nom des catégories dans la langue demandée, à
+// défaut dans la langue par défaut
+func categoryNames(q queryer, ids []string, locale string) (map[string]string, error) {
+	return queryNames(q,
+		`SELECT c.id, COALESCE(t.name, c.name) FROM categories c
+		 LEFT JOIN category_translations t ON t.category_id = c.id AND t.locale = $2
+		 WHERE c.id = ANY($1)`,
+		pq.Array(ids), locale,
+	)
+}
+
+// queryNames exécute une requête (id, nom) et retourne les noms par identifiant
+func queryNames(q queryer, query string, args ...interface{}) (map[string]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := map[string]string{}
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+	return names, rows.Err()
+}
+
+// ProductTranslation est la traduction d'un produit et de ses variantes dans une
+// langue. Un champ vide reprend la valeur de la langue par défaut.
+type ProductTranslation struct {
+	Locale          string `json:"locale"`
+	Name            string `json:"name,omitempty"`
+	Description     string `json:"description,omitempty"`
+	SEOTitle        string `json:"seo_title,omitempty"`
+	MetaDescription string `json:"meta_description,omitempty"`
+	// Variants associe l'identifiant de chaque variante à son nom traduit
+	Variants  map[string]string `json:"variants,omitempty"`
+	Source    string            `json:"source,omitempty"`
+	UpdatedAt *time.Time        `json:"updated_at,omitempty"`
+}
+
+// ListProductTranslations retourne les traductions d'un produit, par langue
+func ListProductTranslations(q queryer, productID string) ([]*ProductTranslation, error) {
+	byLocale := map[string]*ProductTranslation{}
+	translation := func(locale string) *ProductTranslation {
+		if t, ok := byLocale[locale]; ok {
+			return t
+		}
+		t := &ProductTranslation{Locale: locale}
+		byLocale[locale] = t
+		return t
+	}
+
+	rows, err := q.Query(
+		`SELECT locale, COALESCE(name, ''), COALESCE(description, ''), COALESCE(seo_title, ''),
+		        COALESCE(meta_description, ''), source, updated_at
+		 FROM product_translations WHERE product_id = $1`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var locale string
+		var updatedAt time.Time
+		var t ProductTranslation
+		if err := rows.Scan(&locale, &t.Name, &t.Description, &t.SEOTitle, &t.MetaDescription, &t.Source, &updatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		t.Locale, t.UpdatedAt = locale, &updatedAt
+		byLocale[locale] = &t
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query(
+		`SELECT t.locale, t.variant_id, t.name FROM variant_translations t
+		 JOIN product_variants v ON v.id = t.variant_id
+		 WHERE v.product_id = $1`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var locale, variantID, name string
+		if err := rows.Scan(&locale, &variantID, &name); err != nil {
+			return nil, err
+		}
+		t := translation(locale)
+		if t.Variants == nil {
+			t.Variants = map[string]string{}
+		}
+		t.Variants[variantID] = name
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	translations := make([]*ProductTranslation, 0, len(byLocale))
+	for _, t := range byLocale {
+		translations = append(translations, t)
+	}
+	sort.Slice(translations, func(i, j int) bool { return translations[i].Locale < translations[j].Locale })
+	return translations, nil
+}
+
+// saveProductTranslation enregistre la traduction d'un produit et de ses
+// variantes dans la transaction fournie ; un nom de variante vide retire sa traduction
+func saveProductTranslation(tx *sql.Tx, productID, locale, source string, t *ProductTranslation) error {
+	_, err := tx.Exec(
+		`INSERT INTO product_translations (product_id, locale, name, description, seo_title, meta_description, source)
+		 VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7)
+		 ON CONFLICT (product_id, locale) DO UPDATE SET name = EXCLUDED.name, description = EXCLUDED.description,
+		     seo_title = EXCLUDED.seo_title, meta_description = EXCLUDED.meta_description,
+		     source = EXCLUDED.source, updated_at = CURRENT_TIMESTAMP`,
+		productID, locale, strings.TrimSpace(t.Name), strings.TrimSpace(t.Description),
+		strings.TrimSpace(t.SEOTitle), strings.TrimSpace(t.MetaDescription), source,
+	)
+	if err != nil {
+		return err
+	}
+
+	for variantID, name := range t.Variants {
+		if name = strings.TrimSpace(name); name == "" {
+			_, err = tx.Exec(
+				`DELETE FROM variant_translations t USING product_variants v
+				 WHERE t.variant_id = v.id AND v.id = $1 AND v.product_id = $2 AND t.locale = $3`,
+				variantID, productID, locale,
+			)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		result, err := tx.Exec(
+			`INSERT INTO variant_translations (variant_id, locale, name)
+			 SELECT id, $3, $4 FROM product_variants WHERE id = $1 AND product_id = $2
+			 ON CONFLICT (variant_id, locale) DO UPDATE SET name = EXCLUDED.name, updated_at = CURRENT_TIMESTAMP`,
+			variantID, productID, locale, name,
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return errVariantNotFound
+		}
+	}
+	return enqueueSearchOutbox(tx, productID, OutboxOpIndex)
+}
+
+// SaveProductTranslation enregistre une traduction saisie par le marchand
+func SaveProductTranslation(productID, locale string, t *ProductTranslation) error {
+	err := withTx(func(tx *sql.Tx) error {
+		return saveProductTranslation(tx, productID, locale, TranslationSourceManual, t)
+	})
+	if err == nil {
+		notifySearchIndexer()
+	}
+	return err
+}
+
+// DeleteProductTranslation supprime la traduction d'un produit et de ses variantes dans une langue
+func DeleteProductTranslation(productID, locale string) error {
+	deleted := int64(0)
+	err := withTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec("DELETE FROM product_translations WHERE product_id = $1 AND locale = $2", productID, locale)
+		if err != nil {
+			return err
+		}
+		deleted, _ = result.RowsAffected()
+
+		result, err = tx.Exec(
+			`DELETE FROM variant_translations t USING product_variants v
+			 WHERE t.variant_id = v.id AND v.product_id = $1 AND t.locale = $2`,
+			productID, locale,
+		)
+		if err != nil {
+			return err
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+		if deleted == 0 {
+			return errTranslationNotFound
+		}
+		return enqueueSearchOutbox(tx, productID, OutboxOpIndex)
+	})
+	if err == nil {
+		notifySearchIndexer()
+	}
+	return err
+}
+
+// CategoryTranslation est le nom d'une catégorie dans une langue
+type CategoryTranslation struct {
+	Locale string `json:"locale"`
+	Name   string `json:"name"`
+}
+
+// categoryBelongsTo vérifie que la catégorie appartient au marchand
+func categoryBelongsTo(merchantID, categoryID string) error {
+	var exists bool
+	err := db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1 AND merchant_id = $2)",
+		categoryID, merchantID,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errCategoryNotFound
+	}
+	return nil
+}
+
+// ListCategoryTranslations retourne les traductions du nom d'une catégorie
+func ListCategoryTranslations(merchantID, categoryID string) ([]CategoryTranslation, error) {
+	if err := categoryBelongsTo(merchantID, categoryID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT locale, name FROM category_translations WHERE category_id = $1 ORDER BY locale", categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []CategoryTranslation{}
+	for rows.Next() {
+		var t CategoryTranslation
+		if err := rows.Scan(&t.Locale, &t.Name); err != nil {
+			return nil, err
+		}
+		translations = append(translations, t)
+	}
+	return translations, rows.Err()
+}
+
+// SaveCategoryTranslation enregistre le nom d'une catégorie dans une langue
+func SaveCategoryTranslation(merchantID, categoryID, locale, name string) error {
+	if err := categoryBelongsTo(merchantID, categoryID); err != nil {
+		return err
+	}
+	_, err := db.Exec(
+		`INSERT INTO category_translations (category_id, locale, name) VALUES ($1, $2, $3)
+		 ON CONFLICT (category_id, locale) DO UPDATE SET name = EXCLUDED.name, updated_at = CURRENT_TIMESTAMP`,
+		categoryID, locale, name,
+	)
+	return err
+}
+
+// DeleteCategoryTranslation supprime le nom d'une catégorie dans une langue
+func DeleteCategoryTranslation(merchantID, categoryID, locale string) error {
+	if err := categoryBelongsTo(merchantID, categoryID); err != nil {
+		return err
+	}
+	result, err := db.Exec("DELETE FROM category_translations WHERE category_id = $1 AND locale = $2", categoryID, locale)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errTranslationNotFound
+	}
+	return nil
+}
+
+func respondTranslationError(c *gin.Context, err error, message string) {
+	switch err {
+	case errTranslationNotFound, errCategoryNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errVariantNotFound:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// translationLocaleParam valide la langue de l'URL : elle doit être proposée
+// par le marchand et différente de sa langue par défaut, portée par le produit
+func translationLocaleParam(c *gin.Context, merchantID string) (string, bool) {
+	settings, err := GetMerchantLocales(db, merchantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors du chargement des langues"})
+		return "", false
+	}
+
+	locale := normalizeLocale(c.Param("locale"))
+	var errs ValidationErrors
+	switch {
+	case !settings.Supports(locale):
+		errs = append(errs, FieldError{Field: "locale", Message: "Langue non proposée par la boutique"})
+	case locale == settings.DefaultLocale:
+		errs = append(errs, FieldError{Field: "locale", Message: "La langue par défaut se modifie sur le produit"})
+	}
+	if len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return "", false
+	}
+	return locale, true
+}
+
+// authorizeTranslatedProduct vérifie que le produit existe et appartient au marchand
+func authorizeTranslatedProduct(c *gin.Context) (*Product, bool) {
+	product, err := GetProductByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération du produit"})
+		return nil, false
+	}
+	if product == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Produit introuvable"})
+		return nil, false
+	}
+	if product.MerchantID != c.GetHeader("X-Merchant-ID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Accès non autorisé"})
+		return nil, false
+	}
+	return product, true
+}
+
+// handleGetLocales retourne les langues proposées par la boutique (sélecteur de langue du storefront)
+func handleGetLocales(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+	if merchantID == "" {
+		merchantID = storefrontMerchantID(c)
+	}
+	if merchantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "merchant_id requis"})
+		return
+	}
+
+	locale, settings := negotiateLocale(c, merchantID)
+	c.JSON(http.StatusOK, gin.H{
+		"default_locale": settings.DefaultLocale,
+		"locales":        settings.Locales,
+		"locale":         locale,
+	})
+}
+
+// handleSaveLocales enregistre les langues proposées par le marchand
+func handleSaveLocales(c *gin.Context) {
+	var settings MerchantLocales
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errs := validateMerchantLocales(&settings); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	_, err := db.Exec(
+		`INSERT INTO merchant_locales (merchant_id, default_locale, locales) VALUES ($1, $2, $3)
+		 ON CONFLICT (merchant_id) DO UPDATE SET default_locale = $2, locales = $3, updated_at = CURRENT_TIMESTAMP`,
+		c.GetHeader("X-Merchant-ID"), settings.DefaultLocale, pq.Array(settings.Locales),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement des langues"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// handleListProductTranslations retourne les traductions d'un produit
+func handleListProductTranslations(c *gin.Context) {
+	product, ok := authorizeTranslatedProduct(c)
+	if !ok {
+		return
+	}
+
+	translations, err := ListProductTranslations(db, product.ID)
+	if err != nil {
+		respondTranslationError(c, err, "Erreur lors de la récupération des traductions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"translations": translations})
+}
+
+// handleSaveProductTranslation enregistre la traduction d'un produit dans une langue
+func handleSaveProductTranslation(c *gin.Context) {
+	product, ok := authorizeTranslatedProduct(c)
+	if !ok {
+		return
+	}
+	locale, ok := translationLocaleParam(c, product.MerchantID)
+	if !ok {
+		return
+	}
+
+	var req ProductTranslation
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := SaveProductTranslation(product.ID, locale, &req); err != nil {
+		respondTranslationError(c, err, "Erreur lors de l'enregistrement de la traduction")
+		return
+	}
+
+	translations, err := ListProductTranslations(db, product.ID)
+	if err != nil {
+		respondTranslationError(c, err, "Erreur lors de la récupération des traductions")
+		return
+	}
+	for _, t := range translations {
+		if t.Locale == locale {
+			c.JSON(http.StatusOK, t)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"locale": locale})
+}
+
+// handleDeleteProductTranslation supprime la traduction d'un produit dans une langue
+func handleDeleteProductTranslation(c *gin.Context) {
+	product, ok := authorizeTranslatedProduct(c)
+	if !ok {
+		return
+	}
+
+	if err := DeleteProductTranslation(product.ID, normalizeLocale(c.Param("locale"))); err != nil {
+		respondTranslationError(c, err, "Erreur lors de la suppression de la traduction")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Traduction supprimée"})
+}
+
+// handleListCategoryTranslations retourne les traductions du nom d'une catégorie
+func handleListCategoryTranslations(c *gin.Context) {
+	translations, err := ListCategoryTranslations(c.GetHeader("X-Merchant-ID"), c.Param("id"))
+	if err != nil {
+		respondTranslationError(c, err, "Erreur lors de la récupération des traductions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"translations": translations})
+}
+
+// handleSaveCategoryTranslation enregistre le nom d'une catégorie dans une langue
+func handleSaveCategoryTranslation(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+	locale, ok := translationLocaleParam(c, merchantID)
+	if !ok {
+		return
+	}
+
+	var req CategoryTranslation
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Locale, req.Name = locale, strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondValidationErrors(c, ValidationErrors{{Field: "name", Message: "Nom requis"}})
+		return
+	}
+
+	if err := SaveCategoryTranslation(merchantID, c.Param("id"), locale, req.Name); err != nil {
+		respondTranslationError(c, err, "Erreur lors de l'enregistrement de la traduction")
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+// handleDeleteCategoryTranslation supprime le nom d'une catégorie dans une langue
+func handleDeleteCategoryTranslation(c *gin.Context) {
+	err := DeleteCategoryTranslation(c.GetHeader("X-Merchant-ID"), c.Param("id"), normalizeLocale(c.Param("locale")))
+	if err != nil {
+		respondTranslationError(c, err, "Erreur lors de la suppression de la traduction")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Traduction supprimée"})
+}
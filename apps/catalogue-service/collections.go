@@ -0,0 +1,629 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Types de collection
+const (
+	CollectionTypeManual = "manual" // liste ordonnée choisie par le marchand
+	CollectionTypeSmart  = "smart"  // produits respectant des règles
+)
+
+// Règles des collections smart
+const (
+	RuleTagContains  = "tag_contains"  // le produit porte le tag (sans tenir compte de la casse)
+	RulePriceBelow   = "price_below"   // prix strictement inférieur
+	RuleCategoryIn   = "category_in"   // catégorie parmi values
+	RuleCreatedAfter = "created_after" // créé après la date (AAAA-MM-JJ ou RFC 3339)
+)
+
+// collectionSortOrders associe chaque tri à sa clause ORDER BY
+var collectionSortOrders = map[string]string{
+	"manual":     "cp.position, cp.added_at",
+	"newest":     "p.created_at DESC",
+	"price_asc":  "p.price, p.created_at DESC",
+	"price_desc": "p.price DESC, p.created_at DESC",
+	"name":       "p.name, p.created_at DESC",
+}
+
+const (
+	maxCollectionRules          = 20
+	maxManualCollectionProducts = 1000
+)
+
+var (
+	errCollectionNotFound        = errors.New("collection introuvable")
+	errCollectionTypeChange      = errors.New("le type d'une collection ne peut pas être modifié")
+	errCollectionProductNotFound = errors.New("produit introuvable")
+)
+
+// CollectionRule est une règle d'une collection smart
+type CollectionRule struct {
+	Type   string   `json:"type"`
+	Value  string   `json:"value,omitempty"`  // tag, prix ou date
+	Values []string `json:"values,omitempty"` // catégories de category_in
+}
+
+// Collection regroupe des produits pour le storefront et les remises
+type Collection struct {
+	ID           string           `json:"id"`
+	MerchantID   string           `json:"merchant_id"`
+	Handle       string           `json:"handle"`
+	Title        string           `json:"title"`
+	Description  string           `json:"description,omitempty"`
+	Type         string           `json:"type"`
+	Rules        []CollectionRule `json:"rules,omitempty"`
+	Match        string           `json:"match,omitempty"`
+	SortOrder    string           `json:"sort_order"`
+	ProductCount int              `json:"product_count"` // produits actifs
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+// CollectionRequest crée ou remplace une collection. ProductIDs (collection
+// manual) remplace la liste ordonnée des produits ; absent, elle est conservée.
+type CollectionRequest struct {
+	Handle      string           `json:"handle"`
+	Title       string           `json:"title"`
+	Description string           `json:"description"`
+	Type        string           `json:"type"`
+	Rules       []CollectionRule `json:"rules"`
+	Match       string           `json:"match"`
+	SortOrder   string           `json:"sort_order"`
+	ProductIDs  []string         `json:"product_ids"`
+}
+
+const collectionColumns = `c.id, c.merchant_id, c.handle, c.title, COALESCE(c.description, ''), c.type, c.rules,
+	c.rules_match, c.sort_order, c.created_at, c.updated_at,
+	(SELECT COUNT(*) FROM collection_products cp JOIN products p ON p.id = cp.product_id
+	 WHERE cp.collection_id = c.id AND p.status = 'active')`
+
+func scanCollection(row interface{ Scan(...interface{}) error }) (*Collection, error) {
+	var col Collection
+	var rules []byte
+	err := row.Scan(&col.ID, &col.MerchantID, &col.Handle, &col.Title, &col.Description, &col.Type, &rules,
+		&col.Match, &col.SortOrder, &col.CreatedAt, &col.UpdatedAt, &col.ProductCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(rules, &col.Rules); err != nil {
+		return nil, err
+	}
+	if col.Type == CollectionTypeManual {
+		col.Rules = nil
+		col.Match = ""
+	}
+	return &col, nil
+}
+
+// validateCollectionRequest normalise la demande et vérifie handle, règles et tri
+func validateCollectionRequest(req *CollectionRequest) ValidationErrors {
+	var errs ValidationErrors
+	req.Handle = strings.TrimSpace(req.Handle)
+	req.Title = strings.TrimSpace(req.Title)
+
+	if !pageHandlePattern.MatchString(req.Handle) {
+		errs = append(errs, FieldError{"handle", "handle invalide (minuscules, chiffres et tirets)"})
+	}
+	if req.Title == "" {
+		errs = append(errs, FieldError{"title", "titre requis"})
+	}
+
+	switch req.Type {
+	case CollectionTypeManual:
+		if req.SortOrder == "" {
+			req.SortOrder = "manual"
+		}
+		if len(req.Rules) > 0 {
+			errs = append(errs, FieldError{"rules", "réservé aux collections smart"})
+		}
+		if len(req.ProductIDs) > maxManualCollectionProducts {
+			errs = append(errs, FieldError{"product_ids", fmt.Sprintf("au plus %d produits", maxManualCollectionProducts)})
+		}
+		seen := map[string]bool{}
+		for i, id := range req.ProductIDs {
+			if seen[id] {
+				errs = append(errs, FieldError{fmt.Sprintf("product_ids[%d]", i), "produit en double"})
+			}
+			seen[id] = true
+		}
+	case CollectionTypeSmart:
+		if req.SortOrder == "" {
+			req.SortOrder = "newest"
+		}
+		if req.SortOrder == "manual" {
+			errs = append(errs, FieldError{"sort_order", "tri manuel réservé aux collections manual"})
+		}
+		if req.Match == "" {
+			req.Match = "all"
+		}
+		if req.Match != "all" && req.Match != "any" {
+			errs = append(errs, FieldError{"match", "valeur invalide (all, any)"})
+		}
+		if req.ProductIDs != nil {
+			errs = append(errs, FieldError{"product_ids", "les produits d'une collection smart sont calculés par ses règles"})
+		}
+		if len(req.Rules) == 0 || len(req.Rules) > maxCollectionRules {
+			errs = append(errs, FieldError{"rules", fmt.Sprintf("entre 1 et %d règles", maxCollectionRules)})
+		}
+		for i := range req.Rules {
+			if msg := validateCollectionRule(&req.Rules[i]); msg != "" {
+				errs = append(errs, FieldError{fmt.Sprintf("rules[%d]", i), msg})
+			}
+		}
+	default:
+		errs = append(errs, FieldError{"type", "type invalide (manual, smart)"})
+	}
+
+	if _, ok := collectionSortOrders[req.SortOrder]; !ok {
+		errs = append(errs, FieldError{"sort_order", "tri invalide (manual, newest, price_asc, price_desc, name)"})
+	}
+	return errs
+}
+
+// validateCollectionRule vérifie une règle et retourne le message d'erreur éventuel
+func validateCollectionRule(rule *CollectionRule) string {
+	rule.Value = strings.TrimSpace(rule.Value)
+	switch rule.Type {
+	case RuleTagContains:
+		if rule.Value == "" {
+			return "tag requis"
+		}
+	case RulePriceBelow:
+		if price, err := strconv.ParseFloat(rule.Value, 64); err != nil || price <= 0 {
+			return "prix invalide"
+		}
+	case RuleCategoryIn:
+		if len(rule.Values) == 0 {
+			return "au moins une catégorie requise"
+		}
+	case RuleCreatedAfter:
+		if _, err := parseRuleDate(rule.Value); err != nil {
+			return "date invalide (AAAA-MM-JJ ou RFC 3339)"
+		}
+	default:
+		return "règle inconnue (tag_contains, price_below, category_in, created_after)"
+	}
+	return ""
+}
+
+func parseRuleDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// collectionCondition traduit les règles d'une collection smart en condition
+// SQL sur la table products ; les paramètres sont ajoutés à args
+func collectionCondition(rules []CollectionRule, match string, args *[]interface{}) string {
+	parts := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		switch rule.Type {
+		case RuleTagContains:
+			*args = append(*args, strings.ToLower(rule.Value))
+			parts = append(parts, fmt.Sprintf("EXISTS (SELECT 1 FROM unnest(products.tags) t WHERE lower(t) = $%d)", len(*args)))
+		case RulePriceBelow:
+			price, _ := strconv.ParseFloat(rule.Value, 64)
+			*args = append(*args, price)
+			parts = append(parts, fmt.Sprintf("products.price < $%d", len(*args)))
+		case RuleCategoryIn:
+			*args = append(*args, pq.Array(rule.Values))
+			parts = append(parts, fmt.Sprintf("products.category_id::text = ANY($%d)", len(*args)))
+		case RuleCreatedAfter:
+			date, _ := parseRuleDate(rule.Value)
+			*args = append(*args, date)
+			parts = append(parts, fmt.Sprintf("products.created_at > $%d", len(*args)))
+		}
+	}
+	if len(parts) == 0 {
+		return "FALSE"
+	}
+	joiner := " AND "
+	if match == "any" {
+		joiner = " OR "
+	}
+	return "(" + strings.Join(parts, joiner) + ")"
+}
+
+// rebuildSmartCollection recalcule tous les produits d'une collection smart,
+// après création ou modification de ses règles
+func rebuildSmartCollection(tx *sql.Tx, col *Collection) error {
+	args := []interface{}{col.ID, col.MerchantID}
+	cond := collectionCondition(col.Rules, col.Match, &args)
+
+	if _, err := tx.Exec(
+		`DELETE FROM collection_products cp
+		 WHERE cp.collection_id = $1 AND NOT EXISTS (
+			SELECT 1 FROM products WHERE products.id = cp.product_id AND products.merchant_id = $2 AND `+cond+`
+		 )`,
+		args...,
+	); err != nil {
+		return err
+	}
+	_, err := tx.Exec(
+		`INSERT INTO collection_products (collection_id, product_id)
+		 SELECT $1, products.id FROM products WHERE products.merchant_id = $2 AND `+cond+`
+		 ON CONFLICT (collection_id, product_id) DO NOTHING`,
+		args...,
+	)
+	return err
+}
+
+// syncProductCollections réévalue l'appartenance d'un produit aux collections
+// smart de son marchand ; appelée dans la transaction qui crée ou modifie le
+// produit (la suppression est propagée par la clé étrangère)
+func syncProductCollections(tx *sql.Tx, productID string) error {
+	rows, err := tx.Query(
+		`SELECT c.id, c.rules, c.rules_match FROM collections c
+		 JOIN products p ON p.merchant_id = c.merchant_id
+		 WHERE p.id = $1 AND c.type = 'smart'`,
+		productID,
+	)
+	if err != nil {
+		return err
+	}
+	var collections []Collection
+	for rows.Next() {
+		var col Collection
+		var rules []byte
+		if err := rows.Scan(&col.ID, &rules, &col.Match); err != nil {
+			rows.Close()
+			return err
+		}
+		if err := json.Unmarshal(rules, &col.Rules); err != nil {
+			rows.Close()
+			return err
+		}
+		collections = append(collections, col)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, col := range collections {
+		args := []interface{}{productID}
+		cond := collectionCondition(col.Rules, col.Match, &args)
+		var matches bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM products WHERE products.id = $1 AND "+cond+")", args...).Scan(&matches); err != nil {
+			return err
+		}
+
+		if matches {
+			_, err = tx.Exec(
+				`INSERT INTO collection_products (collection_id, product_id) VALUES ($1, $2)
+				 ON CONFLICT (collection_id, product_id) DO NOTHING`,
+				col.ID, productID,
+			)
+		} else {
+			_, err = tx.Exec("DELETE FROM collection_products WHERE collection_id = $1 AND product_id = $2", col.ID, productID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setManualCollectionProducts remplace la liste ordonnée d'une collection manual
+func setManualCollectionProducts(tx *sql.Tx, col *Collection, productIDs []string) error {
+	if _, err := tx.Exec("DELETE FROM collection_products WHERE collection_id = $1", col.ID); err != nil {
+		return err
+	}
+	if len(productIDs) == 0 {
+		return nil
+	}
+
+	result, err := tx.Exec(
+		`INSERT INTO collection_products (collection_id, product_id, position)
+		 SELECT $1, p.id, u.position
+		 FROM unnest($2::text[]) WITH ORDINALITY AS u(product_id, position)
+		 JOIN products p ON p.id::text = u.product_id AND p.merchant_id = $3`,
+		col.ID, pq.Array(productIDs), col.MerchantID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); int(n) != len(productIDs) {
+		return errCollectionProductNotFound
+	}
+	return nil
+}
+
+// getCollection retrouve une collection du marchand par identifiant ou handle
+func getCollection(q queryer, merchantID, ref string) (*Collection, error) {
+	col, err := scanCollection(q.QueryRow(
+		"SELECT "+collectionColumns+" FROM collections c WHERE c.merchant_id = $1 AND (c.id::text = $2 OR c.handle = $2)",
+		merchantID, ref,
+	))
+	if err == sql.ErrNoRows {
+		return nil, errCollectionNotFound
+	}
+	return col, err
+}
+
+// SaveCollection crée (collectionID vide) ou remplace une collection, puis
+// calcule ses produits
+func SaveCollection(merchantID, collectionID string, req *CollectionRequest) (*Collection, error) {
+	rules, err := json.Marshal(req.Rules)
+	if err != nil {
+		return nil, err
+	}
+	if req.Rules == nil {
+		rules = []byte("[]")
+	}
+	match := req.Match
+	if match == "" {
+		match = "all"
+	}
+
+	var col *Collection
+	err = withTx(func(tx *sql.Tx) error {
+		if collectionID == "" {
+			err := tx.QueryRow(
+				`INSERT INTO collections (merchant_id, handle, title, description, type, rules, rules_match, sort_order)
+				 VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8)
+				 RETURNING id`,
+				merchantID, req.Handle, req.Title, req.Description, req.Type, rules, match, req.SortOrder,
+			).Scan(&collectionID)
+			if err != nil {
+				return err
+			}
+		} else {
+			var currentType string
+			err := tx.QueryRow(
+				"SELECT type FROM collections WHERE id::text = $1 AND merchant_id = $2 FOR UPDATE",
+				collectionID, merchantID,
+			).Scan(&currentType)
+			if err == sql.ErrNoRows {
+				return errCollectionNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if currentType != req.Type {
+				return errCollectionTypeChange
+			}
+			if _, err := tx.Exec(
+				`UPDATE collections
+				 SET handle = $1, title = $2, description = NULLIF($3, ''), rules = $4, rules_match = $5,
+				     sort_order = $6, updated_at = CURRENT_TIMESTAMP
+				 WHERE id = $7`,
+				req.Handle, req.Title, req.Description, rules, match, req.SortOrder, collectionID,
+			); err != nil {
+				return err
+			}
+		}
+
+		current := &Collection{ID: collectionID, MerchantID: merchantID, Rules: req.Rules, Match: match}
+		if req.Type == CollectionTypeSmart {
+			if err := rebuildSmartCollection(tx, current); err != nil {
+				return err
+			}
+		} else if req.ProductIDs != nil {
+			if err := setManualCollectionProducts(tx, current, req.ProductIDs); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		col, err = getCollection(tx, merchantID, collectionID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return col, nil
+}
+
+// collectionMerchantID lit le marchand authentifié (X-Merchant-ID), sinon la
+// boutique consultée
+func collectionMerchantID(c *gin.Context) string {
+	if merchantID := c.GetHeader("X-Merchant-ID"); merchantID != "" {
+		return merchantID
+	}
+	return storefrontMerchantID(c)
+}
+
+// handleListCollections liste les collections du marchand
+func handleListCollections(c *gin.Context) {
+	merchantID := collectionMerchantID(c)
+	if merchantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "merchant_id requis"})
+		return
+	}
+
+	query := "SELECT " + collectionColumns + " FROM collections c WHERE c.merchant_id = $1"
+	args := []interface{}{merchantID}
+	if collectionType := c.Query("type"); collectionType != "" {
+		query += " AND c.type = $2"
+		args = append(args, collectionType)
+	}
+	rows, err := db.Query(query+" ORDER BY c.title", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des collections"})
+		return
+	}
+	defer rows.Close()
+
+	collections := []*Collection{}
+	for rows.Next() {
+		col, err := scanCollection(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des collections"})
+			return
+		}
+		collections = append(collections, col)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collections": collections})
+}
+
+// handleGetCollection retourne une collection par identifiant ou handle
+func handleGetCollection(c *gin.Context) {
+	merchantID := collectionMerchantID(c)
+	if merchantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "merchant_id requis"})
+		return
+	}
+
+	col, err := getCollection(db, merchantID, c.Param("id"))
+	if err == errCollectionNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection non trouvée"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération de la collection"})
+		return
+	}
+
+	c.JSON(http.StatusOK, col)
+}
+
+// handleListCollectionProducts liste les produits actifs d'une collection dans
+// son ordre de tri, traduits dans la langue négociée
+func handleListCollectionProducts(c *gin.Context) {
+	merchantID := collectionMerchantID(c)
+	if merchantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "merchant_id requis"})
+		return
+	}
+
+	col, err := getCollection(db, merchantID, c.Param("id"))
+	if err == errCollectionNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection non trouvée"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération de la collection"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := db.Query(
+		`SELECT p.id, p.merchant_id, p.name, p.description, p.sku, p.price, p.currency, p.category_id, p.images, p.tags,
+		        p.status, p.created_at, p.updated_at, COALESCE(p.seo_title, ''), COALESCE(p.meta_description, ''),
+		        p.rating_average, p.rating_count, p.is_digital, p.requires_shipping
+		 FROM collection_products cp
+		 JOIN products p ON p.id = cp.product_id
+		 WHERE cp.collection_id = $1 AND p.status = 'active'
+		 ORDER BY `+collectionSortOrders[col.SortOrder]+`
+		 LIMIT $2 OFFSET $3`,
+		col.ID, limit, offset,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des produits"})
+		return
+	}
+	defer rows.Close()
+
+	products := []*Product{}
+	for rows.Next() {
+		var p Product
+		var images, tags pq.StringArray
+		var categoryID sql.NullString
+		err := rows.Scan(&p.ID, &p.MerchantID, &p.Name, &p.Description, &p.SKU, &p.Price, &p.Currency, &categoryID, &images, &tags, &p.Status, &p.CreatedAt, &p.UpdatedAt, &p.SEOTitle, &p.MetaDescription, &p.RatingAverage, &p.RatingCount, &p.IsDigital, &p.RequiresShipping)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des produits"})
+			return
+		}
+		p.Images = []string(images)
+		p.Tags = []string(tags)
+		p.CategoryID = categoryID.String
+		products = append(products, &p)
+	}
+
+	locale, locales := negotiateLocale(c, merchantID)
+	if locale != locales.DefaultLocale {
+		if err := localizeProducts(db, locale, products); err != nil {
+			log.Printf("Erreur lors de la traduction des produits de la collection: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"collection": col,
+		"products":   products,
+		"total":      col.ProductCount,
+		"locale":     locale,
+	})
+}
+
+// handleSaveCollection crée une collection (POST) ou la remplace (PUT /collections/:id)
+func handleSaveCollection(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+	collectionID := c.Param("id")
+
+	var req CollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errs := validateCollectionRequest(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	col, err := SaveCollection(merchantID, collectionID, &req)
+	switch {
+	case err == errCollectionNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection non trouvée"})
+		return
+	case err == errCollectionTypeChange:
+		respondValidationErrors(c, ValidationErrors{{"type", err.Error()}})
+		return
+	case err == errCollectionProductNotFound:
+		respondValidationErrors(c, ValidationErrors{{"product_ids", "produit introuvable pour ce marchand"}})
+		return
+	case isUniqueViolation(err):
+		c.JSON(http.StatusConflict, gin.H{"error": "Une collection utilise déjà ce handle"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement de la collection"})
+		return
+	}
+
+	status := http.StatusOK
+	if collectionID == "" {
+		status = http.StatusCreated
+	}
+	c.JSON(status, col)
+}
+
+// handleDeleteCollection supprime une collection et ses associations produits
+func handleDeleteCollection(c *gin.Context) {
+	result, err := db.Exec(
+		"DELETE FROM collections WHERE id::text = $1 AND merchant_id = $2",
+		c.Param("id"), c.GetHeader("X-Merchant-ID"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la suppression de la collection"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection non trouvée"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Collection supprimée"})
+}
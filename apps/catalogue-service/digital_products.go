@@ -0,0 +1,699 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxDigitalAssetSize est la taille maximale d'un fichier téléversé
+	maxDigitalAssetSize = 512 << 20
+	// defaultDownloadLimit est le nombre de téléchargements accordés par défaut
+	defaultDownloadLimit = 5
+)
+
+var (
+	errInvalidDownloadToken = errors.New("lien de téléchargement invalide ou expiré")
+	errDownloadLimitReached = errors.New("nombre maximal de téléchargements atteint")
+	errDigitalAssetNotFound = errors.New("fichier introuvable")
+)
+
+// DigitalAsset est un fichier livré aux acheteurs d'un produit numérique
+type DigitalAsset struct {
+	ID             string    `json:"id"`
+	MerchantID     string    `json:"merchant_id"`
+	ProductID      string    `json:"product_id"`
+	VariantID      *string   `json:"variant_id,omitempty"` // nil : toutes les variantes
+	Filename       string    `json:"filename"`
+	ContentType    string    `json:"content_type"`
+	SizeBytes      int64     `json:"size_bytes"`
+	Checksum       string    `json:"checksum"` // SHA-256
+	StorageBackend string    `json:"storage_backend"`
+	StorageKey     string    `json:"-"`
+	DownloadLimit  int       `json:"download_limit"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+const digitalAssetColumns = `id, merchant_id, product_id, variant_id, filename, content_type, size_bytes, checksum,
+	storage_backend, storage_key, download_limit, created_at`
+
+func scanDigitalAsset(row interface{ Scan(...interface{}) error }) (*DigitalAsset, error) {
+	var a DigitalAsset
+	var variantID sql.NullString
+	err := row.Scan(&a.ID, &a.MerchantID, &a.ProductID, &variantID, &a.Filename, &a.ContentType, &a.SizeBytes, &a.Checksum,
+		&a.StorageBackend, &a.StorageKey, &a.DownloadLimit, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if variantID.Valid {
+		a.VariantID = &variantID.String
+	}
+	return &a, nil
+}
+
+// VariantDeliveryRequest remplace le type de livraison d'une variante ; une
+// valeur nulle reprend celle du produit
+type VariantDeliveryRequest struct {
+	IsDigital        *bool `json:"is_digital"`
+	RequiresShipping *bool `json:"requires_shipping"`
+}
+
+// DigitalFulfilmentRequest est envoyée par le checkout-service lorsqu'une
+// commande est payée ; les lignes non numériques sont ignorées
+type DigitalFulfilmentRequest struct {
+	OrderID    string `json:"order_id" binding:"required"`
+	UserID     string `json:"user_id" binding:"required"`
+	MerchantID string `json:"merchant_id" binding:"required"`
+	Items      []struct {
+		OrderItemID string  `json:"order_item_id" binding:"required"`
+		ProductID   string  `json:"product_id" binding:"required"`
+		VariantID   *string `json:"variant_id,omitempty"`
+	} `json:"items" binding:"required,dive"`
+}
+
+// DigitalOrderLine est une ligne numérique d'une commande vue par l'acheteur
+type DigitalOrderLine struct {
+	OrderItemID string  `json:"order_item_id"`
+	ProductID   string  `json:"product_id"`
+	VariantID   *string `json:"variant_id,omitempty"`
+	ProductName string  `json:"product_name"`
+	LicenseKey  string  `json:"license_key,omitempty"`
+	// LicenseKeyPending : la réserve de clés était vide lors de la livraison
+	LicenseKeyPending bool              `json:"license_key_pending,omitempty"`
+	Downloads         []DigitalDownload `json:"downloads"`
+}
+
+// DigitalDownload est un droit de téléchargement ; l'URL signée est régénérée
+// à chaque consultation et expire après DIGITAL_DOWNLOAD_TTL
+type DigitalDownload struct {
+	ID            string     `json:"id"`
+	AssetID       string     `json:"asset_id"`
+	Filename      string     `json:"filename"`
+	SizeBytes     int64      `json:"size_bytes"`
+	DownloadLimit int        `json:"download_limit"`
+	DownloadCount int        `json:"download_count"`
+	URL           string     `json:"url,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+}
+
+// downloadSecret retourne la clé de signature des liens de téléchargement
+func downloadSecret() []byte {
+	return []byte(getEnv("DIGITAL_DOWNLOAD_SECRET", "download-secret-change-in-production"))
+}
+
+// downloadTTL retourne la durée de validité d'un lien de téléchargement
+func downloadTTL() time.Duration {
+	ttl, err := time.ParseDuration(getEnv("DIGITAL_DOWNLOAD_TTL", "24h"))
+	if err != nil || ttl <= 0 {
+		return 24 * time.Hour
+	}
+	return ttl
+}
+
+// signDownloadToken signe un lien de téléchargement : droit et date d'expiration
+func signDownloadToken(downloadID string, expiresAt time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString(
+		[]byte(downloadID + "|" + strconv.FormatInt(expiresAt.Unix(), 10)),
+	)
+	mac := hmac.New(sha256.New, downloadSecret())
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyDownloadToken vérifie la signature et l'expiration d'un lien de téléchargement
+func verifyDownloadToken(token string) (string, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", errInvalidDownloadToken
+	}
+	given, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return "", errInvalidDownloadToken
+	}
+	mac := hmac.New(sha256.New, downloadSecret())
+	mac.Write([]byte(payload))
+	if !hmac.Equal(given, mac.Sum(nil)) {
+		return "", errInvalidDownloadToken
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", errInvalidDownloadToken
+	}
+	downloadID, expires, ok := strings.Cut(string(decoded), "|")
+	if !ok {
+		return "", errInvalidDownloadToken
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return "", errInvalidDownloadToken
+	}
+	return downloadID, nil
+}
+
+// storeDigitalAsset téléverse le fichier dans le backend de stockage puis
+// l'enregistre ; le fichier est supprimé si l'enregistrement échoue
+func storeDigitalAsset(c *gin.Context, product *Product, variantID *string, filename, contentType string, downloadLimit int, r io.Reader) (*DigitalAsset, error) {
+	random, err := generateFeedToken()
+	if err != nil {
+		return nil, err
+	}
+	key := product.MerchantID + "/" + product.ID + "/" + random
+	hash := sha256.New()
+	counter := &countingReader{r: io.TeeReader(r, hash)}
+
+	ctx := c.Request.Context()
+	if err := assetStorage.Put(ctx, key, counter); err != nil {
+		return nil, err
+	}
+
+	asset, err := scanDigitalAsset(db.QueryRow(
+		`INSERT INTO digital_assets (merchant_id, product_id, variant_id, filename, content_type, size_bytes, checksum, storage_backend, storage_key, download_limit)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		 RETURNING `+digitalAssetColumns,
+		product.MerchantID, product.ID, variantID, filename, contentType, counter.n,
+		hex.EncodeToString(hash.Sum(nil)), assetStorage.Name(), key, downloadLimit,
+	))
+	if err != nil {
+		if delErr := assetStorage.Delete(ctx, key); delErr != nil {
+			log.Printf("Erreur lors de la suppression du fichier %s: %v", key, delErr)
+		}
+		return nil, err
+	}
+	return asset, nil
+}
+
+// countingReader compte les octets lus
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// ListDigitalAssets retourne les fichiers d'un produit
+func ListDigitalAssets(productID string) ([]*DigitalAsset, error) {
+	rows, err := db.Query(
+		"SELECT "+digitalAssetColumns+" FROM digital_assets WHERE product_id = $1 ORDER BY created_at",
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assets := []*DigitalAsset{}
+	for rows.Next() {
+		asset, err := scanDigitalAsset(rows)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+	return assets, rows.Err()
+}
+
+// isDigitalLine indique si la variante (ou, sans variante, le produit) est
+// numérique et appartient au marchand de la commande
+func isDigitalLine(tx *sql.Tx, merchantID, productID string, variantID *string) (bool, error) {
+	var digital bool
+	err := tx.QueryRow(
+		`SELECT COALESCE(v.is_digital, p.is_digital)
+		 FROM products p LEFT JOIN product_variants v ON v.id = $3 AND v.product_id = p.id
+		 WHERE p.id = $1 AND p.merchant_id = $2`,
+		productID, merchantID, variantID,
+	).Scan(&digital)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return digital, err
+}
+
+// FulfilDigitalOrder livre les lignes numériques d'une commande payée : droits
+// de téléchargement sur les fichiers du produit et clé de licence si le produit
+// en a une réserve. Rejouer la livraison est sans effet sur les lignes déjà
+// livrées et attribue les clés manquantes.
+func FulfilDigitalOrder(req *DigitalFulfilmentRequest) ([]DigitalOrderLine, error) {
+	var exhausted []DigitalOrderLine
+	err := withTx(func(tx *sql.Tx) error {
+		for _, item := range req.Items {
+			digital, err := isDigitalLine(tx, req.MerchantID, item.ProductID, item.VariantID)
+			if err != nil {
+				return err
+			}
+			if !digital {
+				continue
+			}
+
+			_, err = tx.Exec(
+				`INSERT INTO digital_order_lines (order_item_id, order_id, user_id, merchant_id, product_id, variant_id)
+				 VALUES ($1, $2, $3, $4, $5, $6)
+				 ON CONFLICT (order_item_id) DO NOTHING`,
+				item.OrderItemID, req.OrderID, req.UserID, req.MerchantID, item.ProductID, item.VariantID,
+			)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(
+				`INSERT INTO digital_downloads (order_item_id, asset_id, download_limit)
+				 SELECT $1, id, download_limit FROM digital_assets
+				 WHERE product_id = $2 AND (variant_id IS NULL OR variant_id = $3)
+				 ON CONFLICT (order_item_id, asset_id) DO NOTHING`,
+				item.OrderItemID, item.ProductID, item.VariantID,
+			)
+			if err != nil {
+				return err
+			}
+
+			assigned, err := assignLicenseKey(tx, item.OrderItemID, item.ProductID, item.VariantID)
+			if err != nil {
+				return err
+			}
+			if !assigned {
+				exhausted = append(exhausted, DigitalOrderLine{OrderItemID: item.OrderItemID, ProductID: item.ProductID, VariantID: item.VariantID})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range exhausted {
+		line := line
+		go func() {
+			err := publishMerchantEvent(req.MerchantID, "license_keys.exhausted", gin.H{
+				"product_id":    line.ProductID,
+				"variant_id":    line.VariantID,
+				"order_id":      req.OrderID,
+				"order_item_id": line.OrderItemID,
+			})
+			if err != nil {
+				log.Printf("Erreur lors de la publication de l'alerte de clés de licence: %v", err)
+			}
+		}()
+	}
+
+	return GetDigitalOrder(req.OrderID, req.UserID)
+}
+
+// GetDigitalOrder retourne les lignes numériques d'une commande de l'acheteur
+// avec des liens de téléchargement fraîchement signés
+func GetDigitalOrder(orderID, userID string) ([]DigitalOrderLine, error) {
+	rows, err := db.Query(
+		`SELECT l.order_item_id, l.product_id, l.variant_id, p.name,
+		        COALESCE(k.license_key, ''),
+		        NOT EXISTS (SELECT 1 FROM license_keys lk WHERE lk.order_item_id = l.order_item_id)
+		            AND EXISTS (SELECT 1 FROM license_keys pk WHERE pk.product_id = l.product_id)
+		 FROM digital_order_lines l
+		 JOIN products p ON p.id = l.product_id
+		 LEFT JOIN license_keys k ON k.order_item_id = l.order_item_id AND k.status = 'assigned'
+		 WHERE l.order_id::text = $1 AND l.user_id::text = $2
+		 ORDER BY l.created_at, l.order_item_id`,
+		orderID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []DigitalOrderLine{}
+	index := map[string]int{}
+	for rows.Next() {
+		var line DigitalOrderLine
+		var variantID sql.NullString
+		if err := rows.Scan(&line.OrderItemID, &line.ProductID, &variantID, &line.ProductName, &line.LicenseKey, &line.LicenseKeyPending); err != nil {
+			return nil, err
+		}
+		if variantID.Valid {
+			line.VariantID = &variantID.String
+		}
+		line.Downloads = []DigitalDownload{}
+		index[line.OrderItemID] = len(lines)
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return lines, nil
+	}
+
+	rows, err = db.Query(
+		`SELECT d.id, d.order_item_id, a.id, a.filename, a.size_bytes, d.download_limit, d.download_count
+		 FROM digital_downloads d
+		 JOIN digital_assets a ON a.id = d.asset_id
+		 JOIN digital_order_lines l ON l.order_item_id = d.order_item_id
+		 WHERE l.order_id::text = $1
+		 ORDER BY a.created_at`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expiresAt := time.Now().Add(downloadTTL()).UTC()
+	for rows.Next() {
+		var d DigitalDownload
+		var orderItemID string
+		if err := rows.Scan(&d.ID, &orderItemID, &d.AssetID, &d.Filename, &d.SizeBytes, &d.DownloadLimit, &d.DownloadCount); err != nil {
+			return nil, err
+		}
+		if d.DownloadCount < d.DownloadLimit {
+			d.URL = "/api/v1/downloads/" + signDownloadToken(d.ID, expiresAt)
+			d.ExpiresAt = &expiresAt
+		}
+		i, ok := index[orderItemID]
+		if ok {
+			lines[i].Downloads = append(lines[i].Downloads, d)
+		}
+	}
+	return lines, rows.Err()
+}
+
+// consumeDownload ouvre le fichier d'un droit de téléchargement et décompte le
+// téléchargement dans la même transaction : un fichier absent ou illisible ne
+// consomme pas de téléchargement. L'appelant ferme le lecteur retourné.
+func consumeDownload(ctx context.Context, downloadID string) (*DigitalAsset, io.ReadCloser, error) {
+	var asset *DigitalAsset
+	var reader io.ReadCloser
+	err := withTx(func(tx *sql.Tx) error {
+		var assetID string
+		var count, limit int
+		err := tx.QueryRow(
+			"SELECT asset_id, download_count, download_limit FROM digital_downloads WHERE id::text = $1 FOR UPDATE",
+			downloadID,
+		).Scan(&assetID, &count, &limit)
+		if err == sql.ErrNoRows {
+			return errDigitalAssetNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if count >= limit {
+			return errDownloadLimitReached
+		}
+
+		asset, err = scanDigitalAsset(tx.QueryRow("SELECT "+digitalAssetColumns+" FROM digital_assets WHERE id = $1", assetID))
+		if err != nil {
+			return err
+		}
+		if asset.StorageBackend != assetStorage.Name() {
+			return fmt.Errorf("fichier %s stocké sur le backend %s, non configuré", asset.ID, asset.StorageBackend)
+		}
+		reader, err = assetStorage.Open(ctx, asset.StorageKey)
+		if err != nil {
+			return fmt.Errorf("lecture du fichier %s: %w", asset.StorageKey, err)
+		}
+
+		_, err = tx.Exec(
+			`UPDATE digital_downloads SET download_count = download_count + 1, last_downloaded_at = CURRENT_TIMESTAMP
+			 WHERE id = $1`,
+			downloadID,
+		)
+		return err
+	})
+	if err != nil {
+		if reader != nil {
+			reader.Close()
+		}
+		return nil, nil, err
+	}
+	return asset, reader, nil
+}
+
+// digitalTransferTimeout est le délai accordé à un téléversement ou à un
+// téléchargement de fichier, au-delà du délai de 15s du serveur
+func digitalTransferTimeout() time.Duration {
+	timeout, err := time.ParseDuration(getEnv("DIGITAL_TRANSFER_TIMEOUT", "30m"))
+	if err != nil || timeout <= 0 {
+		return 30 * time.Minute
+	}
+	return timeout
+}
+
+// authorizeDigitalProduct charge le produit de la route et vérifie qu'il
+// appartient au marchand
+func authorizeDigitalProduct(c *gin.Context) (*Product, bool) {
+	product, err := GetProductByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération du produit"})
+		return nil, false
+	}
+	if product == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Produit introuvable"})
+		return nil, false
+	}
+	if product.MerchantID != c.GetHeader("X-Merchant-ID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Accès non autorisé"})
+		return nil, false
+	}
+	return product, true
+}
+
+// productVariantParam valide une variante facultative du produit
+func productVariantParam(c *gin.Context, productID, variantID string) (*string, bool) {
+	if variantID == "" {
+		return nil, true
+	}
+	var exists bool
+	err := db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM product_variants WHERE id::text = $1 AND product_id = $2)",
+		variantID, productID,
+	).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération de la variante"})
+		return nil, false
+	}
+	if !exists {
+		respondValidationErrors(c, ValidationErrors{{"variant_id", "Variante inconnue pour ce produit"}})
+		return nil, false
+	}
+	return &variantID, true
+}
+
+// handleUpdateVariantDelivery définit si une variante est numérique et expédiée
+func handleUpdateVariantDelivery(c *gin.Context) {
+	product, ok := authorizeDigitalProduct(c)
+	if !ok {
+		return
+	}
+
+	var req VariantDeliveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := db.Exec(
+		`UPDATE product_variants SET is_digital = $1, requires_shipping = $2, updated_at = CURRENT_TIMESTAMP
+		 WHERE id::text = $3 AND product_id = $4`,
+		req.IsDigital, req.RequiresShipping, c.Param("variantId"), product.ID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour de la variante"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variante introuvable"})
+		return
+	}
+
+	variants, err := GetProductVariants(db, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des variantes"})
+		return
+	}
+	for _, v := range variants {
+		if v.ID == c.Param("variantId") {
+			c.JSON(http.StatusOK, v)
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Variante introuvable"})
+}
+
+// handleListDigitalAssets liste les fichiers d'un produit
+func handleListDigitalAssets(c *gin.Context) {
+	product, ok := authorizeDigitalProduct(c)
+	if !ok {
+		return
+	}
+
+	assets, err := ListDigitalAssets(product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des fichiers"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"assets": assets})
+}
+
+// handleUploadDigitalAsset téléverse un fichier en multipart (champ file) ;
+// variant_id et download_limit sont des champs facultatifs du formulaire
+func handleUploadDigitalAsset(c *gin.Context) {
+	product, ok := authorizeDigitalProduct(c)
+	if !ok {
+		return
+	}
+
+	extendDeadlines(c, digitalTransferTimeout(), digitalTransferTimeout())
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxDigitalAssetSize+1<<20)
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "champ file requis"})
+		return
+	}
+	if file.Size > maxDigitalAssetSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Fichier trop volumineux (%d Mo maximum)", maxDigitalAssetSize>>20)})
+		return
+	}
+
+	variantID, ok := productVariantParam(c, product.ID, c.PostForm("variant_id"))
+	if !ok {
+		return
+	}
+	downloadLimit := defaultDownloadLimit
+	if value := c.PostForm("download_limit"); value != "" {
+		downloadLimit, err = strconv.Atoi(value)
+		if err != nil || downloadLimit <= 0 {
+			respondValidationErrors(c, ValidationErrors{{"download_limit", "Doit être strictement positif"}})
+			return
+		}
+	}
+
+	filename := filepath.Base(file.Filename)
+	contentType := file.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fichier illisible"})
+		return
+	}
+	defer f.Close()
+
+	asset, err := storeDigitalAsset(c, product, variantID, filename, contentType, downloadLimit, f)
+	if err != nil {
+		log.Printf("Erreur lors de l'enregistrement du fichier du produit %s: %v", product.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement du fichier"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, asset)
+}
+
+// handleDeleteDigitalAsset supprime un fichier ; les droits de téléchargement
+// déjà accordés sur ce fichier disparaissent avec lui
+func handleDeleteDigitalAsset(c *gin.Context) {
+	product, ok := authorizeDigitalProduct(c)
+	if !ok {
+		return
+	}
+
+	asset, err := scanDigitalAsset(db.QueryRow(
+		"DELETE FROM digital_assets WHERE id::text = $1 AND product_id = $2 RETURNING "+digitalAssetColumns,
+		c.Param("assetId"), product.ID,
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Fichier introuvable"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la suppression du fichier"})
+		return
+	}
+
+	if err := assetStorage.Delete(c.Request.Context(), asset.StorageKey); err != nil {
+		log.Printf("Erreur lors de la suppression du fichier %s: %v", asset.StorageKey, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Fichier supprimé"})
+}
+
+// handleFulfilDigitalOrder livre les lignes numériques d'une commande payée
+// (appel interne du checkout-service)
+func handleFulfilDigitalOrder(c *gin.Context) {
+	var req DigitalFulfilmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lines, err := FulfilDigitalOrder(&req)
+	if err != nil {
+		log.Printf("Erreur lors de la livraison numérique de la commande %s: %v", req.OrderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la livraison des produits numériques"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"order_id": req.OrderID, "lines": lines})
+}
+
+// handleGetDigitalOrder retourne les téléchargements et clés de licence d'une
+// commande du client authentifié (X-User-ID posé par l'API Gateway)
+func handleGetDigitalOrder(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Utilisateur non authentifié"})
+		return
+	}
+
+	lines, err := GetDigitalOrder(c.Param("orderId"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des téléchargements"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"order_id": c.Param("orderId"), "lines": lines})
+}
+
+// handleDownload sert le fichier d'un lien signé et décompte le téléchargement
+func handleDownload(c *gin.Context) {
+	downloadID, err := verifyDownloadToken(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	asset, reader, err := consumeDownload(c.Request.Context(), downloadID)
+	if err == errDownloadLimitReached {
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	}
+	if err == errDigitalAssetNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Erreur lors du téléchargement %s: %v", downloadID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors du téléchargement"})
+		return
+	}
+	defer reader.Close()
+
+	extendDeadlines(c, 0, digitalTransferTimeout())
+	c.DataFromReader(http.StatusOK, asset.SizeBytes, asset.ContentType, reader, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": asset.Filename}),
+		"Cache-Control":       "no-store",
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// createTestDownload crée un fichier stocké localement et un droit de
+// téléchargement de limit téléchargements ; retourne le droit et la clé du fichier
+func createTestDownload(t *testing.T, limit int) (downloadID, storageKey string) {
+	t.Helper()
+	previous := assetStorage
+	assetStorage = &localAssetStorage{root: t.TempDir()}
+	t.Cleanup(func() { assetStorage = previous })
+	merchantID := testMerchantID(t)
+	productID, _ := createTestProduct(t, merchantID)
+
+	storageKey = "test/" + productID
+	if err := assetStorage.Put(context.Background(), storageKey, strings.NewReader("contenu")); err != nil {
+		t.Fatal(err)
+	}
+
+	var assetID, orderItemID string
+	if err := db.QueryRow(
+		`INSERT INTO digital_assets (merchant_id, product_id, filename, content_type, size_bytes, checksum, storage_backend, storage_key)
+		 VALUES ($1, $2, 'guide.pdf', 'application/pdf', 7, '', $3, $4) RETURNING id`,
+		merchantID, productID, AssetStorageLocal, storageKey,
+	).Scan(&assetID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(
+		`INSERT INTO digital_order_lines (order_item_id, order_id, user_id, merchant_id, product_id)
+		 VALUES (gen_random_uuid(), gen_random_uuid(), gen_random_uuid(), $1, $2) RETURNING order_item_id`,
+		merchantID, productID,
+	).Scan(&orderItemID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(
+		"INSERT INTO digital_downloads (order_item_id, asset_id, download_limit) VALUES ($1, $2, $3) RETURNING id",
+		orderItemID, assetID, limit,
+	).Scan(&downloadID); err != nil {
+		t.Fatal(err)
+	}
+	return downloadID, storageKey
+}
+
+func downloadCount(t *testing.T, downloadID string) int {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT download_count FROM digital_downloads WHERE id = $1", downloadID).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestConsumeDownloadCountsOpenedFiles(t *testing.T) {
+	openTestDB(t)
+	downloadID, _ := createTestDownload(t, 2)
+
+	for i := 0; i < 2; i++ {
+		_, reader, err := consumeDownload(context.Background(), downloadID)
+		if err != nil {
+			t.Fatalf("téléchargement %d: %v", i+1, err)
+		}
+		content, _ := io.ReadAll(reader)
+		reader.Close()
+		if string(content) != "contenu" {
+			t.Errorf("contenu %q, attendu %q", content, "contenu")
+		}
+	}
+	if _, _, err := consumeDownload(context.Background(), downloadID); err != errDownloadLimitReached {
+		t.Errorf("troisième téléchargement: erreur %v, attendu errDownloadLimitReached", err)
+	}
+	if count := downloadCount(t, downloadID); count != 2 {
+		t.Errorf("%d téléchargements décomptés, attendu 2", count)
+	}
+}
+
+func TestConsumeDownloadMissingFileIsNotCounted(t *testing.T) {
+	openTestDB(t)
+	downloadID, storageKey := createTestDownload(t, 1)
+	if err := assetStorage.Delete(context.Background(), storageKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := consumeDownload(context.Background(), downloadID); err == nil {
+		t.Fatal("un fichier absent doit faire échouer le téléchargement")
+	}
+	if count := downloadCount(t, downloadID); count != 0 {
+		t.Errorf("%d téléchargement décompté pour un fichier absent, attendu 0", count)
+	}
+}
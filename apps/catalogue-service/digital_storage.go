@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Backends de stockage des fichiers numériques sélectionnables via DIGITAL_STORAGE_BACKEND
+const (
+	AssetStorageLocal = "local"
+)
+
+// assetStorage est le backend où sont déposés les fichiers des produits numériques
+var assetStorage AssetStorage
+
+// AssetStorage abstrait le stockage des fichiers livrés aux acheteurs ; les
+// clés sont générées par le catalogue et ne viennent jamais du client
+type AssetStorage interface {
+	Name() string
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// newAssetStorage construit le backend correspondant à la configuration
+func newAssetStorage(name string) (AssetStorage, error) {
+	switch name {
+	case AssetStorageLocal:
+		return &localAssetStorage{root: getEnv("DIGITAL_STORAGE_DIR", "./data/digital-assets")}, nil
+	default:
+		return nil, fmt.Errorf("backend de stockage inconnu: %s", name)
+	}
+}
+
+// localAssetStorage stocke les fichiers sur le disque local (volume partagé
+// entre les instances en production)
+type localAssetStorage struct {
+	root string
+}
+
+func (s *localAssetStorage) Name() string { return AssetStorageLocal }
+
+func (s *localAssetStorage) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+// Put écrit le fichier sous un nom temporaire puis le renomme : un fichier
+// interrompu n'est jamais servi
+func (s *localAssetStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *localAssetStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+func (s *localAssetStorage) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -6,9 +6,37 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"time"
 )
 
+// productsIndexAlias est l'alias par lequel passent toutes les lectures et écritures.
+// Il pointe vers un index versionné (products_v<timestamp>) remplacé lors d'une réindexation.
+const productsIndexAlias = "products"
+
+// ProductDocument représente un produit tel qu'indexé dans Elasticsearch
+type ProductDocument struct {
+	Product
+	VariantOptions []string `json:"variant_options"`
+	Available      int      `json:"available"`
+	InStock        bool     `json:"in_stock"`
+	// Translations contient le nom et la description traduits, par langue
+	Translations map[string]DocumentTranslation `json:"translations,omitempty"`
+}
+
+// DocumentTranslation représente les champs traduits indexés d'un produit
+type DocumentTranslation struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// IndexedState contient les champs d'un document indexé que check-drift
+// compare à la base
+type IndexedState struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	Available int       `json:"available"`
+	InStock   bool      `json:"in_stock"`
+}
+
 // ElasticsearchClient gère les interactions avec Elasticsearch
 type ElasticsearchClient struct {
 	BaseURL string
@@ -20,13 +48,13 @@ func NewElasticsearchClient() *ElasticsearchClient {
 	baseURL := getEnv("ELASTICSEARCH_URL", "http://localhost:9200")
 	return &ElasticsearchClient{
 		BaseURL: baseURL,
-		Client:  &http.Client{},
+		Client:  &http.Client{Timeout: 30 * time.Second},
 	}
 }
 
 // IndexProduct indexe un produit dans Elasticsearch
 func (es *ElasticsearchClient) IndexProduct(product *Product) error {
-	indexName := "products"
+	indexName := productsIndexAlias
 	url := fmt.Sprintf("%s/%s/_doc/%s", es.BaseURL, indexName, product.ID)
 	
 	body, err := json.Marshal(product)
@@ -57,7 +85,7 @@ func (es *ElasticsearchClient) IndexProduct(product *Product) error {
 
 // DeleteProduct supprime un produit de l'index Elasticsearch
 func (es *ElasticsearchClient) DeleteProduct(productID string) error {
-	indexName := "products"
+	indexName := productsIndexAlias
 	url := fmt.Sprintf("%s/%s/_doc/%s", es.BaseURL, indexName, productID)
 	
 	req, err := http.NewRequest("DELETE", url, nil)
@@ -79,90 +107,248 @@ func (es *ElasticsearchClient) DeleteProduct(productID string) error {
 	return nil
 }
 
-// SearchProducts recherche des produits dans Elasticsearch
-func (es *ElasticsearchClient) SearchProducts(query string, filters map[string]interface{}) ([]Product, error) {
-	indexName := "products"
-	url := fmt.Sprintf("%s/%s/_search", es.BaseURL, indexName)
-	
-	searchQuery := map[string]interface{}{
-		"query": map[string]interface{}{
-			"multi_match": map[string]interface{}{
-				"query":  query,
-				"fields": []string{"name^2", "description", "tags"},
-			},
-		},
+// BulkIndexAction représente une opération unitaire d'un appel _bulk
+type BulkIndexAction struct {
+	ProductID string
+	Document  interface{} // nil pour une suppression
+}
+
+// BulkIndex envoie plusieurs indexations/suppressions en un seul appel _bulk vers l'index donné.
+// Les opérations en échec sont retournées par ID de produit avec leur motif.
+func (es *ElasticsearchClient) BulkIndex(indexName string, actions []BulkIndexAction) (map[string]string, error) {
+	if len(actions) == 0 {
+		return nil, nil
 	}
-	
-	body, err := json.Marshal(searchQuery)
-	if err != nil {
-		return nil, err
+
+	url := fmt.Sprintf("%s/_bulk", es.BaseURL)
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, action := range actions {
+		meta := map[string]interface{}{
+			"_index": indexName,
+			"_id":    action.ProductID,
+		}
+		if action.Document == nil {
+			if err := encoder.Encode(map[string]interface{}{"delete": meta}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := encoder.Encode(map[string]interface{}{"index": meta}); err != nil {
+			return nil, err
+		}
+		if err := encoder.Encode(action.Document); err != nil {
+			return nil, err
+		}
 	}
-	
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+
+	req, err := http.NewRequest("POST", url, &buf)
 	if err != nil {
 		return nil, err
 	}
-	
-	req.Header.Set("Content-Type", "application/json")
-	
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
 	resp, err := es.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	
+
 	if resp.StatusCode >= 400 {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("erreur Elasticsearch: %s", string(bodyBytes))
 	}
-	
-	var result map[string]interface{}
+
+	// _bulk répond 200 même si certaines opérations échouent
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string          `json:"_id"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, err
 	}
-	
-	var products []Product
-	hits, ok := result["hits"].(map[string]interface{})
-	if !ok {
-		return products, nil
+
+	failed := map[string]string{}
+	if result.Errors {
+		for _, item := range result.Items {
+			for op, detail := range item {
+				// Une suppression d'un document absent n'est pas une erreur
+				if detail.Status >= 400 && !(op == "delete" && detail.Status == 404) {
+					failed[detail.ID] = fmt.Sprintf("%s %d: %s", op, detail.Status, string(detail.Error))
+				}
+			}
+		}
 	}
-	
-	hitsList, ok := hits["hits"].([]interface{})
-	if !ok {
-		return products, nil
+
+	return failed, nil
+}
+
+// CreateIndex crée un index avec le corps (settings/mappings) fourni
+func (es *ElasticsearchClient) CreateIndex(indexName string, body map[string]interface{}) error {
+	_, err := es.doJSON("PUT", "/"+indexName, body, nil)
+	return err
+}
+
+// DeleteIndex supprime un index
+func (es *ElasticsearchClient) DeleteIndex(indexName string) error {
+	_, err := es.doJSON("DELETE", "/"+indexName, nil, nil)
+	return err
+}
+
+// GetAliasIndices retourne les index vers lesquels pointe un alias, et indique
+// si le nom correspond à un index concret (ancien schéma sans alias)
+func (es *ElasticsearchClient) GetAliasIndices(alias string) ([]string, bool, error) {
+	var result map[string]interface{}
+	status, err := es.doJSON("GET", "/_alias/"+alias, nil, &result)
+	if status == http.StatusNotFound {
+		// Pas d'alias : vérifier si un index concret porte ce nom
+		existsStatus, err := es.doJSON("HEAD", "/"+alias, nil, nil)
+		if existsStatus == http.StatusNotFound {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, true, nil
 	}
-	
-	for _, hit := range hitsList {
-		hitMap, ok := hit.(map[string]interface{})
-		if !ok {
-			continue
+	if err != nil {
+		return nil, false, err
+	}
+
+	indices := make([]string, 0, len(result))
+	for index := range result {
+		indices = append(indices, index)
+	}
+	return indices, false, nil
+}
+
+// SwapAlias fait pointer atomiquement l'alias vers newIndex. Si concreteIndex est vrai,
+// l'index concret portant le nom de l'alias est supprimé dans la même opération.
+func (es *ElasticsearchClient) SwapAlias(alias, newIndex string, oldIndices []string, concreteIndex bool) error {
+	actions := []map[string]interface{}{}
+	if concreteIndex {
+		actions = append(actions, map[string]interface{}{
+			"remove_index": map[string]interface{}{"index": alias},
+		})
+	}
+	for _, old := range oldIndices {
+		actions = append(actions, map[string]interface{}{
+			"remove": map[string]interface{}{"index": old, "alias": alias},
+		})
+	}
+	actions = append(actions, map[string]interface{}{
+		"add": map[string]interface{}{"index": newIndex, "alias": alias},
+	})
+
+	_, err := es.doJSON("POST", "/_aliases", map[string]interface{}{"actions": actions}, nil)
+	return err
+}
+
+// ScrollDocuments parcourt tous les documents d'un index et transmet l'ID
+// et l'état indexé (mise à jour, disponibilité) de chacun
+func (es *ElasticsearchClient) ScrollDocuments(indexName string, fn func(id string, state IndexedState) error) error {
+	type scrollPage struct {
+		ScrollID string `json:"_scroll_id"`
+		Hits     struct {
+			Hits []struct {
+				ID     string       `json:"_id"`
+				Source IndexedState `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+
+	var page scrollPage
+	_, err := es.doJSON("POST", "/"+indexName+"/_search?scroll=1m", map[string]interface{}{
+		"size":    1000,
+		"_source": []string{"updated_at", "available", "in_stock"},
+		"sort":    []string{"_doc"},
+	}, &page)
+	if err != nil {
+		return err
+	}
+
+	for len(page.Hits.Hits) > 0 {
+		for _, hit := range page.Hits.Hits {
+			if err := fn(hit.ID, hit.Source); err != nil {
+				return err
+			}
 		}
-		
-		source, ok := hitMap["_source"].(map[string]interface{})
-		if !ok {
-			continue
+
+		scrollID := page.ScrollID
+		page = scrollPage{}
+		if _, err := es.doJSON("POST", "/_search/scroll", map[string]interface{}{
+			"scroll":    "1m",
+			"scroll_id": scrollID,
+		}, &page); err != nil {
+			return err
 		}
-		
-		productJSON, err := json.Marshal(source)
+	}
+
+	if page.ScrollID != "" {
+		es.doJSON("DELETE", "/_search/scroll", map[string]interface{}{"scroll_id": page.ScrollID}, nil)
+	}
+	return nil
+}
+
+// Ping vérifie que le cluster Elasticsearch répond
+func (es *ElasticsearchClient) Ping() error {
+	_, err := es.doJSON("GET", "/_cluster/health", nil, nil)
+	return err
+}
+
+// doJSON exécute une requête JSON et décode la réponse dans out si fourni.
+// Le code HTTP est retourné pour permettre de distinguer les 404.
+func (es *ElasticsearchClient) doJSON(method, path string, body interface{}, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
 		if err != nil {
-			continue
+			return 0, err
 		}
-		
-		var product Product
-		if err := json.Unmarshal(productJSON, &product); err != nil {
-			continue
+		reader = bytes.NewBuffer(data)
+	}
+
+	req, err := http.NewRequest(method, es.BaseURL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := es.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, fmt.Errorf("erreur Elasticsearch: %s", string(bodyBytes))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, err
 		}
-		
-		products = append(products, product)
 	}
-	
-	return products, nil
+
+	return resp.StatusCode, nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// SearchProducts recherche des produits d'un marchand avec filtres, facettes, tri et pagination
+func (es *ElasticsearchClient) SearchProducts(req *SearchRequest) (*SearchResult, error) {
+	var resp searchResponse
+	if _, err := es.doJSON("POST", "/"+productsIndexAlias+"/_search", buildSearchBody(req), &resp); err != nil {
+		return nil, err
 	}
-	return defaultValue
+	return resp.toSearchResult(req), nil
 }
 
+
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stratégies d'allocation des commandes aux emplacements
+const (
+	AllocationPriority = "priority" // ordre de priorité des emplacements
+	AllocationClosest  = "closest"  // emplacements du pays de livraison d'abord, puis priorité
+)
+
+// errAllocationUnavailable est retournée lorsqu'aucun plan ne peut servir la commande
+var errAllocationUnavailable = errors.New("stock insuffisant pour allouer la commande")
+
+// AllocationSettings représente les règles d'allocation d'un marchand
+type AllocationSettings struct {
+	Strategy   string `json:"strategy" binding:"required,oneof=priority closest"`
+	AllowSplit bool   `json:"allow_split"`
+}
+
+// AllocationLine représente une ligne de commande à allouer
+type AllocationLine struct {
+	ProductID string  `json:"product_id" binding:"required"`
+	VariantID *string `json:"variant_id,omitempty"`
+	Quantity  int     `json:"quantity" binding:"required,min=1"`
+}
+
+// AllocationRequest représente une demande d'allocation d'une commande
+type AllocationRequest struct {
+	MerchantID      string           `json:"merchant_id" binding:"required"`
+	ShippingCountry string           `json:"shipping_country"`
+	AllowSplit      *bool            `json:"allow_split,omitempty"` // remplace le réglage du marchand
+	Lines           []AllocationLine `json:"lines" binding:"required,min=1,dive"`
+}
+
+// Shipment regroupe les lignes expédiées depuis un même emplacement
+type Shipment struct {
+	LocationID   string           `json:"location_id"`
+	LocationName string           `json:"location_name"`
+	Lines        []AllocationLine `json:"lines"`
+}
+
+// AllocationPlan représente la répartition d'une commande entre emplacements
+type AllocationPlan struct {
+	Strategy    string           `json:"strategy"`
+	Split       bool             `json:"split"`
+	Shipments   []Shipment       `json:"shipments"`
+	Unallocated []AllocationLine `json:"unallocated,omitempty"`
+}
+
+// locationPick représente une quantité prélevée dans un emplacement
+type locationPick struct {
+	LocationID string
+	Quantity   int
+}
+
+// candidateLocation est un emplacement éligible à l'allocation, dans l'ordre de préférence
+type candidateLocation struct {
+	ID   string
+	Name string
+}
+
+// GetAllocationSettings retourne les règles d'allocation du marchand (priorité, fractionnement autorisé par défaut)
+func GetAllocationSettings(q queryer, merchantID string) (*AllocationSettings, error) {
+	settings := &AllocationSettings{Strategy: AllocationPriority, AllowSplit: true}
+	err := q.QueryRow(
+		"SELECT strategy, allow_split FROM allocation_settings WHERE merchant_id = $1",
+		merchantID,
+	).Scan(&settings.Strategy, &settings.AllowSplit)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// candidateLocations retourne les emplacements actifs expédiant en ligne, dans l'ordre de la stratégie
+func candidateLocations(q queryer, merchantID, strategy, country string) ([]candidateLocation, error) {
+	query := `SELECT id, name FROM stock_locations
+	          WHERE merchant_id = $1 AND active AND fulfils_online`
+	args := []interface{}{merchantID}
+	if strategy == AllocationClosest && country != "" {
+		args = append(args, country)
+		query += " ORDER BY (country IS NOT DISTINCT FROM $2) DESC, priority, name"
+	} else {
+		query += " ORDER BY priority, name"
+	}
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locations []candidateLocation
+	for rows.Next() {
+		var l candidateLocation
+		if err := rows.Scan(&l.ID, &l.Name); err != nil {
+			return nil, err
+		}
+		locations = append(locations, l)
+	}
+	return locations, rows.Err()
+}
+
+// locationStock retourne le stock de chaque ligne dans chaque emplacement candidat
+func locationStock(q queryer, locations []candidateLocation, lines []AllocationLine) (map[string][]int, error) {
+	stock := map[string][]int{}
+	for _, l := range locations {
+		stock[l.ID] = make([]int, len(lines))
+	}
+
+	for i, line := range lines {
+		rows, err := q.Query(
+			`SELECT location_id, quantity FROM inventory_levels
+			 WHERE product_id = $1 AND variant_id IS NOT DISTINCT FROM $2 AND quantity > 0`,
+			line.ProductID, line.VariantID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var locationID string
+			var quantity int
+			if err := rows.Scan(&locationID, &quantity); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if perLine, ok := stock[locationID]; ok {
+				perLine[i] = quantity
+			}
+		}
+		rows.Close()
+	}
+	return stock, nil
+}
+
+// AllocateOrder choisit les emplacements d'expédition d'une commande : un seul
+// emplacement capable de tout servir est privilégié ; sinon, si le fractionnement
+// est autorisé, les lignes sont réparties dans l'ordre de préférence.
+func AllocateOrder(req *AllocationRequest) (*AllocationPlan, error) {
+	settings, err := GetAllocationSettings(db, req.MerchantID)
+	if err != nil {
+		return nil, err
+	}
+	allowSplit := settings.AllowSplit
+	if req.AllowSplit != nil {
+		allowSplit = *req.AllowSplit
+	}
+
+	locations, err := candidateLocations(db, req.MerchantID, settings.Strategy, strings.ToUpper(req.ShippingCountry))
+	if err != nil {
+		return nil, err
+	}
+	stock, err := locationStock(db, locations, req.Lines)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &AllocationPlan{Strategy: settings.Strategy, Shipments: []Shipment{}}
+
+	for _, location := range locations {
+		complete := true
+		for i, line := range req.Lines {
+			if stock[location.ID][i] < line.Quantity {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			plan.Shipments = append(plan.Shipments, Shipment{
+				LocationID:   location.ID,
+				LocationName: location.Name,
+				Lines:        req.Lines,
+			})
+			return plan, nil
+		}
+	}
+
+	if !allowSplit {
+		plan.Unallocated = req.Lines
+		return plan, errAllocationUnavailable
+	}
+
+	remaining := make([]int, len(req.Lines))
+	for i, line := range req.Lines {
+		remaining[i] = line.Quantity
+	}
+	for _, location := range locations {
+		shipment := Shipment{LocationID: location.ID, LocationName: location.Name}
+		for i, line := range req.Lines {
+			take := stock[location.ID][i]
+			if take > remaining[i] {
+				take = remaining[i]
+			}
+			if take == 0 {
+				continue
+			}
+			remaining[i] -= take
+			shipment.Lines = append(shipment.Lines, AllocationLine{ProductID: line.ProductID, VariantID: line.VariantID, Quantity: take})
+		}
+		if len(shipment.Lines) > 0 {
+			plan.Shipments = append(plan.Shipments, shipment)
+		}
+	}
+	plan.Split = len(plan.Shipments) > 1
+
+	for i, line := range req.Lines {
+		if remaining[i] > 0 {
+			plan.Unallocated = append(plan.Unallocated, AllocationLine{ProductID: line.ProductID, VariantID: line.VariantID, Quantity: remaining[i]})
+		}
+	}
+	if len(plan.Unallocated) > 0 {
+		return plan, errAllocationUnavailable
+	}
+	return plan, nil
+}
+
+// pickLocationsForLine prélève une ligne dans les emplacements du marchand par
+// ordre de priorité, lorsque la déduction n'indique pas d'emplacement
+func pickLocationsForLine(tx *sql.Tx, productID string, variantID *string, quantity int) ([]locationPick, error) {
+	rows, err := tx.Query(
+		`SELECT il.location_id, il.quantity
+		 FROM inventory_levels il
+		 JOIN stock_locations l ON l.id = il.location_id
+		 WHERE il.product_id = $1 AND il.variant_id IS NOT DISTINCT FROM $2 AND il.quantity > 0
+		 ORDER BY l.active DESC, l.fulfils_online DESC, l.priority, l.name
+		 FOR UPDATE OF il`,
+		productID, variantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var picks []locationPick
+	remaining := quantity
+	for remaining > 0 && rows.Next() {
+		var pick locationPick
+		var available int
+		if err := rows.Scan(&pick.LocationID, &available); err != nil {
+			return nil, err
+		}
+		pick.Quantity = available
+		if pick.Quantity > remaining {
+			pick.Quantity = remaining
+		}
+		remaining -= pick.Quantity
+		picks = append(picks, pick)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if remaining > 0 {
+		return nil, ErrInsufficientStock
+	}
+	return picks, nil
+}
+
+// handleAllocateOrder calcule le plan d'expédition d'une commande (appel interne du checkout)
+func handleAllocateOrder(c *gin.Context) {
+	var req AllocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan, err := AllocateOrder(&req)
+	if err == errAllocationUnavailable {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "plan": plan})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'allocation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// handleGetAllocationSettings retourne les règles d'allocation du marchand
+func handleGetAllocationSettings(c *gin.Context) {
+	settings, err := GetAllocationSettings(db, c.GetHeader("X-Merchant-ID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des règles d'allocation"})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// handleSaveAllocationSettings enregistre les règles d'allocation du marchand
+func handleSaveAllocationSettings(c *gin.Context) {
+	var settings AllocationSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := db.Exec(
+		`INSERT INTO allocation_settings (merchant_id, strategy, allow_split) VALUES ($1, $2, $3)
+		 ON CONFLICT (merchant_id) DO UPDATE SET strategy = $2, allow_split = $3, updated_at = CURRENT_TIMESTAMP`,
+		c.GetHeader("X-Merchant-ID"), settings.Strategy, settings.AllowSplit,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement des règles d'allocation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
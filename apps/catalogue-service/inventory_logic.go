@@ -3,48 +3,80 @@ package main
 import (
 	"database/sql"
 	"errors"
-	"log"
+	"fmt"
 	"time"
 )
 
+var (
+	// ErrInsufficientStock est retournée lorsqu'une réservation ou une déduction dépasserait le stock
+	ErrInsufficientStock = errors.New("stock insuffisant")
+	// ErrReservationNotFound est retournée pour une réservation inconnue ou déjà libérée
+	ErrReservationNotFound = errors.New("réservation introuvable")
+)
+
 // Inventory représente le stock d'un produit
 type Inventory struct {
-	ProductID   string    `json:"product_id" db:"product_id"`
-	VariantID   *string   `json:"variant_id,omitempty" db:"variant_id"`
-	Quantity    int       `json:"quantity" db:"quantity"`
-	Reserved    int       `json:"reserved" db:"reserved"` // Quantité réservée (dans les paniers)
-	Available   int       `json:"available" db:"available"` // Quantité disponible = Quantity - Reserved
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ProductID   string          `json:"product_id" db:"product_id"`
+	VariantID   *string         `json:"variant_id,omitempty" db:"variant_id"`
+	Quantity    int             `json:"quantity" db:"quantity"`
+	Reserved    int             `json:"reserved" db:"reserved"` // Quantité réservée (dans les paniers)
+	Available   int             `json:"available" db:"available"` // Quantité disponible = Quantity - Reserved
+	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`
+	Locations   []LocationLevel `json:"locations,omitempty"` // Stock par emplacement
+	// Politique de stock : deny, backorder ou preorder
+	Policy            string        `json:"policy" db:"policy"`
+	BackorderLimit    *int          `json:"backorder_limit,omitempty" db:"backorder_limit"`
+	BackorderLeadDays *int          `json:"backorder_lead_days,omitempty" db:"backorder_lead_days"`
+	PreorderUntil     *time.Time    `json:"preorder_until,omitempty" db:"preorder_until"`
+	Availability      *Availability `json:"availability,omitempty"`
 }
 
 // InventoryMovement représente un mouvement de stock
 type InventoryMovement struct {
-	ID          string    `json:"id" db:"id"`
-	ProductID   string    `json:"product_id" db:"product_id"`
-	VariantID   *string   `json:"variant_id,omitempty" db:"variant_id"`
-	Type        string    `json:"type" db:"type"` // in, out, adjustment
-	Quantity    int       `json:"quantity" db:"quantity"`
-	Reason      string    `json:"reason" db:"reason"`
-	ReferenceID *string   `json:"reference_id,omitempty" db:"reference_id"` // ID de commande, etc.
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ID           string    `json:"id" db:"id"`
+	ProductID    string    `json:"product_id" db:"product_id"`
+	VariantID    *string   `json:"variant_id,omitempty" db:"variant_id"`
+	LocationID   *string   `json:"location_id,omitempty" db:"location_id"`
+	Type         string    `json:"type" db:"type"` // in, out, adjustment
+	Quantity     int       `json:"quantity" db:"quantity"` // Variation signée
+	BalanceAfter int       `json:"balance_after" db:"balance_after"`
+	Reason       string    `json:"reason" db:"reason"`
+	ReferenceID  *string   `json:"reference_id,omitempty" db:"reference_id"` // ID de commande, etc.
+	Note         string    `json:"note,omitempty" db:"note"`
+	CreatedBy    string    `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 }
 
-// GetInventory récupère le stock d'un produit
+// StockChange décrit une modification de stock : quantité absolue (inventaire
+// physique) ou variation, avec le motif inscrit au registre
+type StockChange struct {
+	Quantity    *int   `json:"quantity,omitempty"`
+	Delta       *int   `json:"delta,omitempty"`
+	Reason      string `json:"reason"`
+	ReferenceID string `json:"reference_id,omitempty"`
+	Note        string `json:"note,omitempty"`
+}
+
+// GetInventory récupère le stock d'une variante, ou celui du produit entier
+// (somme de ses variantes) si variantID est nil
 func GetInventory(productID string, variantID *string) (*Inventory, error) {
+	if variantID == nil {
+		return getProductInventory(productID)
+	}
+	
 	var inv Inventory
 	var variantIDNull sql.NullString
 	
-	query := "SELECT product_id, variant_id, quantity, reserved, (quantity - reserved) as available, updated_at FROM inventory WHERE product_id = $1"
-	args := []interface{}{productID}
+	var backorderLimit, backorderLeadDays sql.NullInt64
+	var preorderUntil sql.NullTime
 	
-	if variantID != nil {
-		query += " AND variant_id = $2"
-		args = append(args, *variantID)
-	} else {
-		query += " AND variant_id IS NULL"
-	}
+	query := `SELECT product_id, variant_id, quantity, reserved, (quantity - reserved) as available, updated_at,
+		policy, backorder_limit, backorder_lead_days, preorder_until
+		FROM inventory WHERE product_id = $1 AND variant_id = $2`
+	args := []interface{}{productID, *variantID}
 	
-	err := db.QueryRow(query, args...).Scan(&inv.ProductID, &variantIDNull, &inv.Quantity, &inv.Reserved, &inv.Available, &inv.UpdatedAt)
+	err := db.QueryRow(query, args...).Scan(&inv.ProductID, &variantIDNull, &inv.Quantity, &inv.Reserved, &inv.Available, &inv.UpdatedAt,
+		&inv.Policy, &backorderLimit, &backorderLeadDays, &preorderUntil)
 	
 	if err == sql.ErrNoRows {
 		// Créer un inventaire vide si il n'existe pas
@@ -54,6 +86,7 @@ func GetInventory(productID string, variantID *string) (*Inventory, error) {
 		inv.Reserved = 0
 		inv.Available = 0
 		inv.UpdatedAt = time.Now()
+		inv.Policy = PolicyDeny
 		return &inv, nil
 	}
 	
@@ -65,76 +98,393 @@ func GetInventory(productID string, variantID *string) (*Inventory, error) {
 		v := variantIDNull.String
 		inv.VariantID = &v
 	}
+	if backorderLimit.Valid {
+		limit := int(backorderLimit.Int64)
+		inv.BackorderLimit = &limit
+	}
+	if backorderLeadDays.Valid {
+		days := int(backorderLeadDays.Int64)
+		inv.BackorderLeadDays = &days
+	}
+	if preorderUntil.Valid {
+		inv.PreorderUntil = &preorderUntil.Time
+	}
 	
 	return &inv, nil
 }
 
-// UpdateInventory met à jour le stock d'un produit
-func UpdateInventory(productID string, variantID *string, quantity int) error {
-	// Vérifier si l'inventaire existe
-	existing, err := GetInventory(productID, variantID)
+// getProductInventory cumule le stock des variantes d'un produit : la clé de
+// inventory impose une variante, il n'existe pas de ligne au niveau du produit.
+// Une variante en rupture avec des commandes en attente compte pour zéro au lieu
+// de masquer le stock des autres variantes ; la politique est celle par défaut.
+func getProductInventory(productID string) (*Inventory, error) {
+	inv := Inventory{ProductID: productID, Policy: PolicyDeny}
+	var updatedAt sql.NullTime
+	
+	err := db.QueryRow(
+		`SELECT COALESCE(SUM(quantity), 0), COALESCE(SUM(reserved), 0),
+		        COALESCE(SUM(GREATEST(quantity - reserved, 0)), 0), MAX(updated_at)
+		 FROM inventory WHERE product_id = $1`,
+		productID,
+	).Scan(&inv.Quantity, &inv.Reserved, &inv.Available, &updatedAt)
 	if err != nil {
+		return nil, err
+	}
+	
+	inv.UpdatedAt = time.Now()
+	if updatedAt.Valid {
+		inv.UpdatedAt = updatedAt.Time
+	}
+	return &inv, nil
+}
+
+// UpdateInventory modifie le stock d'un produit dans un emplacement (l'emplacement
+// par défaut du marchand si locationID est vide) ainsi que le total du réseau, et
+// inscrit le mouvement correspondant dans la même transaction. Une quantité
+// absolue est enregistrée comme une correction d'inventaire (count_correction) par défaut.
+func UpdateInventory(merchantID, productID string, variantID *string, locationID string, change *StockChange) (*InventoryMovement, error) {
+	var movement *InventoryMovement
+	err := withTx(func(tx *sql.Tx) error {
+		var err error
+		_, movement, err = applyStockChange(tx, merchantID, productID, variantID, locationID, change)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 	
-	if existing == nil || existing.Quantity == 0 {
-		// Créer un nouvel inventaire
-		_, err = db.Exec(
-			"INSERT INTO inventory (product_id, variant_id, quantity, reserved) VALUES ($1, $2, $3, 0) ON CONFLICT (product_id, variant_id) DO UPDATE SET quantity = $3, updated_at = CURRENT_TIMESTAMP",
-			productID, variantID, quantity,
-		)
+	notifySearchIndexer()
+	return movement, nil
+}
+
+// applyStockChange applique une modification de stock dans la transaction. Elle
+// retourne le stock de l'emplacement avant modification et le mouvement inscrit
+// (nil si le stock est inchangé).
+func applyStockChange(tx *sql.Tx, merchantID, productID string, variantID *string, locationID string, change *StockChange) (int, *InventoryMovement, error) {
+	if (change.Quantity == nil) == (change.Delta == nil) {
+		return 0, nil, fmt.Errorf("%w: quantity ou delta requis (l'un ou l'autre)", errInvalidStockChange)
+	}
+	if change.Reason == "" && change.Quantity != nil {
+		change.Reason = ReasonCountCorrection
+	}
+	
+	locationID, err := resolveLocationID(tx, merchantID, locationID)
+	if err != nil {
+		return 0, nil, err
+	}
+	
+	// Le stock de l'emplacement est verrouillé pour calculer la variation
+	current, _, err := lockLocationLevel(tx, locationID, productID, variantID)
+	if err != nil {
+		return 0, nil, err
+	}
+	
+	delta := 0
+	if change.Quantity != nil {
+		delta = *change.Quantity - current
 	} else {
-		// Mettre à jour l'inventaire existant
-		_, err = db.Exec(
-			"UPDATE inventory SET quantity = $1, updated_at = CURRENT_TIMESTAMP WHERE product_id = $2 AND (variant_id = $3 OR (variant_id IS NULL AND $3 IS NULL))",
-			quantity, productID, variantID,
-		)
+		delta = *change.Delta
+	}
+	if delta == 0 {
+		return current, nil, nil
+	}
+	if err := validateMovementReason(change.Reason, delta); err != nil {
+		return 0, nil, err
 	}
 	
-	return err
+	if err := adjustLocationLevel(tx, locationID, productID, variantID, delta, 0); err != nil {
+		return 0, nil, err
+	}
+	balance, err := adjustNetworkInventory(tx, productID, variantID, delta, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	
+	movement, err := recordInventoryMovement(tx, &InventoryMovement{
+		ProductID:    productID,
+		VariantID:    variantID,
+		LocationID:   &locationID,
+		Quantity:     delta,
+		BalanceAfter: balance,
+		Reason:       change.Reason,
+		ReferenceID:  optionalString(change.ReferenceID),
+		Note:         change.Note,
+		CreatedBy:    merchantID,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return current, movement, enqueueSearchOutbox(tx, productID, OutboxOpIndex)
 }
 
-// ReserveInventory réserve une quantité de stock (pour un panier)
-func ReserveInventory(productID string, variantID *string, quantity int) error {
-	available, err := CheckAvailability(productID, variantID, quantity)
-	if err != nil || !available {
-		return errors.New("stock insuffisant")
+// ReserveInventory réserve du stock pour un panier ou une commande. La réserve
+// n'est incrémentée que si la quantité disponible suffit, en une seule requête
+// conditionnelle : deux réservations concurrentes ne peuvent pas survendre.
+// Une clé d'idempotence déjà utilisée retourne la réservation existante.
+func ReserveInventory(req *ReservationRequest, idempotencyKey string) (*InventoryReservation, error) {
+	ttl := defaultReservationTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > maxReservationTTL {
+		ttl = maxReservationTTL
 	}
 	
-	_, err = db.Exec(
-		"UPDATE inventory SET reserved = reserved + $1, updated_at = CURRENT_TIMESTAMP WHERE product_id = $2 AND (variant_id = $3 OR (variant_id IS NULL AND $3 IS NULL))",
-		quantity, productID, variantID,
-	)
+	if idempotencyKey != "" {
+		existing, err := getReservationByKey(db, idempotencyKey)
+		if err != nil || existing != nil {
+			return existing, err
+		}
+	}
+	
+	var reservation *InventoryReservation
+	err := withTx(func(tx *sql.Tx) error {
+		// Au-delà du disponible, la politique de stock décide (réapprovisionnement, précommande) ;
+		// backordered compte les unités réservées sans stock
+		var backordered int
+		var fulfilment string
+		err := tx.QueryRow(
+			`UPDATE inventory SET reserved = reserved + $1, updated_at = CURRENT_TIMESTAMP
+			 WHERE product_id = $2 AND (variant_id = $3 OR (variant_id IS NULL AND $3 IS NULL))
+			   AND `+sellableSQL("quantity - reserved", "$1")+`
+			 RETURNING GREATEST(0, $1 - GREATEST(0, quantity - reserved + $1)),
+			           `+fulfilmentSQL("GREATEST(0, $1 - GREATEST(0, quantity - reserved + $1))"),
+			req.Quantity, req.ProductID, req.VariantID,
+		).Scan(&backordered, &fulfilment)
+		if err == sql.ErrNoRows {
+			return ErrInsufficientStock
+		}
+		if err != nil {
+			return err
+		}
+		
+		reservation, err = scanReservation(tx.QueryRow(
+			`INSERT INTO inventory_reservations (product_id, variant_id, quantity, owner_type, owner_id, idempotency_key, expires_at, backordered, fulfilment)
+			 VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9)
+			 RETURNING `+reservationColumns,
+			req.ProductID, req.VariantID, req.Quantity, req.OwnerType, req.OwnerID, idempotencyKey, time.Now().Add(ttl),
+			backordered, fulfilment,
+		))
+		if err != nil {
+			return err
+		}
+		return enqueueSearchOutbox(tx, req.ProductID, OutboxOpIndex)
+	})
+	
+	// Deux requêtes concurrentes avec la même clé : la seconde retourne la réservation de la première
+	if isUniqueViolation(err) && idempotencyKey != "" {
+		return getReservationByKey(db, idempotencyKey)
+	}
+	if err != nil {
+		return nil, err
+	}
 	
-	return err
+	notifySearchIndexer()
+	return reservation, nil
+}
+
+// ReleaseReservation libère une réservation active et restitue son stock
+func ReleaseReservation(reservationID string) error {
+	released, err := releaseReservations(ReservationReleased, "id = $2", reservationID)
+	if err != nil {
+		return err
+	}
+	if released == 0 {
+		return ErrReservationNotFound
+	}
+	return nil
 }
 
-// ReleaseInventory libère une quantité réservée
-func ReleaseInventory(productID string, variantID *string, quantity int) error {
-	_, err := db.Exec(
-		"UPDATE inventory SET reserved = GREATEST(0, reserved - $1), updated_at = CURRENT_TIMESTAMP WHERE product_id = $2 AND (variant_id = $3 OR (variant_id IS NULL AND $3 IS NULL))",
-		quantity, productID, variantID,
-	)
-	return err
+// ReleaseOwnerReservations libère toutes les réservations actives d'un panier ou d'une commande
+func ReleaseOwnerReservations(ownerType, ownerID string) (int, error) {
+	return releaseReservations(ReservationReleased, "owner_type = $2 AND owner_id = $3", ownerType, ownerID)
 }
 
-// DeductInventory déduit une quantité de stock (après commande)
-func DeductInventory(productID string, variantID *string, quantity int, orderID string) error {
-	available, err := CheckAvailability(productID, variantID, quantity)
-	if err != nil || !available {
-		return errors.New("stock insuffisant")
+// releaseReservations passe les réservations actives correspondant à la condition
+// au statut donné et décrémente la réserve en conséquence. La condition utilise
+// les paramètres à partir de $2.
+func releaseReservations(status string, condition string, args ...interface{}) (int, error) {
+	released := 0
+	err := withTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(
+			`UPDATE inventory_reservations SET status = $1, updated_at = CURRENT_TIMESTAMP
+			 WHERE status = 'active' AND `+condition+`
+			 RETURNING product_id, variant_id, quantity`,
+			append([]interface{}{status}, args...)...,
+		)
+		if err != nil {
+			return err
+		}
+		
+		type heldStock struct {
+			productID string
+			variantID sql.NullString
+			quantity  int
+		}
+		var held []heldStock
+		for rows.Next() {
+			var h heldStock
+			if err := rows.Scan(&h.productID, &h.variantID, &h.quantity); err != nil {
+				rows.Close()
+				return err
+			}
+			held = append(held, h)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		
+		for _, h := range held {
+			var variantID *string
+			if h.variantID.Valid {
+				variantID = &h.variantID.String
+			}
+			if _, err := tx.Exec(
+				`UPDATE inventory SET reserved = GREATEST(0, reserved - $1), updated_at = CURRENT_TIMESTAMP
+				 WHERE product_id = $2 AND (variant_id = $3 OR (variant_id IS NULL AND $3 IS NULL))`,
+				h.quantity, h.productID, variantID,
+			); err != nil {
+				return err
+			}
+			if err := enqueueSearchOutbox(tx, h.productID, OutboxOpIndex); err != nil {
+				return err
+			}
+		}
+		released = len(held)
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 	
-	// Déduire de la quantité et de la réserve
-	_, err = db.Exec(
-		"UPDATE inventory SET quantity = quantity - $1, reserved = GREATEST(0, reserved - $1), updated_at = CURRENT_TIMESTAMP WHERE product_id = $2 AND (variant_id = $3 OR (variant_id IS NULL AND $3 IS NULL))",
-		quantity, productID, variantID,
-	)
+	if released > 0 {
+		notifySearchIndexer()
+	}
+	return released, nil
+}
+
+// DeductInventory déduit du stock après commande. Les réservations du propriétaire
+// indiqué sont consommées ; la déduction échoue si le stock restant ne suffit pas.
+// Avec une clé d'idempotence, un retry ne décrémente pas une seconde fois et
+// DeductInventory retourne false.
+func DeductInventory(req *DeductionRequest, idempotencyKey string) (bool, error) {
+	applied := true
+	err := withTx(func(tx *sql.Tx) error {
+		if idempotencyKey != "" {
+			// Une requête concurrente avec la même clé attend la validation de celle-ci
+			result, err := tx.Exec(
+				`INSERT INTO inventory_operations (idempotency_key, operation, product_id, variant_id, quantity, reference_id)
+				 VALUES ($1, 'deduct', $2, $3, $4, $5)
+				 ON CONFLICT (idempotency_key) DO NOTHING`,
+				idempotencyKey, req.ProductID, req.VariantID, req.Quantity, req.OrderID,
+			)
+			if err != nil {
+				return err
+			}
+			if n, _ := result.RowsAffected(); n == 0 {
+				applied = false
+				return nil
+			}
+		}
+		
+		consumed := 0
+		if req.OwnerID != "" {
+			err := tx.QueryRow(
+				`WITH consumed AS (
+				     UPDATE inventory_reservations SET status = 'consumed', updated_at = CURRENT_TIMESTAMP
+				     WHERE status = 'active' AND owner_type = $1 AND owner_id = $2
+				       AND product_id = $3 AND (variant_id = $4 OR (variant_id IS NULL AND $4 IS NULL))
+				     RETURNING quantity
+				 )
+				 SELECT COALESCE(SUM(quantity), 0) FROM consumed`,
+				req.OwnerType, req.OwnerID, req.ProductID, req.VariantID,
+			).Scan(&consumed)
+			if err != nil {
+				return err
+			}
+		}
+		
+		// La quantité libérée par les réservations consommées redevient disponible pour cette commande
+		// Selon la politique de stock, le total du réseau peut devenir négatif : les
+		// unités vendues au-delà du stock physique (backordered) sont inscrites en reliquat
+		var balance, backordered int
+		var fulfilment string
+		err := tx.QueryRow(
+			`UPDATE inventory
+			 SET quantity = quantity - $1, reserved = GREATEST(0, reserved - $2), updated_at = CURRENT_TIMESTAMP
+			 WHERE product_id = $3 AND (variant_id = $4 OR (variant_id IS NULL AND $4 IS NULL))
+			   AND `+sellableSQL("quantity - GREATEST(0, reserved - $2)", "$1")+`
+			 RETURNING quantity, GREATEST(0, $1 - GREATEST(0, quantity + $1)),
+			           `+fulfilmentSQL("GREATEST(0, $1 - GREATEST(0, quantity + $1))"),
+			req.Quantity, consumed, req.ProductID, req.VariantID,
+		).Scan(&balance, &backordered, &fulfilment)
+		if err == sql.ErrNoRows {
+			return ErrInsufficientStock
+		}
+		if err != nil {
+			return err
+		}
+		
+		// Sortie des emplacements pour la part en stock : celui indiqué, sinon par ordre de priorité
+		onHand := req.Quantity - backordered
+		var picks []locationPick
+		switch {
+		case onHand == 0:
+			// Tout est en reliquat
+		case req.LocationID != "":
+			var merchantID string
+			if err := tx.QueryRow("SELECT merchant_id FROM products WHERE id = $1", req.ProductID).Scan(&merchantID); err != nil {
+				return err
+			}
+			locationID, err := resolveLocationID(tx, merchantID, req.LocationID)
+			if err != nil {
+				return err
+			}
+			picks = []locationPick{{LocationID: locationID, Quantity: onHand}}
+		default:
+			picks, err = pickLocationsForLine(tx, req.ProductID, req.VariantID, onHand)
+			if err != nil {
+				return err
+			}
+		}
+		
+		for _, pick := range picks {
+			locationID := pick.LocationID
+			if err := adjustLocationLevel(tx, locationID, req.ProductID, req.VariantID, -pick.Quantity, 0); err != nil {
+				return err
+			}
+			if _, err := recordInventoryMovement(tx, &InventoryMovement{
+				ProductID:    req.ProductID,
+				VariantID:    req.VariantID,
+				LocationID:   &locationID,
+				Quantity:     -pick.Quantity,
+				BalanceAfter: balance,
+				Reason:       ReasonSale,
+				ReferenceID:  &req.OrderID,
+				CreatedBy:    "checkout",
+			}); err != nil {
+				return err
+			}
+		}
+		if backordered > 0 {
+			if err := recordBackorder(tx, req, backordered, fulfilment, balance); err != nil {
+				return err
+			}
+		}
+		return enqueueSearchOutbox(tx, req.ProductID, OutboxOpIndex)
+	})
+	if err != nil {
+		return false, err
+	}
 	
-	return err
+	if applied {
+		notifySearchIndexer()
+	}
+	return applied, nil
 }
 
-// CheckAvailability vérifie si une quantité est disponible
+// CheckAvailability vérifie si une quantité peut être vendue selon la politique de stock
 func CheckAvailability(productID string, variantID *string, quantity int) (bool, error) {
 	inventory, err := GetInventory(productID, variantID)
 	if err != nil {
@@ -145,13 +495,15 @@ func CheckAvailability(productID string, variantID *string, quantity int) (bool,
 		return false, errors.New("produit non trouvé")
 	}
 	
-	return inventory.Available >= quantity, nil
+	return inventory.AvailabilityFor(quantity).Purchasable, nil
 }
 
-// SyncInventoryToElasticsearch synchronise le stock avec Elasticsearch
+// SyncInventoryToElasticsearch planifie la mise à jour du stock dans Elasticsearch
 func SyncInventoryToElasticsearch(productID string) error {
-	// TODO: Récupérer le produit et son stock
-	// TODO: Mettre à jour le document Elasticsearch
+	if err := enqueueSearchOutbox(db, productID, OutboxOpIndex); err != nil {
+		return err
+	}
+	notifySearchIndexer()
 	return nil
 }
 
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Motifs des mouvements de stock
+const (
+	ReasonOpeningBalance  = "opening_balance" // solde initial lors de la mise en place du registre
+	ReasonSale            = "sale"
+	ReasonReturn          = "return"
+	ReasonRestock         = "restock"
+	ReasonShrinkage       = "shrinkage" // casse, vol, péremption
+	ReasonCountCorrection = "count_correction"
+	ReasonTransferOut     = "transfer_out" // expédition d'un transfert entre emplacements
+	ReasonTransferIn      = "transfer_in"  // réception (ou annulation) d'un transfert
+)
+
+// errInvalidStockChange signale une modification de stock incohérente (motif, sens)
+var errInvalidStockChange = errors.New("modification de stock invalide")
+
+// movementReasonSigns indique le sens autorisé pour chaque motif saisi manuellement
+// (1 : entrée, -1 : sortie, 0 : les deux) ; les transferts sont inscrits par le système
+var movementReasonSigns = map[string]int{
+	ReasonSale:            -1,
+	ReasonReturn:          1,
+	ReasonRestock:         1,
+	ReasonShrinkage:       -1,
+	ReasonCountCorrection: 0,
+}
+
+// InventoryDiscrepancy représente un écart entre le stock et la somme du registre
+type InventoryDiscrepancy struct {
+	ProductID      string  `json:"product_id"`
+	VariantID      *string `json:"variant_id,omitempty"`
+	Quantity       int     `json:"quantity"`
+	LedgerQuantity int     `json:"ledger_quantity"`
+	Difference     int     `json:"difference"`
+}
+
+// validateMovementReason vérifie que le motif est connu et cohérent avec le sens du mouvement
+func validateMovementReason(reason string, delta int) error {
+	sign, ok := movementReasonSigns[reason]
+	if !ok {
+		return fmt.Errorf("%w: motif %q inconnu (sale, return, restock, shrinkage, count_correction)", errInvalidStockChange, reason)
+	}
+	if sign > 0 && delta < 0 || sign < 0 && delta > 0 {
+		return fmt.Errorf("%w: le motif %s n'autorise pas une variation de %d", errInvalidStockChange, reason, delta)
+	}
+	return nil
+}
+
+// movementType déduit le type d'un mouvement de son motif et de son sens
+func movementType(reason string, delta int) string {
+	switch {
+	case reason == ReasonCountCorrection || reason == ReasonOpeningBalance:
+		return "adjustment"
+	case delta > 0:
+		return "in"
+	default:
+		return "out"
+	}
+}
+
+// recordInventoryMovement inscrit un mouvement dans le registre, dans la
+// transaction qui modifie le stock
+func recordInventoryMovement(tx *sql.Tx, m *InventoryMovement) (*InventoryMovement, error) {
+	m.Type = movementType(m.Reason, m.Quantity)
+	err := tx.QueryRow(
+		`INSERT INTO inventory_movements (product_id, variant_id, location_id, type, quantity, balance_after, reason, reference_id, note, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''))
+		 RETURNING id, created_at`,
+		m.ProductID, m.VariantID, m.LocationID, m.Type, m.Quantity, m.BalanceAfter, m.Reason, m.ReferenceID, m.Note, m.CreatedBy,
+	).Scan(&m.ID, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ListInventoryMovements retourne les mouvements d'un produit, les plus récents d'abord
+func ListInventoryMovements(productID string, variantID *string, locationID, reason string, limit, offset int) ([]InventoryMovement, error) {
+	query := `SELECT id, product_id, variant_id, location_id, type, quantity, balance_after, reason, reference_id,
+	                 COALESCE(note, ''), COALESCE(created_by, ''), created_at
+	          FROM inventory_movements WHERE product_id = $1`
+	args := []interface{}{productID}
+
+	if variantID != nil {
+		args = append(args, *variantID)
+		query += fmt.Sprintf(" AND variant_id = $%d", len(args))
+	}
+	if locationID != "" {
+		args = append(args, locationID)
+		query += fmt.Sprintf(" AND location_id = $%d", len(args))
+	}
+	if reason != "" {
+		args = append(args, reason)
+		query += fmt.Sprintf(" AND reason = $%d", len(args))
+	}
+	args = append(args, limit, offset)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movements := []InventoryMovement{}
+	for rows.Next() {
+		var m InventoryMovement
+		var variant, location, reference sql.NullString
+		err := rows.Scan(&m.ID, &m.ProductID, &variant, &location, &m.Type, &m.Quantity, &m.BalanceAfter,
+			&m.Reason, &reference, &m.Note, &m.CreatedBy, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if variant.Valid {
+			m.VariantID = &variant.String
+		}
+		if location.Valid {
+			m.LocationID = &location.String
+		}
+		if reference.Valid {
+			m.ReferenceID = &reference.String
+		}
+		movements = append(movements, m)
+	}
+	return movements, rows.Err()
+}
+
+// ReconcileInventory compare le stock à la somme des mouvements du registre.
+// Avec apply, la quantité est recalculée depuis le registre ; la variation
+// n'est pas inscrite puisque le registre fait foi. productID vide couvre tout le stock.
+func ReconcileInventory(productID string, apply bool) ([]InventoryDiscrepancy, error) {
+	discrepancies := []InventoryDiscrepancy{}
+	err := withTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(
+			`SELECT i.product_id, i.variant_id, i.quantity, COALESCE(l.total, 0)
+			 FROM inventory i
+			 LEFT JOIN (
+			     SELECT product_id, variant_id, SUM(quantity) AS total
+			     FROM inventory_movements GROUP BY product_id, variant_id
+			 ) l ON l.product_id = i.product_id AND l.variant_id IS NOT DISTINCT FROM i.variant_id
+			 WHERE ($1 = '' OR i.product_id::text = $1) AND i.quantity <> COALESCE(l.total, 0)
+			 ORDER BY i.product_id
+			 FOR UPDATE OF i`,
+			productID,
+		)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var d InventoryDiscrepancy
+			var variant sql.NullString
+			if err := rows.Scan(&d.ProductID, &variant, &d.Quantity, &d.LedgerQuantity); err != nil {
+				rows.Close()
+				return err
+			}
+			if variant.Valid {
+				d.VariantID = &variant.String
+			}
+			d.Difference = d.LedgerQuantity - d.Quantity
+			discrepancies = append(discrepancies, d)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if !apply {
+			return nil
+		}
+		for _, d := range discrepancies {
+			if _, err := tx.Exec(
+				`UPDATE inventory SET quantity = $1, updated_at = CURRENT_TIMESTAMP
+				 WHERE product_id = $2 AND variant_id IS NOT DISTINCT FROM $3`,
+				d.LedgerQuantity, d.ProductID, d.VariantID,
+			); err != nil {
+				return err
+			}
+			if err := enqueueSearchOutbox(tx, d.ProductID, OutboxOpIndex); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if apply && len(discrepancies) > 0 {
+		notifySearchIndexer()
+	}
+	return discrepancies, nil
+}
+
+// runReconcileCommand exécute la commande reconcile-inventory [-apply]
+func runReconcileCommand(args []string) int {
+	fs := flag.NewFlagSet("reconcile-inventory", flag.ContinueOnError)
+	apply := fs.Bool("apply", false, "recalculer le stock depuis le registre")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	discrepancies, err := ReconcileInventory("", *apply)
+	if err != nil {
+		log.Printf("Erreur lors du rapprochement du stock: %v", err)
+		return 1
+	}
+	for _, d := range discrepancies {
+		log.Printf("Produit %s: stock %d, registre %d (écart %+d)", d.ProductID, d.Quantity, d.LedgerQuantity, d.Difference)
+	}
+	log.Printf("%d écart(s) détecté(s)", len(discrepancies))
+
+	if len(discrepancies) > 0 && !*apply {
+		return 3
+	}
+	return 0
+}
+
+// authorizeInventoryProduct vérifie que le produit existe et appartient au marchand
+func authorizeInventoryProduct(c *gin.Context, productID string) bool {
+	product, err := GetProductByID(productID)
+	if err != nil || product == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Produit introuvable"})
+		return false
+	}
+	if product.MerchantID != c.GetHeader("X-Merchant-ID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Accès non autorisé"})
+		return false
+	}
+	return true
+}
+
+// handleListInventoryMovements retourne le registre des mouvements d'un produit
+func handleListInventoryMovements(c *gin.Context) {
+	productID := c.Param("productId")
+	if !authorizeInventoryProduct(c, productID) {
+		return
+	}
+
+	var variantID *string
+	if v := c.Query("variant_id"); v != "" {
+		variantID = &v
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	movements, err := ListInventoryMovements(productID, variantID, c.Query("location_id"), c.Query("reason"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des mouvements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"movements": movements,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+// handleReconcileInventory compare le stock d'un produit au registre ; ?apply=true le réaligne
+func handleReconcileInventory(c *gin.Context) {
+	productID := c.Param("productId")
+	if !authorizeInventoryProduct(c, productID) {
+		return
+	}
+
+	apply := c.Query("apply") == "true"
+	discrepancies, err := ReconcileInventory(productID, apply)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors du rapprochement du stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"applied":       apply,
+		"discrepancies": discrepancies,
+		"checked_at":    time.Now(),
+	})
+}
+
+// optionalString retourne nil pour une chaîne vide
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Politiques de stock d'un produit ou d'une variante
+const (
+	PolicyDeny      = "deny"      // refus au-delà du stock disponible
+	PolicyBackorder = "backorder" // vente en réapprovisionnement, plafonnée par backorder_limit
+	PolicyPreorder  = "preorder"  // précommande jusqu'à la date de sortie
+)
+
+// Modes d'exécution d'une ligne réservée ou vendue
+const (
+	FulfilmentInStock   = "in_stock"
+	FulfilmentBackorder = "backorder"
+	FulfilmentPreorder  = "preorder"
+)
+
+// États de disponibilité exposés à la vitrine
+const (
+	AvailabilityInStock    = "in_stock"
+	AvailabilityBackorder  = "backorder"
+	AvailabilityPreorder   = "preorder"
+	AvailabilityOutOfStock = "out_of_stock"
+)
+
+// errBackorderNotFound est retournée pour un reliquat inconnu ou déjà expédié
+var errBackorderNotFound = errors.New("reliquat introuvable")
+
+// preorderOpenSQL est vrai tant que la précommande d'une ligne d'inventaire est ouverte
+const preorderOpenSQL = `(policy = 'preorder' AND (preorder_until IS NULL OR preorder_until > CURRENT_TIMESTAMP))`
+
+// sellableSQL retourne la condition SQL autorisant la vente de quantity unités
+// sur le disponible indiqué, selon la politique de la ligne d'inventaire
+func sellableSQL(available, quantity string) string {
+	return fmt.Sprintf(
+		`(%[1]s >= %[2]s OR ((policy = 'backorder' OR %[3]s)
+		   AND (backorder_limit IS NULL OR %[1]s - %[2]s >= -backorder_limit)))`,
+		available, quantity, preorderOpenSQL,
+	)
+}
+
+// fulfilmentSQL retourne le mode d'exécution d'une vente dont backordered unités dépassent le stock
+func fulfilmentSQL(backordered string) string {
+	return fmt.Sprintf(
+		`CASE WHEN %s THEN 'preorder' WHEN %s > 0 THEN 'backorder' ELSE 'in_stock' END`,
+		preorderOpenSQL, backordered,
+	)
+}
+
+// InventoryPolicy représente la politique de stock d'un produit ou d'une variante
+type InventoryPolicy struct {
+	VariantID         *string    `json:"variant_id,omitempty"`
+	Policy            string     `json:"policy" binding:"required,oneof=deny backorder preorder"`
+	BackorderLimit    *int       `json:"backorder_limit,omitempty" binding:"omitempty,min=0"` // nil : illimité
+	BackorderLeadDays *int       `json:"backorder_lead_days,omitempty" binding:"omitempty,min=0"`
+	PreorderUntil     *time.Time `json:"preorder_until,omitempty"` // date de sortie
+}
+
+// Availability décrit l'état de disponibilité d'un produit pour une quantité donnée
+type Availability struct {
+	State       string     `json:"state"` // in_stock, backorder, preorder, out_of_stock
+	Purchasable bool       `json:"purchasable"`
+	Available   int        `json:"available"`
+	MaxQuantity *int       `json:"max_quantity,omitempty"`  // nil : illimité
+	ShipsInDays *int       `json:"ships_in_days,omitempty"` // délai annoncé en réapprovisionnement
+	ReleaseDate *time.Time `json:"release_date,omitempty"`  // date de sortie d'une précommande
+}
+
+// preorderOpen indique si la précommande est ouverte à la date donnée
+func (inv *Inventory) preorderOpen(now time.Time) bool {
+	return inv.Policy == PolicyPreorder && (inv.PreorderUntil == nil || inv.PreorderUntil.After(now))
+}
+
+// AvailabilityFor évalue la disponibilité d'une quantité selon la politique de
+// stock, avec les mêmes règles que la réservation et la déduction
+func (inv *Inventory) AvailabilityFor(quantity int) *Availability {
+	a := &Availability{Available: inv.Available}
+	preorder := inv.preorderOpen(time.Now())
+	oversell := inv.Policy == PolicyBackorder || preorder
+
+	switch {
+	case !oversell:
+		limit := inv.Available
+		if limit < 0 {
+			limit = 0
+		}
+		a.MaxQuantity = &limit
+	case inv.BackorderLimit != nil:
+		limit := inv.Available + *inv.BackorderLimit
+		if limit < 0 {
+			limit = 0
+		}
+		a.MaxQuantity = &limit
+	}
+	a.Purchasable = quantity > 0 && (a.MaxQuantity == nil || quantity <= *a.MaxQuantity)
+
+	switch {
+	case !a.Purchasable:
+		a.State = AvailabilityOutOfStock
+	case preorder:
+		a.State = AvailabilityPreorder
+		a.ReleaseDate = inv.PreorderUntil
+	case inv.Available >= quantity:
+		a.State = AvailabilityInStock
+	default:
+		a.State = AvailabilityBackorder
+		a.ShipsInDays = inv.BackorderLeadDays
+	}
+	return a
+}
+
+// SetInventoryPolicy enregistre la politique de stock d'un produit ou d'une variante
+func SetInventoryPolicy(productID string, p *InventoryPolicy) error {
+	if p.Policy != PolicyPreorder {
+		p.PreorderUntil = nil
+	}
+	return withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(
+			"INSERT INTO inventory (product_id, variant_id, quantity, reserved) VALUES ($1, $2, 0, 0) ON CONFLICT (product_id, variant_id) DO NOTHING",
+			productID, p.VariantID,
+		); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			`UPDATE inventory
+			 SET policy = $1, backorder_limit = $2, backorder_lead_days = $3, preorder_until = $4, updated_at = CURRENT_TIMESTAMP
+			 WHERE product_id = $5 AND variant_id IS NOT DISTINCT FROM $6`,
+			p.Policy, p.BackorderLimit, p.BackorderLeadDays, p.PreorderUntil, productID, p.VariantID,
+		)
+		return err
+	})
+}
+
+// recordBackorder inscrit les unités vendues au-delà du stock, à expédier à l'arrivée de la marchandise
+func recordBackorder(tx *sql.Tx, req *DeductionRequest, quantity int, fulfilment string, balance int) error {
+	if fulfilment == FulfilmentInStock {
+		fulfilment = FulfilmentBackorder
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO inventory_backorders (product_id, variant_id, order_id, quantity, fulfilment)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		req.ProductID, req.VariantID, req.OrderID, quantity, fulfilment,
+	); err != nil {
+		return err
+	}
+	// Sortie du réseau sans emplacement : le stock physique n'a pas encore bougé
+	_, err := recordInventoryMovement(tx, &InventoryMovement{
+		ProductID:    req.ProductID,
+		VariantID:    req.VariantID,
+		Quantity:     -quantity,
+		BalanceAfter: balance,
+		Reason:       ReasonSale,
+		ReferenceID:  &req.OrderID,
+		Note:         "reliquat",
+		CreatedBy:    "checkout",
+	})
+	return err
+}
+
+// Backorder représente des unités vendues sans stock
+type Backorder struct {
+	ID          string     `json:"id"`
+	ProductID   string     `json:"product_id"`
+	VariantID   *string    `json:"variant_id,omitempty"`
+	OrderID     string     `json:"order_id"`
+	Quantity    int        `json:"quantity"`
+	Fulfilment  string     `json:"fulfilment"` // backorder, preorder
+	LocationID  *string    `json:"location_id,omitempty"`
+	FulfilledAt *time.Time `json:"fulfilled_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+const backorderColumns = `b.id, b.product_id, b.variant_id, b.order_id, b.quantity, b.fulfilment, b.location_id,
+	b.fulfilled_at, b.created_at`
+
+func scanBackorder(row interface{ Scan(...interface{}) error }) (*Backorder, error) {
+	var b Backorder
+	var variantID, locationID sql.NullString
+	var fulfilledAt sql.NullTime
+	err := row.Scan(&b.ID, &b.ProductID, &variantID, &b.OrderID, &b.Quantity, &b.Fulfilment, &locationID,
+		&fulfilledAt, &b.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if variantID.Valid {
+		b.VariantID = &variantID.String
+	}
+	if locationID.Valid {
+		b.LocationID = &locationID.String
+	}
+	if fulfilledAt.Valid {
+		b.FulfilledAt = &fulfilledAt.Time
+	}
+	return &b, nil
+}
+
+// FulfilBackorder expédie un reliquat depuis un emplacement (celui indiqué, sinon
+// par ordre de priorité). Le total du réseau a déjà été décrémenté à la vente :
+// seuls les stocks des emplacements diminuent. Un reliquat prélevé dans
+// plusieurs emplacements est scindé en une ligne expédiée par emplacement ;
+// la ligne retournée est celle du premier.
+func FulfilBackorder(merchantID, backorderID, locationID string) (*Backorder, error) {
+	var backorder *Backorder
+	err := withTx(func(tx *sql.Tx) error {
+		var err error
+		backorder, err = scanBackorder(tx.QueryRow(
+			"SELECT "+backorderColumns+` FROM inventory_backorders b
+			 JOIN products p ON p.id = b.product_id
+			 WHERE b.id = $1 AND p.merchant_id = $2 AND b.fulfilled_at IS NULL
+			 FOR UPDATE OF b`,
+			backorderID, merchantID,
+		))
+		if err == sql.ErrNoRows {
+			return errBackorderNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var picks []locationPick
+		if locationID != "" {
+			resolved, err := resolveLocationID(tx, merchantID, locationID)
+			if err != nil {
+				return err
+			}
+			picks = []locationPick{{LocationID: resolved, Quantity: backorder.Quantity}}
+		} else {
+			picks, err = pickLocationsForLine(tx, backorder.ProductID, backorder.VariantID, backorder.Quantity)
+			if err != nil {
+				return err
+			}
+		}
+		for _, pick := range picks {
+			if err := adjustLocationLevel(tx, pick.LocationID, backorder.ProductID, backorder.VariantID, -pick.Quantity, 0); err != nil {
+				return err
+			}
+		}
+
+		for _, pick := range picks[1:] {
+			if _, err := tx.Exec(
+				`INSERT INTO inventory_backorders (product_id, variant_id, order_id, quantity, fulfilment, location_id, fulfilled_at, created_at)
+				 SELECT product_id, variant_id, order_id, $1, fulfilment, $2, CURRENT_TIMESTAMP, created_at
+				 FROM inventory_backorders WHERE id = $3`,
+				pick.Quantity, pick.LocationID, backorderID,
+			); err != nil {
+				return err
+			}
+		}
+
+		backorder, err = scanBackorder(tx.QueryRow(
+			`UPDATE inventory_backorders b SET fulfilled_at = CURRENT_TIMESTAMP, location_id = $1, quantity = $2
+			 WHERE b.id = $3
+			 RETURNING `+backorderColumns,
+			picks[0].LocationID, picks[0].Quantity, backorderID,
+		))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return backorder, nil
+}
+
+// handleGetAvailability retourne l'état de disponibilité d'un produit (?variant_id, ?quantity)
+func handleGetAvailability(c *gin.Context) {
+	var variantID *string
+	if v := c.Query("variant_id"); v != "" {
+		variantID = &v
+	}
+	quantity, err := strconv.Atoi(c.DefaultQuery("quantity", "1"))
+	if err != nil || quantity < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quantity invalide"})
+		return
+	}
+
+	inventory, err := GetInventory(c.Param("productId"), variantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération du stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, inventory.AvailabilityFor(quantity))
+}
+
+// handleUpdateInventoryPolicy modifie la politique de stock d'un produit ou d'une variante
+func handleUpdateInventoryPolicy(c *gin.Context) {
+	productID := c.Param("productId")
+	if !authorizeInventoryProduct(c, productID) {
+		return
+	}
+
+	var req InventoryPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := SetInventoryPolicy(productID, &req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour de la politique de stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+// handleListBackorders liste les reliquats du marchand (?status=open|fulfilled, ?order_id)
+func handleListBackorders(c *gin.Context) {
+	query := "SELECT " + backorderColumns + ` FROM inventory_backorders b
+		JOIN products p ON p.id = b.product_id
+		WHERE p.merchant_id = $1`
+	args := []interface{}{c.GetHeader("X-Merchant-ID")}
+
+	switch c.DefaultQuery("status", "open") {
+	case "open":
+		query += " AND b.fulfilled_at IS NULL"
+	case "fulfilled":
+		query += " AND b.fulfilled_at IS NOT NULL"
+	case "all":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status invalide (open, fulfilled, all)"})
+		return
+	}
+	if orderID := c.Query("order_id"); orderID != "" {
+		args = append(args, orderID)
+		query += fmt.Sprintf(" AND b.order_id = $%d", len(args))
+	}
+	query += " ORDER BY b.created_at LIMIT 500"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des reliquats"})
+		return
+	}
+	defer rows.Close()
+
+	backorders := []*Backorder{}
+	for rows.Next() {
+		backorder, err := scanBackorder(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des reliquats"})
+			return
+		}
+		backorders = append(backorders, backorder)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"backorders": backorders})
+}
+
+// handleFulfilBackorder expédie un reliquat une fois la marchandise reçue
+func handleFulfilBackorder(c *gin.Context) {
+	var req struct {
+		LocationID string `json:"location_id"`
+	}
+	// Le corps est facultatif
+	_ = c.ShouldBindJSON(&req)
+
+	backorder, err := FulfilBackorder(c.GetHeader("X-Merchant-ID"), c.Param("id"), req.LocationID)
+	switch {
+	case err == errBackorderNotFound, err == errLocationNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err == ErrInsufficientStock:
+		c.JSON(http.StatusConflict, gin.H{"error": "Stock insuffisant dans les emplacements pour expédier ce reliquat"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'expédition du reliquat"})
+	default:
+		c.JSON(http.StatusOK, backorder)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+)
+
+// createTestLocation crée un emplacement du marchand
+func createTestLocation(t *testing.T, merchantID, code string, priority int) string {
+	t.Helper()
+	var id string
+	if err := db.QueryRow(
+		"INSERT INTO stock_locations (merchant_id, name, code, priority) VALUES ($1, $2, $2, $3) RETURNING id",
+		merchantID, code, priority,
+	).Scan(&id); err != nil {
+		t.Fatalf("création de l'emplacement %s: %v", code, err)
+	}
+	return id
+}
+
+// backorderTestVariant crée une variante vendue en réapprovisionnement puis vend
+// sold unités sans stock
+func backorderTestVariant(t *testing.T, merchantID string, sold int) (productID, variantID string) {
+	t.Helper()
+	productID, variantID = createTestProduct(t, merchantID)
+	if err := SetInventoryPolicy(productID, &InventoryPolicy{VariantID: &variantID, Policy: PolicyBackorder}); err != nil {
+		t.Fatalf("politique de stock: %v", err)
+	}
+	if _, err := DeductInventory(&DeductionRequest{
+		ProductID: productID,
+		VariantID: &variantID,
+		Quantity:  sold,
+		OrderID:   "order-" + variantID,
+	}, ""); err != nil {
+		t.Fatalf("vente en réapprovisionnement: %v", err)
+	}
+	return productID, variantID
+}
+
+func TestRestockBackorderedVariant(t *testing.T) {
+	openTestDB(t)
+	merchantID := testMerchantID(t)
+	productID, variantID := backorderTestVariant(t, merchantID, 10)
+
+	steps := []struct {
+		name    string
+		change  StockChange
+		balance int
+	}{
+		{"réapprovisionnement inférieur au déficit", StockChange{Delta: intPtr(4), Reason: ReasonRestock}, -6},
+		{"correction d'inventaire", StockChange{Quantity: intPtr(1)}, -9},
+		{"retour client", StockChange{Delta: intPtr(2), Reason: ReasonReturn}, -7},
+	}
+	for _, step := range steps {
+		change := step.change
+		if _, err := UpdateInventory(merchantID, productID, &variantID, "", &change); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		inventory, err := GetInventory(productID, &variantID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inventory.Quantity != step.balance {
+			t.Errorf("%s: total du réseau %d, attendu %d", step.name, inventory.Quantity, step.balance)
+		}
+	}
+
+	// Une sortie reste limitée par le stock physique de l'emplacement
+	if _, err := UpdateInventory(merchantID, productID, &variantID, "", &StockChange{Delta: intPtr(-4), Reason: ReasonShrinkage}); err != ErrInsufficientStock {
+		t.Errorf("sortie au-delà du stock de l'emplacement: erreur %v, attendu ErrInsufficientStock", err)
+	}
+}
+
+func TestRestockDenyPolicyKeepsNonNegativeGuard(t *testing.T) {
+	openTestDB(t)
+	merchantID := testMerchantID(t)
+	productID, variantID := createTestProduct(t, merchantID)
+
+	if _, err := UpdateInventory(merchantID, productID, &variantID, "", &StockChange{Delta: intPtr(3), Reason: ReasonRestock}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UpdateInventory(merchantID, productID, &variantID, "", &StockChange{Delta: intPtr(-5), Reason: ReasonShrinkage}); err != ErrInsufficientStock {
+		t.Errorf("sortie au-delà du stock: erreur %v, attendu ErrInsufficientStock", err)
+	}
+}
+
+func TestFulfilBackorderSplitsAcrossLocations(t *testing.T) {
+	openTestDB(t)
+	merchantID := testMerchantID(t)
+	productID, variantID := backorderTestVariant(t, merchantID, 5)
+
+	first := createTestLocation(t, merchantID, "PARIS", 1)
+	second := createTestLocation(t, merchantID, "LYON", 2)
+	for location, quantity := range map[string]int{first: 3, second: 2} {
+		if _, err := UpdateInventory(merchantID, productID, &variantID, location, &StockChange{Delta: intPtr(quantity), Reason: ReasonRestock}); err != nil {
+			t.Fatalf("réapprovisionnement: %v", err)
+		}
+	}
+
+	var backorderID string
+	if err := db.QueryRow("SELECT id FROM inventory_backorders WHERE variant_id = $1", variantID).Scan(&backorderID); err != nil {
+		t.Fatal(err)
+	}
+	backorder, err := FulfilBackorder(merchantID, backorderID, "")
+	if err != nil {
+		t.Fatalf("expédition du reliquat: %v", err)
+	}
+	if backorder.LocationID == nil || *backorder.LocationID != first || backorder.Quantity != 3 {
+		t.Errorf("ligne retournée: %+v, attendu 3 unités depuis l'emplacement prioritaire", backorder)
+	}
+
+	rows, err := db.Query(
+		"SELECT location_id, quantity FROM inventory_backorders WHERE variant_id = $1 AND fulfilled_at IS NOT NULL",
+		variantID,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	shipped := map[string]int{}
+	for rows.Next() {
+		var location string
+		var quantity int
+		if err := rows.Scan(&location, &quantity); err != nil {
+			t.Fatal(err)
+		}
+		shipped[location] += quantity
+	}
+	if shipped[first] != 3 || shipped[second] != 2 || len(shipped) != 2 {
+		t.Errorf("reliquat expédié %v, attendu 3 depuis %s et 2 depuis %s", shipped, first, second)
+	}
+
+	levels, err := GetLocationLevels(productID, &variantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, level := range levels {
+		if level.Quantity != 0 {
+			t.Errorf("emplacement %s: stock %d après expédition, attendu 0", level.LocationCode, level.Quantity)
+		}
+	}
+}
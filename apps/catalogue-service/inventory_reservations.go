@@ -0,0 +1,275 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Statuts d'une réservation de stock
+const (
+	ReservationActive   = "active"
+	ReservationReleased = "released"
+	ReservationConsumed = "consumed"
+	ReservationExpired  = "expired"
+)
+
+const (
+	// defaultReservationTTL est la durée de vie d'une réservation sans ttl_seconds
+	defaultReservationTTL = 15 * time.Minute
+	// maxReservationTTL plafonne la durée de vie demandée
+	maxReservationTTL = 24 * time.Hour
+	// reservationSweepBatchSize est le nombre de réservations expirées libérées par passe
+	reservationSweepBatchSize = 500
+)
+
+// InventoryReservation représente une quantité de stock retenue pour un panier ou une commande
+type InventoryReservation struct {
+	ID        string  `json:"id"`
+	ProductID string  `json:"product_id"`
+	VariantID *string `json:"variant_id,omitempty"`
+	Quantity  int     `json:"quantity"`
+	OwnerType string  `json:"owner_type"` // cart, order
+	OwnerID   string  `json:"owner_id"`
+	Status    string  `json:"status"`
+	// Unités réservées au-delà du stock et mode d'exécution (in_stock, backorder, preorder)
+	Backordered int       `json:"backordered"`
+	Fulfilment  string    `json:"fulfilment"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ReservationRequest représente une demande de réservation de stock
+type ReservationRequest struct {
+	ProductID  string  `json:"product_id" binding:"required"`
+	VariantID  *string `json:"variant_id,omitempty"`
+	Quantity   int     `json:"quantity" binding:"required,min=1"`
+	OwnerType  string  `json:"owner_type" binding:"required,oneof=cart order"`
+	OwnerID    string  `json:"owner_id" binding:"required"`
+	TTLSeconds int     `json:"ttl_seconds"`
+}
+
+// ReleaseOwnerRequest identifie le panier ou la commande dont les réservations sont libérées
+type ReleaseOwnerRequest struct {
+	OwnerType string `json:"owner_type" binding:"required,oneof=cart order"`
+	OwnerID   string `json:"owner_id" binding:"required"`
+}
+
+// DeductionRequest représente une déduction de stock après commande
+type DeductionRequest struct {
+	ProductID string  `json:"product_id" binding:"required"`
+	VariantID *string `json:"variant_id,omitempty"`
+	Quantity  int     `json:"quantity" binding:"required,min=1"`
+	OrderID   string  `json:"order_id" binding:"required"`
+	// Emplacement d'expédition retenu par l'allocation ; à défaut, ordre de priorité
+	LocationID string `json:"location_id,omitempty"`
+	// Réservations à consommer (panier ou commande), facultatif
+	OwnerType string `json:"owner_type,omitempty"`
+	OwnerID   string `json:"owner_id,omitempty"`
+}
+
+const reservationColumns = `id, product_id, variant_id, quantity, owner_type, owner_id, status, backordered, fulfilment,
+	expires_at, created_at, updated_at`
+
+func scanReservation(row interface{ Scan(...interface{}) error }) (*InventoryReservation, error) {
+	var r InventoryReservation
+	var variantID sql.NullString
+	err := row.Scan(&r.ID, &r.ProductID, &variantID, &r.Quantity, &r.OwnerType, &r.OwnerID,
+		&r.Status, &r.Backordered, &r.Fulfilment, &r.ExpiresAt, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if variantID.Valid {
+		r.VariantID = &variantID.String
+	}
+	return &r, nil
+}
+
+// getReservationByKey retourne la réservation créée avec la clé d'idempotence, ou nil
+func getReservationByKey(q queryer, idempotencyKey string) (*InventoryReservation, error) {
+	reservation, err := scanReservation(q.QueryRow(
+		"SELECT "+reservationColumns+" FROM inventory_reservations WHERE idempotency_key = $1",
+		idempotencyKey,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return reservation, err
+}
+
+// isUniqueViolation indique si l'erreur provient d'une contrainte d'unicité
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// ReleaseExpiredReservations libère un lot de réservations expirées. Les lignes
+// sont verrouillées (SKIP LOCKED) pour permettre plusieurs instances.
+func ReleaseExpiredReservations() (int, error) {
+	return releaseReservations(ReservationExpired,
+		`id IN (
+		     SELECT id FROM inventory_reservations
+		     WHERE status = 'active' AND expires_at <= CURRENT_TIMESTAMP
+		     ORDER BY expires_at
+		     LIMIT $2
+		     FOR UPDATE SKIP LOCKED
+		 )`,
+		reservationSweepBatchSize,
+	)
+}
+
+// StartReservationSweeper lance la libération périodique des réservations expirées
+func StartReservationSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			for {
+				released, err := ReleaseExpiredReservations()
+				if err != nil {
+					log.Printf("Erreur lors de la libération des réservations expirées: %v", err)
+					break
+				}
+				if released > 0 {
+					log.Printf("%d réservation(s) expirée(s) libérée(s)", released)
+				}
+				if released < reservationSweepBatchSize {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// handleCreateReservation réserve du stock ; l'en-tête Idempotency-Key rend la requête rejouable
+func handleCreateReservation(c *gin.Context) {
+	var req ReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reservation, err := ReserveInventory(&req, c.GetHeader("Idempotency-Key"))
+	if err == ErrInsufficientStock {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Erreur lors de la réservation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la réservation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, reservation)
+}
+
+// handleListReservations liste les réservations actives d'un panier ou d'une commande
+func handleListReservations(c *gin.Context) {
+	ownerType := c.Query("owner_type")
+	ownerID := c.Query("owner_id")
+	if ownerType == "" || ownerID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "owner_type et owner_id requis"})
+		return
+	}
+
+	rows, err := db.Query(
+		"SELECT "+reservationColumns+` FROM inventory_reservations
+		 WHERE owner_type = $1 AND owner_id = $2 AND status = 'active'
+		 ORDER BY created_at`,
+		ownerType, ownerID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des réservations"})
+		return
+	}
+	defer rows.Close()
+
+	reservations := []*InventoryReservation{}
+	for rows.Next() {
+		reservation, err := scanReservation(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des réservations"})
+			return
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reservations": reservations})
+}
+
+// handleReleaseReservation libère une réservation
+func handleReleaseReservation(c *gin.Context) {
+	err := ReleaseReservation(c.Param("id"))
+	if err == ErrReservationNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Erreur lors de la libération de la réservation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la libération de la réservation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Réservation libérée"})
+}
+
+// handleReleaseOwnerReservations libère les réservations d'un panier abandonné ou d'une commande annulée
+func handleReleaseOwnerReservations(c *gin.Context) {
+	var req ReleaseOwnerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	released, err := ReleaseOwnerReservations(req.OwnerType, req.OwnerID)
+	if err != nil {
+		log.Printf("Erreur lors de la libération des réservations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la libération des réservations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"released": released})
+}
+
+// handleDeductInventory déduit le stock d'une commande ; l'en-tête Idempotency-Key
+// garantit qu'un retry ne décrémente pas deux fois
+func handleDeductInventory(c *gin.Context) {
+	var req DeductionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.OwnerType == "") != (req.OwnerID == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "owner_type et owner_id vont ensemble"})
+		return
+	}
+
+	idempotencyKey := c.GetHeader("Idempotency-Key")
+	if idempotencyKey == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "en-tête Idempotency-Key requis"})
+		return
+	}
+
+	applied, err := DeductInventory(&req, idempotencyKey)
+	if err == ErrInsufficientStock {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err == errLocationNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Erreur lors de la déduction du stock: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la déduction du stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"applied": applied})
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// stockedTestVariant crée une variante avec stock unités dans l'emplacement par défaut
+func stockedTestVariant(t *testing.T, stock int) (productID, variantID string) {
+	t.Helper()
+	merchantID := testMerchantID(t)
+	productID, variantID = createTestProduct(t, merchantID)
+	delta := stock
+	if _, err := UpdateInventory(merchantID, productID, &variantID, "", &StockChange{Delta: &delta, Reason: ReasonRestock}); err != nil {
+		t.Fatalf("réapprovisionnement: %v", err)
+	}
+	return productID, variantID
+}
+
+func getTestInventory(t *testing.T, productID, variantID string) *Inventory {
+	t.Helper()
+	inventory, err := GetInventory(productID, &variantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inventory
+}
+
+func TestConcurrentReservationsDoNotOversell(t *testing.T) {
+	openTestDB(t)
+	const stock, buyers = 5, 20
+	productID, variantID := stockedTestVariant(t, stock)
+
+	errs := make([]error, buyers)
+	var wg sync.WaitGroup
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = ReserveInventory(&ReservationRequest{
+				ProductID: productID,
+				VariantID: &variantID,
+				Quantity:  1,
+				OwnerType: "cart",
+				OwnerID:   fmt.Sprintf("cart-%d", i),
+			}, "")
+		}(i)
+	}
+	wg.Wait()
+
+	reserved, refused := 0, 0
+	for _, err := range errs {
+		switch err {
+		case nil:
+			reserved++
+		case ErrInsufficientStock:
+			refused++
+		default:
+			t.Errorf("erreur inattendue: %v", err)
+		}
+	}
+	if reserved != stock || refused != buyers-stock {
+		t.Errorf("%d réservations acceptées et %d refusées, attendu %d et %d", reserved, refused, stock, buyers-stock)
+	}
+	if inventory := getTestInventory(t, productID, variantID); inventory.Reserved != stock || inventory.Available != 0 {
+		t.Errorf("réserve %d et disponible %d, attendu %d et 0", inventory.Reserved, inventory.Available, stock)
+	}
+}
+
+func TestReservationIdempotencyKey(t *testing.T) {
+	openTestDB(t)
+	productID, variantID := stockedTestVariant(t, 10)
+	req := &ReservationRequest{ProductID: productID, VariantID: &variantID, Quantity: 3, OwnerType: "cart", OwnerID: "cart-1"}
+
+	// Retry séquentiel puis retries concurrents avec la même clé
+	first, err := ReserveInventory(req, "reserve-cart-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 5)
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reservation, err := ReserveInventory(req, "reserve-cart-1")
+			if err == nil {
+				ids[i] = reservation.ID
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+
+	for i, id := range ids {
+		if errs[i] != nil {
+			t.Fatalf("retry %d: %v", i, errs[i])
+		}
+		if id != first.ID {
+			t.Errorf("retry %d: réservation %s, attendu %s", i, id, first.ID)
+		}
+	}
+	if inventory := getTestInventory(t, productID, variantID); inventory.Reserved != 3 {
+		t.Errorf("réserve %d, attendu 3 (une seule réservation)", inventory.Reserved)
+	}
+}
+
+func TestConcurrentReservationsWithSameKey(t *testing.T) {
+	openTestDB(t)
+	productID, variantID := stockedTestVariant(t, 10)
+	req := &ReservationRequest{ProductID: productID, VariantID: &variantID, Quantity: 2, OwnerType: "order", OwnerID: "order-1"}
+
+	ids := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reservation, err := ReserveInventory(req, "reserve-order-1")
+			if err != nil {
+				t.Errorf("réservation %d: %v", i, err)
+				return
+			}
+			ids[i] = reservation.ID
+		}(i)
+	}
+	wg.Wait()
+
+	for i, id := range ids {
+		if id != ids[0] {
+			t.Errorf("réservation %d: %s, attendu %s", i, id, ids[0])
+		}
+	}
+	if inventory := getTestInventory(t, productID, variantID); inventory.Reserved != 2 {
+		t.Errorf("réserve %d, attendu 2 (une seule réservation)", inventory.Reserved)
+	}
+}
+
+func TestDeductionReplayIsAppliedOnce(t *testing.T) {
+	openTestDB(t)
+	productID, variantID := stockedTestVariant(t, 10)
+	if _, err := ReserveInventory(&ReservationRequest{
+		ProductID: productID, VariantID: &variantID, Quantity: 4, OwnerType: "order", OwnerID: "order-1",
+	}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &DeductionRequest{
+		ProductID: productID, VariantID: &variantID, Quantity: 4, OrderID: "order-1",
+		OwnerType: "order", OwnerID: "order-1",
+	}
+	applied := 0
+	for i := 0; i < 3; i++ {
+		ok, err := DeductInventory(req, "deduct-order-1")
+		if err != nil {
+			t.Fatalf("déduction %d: %v", i+1, err)
+		}
+		if ok {
+			applied++
+		}
+	}
+	if applied != 1 {
+		t.Errorf("déduction appliquée %d fois, attendu 1", applied)
+	}
+
+	inventory := getTestInventory(t, productID, variantID)
+	if inventory.Quantity != 6 || inventory.Reserved != 0 {
+		t.Errorf("stock %d et réserve %d, attendu 6 et 0", inventory.Quantity, inventory.Reserved)
+	}
+	var sales int
+	if err := db.QueryRow(
+		"SELECT COUNT(*) FROM inventory_movements WHERE variant_id = $1 AND reason = $2",
+		variantID, ReasonSale,
+	).Scan(&sales); err != nil {
+		t.Fatal(err)
+	}
+	if sales != 1 {
+		t.Errorf("%d mouvements de vente inscrits, attendu 1", sales)
+	}
+}
+
+func TestReleaseExpiredReservations(t *testing.T) {
+	openTestDB(t)
+	productID, variantID := stockedTestVariant(t, 5)
+	reservation, err := ReserveInventory(&ReservationRequest{
+		ProductID: productID, VariantID: &variantID, Quantity: 5, OwnerType: "cart", OwnerID: "cart-1",
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(
+		"UPDATE inventory_reservations SET expires_at = CURRENT_TIMESTAMP - INTERVAL '1 minute' WHERE id = $1",
+		reservation.ID,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deux passes concurrentes (deux instances) ne libèrent la réservation qu'une fois
+	released := make([]int, 2)
+	var wg sync.WaitGroup
+	for i := range released {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			n, err := ReleaseExpiredReservations()
+			if err != nil {
+				t.Errorf("passe %d: %v", i, err)
+			}
+			released[i] = n
+		}(i)
+	}
+	wg.Wait()
+
+	if released[0]+released[1] != 1 {
+		t.Errorf("%d réservations libérées, attendu 1", released[0]+released[1])
+	}
+	if inventory := getTestInventory(t, productID, variantID); inventory.Reserved != 0 || inventory.Available != 5 {
+		t.Errorf("réserve %d et disponible %d, attendu 0 et 5", inventory.Reserved, inventory.Available)
+	}
+}
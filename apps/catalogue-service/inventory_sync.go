@@ -0,0 +1,403 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// maxInventorySyncRows limite le nombre de lignes par synchronisation
+const maxInventorySyncRows = 10000
+
+// errUnknownSKU est retournée pour un SKU absent du catalogue du marchand
+var errUnknownSKU = errors.New("sku inconnu")
+
+// InventorySyncRow représente le stock d'un SKU transmis par un WMS : quantité
+// absolue ou variation, dans l'emplacement indiqué ou celui de la requête
+type InventorySyncRow struct {
+	SKU        string `json:"sku"`
+	Quantity   *int   `json:"quantity,omitempty"`
+	Delta      *int   `json:"delta,omitempty"`
+	LocationID string `json:"location_id,omitempty"`
+
+	line int // ligne du fichier CSV
+}
+
+// InventorySyncRequest représente une synchronisation de stock en masse
+type InventorySyncRequest struct {
+	Mode        string             `json:"mode"`    // partial (défaut) ou atomic
+	DryRun      bool               `json:"dry_run"` // calcule les écarts sans rien modifier
+	LocationID  string             `json:"location_id,omitempty"`
+	Reason      string             `json:"reason,omitempty"` // count_correction par défaut
+	ReferenceID string             `json:"reference_id,omitempty"`
+	Items       []InventorySyncRow `json:"items" binding:"required,min=1"`
+}
+
+// InventorySyncResult représente le résultat d'une ligne de synchronisation
+type InventorySyncResult struct {
+	Index      int     `json:"index"`
+	Line       int     `json:"line,omitempty"`
+	SKU        string  `json:"sku"`
+	ProductID  string  `json:"product_id,omitempty"`
+	VariantID  *string `json:"variant_id,omitempty"`
+	LocationID string  `json:"location_id,omitempty"`
+	Previous   *int    `json:"previous,omitempty"` // stock de l'emplacement avant synchronisation
+	Quantity   *int    `json:"quantity,omitempty"` // stock de l'emplacement après synchronisation
+	Delta      int     `json:"delta"`
+	Changed    bool    `json:"changed"`
+	Success    bool    `json:"success"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// InventorySyncReport représente le rapport d'une synchronisation
+type InventorySyncReport struct {
+	Mode      string                `json:"mode"`
+	DryRun    bool                  `json:"dry_run"`
+	Committed bool                  `json:"committed"`
+	Total     int                   `json:"total"`
+	Succeeded int                   `json:"succeeded"`
+	Failed    int                   `json:"failed"`
+	Changed   int                   `json:"changed"`
+	Results   []InventorySyncResult `json:"results"`
+}
+
+// skuTarget identifie le produit ou la variante portant un SKU
+type skuTarget struct {
+	ProductID string
+	VariantID *string
+}
+
+// resolveSKUs retrouve en une requête les produits et variantes du marchand portant les SKU
+func resolveSKUs(q queryer, merchantID string, skus []string) (map[string]skuTarget, error) {
+	rows, err := q.Query(
+		`SELECT p.sku, p.id, NULL FROM products p
+		 WHERE p.merchant_id = $1 AND p.sku = ANY($2)
+		 UNION ALL
+		 SELECT v.sku, v.product_id, v.id FROM product_variants v
+		 JOIN products p ON p.id = v.product_id
+		 WHERE p.merchant_id = $1 AND v.sku = ANY($2)`,
+		merchantID, pq.Array(skus),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := make(map[string]skuTarget, len(skus))
+	for rows.Next() {
+		var sku string
+		var target skuTarget
+		var variantID sql.NullString
+		if err := rows.Scan(&sku, &target.ProductID, &variantID); err != nil {
+			return nil, err
+		}
+		if variantID.Valid {
+			target.VariantID = &variantID.String
+		}
+		targets[sku] = target
+	}
+	return targets, rows.Err()
+}
+
+// SyncInventory applique le stock transmis par SKU dans une transaction. En mode
+// partial, chaque ligne est isolée par un savepoint ; en mode atomic, la première
+// erreur annule l'ensemble. En dry run, toutes les lignes sont évaluées puis la
+// transaction est annulée : le rapport donne les écarts sans rien modifier.
+func SyncInventory(merchantID string, req *InventorySyncRequest) (*InventorySyncReport, error) {
+	report := &InventorySyncReport{
+		Mode:    req.Mode,
+		DryRun:  req.DryRun,
+		Total:   len(req.Items),
+		Results: make([]InventorySyncResult, 0, len(req.Items)),
+	}
+	isolated := req.Mode == BulkModePartial || req.DryRun
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	skus := make([]string, 0, len(req.Items))
+	for _, row := range req.Items {
+		skus = append(skus, row.SKU)
+	}
+	targets, err := resolveSKUs(tx, merchantID, skus)
+	if err != nil {
+		return nil, err
+	}
+	locations := map[string]string{}
+
+	for i := range req.Items {
+		row := &req.Items[i]
+		result := InventorySyncResult{Index: i, Line: row.line, SKU: row.SKU}
+
+		if isolated {
+			if _, err := tx.Exec("SAVEPOINT sync_item"); err != nil {
+				return nil, err
+			}
+		}
+
+		rowErr := applySyncRow(tx, merchantID, req, row, targets, locations, &result)
+		if rowErr != nil {
+			if !errors.Is(rowErr, errInvalidStockChange) && rowErr != errUnknownSKU &&
+				rowErr != errLocationNotFound && rowErr != ErrInsufficientStock {
+				return nil, rowErr
+			}
+			result.Error = rowErr.Error()
+			report.Failed++
+			report.Results = append(report.Results, result)
+
+			if !isolated {
+				// La transaction est annulée : les lignes déjà appliquées sont
+				// marquées annulées et les suivantes ne sont pas tentées
+				for j := range report.Results[:len(report.Results)-1] {
+					report.Results[j].Success = false
+					report.Results[j].Error = "annulé (transaction atomique)"
+				}
+				report.Succeeded = 0
+				report.Changed = 0
+				report.Failed = len(report.Results)
+				return report, nil
+			}
+			if _, err := tx.Exec("ROLLBACK TO SAVEPOINT sync_item"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if isolated {
+			if _, err := tx.Exec("RELEASE SAVEPOINT sync_item"); err != nil {
+				return nil, err
+			}
+		}
+
+		result.Success = true
+		report.Succeeded++
+		if result.Changed {
+			report.Changed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	// En dry run, la transaction est annulée par le Rollback différé
+	if req.DryRun {
+		return report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	report.Committed = true
+
+	return report, nil
+}
+
+// applySyncRow applique une ligne de synchronisation et complète son résultat
+func applySyncRow(tx *sql.Tx, merchantID string, req *InventorySyncRequest, row *InventorySyncRow,
+	targets map[string]skuTarget, locations map[string]string, result *InventorySyncResult) error {
+	target, ok := targets[row.SKU]
+	if !ok {
+		return errUnknownSKU
+	}
+	result.ProductID = target.ProductID
+	result.VariantID = target.VariantID
+
+	// Les emplacements sont vérifiés une fois par requête
+	requested := row.LocationID
+	if requested == "" {
+		requested = req.LocationID
+	}
+	locationID, ok := locations[requested]
+	if !ok {
+		var err error
+		if locationID, err = resolveLocationID(tx, merchantID, requested); err != nil {
+			return err
+		}
+		locations[requested] = locationID
+	}
+	result.LocationID = locationID
+
+	reason := req.Reason
+	if reason == "" {
+		reason = ReasonCountCorrection
+	}
+	previous, movement, err := applyStockChange(tx, merchantID, target.ProductID, target.VariantID, locationID, &StockChange{
+		Quantity:    row.Quantity,
+		Delta:       row.Delta,
+		Reason:      reason,
+		ReferenceID: req.ReferenceID,
+		Note:        "synchronisation",
+	})
+	if err != nil {
+		return err
+	}
+
+	quantity := previous
+	if movement != nil {
+		result.Delta = movement.Quantity
+		result.Changed = true
+		quantity += movement.Quantity
+	}
+	result.Previous = &previous
+	result.Quantity = &quantity
+	return nil
+}
+
+// parseInventorySyncCSV lit un fichier CSV avec un en-tête : sku, quantity et/ou
+// delta, location_id facultatif. Une cellule vide est ignorée.
+func parseInventorySyncCSV(r io.Reader) ([]InventorySyncRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("fichier CSV vide")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["sku"]; !ok {
+		return nil, errors.New("colonne sku requise")
+	}
+	_, hasQuantity := columns["quantity"]
+	_, hasDelta := columns["delta"]
+	if !hasQuantity && !hasDelta {
+		return nil, errors.New("colonne quantity ou delta requise")
+	}
+
+	cell := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	parseInt := func(line int, name, value string) (*int, error) {
+		if value == "" {
+			return nil, nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("ligne %d: %s invalide: %q", line, name, value)
+		}
+		return &n, nil
+	}
+
+	rows := []InventorySyncRow{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) >= maxInventorySyncRows {
+			return nil, fmt.Errorf("maximum %d lignes par synchronisation", maxInventorySyncRows)
+		}
+
+		row := InventorySyncRow{SKU: cell(record, "sku"), LocationID: cell(record, "location_id"), line: line}
+		if row.Quantity, err = parseInt(line, "quantity", cell(record, "quantity")); err != nil {
+			return nil, err
+		}
+		if row.Delta, err = parseInt(line, "delta", cell(record, "delta")); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("aucune ligne dans le fichier CSV")
+	}
+	return rows, nil
+}
+
+// handleSyncInventory synchronise le stock de plusieurs SKU (JSON)
+func handleSyncInventory(c *gin.Context) {
+	var req InventorySyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	runInventorySync(c, &req)
+}
+
+// handleSyncInventoryCSV synchronise le stock depuis un fichier CSV, envoyé en
+// multipart (champ file) ou comme corps text/csv. Les options passent en query :
+// mode, dry_run, location_id, reason, reference_id.
+func handleSyncInventoryCSV(c *gin.Context) {
+	body := io.Reader(c.Request.Body)
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "champ file requis"})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Fichier illisible"})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	rows, err := parseInventorySyncCSV(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	runInventorySync(c, &InventorySyncRequest{
+		Mode:        c.Query("mode"),
+		DryRun:      dryRun,
+		LocationID:  c.Query("location_id"),
+		Reason:      c.Query("reason"),
+		ReferenceID: c.Query("reference_id"),
+		Items:       rows,
+	})
+}
+
+// runInventorySync valide la requête, applique la synchronisation et répond avec le rapport
+func runInventorySync(c *gin.Context, req *InventorySyncRequest) {
+	if req.Mode == "" {
+		req.Mode = BulkModePartial
+	}
+	if req.Mode != BulkModeAtomic && req.Mode != BulkModePartial {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode invalide (atomic ou partial)"})
+		return
+	}
+	if len(req.Items) > maxInventorySyncRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("maximum %d lignes par synchronisation", maxInventorySyncRows)})
+		return
+	}
+
+	report, err := SyncInventory(c.GetHeader("X-Merchant-ID"), req)
+	if err != nil {
+		log.Printf("Erreur lors de la synchronisation du stock: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la synchronisation du stock"})
+		return
+	}
+
+	if report.Committed && report.Changed > 0 {
+		notifySearchIndexer()
+	}
+
+	status := http.StatusOK
+	if !report.Committed && !report.DryRun {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, report)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLicenseKeyImport est le nombre maximal de clés importées par requête
+const maxLicenseKeyImport = 10000
+
+// LicenseKey est une clé de la réserve d'un produit
+type LicenseKey struct {
+	ID          string     `json:"id"`
+	ProductID   string     `json:"product_id"`
+	VariantID   *string    `json:"variant_id,omitempty"` // nil : toutes les variantes
+	Key         string     `json:"license_key"`
+	Status      string     `json:"status"` // available, assigned, revoked
+	OrderItemID *string    `json:"order_item_id,omitempty"`
+	AssignedAt  *time.Time `json:"assigned_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// ImportLicenseKeysRequest ajoute des clés à la réserve d'un produit
+type ImportLicenseKeysRequest struct {
+	VariantID string   `json:"variant_id"`
+	Keys      []string `json:"keys" binding:"required"`
+}
+
+// assignLicenseKey attribue une clé à une ligne de commande qui n'en a pas
+// encore reçu. Retourne false si le produit a une réserve de clés mais
+// qu'aucune n'est disponible ; un produit sans réserve ne reçoit pas de clé.
+func assignLicenseKey(tx *sql.Tx, orderItemID, productID string, variantID *string) (bool, error) {
+	var assigned bool
+	err := tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM license_keys WHERE order_item_id = $1)",
+		orderItemID,
+	).Scan(&assigned)
+	if err != nil || assigned {
+		return true, err
+	}
+
+	assigned, err = takeLicenseKey(tx, orderItemID, productID, variantID)
+	if err != nil || assigned {
+		return assigned, err
+	}
+
+	var hasPool bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM license_keys WHERE product_id = $1)", productID).Scan(&hasPool)
+	return !hasPool, err
+}
+
+// takeLicenseKey attribue à la ligne la première clé disponible, en préférant
+// les clés propres à la variante
+func takeLicenseKey(tx *sql.Tx, orderItemID, productID string, variantID *string) (bool, error) {
+	var keyID string
+	err := tx.QueryRow(
+		`UPDATE license_keys SET status = 'assigned', order_item_id = $1, assigned_at = CURRENT_TIMESTAMP
+		 WHERE id = (
+		     SELECT id FROM license_keys
+		     WHERE product_id = $2 AND status = 'available' AND (variant_id IS NULL OR variant_id = $3)
+		     ORDER BY variant_id NULLS LAST, created_at
+		     LIMIT 1
+		     FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING id`,
+		orderItemID, productID, variantID,
+	).Scan(&keyID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// assignPendingLicenseKeys attribue les clés nouvellement importées aux lignes
+// de commande restées sans clé, de la plus ancienne à la plus récente
+func assignPendingLicenseKeys(tx *sql.Tx, productID string) (int, error) {
+	rows, err := tx.Query(
+		`SELECT l.order_item_id, l.variant_id FROM digital_order_lines l
+		 WHERE l.product_id = $1 AND NOT EXISTS (SELECT 1 FROM license_keys k WHERE k.order_item_id = l.order_item_id)
+		 ORDER BY l.created_at`,
+		productID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	type pendingLine struct {
+		orderItemID string
+		variantID   *string
+	}
+	var pending []pendingLine
+	for rows.Next() {
+		var line pendingLine
+		var variantID sql.NullString
+		if err := rows.Scan(&line.orderItemID, &variantID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if variantID.Valid {
+			line.variantID = &variantID.String
+		}
+		pending = append(pending, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, line := range pending {
+		assigned, err := takeLicenseKey(tx, line.orderItemID, productID, line.variantID)
+		if err != nil {
+			return count, err
+		}
+		if assigned {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ImportLicenseKeys ajoute des clés à la réserve (les doublons sont ignorés) et
+// les attribue aux commandes en attente de clé
+func ImportLicenseKeys(product *Product, variantID *string, keys []string) (imported, assigned int, err error) {
+	err = withTx(func(tx *sql.Tx) error {
+		for _, key := range keys {
+			result, err := tx.Exec(
+				`INSERT INTO license_keys (merchant_id, product_id, variant_id, license_key)
+				 VALUES ($1, $2, $3, $4)
+				 ON CONFLICT (product_id, license_key) DO NOTHING`,
+				product.MerchantID, product.ID, variantID, key,
+			)
+			if err != nil {
+				return err
+			}
+			n, _ := result.RowsAffected()
+			imported += int(n)
+		}
+
+		var err error
+		assigned, err = assignPendingLicenseKeys(tx, product.ID)
+		return err
+	})
+	return imported, assigned, err
+}
+
+// handleListLicenseKeys liste la réserve de clés d'un produit (?status=) et
+// le nombre de clés par état
+func handleListLicenseKeys(c *gin.Context) {
+	product, ok := authorizeDigitalProduct(c)
+	if !ok {
+		return
+	}
+
+	query := `SELECT id, product_id, variant_id, license_key, status, order_item_id, assigned_at, created_at
+		FROM license_keys WHERE product_id = $1`
+	args := []interface{}{product.ID}
+	if status := c.Query("status"); status != "" {
+		query += " AND status = $2"
+		args = append(args, status)
+	}
+
+	rows, err := db.Query(query+" ORDER BY created_at", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des clés"})
+		return
+	}
+	defer rows.Close()
+
+	keys := []LicenseKey{}
+	counts := map[string]int{"available": 0, "assigned": 0, "revoked": 0}
+	for rows.Next() {
+		var k LicenseKey
+		var variantID, orderItemID sql.NullString
+		var assignedAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.ProductID, &variantID, &k.Key, &k.Status, &orderItemID, &assignedAt, &k.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des clés"})
+			return
+		}
+		if variantID.Valid {
+			k.VariantID = &variantID.String
+		}
+		if orderItemID.Valid {
+			k.OrderItemID = &orderItemID.String
+		}
+		if assignedAt.Valid {
+			k.AssignedAt = &assignedAt.Time
+		}
+		counts[k.Status]++
+		keys = append(keys, k)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys, "counts": counts})
+}
+
+// handleImportLicenseKeys ajoute des clés à la réserve d'un produit
+func handleImportLicenseKeys(c *gin.Context) {
+	product, ok := authorizeDigitalProduct(c)
+	if !ok {
+		return
+	}
+
+	var req ImportLicenseKeysRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	keys := []string{}
+	for _, key := range req.Keys {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 || len(keys) > maxLicenseKeyImport {
+		respondValidationErrors(c, ValidationErrors{{"keys", fmt.Sprintf("Entre 1 et %d clés", maxLicenseKeyImport)}})
+		return
+	}
+	variantID, ok := productVariantParam(c, product.ID, req.VariantID)
+	if !ok {
+		return
+	}
+
+	imported, assigned, err := ImportLicenseKeys(product, variantID, keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'import des clés"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"imported":   imported,
+		"duplicates": len(keys) - imported,
+		"assigned":   assigned, // clés attribuées aux commandes en attente
+	})
+}
+
+// handleDeleteLicenseKey retire une clé de la réserve : une clé disponible est
+// supprimée, une clé attribuée est révoquée
+func handleDeleteLicenseKey(c *gin.Context) {
+	product, ok := authorizeDigitalProduct(c)
+	if !ok {
+		return
+	}
+
+	var status string
+	err := db.QueryRow(
+		`WITH deleted AS (
+		     DELETE FROM license_keys WHERE id::text = $1 AND product_id = $2 AND status = 'available' RETURNING status
+		 ), revoked AS (
+		     UPDATE license_keys SET status = 'revoked'
+		     WHERE id::text = $1 AND product_id = $2 AND status = 'assigned' RETURNING status
+		 )
+		 SELECT 'deleted' FROM deleted UNION ALL SELECT 'revoked' FROM revoked`,
+		c.Param("keyId"), product.ID,
+	).Scan(&status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Clé introuvable"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la suppression de la clé"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": status})
+}
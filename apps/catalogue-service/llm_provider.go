@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Fournisseurs LLM sélectionnables via LLM_PROVIDER ou les réglages du marchand
+const (
+	LLMProviderOpenAI    = "openai"
+	LLMProviderAnthropic = "anthropic"
+	LLMProviderOllama    = "ollama"
+	// LLMProviderFake renvoie des réponses déterministes, sans appel réseau (tests, développement)
+	LLMProviderFake = "fake"
+)
+
+// llmRetryBaseDelay est le délai avant la première nouvelle tentative, doublé à
+// chaque essai (variable pour que les tests le raccourcissent)
+var llmRetryBaseDelay = 500 * time.Millisecond
+
+var errLLMNotConfigured = errors.New("fournisseur LLM non configuré")
+
+// CompletionRequest est une demande de génération adressée à un fournisseur
+type CompletionRequest struct {
+	Model       string
+	System      string
+	Prompt      string
+	MaxTokens   int
+	Temperature float64
+	// JSON demande une réponse sous forme d'objet JSON (si le fournisseur le permet)
+	JSON bool
+}
+
+// TokenUsage est la consommation de tokens d'un appel
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// CompletionResponse est le texte généré et sa consommation
+type CompletionResponse struct {
+	Text  string
+	Model string
+	Usage TokenUsage
+}
+
+// LLMProvider abstrait l'API de génération de texte utilisée par AIService
+type LLMProvider interface {
+	Name() string
+	DefaultModel() string
+	Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error)
+}
+
+// llmProviderError est une réponse en erreur d'un fournisseur
+type llmProviderError struct {
+	Provider string
+	Status   int
+	Body     string
+}
+
+func (e *llmProviderError) Error() string {
+	return fmt.Sprintf("erreur API %s (%d): %s", e.Provider, e.Status, e.Body)
+}
+
+// retryable indique si l'erreur est transitoire (limite de débit, erreur serveur)
+func (e *llmProviderError) retryable() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// newLLMProviders construit les fournisseurs configurés par l'environnement
+func newLLMProviders(client *http.Client) map[string]LLMProvider {
+	providers := make(map[string]LLMProvider)
+	if key := getEnv("OPENAI_API_KEY", ""); key != "" {
+		providers[LLMProviderOpenAI] = &openAIProvider{
+			apiKey:  key,
+			baseURL: strings.TrimSuffix(getEnv("OPENAI_BASE_URL", "https://api.openai.com/v1"), "/"),
+			model:   getEnv("OPENAI_MODEL", "gpt-4"),
+			client:  client,
+		}
+	}
+	if key := getEnv("ANTHROPIC_API_KEY", ""); key != "" {
+		providers[LLMProviderAnthropic] = &anthropicProvider{
+			apiKey:  key,
+			baseURL: strings.TrimSuffix(getEnv("ANTHROPIC_BASE_URL", "https://api.anthropic.com/v1"), "/"),
+			model:   getEnv("ANTHROPIC_MODEL", "claude-3-5-haiku-latest"),
+			client:  client,
+		}
+	}
+	if baseURL := getEnv("OLLAMA_BASE_URL", ""); baseURL != "" {
+		providers[LLMProviderOllama] = &ollamaProvider{
+			baseURL: strings.TrimSuffix(baseURL, "/"),
+			model:   getEnv("OLLAMA_MODEL", "llama3"),
+			client:  client,
+		}
+	}
+	if getEnv("LLM_PROVIDER", LLMProviderOpenAI) == LLMProviderFake {
+		providers[LLMProviderFake] = &fakeLLMProvider{}
+	}
+	return providers
+}
+
+// postJSON envoie une requête JSON à un fournisseur et décode sa réponse
+func postJSON(ctx context.Context, client *http.Client, provider, url string, headers map[string]string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &llmProviderError{Provider: provider, Status: resp.StatusCode, Body: string(bodyBytes)}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// completeWithRetry appelle le fournisseur en réessayant les erreurs transitoires
+// (réseau, 429, 5xx) avec un délai exponentiel
+func completeWithRetry(ctx context.Context, provider LLMProvider, req *CompletionRequest, maxRetries int) (*CompletionResponse, error) {
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, lastErr
+			case <-time.After(llmRetryBaseDelay << (attempt - 1)):
+			}
+		}
+
+		resp, err := provider.Complete(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+
+		var providerErr *llmProviderError
+		if errors.As(err, &providerErr) && !providerErr.retryable() {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// openAIProvider parle l'API chat completions d'OpenAI et des services compatibles
+type openAIProvider struct {
+	apiKey  string
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+func (p *openAIProvider) Name() string         { return LLMProviderOpenAI }
+func (p *openAIProvider) DefaultModel() string { return p.model }
+
+func (p *openAIProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	body := map[string]interface{}{
+		"model": req.Model,
+		"messages": []map[string]string{
+			{"role": "system", "content": req.System},
+			{"role": "user", "content": req.Prompt},
+		},
+		"max_tokens":  req.MaxTokens,
+		"temperature": req.Temperature,
+	}
+	if req.JSON {
+		body["response_format"] = map[string]string{"type": "json_object"}
+	}
+
+	var response struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	headers := map[string]string{"Authorization": "Bearer " + p.apiKey}
+	if err := postJSON(ctx, p.client, p.Name(), p.baseURL+"/chat/completions", headers, body, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("aucune réponse de l'API")
+	}
+
+	return &CompletionResponse{
+		Text:  response.Choices[0].Message.Content,
+		Model: firstNonEmpty(response.Model, req.Model),
+		Usage: TokenUsage{PromptTokens: response.Usage.PromptTokens, CompletionTokens: response.Usage.CompletionTokens},
+	}, nil
+}
+
+// anthropicJSONInstruction et anthropicJSONPrefill imposent une réponse JSON à
+// l'API messages d'Anthropic, qui n'a pas d'option response_format
+const (
+	anthropicJSONInstruction = "Réponds uniquement avec un objet JSON valide, sans texte autour ni bloc de code."
+	anthropicJSONPrefill     = "{"
+)
+
+// anthropicProvider parle l'API messages d'Anthropic
+type anthropicProvider struct {
+	apiKey  string
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+func (p *anthropicProvider) Name() string         { return LLMProviderAnthropic }
+func (p *anthropicProvider) DefaultModel() string { return p.model }
+
+func (p *anthropicProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	system := req.System
+	messages := []map[string]string{{"role": "user", "content": req.Prompt}}
+	if req.JSON {
+		// L'API n'a pas de mode JSON : la consigne est ajoutée au prompt système et
+		// la réponse est amorcée par "{", que le modèle complète
+		system = strings.TrimSpace(system + "\n\n" + anthropicJSONInstruction)
+		messages = append(messages, map[string]string{"role": "assistant", "content": anthropicJSONPrefill})
+	}
+	body := map[string]interface{}{
+		"model":       req.Model,
+		"system":      system,
+		"messages":    messages,
+		"max_tokens":  req.MaxTokens,
+		"temperature": req.Temperature,
+	}
+
+	var response struct {
+		Model   string `json:"model"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	headers := map[string]string{"x-api-key": p.apiKey, "anthropic-version": "2023-06-01"}
+	if err := postJSON(ctx, p.client, p.Name(), p.baseURL+"/messages", headers, body, &response); err != nil {
+		return nil, err
+	}
+
+	var text strings.Builder
+	for _, block := range response.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return nil, fmt.Errorf("aucune réponse de l'API")
+	}
+	result := text.String()
+	if req.JSON {
+		// La réponse reprend après l'amorce, qui n'y figure pas
+		result = anthropicJSONPrefill + result
+	}
+
+	return &CompletionResponse{
+		Text:  result,
+		Model: firstNonEmpty(response.Model, req.Model),
+		Usage: TokenUsage{PromptTokens: response.Usage.InputTokens, CompletionTokens: response.Usage.OutputTokens},
+	}, nil
+}
+
+// ollamaProvider parle l'API chat d'un serveur local de type Ollama
+type ollamaProvider struct {
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+func (p *ollamaProvider) Name() string         { return LLMProviderOllama }
+func (p *ollamaProvider) DefaultModel() string { return p.model }
+
+func (p *ollamaProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	body := map[string]interface{}{
+		"model": req.Model,
+		"messages": []map[string]string{
+			{"role": "system", "content": req.System},
+			{"role": "user", "content": req.Prompt},
+		},
+		"stream": false,
+		"options": map[string]interface{}{
+			"num_predict": req.MaxTokens,
+			"temperature": req.Temperature,
+		},
+	}
+	if req.JSON {
+		body["format"] = "json"
+	}
+
+	var response struct {
+		Model   string `json:"model"`
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		PromptEvalCount int `json:"prompt_eval_count"`
+		EvalCount       int `json:"eval_count"`
+	}
+	if err := postJSON(ctx, p.client, p.Name(), p.baseURL+"/api/chat", nil, body, &response); err != nil {
+		return nil, err
+	}
+	if response.Message.Content == "" {
+		return nil, fmt.Errorf("aucune réponse de l'API")
+	}
+
+	return &CompletionResponse{
+		Text:  response.Message.Content,
+		Model: firstNonEmpty(response.Model, req.Model),
+		Usage: TokenUsage{PromptTokens: response.PromptEvalCount, CompletionTokens: response.EvalCount},
+	}, nil
+}
+
+// fakeLLMProvider génère un texte déterministe dérivé de la demande : la même
+// demande donne toujours la même réponse et la même consommation
+type fakeLLMProvider struct{}
+
+func (p *fakeLLMProvider) Name() string         { return LLMProviderFake }
+func (p *fakeLLMProvider) DefaultModel() string { return "fake-1" }
+
+func (p *fakeLLMProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(req.Model + "\x00" + req.System + "\x00" + req.Prompt))
+	digest := hex.EncodeToString(sum[:4])
+	subject := strings.SplitN(req.Prompt, "\n", 2)[0]
+	text := fmt.Sprintf("Texte généré (%s) pour : %s [%s]", req.Model, subject, digest)
+	if req.JSON {
+		// Objet couvrant tous les champs de contenu produit générables ou traduisibles
+		payload, err := json.Marshal(map[string]interface{}{
+			"name":             "Nom " + digest,
+			"description":      text,
+			"seo_title":        "Titre " + digest,
+			"meta_description": "Description courte " + digest,
+			"tags":             []string{"fake", digest},
+		})
+		if err != nil {
+			return nil, err
+		}
+		text = string(payload)
+	}
+
+	return &CompletionResponse{
+		Text:  text,
+		Model: req.Model,
+		Usage: TokenUsage{
+			PromptTokens:     len(strings.Fields(req.System)) + len(strings.Fields(req.Prompt)),
+			CompletionTokens: len(strings.Fields(text)),
+		},
+	}, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
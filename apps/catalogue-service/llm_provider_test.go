@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyProvider échoue avec les erreurs indiquées avant de déléguer au
+// fournisseur fake ; il note l'instant de chaque appel
+type flakyProvider struct {
+	fakeLLMProvider
+	mu    sync.Mutex
+	errs  []error
+	calls []time.Time
+}
+
+func (p *flakyProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	p.mu.Lock()
+	attempt := len(p.calls)
+	p.calls = append(p.calls, time.Now())
+	p.mu.Unlock()
+	if attempt < len(p.errs) {
+		return nil, p.errs[attempt]
+	}
+	return p.fakeLLMProvider.Complete(ctx, req)
+}
+
+// shortRetryDelay raccourcit le délai de nouvelle tentative pendant le test
+func shortRetryDelay(t *testing.T, delay time.Duration) {
+	previous := llmRetryBaseDelay
+	llmRetryBaseDelay = delay
+	t.Cleanup(func() { llmRetryBaseDelay = previous })
+}
+
+func TestCompleteWithRetry(t *testing.T) {
+	shortRetryDelay(t, time.Millisecond)
+	rateLimited := &llmProviderError{Provider: "test", Status: http.StatusTooManyRequests}
+	unavailable := &llmProviderError{Provider: "test", Status: http.StatusServiceUnavailable}
+	badRequest := &llmProviderError{Provider: "test", Status: http.StatusBadRequest}
+	network := errors.New("connection reset by peer")
+
+	tests := []struct {
+		name      string
+		errs      []error
+		retries   int
+		wantCalls int
+		wantErr   error
+	}{
+		{"succès immédiat", nil, 2, 1, nil},
+		{"429 puis succès", []error{rateLimited}, 2, 2, nil},
+		{"5xx et réseau puis succès", []error{unavailable, network}, 2, 3, nil},
+		{"tentatives épuisées", []error{unavailable, rateLimited, unavailable}, 2, 3, unavailable},
+		{"erreur définitive non réessayée", []error{badRequest}, 2, 1, badRequest},
+		{"sans nouvelle tentative", []error{rateLimited}, 0, 1, rateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &flakyProvider{errs: tt.errs}
+			resp, err := completeWithRetry(context.Background(), provider, &CompletionRequest{Model: "fake-1", Prompt: "Lampe"}, tt.retries)
+			if err != tt.wantErr {
+				t.Fatalf("erreur %v, attendu %v", err, tt.wantErr)
+			}
+			if len(provider.calls) != tt.wantCalls {
+				t.Errorf("%d appels, attendu %d", len(provider.calls), tt.wantCalls)
+			}
+			if tt.wantErr == nil && resp.Usage.CompletionTokens == 0 {
+				t.Error("la réponse doit porter la consommation du fournisseur")
+			}
+		})
+	}
+}
+
+func TestCompleteWithRetryBacksOffExponentially(t *testing.T) {
+	const base = 20 * time.Millisecond
+	shortRetryDelay(t, base)
+	unavailable := &llmProviderError{Provider: "test", Status: http.StatusBadGateway}
+	provider := &flakyProvider{errs: []error{unavailable, unavailable, unavailable}}
+
+	if _, err := completeWithRetry(context.Background(), provider, &CompletionRequest{Prompt: "Lampe"}, 3); err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.calls) != 4 {
+		t.Fatalf("%d appels, attendu 4", len(provider.calls))
+	}
+	for i := 1; i < len(provider.calls); i++ {
+		want := base << (i - 1)
+		if gap := provider.calls[i].Sub(provider.calls[i-1]); gap < want {
+			t.Errorf("tentative %d après %v, attendu au moins %v", i+1, gap, want)
+		}
+	}
+}
+
+func TestCompleteWithRetryStopsOnCancel(t *testing.T) {
+	shortRetryDelay(t, time.Hour)
+	unavailable := &llmProviderError{Provider: "test", Status: http.StatusServiceUnavailable}
+	provider := &flakyProvider{errs: []error{unavailable}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := completeWithRetry(ctx, provider, &CompletionRequest{Prompt: "Lampe"}, 2); err != unavailable {
+		t.Errorf("erreur %v, attendu la dernière erreur du fournisseur", err)
+	}
+	if len(provider.calls) != 1 {
+		t.Errorf("%d appels, attendu 1 (annulation pendant l'attente)", len(provider.calls))
+	}
+}
+
+func TestFakeProviderIsDeterministic(t *testing.T) {
+	provider := &fakeLLMProvider{}
+	req := &CompletionRequest{Model: "fake-1", System: "Tu es rédacteur", Prompt: "Lampe de bureau\nen laiton", JSON: true}
+
+	first, err := provider.Complete(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := provider.Complete(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Text != second.Text || first.Usage != second.Usage {
+		t.Error("la même demande doit donner la même réponse et la même consommation")
+	}
+	if first.Usage.PromptTokens != 8 {
+		t.Errorf("%d tokens de prompt, attendu 8", first.Usage.PromptTokens)
+	}
+	var content map[string]interface{}
+	if err := json.Unmarshal([]byte(first.Text), &content); err != nil {
+		t.Errorf("réponse JSON invalide: %v", err)
+	}
+}
+
+// TestProviderTokenAccounting vérifie que chaque fournisseur rapporte la
+// consommation de sa réponse, quel que soit son format
+func TestProviderTokenAccounting(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		provider func(baseURL string, client *http.Client) LLMProvider
+	}{
+		{
+			"openai",
+			`{"model":"gpt-4","choices":[{"message":{"content":"Texte"}}],"usage":{"prompt_tokens":12,"completion_tokens":34}}`,
+			func(baseURL string, client *http.Client) LLMProvider {
+				return &openAIProvider{apiKey: "key", baseURL: baseURL, model: "gpt-4", client: client}
+			},
+		},
+		{
+			"anthropic",
+			`{"model":"claude","content":[{"type":"text","text":"Texte"}],"usage":{"input_tokens":12,"output_tokens":34}}`,
+			func(baseURL string, client *http.Client) LLMProvider {
+				return &anthropicProvider{apiKey: "key", baseURL: baseURL, model: "claude", client: client}
+			},
+		},
+		{
+			"ollama",
+			`{"model":"llama3","message":{"content":"Texte"},"prompt_eval_count":12,"eval_count":34}`,
+			func(baseURL string, client *http.Client) LLMProvider {
+				return &ollamaProvider{baseURL: baseURL, model: "llama3", client: client}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			provider := tt.provider(server.URL, server.Client())
+			resp, err := provider.Complete(context.Background(), &CompletionRequest{Model: provider.DefaultModel(), Prompt: "Lampe"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Text != "Texte" || resp.Usage != (TokenUsage{PromptTokens: 12, CompletionTokens: 34}) {
+				t.Errorf("réponse %q, consommation %+v", resp.Text, resp.Usage)
+			}
+		})
+	}
+}
+
+func TestProviderJSONMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		provider func(baseURL string, client *http.Client) LLMProvider
+		check    func(t *testing.T, body map[string]interface{})
+	}{
+		{
+			"openai",
+			`{"choices":[{"message":{"content":"{\"title\":\"Lampe\"}"}}]}`,
+			func(baseURL string, client *http.Client) LLMProvider {
+				return &openAIProvider{apiKey: "key", baseURL: baseURL, model: "gpt-4", client: client}
+			},
+			func(t *testing.T, body map[string]interface{}) {
+				format, _ := body["response_format"].(map[string]interface{})
+				if format["type"] != "json_object" {
+					t.Errorf("response_format %v, attendu json_object", body["response_format"])
+				}
+			},
+		},
+		{
+			"anthropic",
+			// La réponse reprend après l'amorce "{"
+			`{"content":[{"type":"text","text":"\"title\":\"Lampe\"}"}]}`,
+			func(baseURL string, client *http.Client) LLMProvider {
+				return &anthropicProvider{apiKey: "key", baseURL: baseURL, model: "claude", client: client}
+			},
+			func(t *testing.T, body map[string]interface{}) {
+				if system, _ := body["system"].(string); system != "Rédacteur\n\n"+anthropicJSONInstruction {
+					t.Errorf("prompt système %q sans consigne JSON", system)
+				}
+				messages, _ := body["messages"].([]interface{})
+				if len(messages) != 2 {
+					t.Fatalf("%d messages, attendu le prompt et l'amorce", len(messages))
+				}
+				last, _ := messages[1].(map[string]interface{})
+				if last["role"] != "assistant" || last["content"] != anthropicJSONPrefill {
+					t.Errorf("amorce %v, attendu un message assistant %q", last, anthropicJSONPrefill)
+				}
+			},
+		},
+		{
+			"ollama",
+			`{"message":{"content":"{\"title\":\"Lampe\"}"}}`,
+			func(baseURL string, client *http.Client) LLMProvider {
+				return &ollamaProvider{baseURL: baseURL, model: "llama3", client: client}
+			},
+			func(t *testing.T, body map[string]interface{}) {
+				if body["format"] != "json" {
+					t.Errorf("format %v, attendu json", body["format"])
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("requête illisible: %v", err)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			provider := tt.provider(server.URL, server.Client())
+			resp, err := provider.Complete(context.Background(), &CompletionRequest{
+				Model:  provider.DefaultModel(),
+				System: "Rédacteur",
+				Prompt: "Lampe",
+				JSON:   true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, body)
+
+			var parsed struct {
+				Title string `json:"title"`
+			}
+			if err := json.Unmarshal([]byte(resp.Text), &parsed); err != nil || parsed.Title != "Lampe" {
+				t.Errorf("réponse %q, attendu un objet JSON valide: %v", resp.Text, err)
+			}
+		})
+	}
+}
+
+func TestProviderRateLimitIsRetried(t *testing.T) {
+	shortRetryDelay(t, time.Millisecond)
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		if first {
+			http.Error(w, `{"error":"rate limited"}`, http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"Texte"}}],"usage":{"prompt_tokens":1,"completion_tokens":2}}`))
+	}))
+	defer server.Close()
+
+	provider := &openAIProvider{apiKey: "key", baseURL: server.URL, model: "gpt-4", client: server.Client()}
+	resp, err := completeWithRetry(context.Background(), provider, &CompletionRequest{Model: "gpt-4", Prompt: "Lampe"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || resp.Model != "gpt-4" {
+		t.Errorf("%d appels, modèle %q ; attendu 2 appels et le modèle demandé", calls, resp.Model)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -22,6 +23,92 @@ func main() {
 	// Initialisation Elasticsearch
 	esClient = NewElasticsearchClient()
 	
+	// Commandes d'administration (reindex, check-drift)
+	if len(os.Args) > 1 {
+		code := runCommand(os.Args[1:])
+		db.Close()
+		os.Exit(code)
+	}
+	
+	// Sélection du backend de recherche (elasticsearch, postgres ou auto)
+	var err error
+	searchBackend, err = newSearchBackend(getEnv("SEARCH_BACKEND", SearchBackendAuto))
+	if err != nil {
+		log.Fatalf("SEARCH_BACKEND invalide: %v", err)
+	}
+	log.Printf("Backend de recherche: %s", searchBackend.Name())
+	
+	if searchBackend.Name() == SearchBackendPostgres {
+		searchIndexingEnabled = false
+	} else {
+		// Création de l'index et des mappings explicites
+		if err := esClient.EnsureProductIndex(); err != nil {
+			log.Printf("Impossible d'initialiser l'index Elasticsearch: %v", err)
+		}
+		
+		// Worker d'indexation alimenté par l'outbox
+		StartSearchIndexer()
+	}
+	
+	// Régénération planifiée des flux produits (Google, Meta)
+	feedInterval, err := time.ParseDuration(getEnv("FEED_REFRESH_INTERVAL", "6h"))
+	if err != nil {
+		log.Fatalf("FEED_REFRESH_INTERVAL invalide: %v", err)
+	}
+	StartFeedScheduler(feedInterval)
+	
+	// Libération des réservations de stock expirées
+	sweepInterval, err := time.ParseDuration(getEnv("RESERVATION_SWEEP_INTERVAL", "1m"))
+	if err != nil {
+		log.Fatalf("RESERVATION_SWEEP_INTERVAL invalide: %v", err)
+	}
+	StartReservationSweeper(sweepInterval)
+	
+	// Détection des stocks bas et publication des alertes
+	alertInterval, err := time.ParseDuration(getEnv("STOCK_ALERT_INTERVAL", "5m"))
+	if err != nil {
+		log.Fatalf("STOCK_ALERT_INTERVAL invalide: %v", err)
+	}
+	StartStockAlertMonitor(alertInterval)
+	
+	// Publication des versions planifiées du storefront
+	publishInterval, err := time.ParseDuration(getEnv("STOREFRONT_PUBLISH_INTERVAL", "1m"))
+	if err != nil {
+		log.Fatalf("STOREFRONT_PUBLISH_INTERVAL invalide: %v", err)
+	}
+	StartStorefrontPublisher(publishInterval)
+	
+	// Fournisseurs LLM (openai, anthropic, ollama, fake) pour les contenus générés
+	aiService, err = NewAIService()
+	if err != nil {
+		log.Fatalf("Configuration AI invalide: %v", err)
+	}
+	log.Printf("Fournisseurs AI disponibles: %v (défaut: %s)", aiService.ProviderNames(), aiService.defaultProvider)
+	
+	// Jobs de génération de contenus en masse
+	aiJobInterval, err := time.ParseDuration(getEnv("AI_JOB_INTERVAL", "10s"))
+	if err != nil {
+		log.Fatalf("AI_JOB_INTERVAL invalide: %v", err)
+	}
+	aiJobConcurrency, err := strconv.Atoi(getEnv("AI_JOB_CONCURRENCY", "4"))
+	if err != nil || aiJobConcurrency < 1 {
+		log.Fatalf("AI_JOB_CONCURRENCY invalide: %s", getEnv("AI_JOB_CONCURRENCY", "4"))
+	}
+	StartAIJobWorker(aiJobInterval, aiJobConcurrency)
+	
+	// Recalcul de la matrice d'achats conjoints des recommandations
+	recommendationInterval, err := time.ParseDuration(getEnv("RECOMMENDATION_REFRESH_INTERVAL", "1h"))
+	if err != nil {
+		log.Fatalf("RECOMMENDATION_REFRESH_INTERVAL invalide: %v", err)
+	}
+	StartRecommendationRefresher(recommendationInterval)
+	
+	// Stockage des fichiers des produits numériques
+	assetStorage, err = newAssetStorage(getEnv("DIGITAL_STORAGE_BACKEND", AssetStorageLocal))
+	if err != nil {
+		log.Fatalf("DIGITAL_STORAGE_BACKEND invalide: %v", err)
+	}
+	
 	port := getEnv("PORT", "8082")
 	
 	router := gin.Default()
@@ -38,20 +125,177 @@ func main() {
 		api.POST("/products", authenticateMiddleware(), handleCreateProduct)
 		api.PUT("/products/:id", authenticateMiddleware(), handleUpdateProduct)
 		api.DELETE("/products/:id", authenticateMiddleware(), handleDeleteProduct)
+		api.POST("/products/bulk", authenticateMiddleware(), handleBulkProducts)
+		api.GET("/products/export", authenticateMiddleware(), handleExportProducts)
+		
+		// Langues du catalogue et traductions (langue choisie par ?locale= ou Accept-Language)
+		api.GET("/locales", handleGetLocales)
+		api.PUT("/locales", authenticateMiddleware(), handleSaveLocales)
+		api.GET("/products/:id/translations", authenticateMiddleware(), handleListProductTranslations)
+		api.PUT("/products/:id/translations/:locale", authenticateMiddleware(), handleSaveProductTranslation)
+		api.DELETE("/products/:id/translations/:locale", authenticateMiddleware(), handleDeleteProductTranslation)
+		api.GET("/categories/:id/translations", authenticateMiddleware(), handleListCategoryTranslations)
+		api.PUT("/categories/:id/translations/:locale", authenticateMiddleware(), handleSaveCategoryTranslation)
+		api.DELETE("/categories/:id/translations/:locale", authenticateMiddleware(), handleDeleteCategoryTranslation)
+		
+		// Collections manuelles et smart (GET publics, par identifiant ou handle)
+		api.GET("/collections", handleListCollections)
+		api.GET("/collections/:id", handleGetCollection)
+		api.GET("/collections/:id/products", handleListCollectionProducts)
+		api.POST("/collections", authenticateMiddleware(), handleSaveCollection)
+		api.PUT("/collections/:id", authenticateMiddleware(), handleSaveCollection)
+		api.DELETE("/collections/:id", authenticateMiddleware(), handleDeleteCollection)
+		
+		// Recommandations (produits similaires, achetés ensemble, consultés récemment)
+		api.GET("/products/:id/recommendations", handleProductRecommendations)
+		api.GET("/recommendations/cart", handleCartRecommendations)
+		api.POST("/recommendations/views", handleRecordProductView)
+		
+		// Avis clients (dépôt réservé aux acheteurs vérifiés, X-User-ID posé par l'API Gateway)
+		api.GET("/products/:id/reviews", handleListProductReviews)
+		api.POST("/products/:id/reviews", handleCreateReview)
+		api.GET("/products/:id/structured-data", handleProductStructuredData)
+		api.GET("/reviews", authenticateMiddleware(), handleListReviews)
+		api.GET("/reviews/settings", authenticateMiddleware(), handleGetReviewSettings)
+		api.PUT("/reviews/settings", authenticateMiddleware(), handleSaveReviewSettings)
+		api.POST("/reviews/:id/moderate", authenticateMiddleware(), handleModerateReview)
+		api.PUT("/reviews/:id/reply", authenticateMiddleware(), handleReplyReview)
+		api.DELETE("/reviews/:id", authenticateMiddleware(), handleDeleteReview)
+		
+		// Produits numériques : fichiers, clés de licence et téléchargements
+		api.PUT("/products/:id/variants/:variantId/delivery", authenticateMiddleware(), handleUpdateVariantDelivery)
+		api.GET("/products/:id/assets", authenticateMiddleware(), handleListDigitalAssets)
+		api.POST("/products/:id/assets", authenticateMiddleware(), handleUploadDigitalAsset)
+		api.DELETE("/products/:id/assets/:assetId", authenticateMiddleware(), handleDeleteDigitalAsset)
+		api.GET("/products/:id/license-keys", authenticateMiddleware(), handleListLicenseKeys)
+		api.POST("/products/:id/license-keys", authenticateMiddleware(), handleImportLicenseKeys)
+		api.DELETE("/products/:id/license-keys/:keyId", authenticateMiddleware(), handleDeleteLicenseKey)
+		api.GET("/digital/orders/:orderId", handleGetDigitalOrder)
+		api.GET("/downloads/:token", handleDownload)
 		
 		api.GET("/inventory/:productId", handleGetInventory)
 		api.PUT("/inventory/:productId", authenticateMiddleware(), handleUpdateInventory)
+		api.GET("/inventory/:productId/movements", authenticateMiddleware(), handleListInventoryMovements)
+		api.POST("/inventory/:productId/reconcile", authenticateMiddleware(), handleReconcileInventory)
+		api.POST("/inventory/sync", authenticateMiddleware(), handleSyncInventory)
+		api.POST("/inventory/sync/csv", authenticateMiddleware(), handleSyncInventoryCSV)
+		
+		// Politique de stock (refus, réapprovisionnement, précommande) et reliquats
+		api.GET("/inventory/:productId/availability", handleGetAvailability)
+		api.PUT("/inventory/:productId/policy", authenticateMiddleware(), handleUpdateInventoryPolicy)
+		api.GET("/inventory/backorders", authenticateMiddleware(), handleListBackorders)
+		api.POST("/inventory/backorders/:id/fulfil", authenticateMiddleware(), handleFulfilBackorder)
+		
+		// Réservations et déductions (appels internes du checkout, non exposés par l'API Gateway)
+		api.POST("/inventory/reservations", handleCreateReservation)
+		api.GET("/inventory/reservations", handleListReservations)
+		api.DELETE("/inventory/reservations/:id", handleReleaseReservation)
+		api.POST("/inventory/reservations/release", handleReleaseOwnerReservations)
+		api.POST("/inventory/deductions", handleDeductInventory)
+		api.POST("/inventory/allocate", handleAllocateOrder)
+		
+		// Livraison des produits numériques d'une commande payée (appel interne du checkout)
+		api.POST("/digital/fulfilments", handleFulfilDigitalOrder)
+		
+		// Emplacements de stock, transferts et règles d'allocation
+		api.GET("/locations", authenticateMiddleware(), handleListLocations)
+		api.POST("/locations", authenticateMiddleware(), handleSaveLocation)
+		api.PUT("/locations/:id", authenticateMiddleware(), handleSaveLocation)
+		api.GET("/transfers", authenticateMiddleware(), handleListTransfers)
+		api.POST("/transfers", authenticateMiddleware(), handleCreateTransfer)
+		api.GET("/transfers/:id", authenticateMiddleware(), handleGetTransfer)
+		api.POST("/transfers/:id/ship", authenticateMiddleware(), handleTransferAction(ShipStockTransfer))
+		api.POST("/transfers/:id/receive", authenticateMiddleware(), handleTransferAction(ReceiveStockTransfer))
+		api.POST("/transfers/:id/cancel", authenticateMiddleware(), handleTransferAction(CancelStockTransfer))
+		api.GET("/allocation-settings", authenticateMiddleware(), handleGetAllocationSettings)
+		api.PUT("/allocation-settings", authenticateMiddleware(), handleSaveAllocationSettings)
+		
+		// Réapprovisionnement : seuils, alertes de stock bas, fournisseurs et bons de commande
+		api.GET("/inventory/low-stock", authenticateMiddleware(), handleListLowStock)
+		api.PUT("/inventory/:productId/reorder", authenticateMiddleware(), handleUpdateReorderSettings)
+		api.GET("/stock-alerts", authenticateMiddleware(), handleListStockAlerts)
+		api.GET("/stock-alerts/settings", authenticateMiddleware(), handleGetStockAlertSettings)
+		api.PUT("/stock-alerts/settings", authenticateMiddleware(), handleSaveStockAlertSettings)
+		api.GET("/suppliers", authenticateMiddleware(), handleListSuppliers)
+		api.POST("/suppliers", authenticateMiddleware(), handleSaveSupplier)
+		api.PUT("/suppliers/:id", authenticateMiddleware(), handleSaveSupplier)
+		api.DELETE("/suppliers/:id", authenticateMiddleware(), handleDeleteSupplier)
+		api.GET("/purchase-orders", authenticateMiddleware(), handleListPurchaseOrders)
+		api.POST("/purchase-orders", authenticateMiddleware(), handleCreatePurchaseOrder)
+		api.POST("/purchase-orders/generate", authenticateMiddleware(), handleGeneratePurchaseOrders)
+		api.GET("/purchase-orders/:id", authenticateMiddleware(), handleGetPurchaseOrder)
+		api.POST("/purchase-orders/:id/submit", authenticateMiddleware(), handlePurchaseOrderAction(SubmitPurchaseOrder))
+		api.POST("/purchase-orders/:id/receive", authenticateMiddleware(), handleReceivePurchaseOrder)
+		api.POST("/purchase-orders/:id/cancel", authenticateMiddleware(), handlePurchaseOrderAction(CancelPurchaseOrder))
 		
 		api.POST("/search", handleSearchProducts)
+		api.POST("/search/admin", authenticateMiddleware(), handleAdminSearchProducts)
+		api.GET("/search/autocomplete", handleAutocomplete)
+		api.GET("/search/synonyms", authenticateMiddleware(), handleListSynonyms)
+		api.POST("/search/synonyms", authenticateMiddleware(), handleCreateSynonyms)
+		api.PUT("/search/synonyms/:id", authenticateMiddleware(), handleUpdateSynonyms)
+		api.DELETE("/search/synonyms/:id", authenticateMiddleware(), handleDeleteSynonyms)
+		api.POST("/search/clicks", handleSearchClick)
+		api.POST("/search/conversions", handleSearchConversion)
+		api.GET("/search/analytics", authenticateMiddleware(), handleSearchAnalytics)
+		api.GET("/search/rules", authenticateMiddleware(), handleListMerchandisingRules)
+		api.POST("/search/rules", authenticateMiddleware(), handleCreateMerchandisingRule)
+		api.PUT("/search/rules/:id", authenticateMiddleware(), handleUpdateMerchandisingRule)
+		api.DELETE("/search/rules/:id", authenticateMiddleware(), handleDeleteMerchandisingRule)
+		
+		// Flux produits (Google Merchant Center, Meta)
+		api.GET("/feeds", authenticateMiddleware(), handleListFeeds)
+		api.POST("/feeds", authenticateMiddleware(), handleSaveFeed)
+		api.GET("/feeds/:token/:file", handleServeFeed)
 		
 		// Route pour génération de description par IA
 		api.POST("/products/generate-description", authenticateMiddleware(), HandleGenerateDescription)
+		api.GET("/ai/settings", authenticateMiddleware(), handleGetAISettings)
+		api.PUT("/ai/settings", authenticateMiddleware(), handleSaveAISettings)
+		api.GET("/ai/usage", authenticateMiddleware(), handleGetAIUsage)
+		api.POST("/ai/jobs", authenticateMiddleware(), handleCreateAIJob)
+		api.GET("/ai/jobs", authenticateMiddleware(), handleListAIJobs)
+		api.GET("/ai/jobs/:id", authenticateMiddleware(), handleGetAIJob)
+		api.GET("/ai/jobs/:id/items", authenticateMiddleware(), handleListAIJobItems)
+		api.POST("/ai/jobs/:id/cancel", authenticateMiddleware(), handleCancelAIJob)
+		api.POST("/ai/jobs/:id/resume", authenticateMiddleware(), handleResumeAIJob)
+		api.POST("/ai/jobs/:id/accept", authenticateMiddleware(), handleAcceptAllAIItems)
+		api.POST("/ai/jobs/:id/items/:itemId/accept", authenticateMiddleware(), handleAcceptAIItem)
+		api.POST("/ai/jobs/:id/items/:itemId/reject", authenticateMiddleware(), handleRejectAIItem)
+		api.POST("/ai/translations", authenticateMiddleware(), handleCreateTranslationJobs)
 		
 		// Routes Store Builder (publiques pour GET, protégées pour POST)
 		api.GET("/store-builder/config", handleGetStorefrontConfig)
 		api.POST("/store-builder/config", authenticateMiddleware(), handleSaveStorefrontConfig)
 		api.GET("/store-builder/theme", handleGetTheme)
 		api.POST("/store-builder/theme", authenticateMiddleware(), handleSaveTheme)
+		api.GET("/store-builder/section-types", handleListSectionTypes)
+		api.GET("/store-builder/theme.css", handleGetThemeCSS)
+		api.GET("/store-builder/theme-presets", handleListThemePresets)
+		api.POST("/store-builder/theme-presets/:id/apply", authenticateMiddleware(), handleApplyThemePreset)
+		api.GET("/store-builder/theme/export", authenticateMiddleware(), handleExportTheme)
+		api.POST("/store-builder/theme/import", authenticateMiddleware(), handleImportTheme)
+		
+		// Brouillon, publication (immédiate ou planifiée), historique des versions et prévisualisation
+		api.GET("/store-builder/draft", authenticateMiddleware(), handleGetStorefrontDraft)
+		api.POST("/store-builder/publish", authenticateMiddleware(), handlePublishStorefront)
+		api.POST("/store-builder/preview-token", authenticateMiddleware(), handleCreatePreviewToken)
+		api.GET("/store-builder/versions", authenticateMiddleware(), handleListStorefrontVersions)
+		api.GET("/store-builder/versions/diff", authenticateMiddleware(), handleDiffStorefrontVersions)
+		api.GET("/store-builder/versions/:version", authenticateMiddleware(), handleGetStorefrontVersion)
+		api.POST("/store-builder/versions/:version/rollback", authenticateMiddleware(), handleRollbackStorefront)
+		api.DELETE("/store-builder/versions/:version/schedule", authenticateMiddleware(), handleCancelStorefrontSchedule)
+		
+		// Pages, gabarits et menus ; résolution publique d'une page par chemin
+		api.GET("/store-builder/resolve", handleResolveStorefrontPage)
+		api.GET("/store-builder/pages", authenticateMiddleware(), handleListStorefrontPages)
+		api.POST("/store-builder/pages", authenticateMiddleware(), handleCreateStorefrontPage)
+		api.GET("/store-builder/pages/:handle", authenticateMiddleware(), handleGetStorefrontPage)
+		api.PUT("/store-builder/pages/:handle", authenticateMiddleware(), handleUpdateStorefrontPage)
+		api.DELETE("/store-builder/pages/:handle", authenticateMiddleware(), handleDeleteStorefrontPage)
+		api.GET("/store-builder/menus", authenticateMiddleware(), handleListStorefrontMenus)
+		api.PUT("/store-builder/menus/:handle", authenticateMiddleware(), handleSaveStorefrontMenu)
+		api.DELETE("/store-builder/menus/:handle", authenticateMiddleware(), handleDeleteStorefrontMenu)
 	}
 	
 	srv := &http.Server{
@@ -109,7 +353,7 @@ func readinessCheck(c *gin.Context) {
 }
 
 func handleListProducts(c *gin.Context) {
-	merchantID := c.Query("merchant_id")
+	merchantID := storefrontMerchantID(c)
 	if merchantID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "merchant_id requis"})
 		return
@@ -124,7 +368,19 @@ func handleListProducts(c *gin.Context) {
 		return
 	}
 	
-	c.JSON(http.StatusOK, gin.H{"products": products})
+	// Champs traduits dans la langue demandée (?locale= ou Accept-Language)
+	locale, locales := negotiateLocale(c, merchantID)
+	if locale != locales.DefaultLocale {
+		refs := make([]*Product, len(products))
+		for i := range products {
+			refs[i] = &products[i]
+		}
+		if err := localizeProducts(db, locale, refs); err != nil {
+			log.Printf("Erreur lors de la traduction des produits: %v", err)
+		}
+	}
+	
+	c.JSON(http.StatusOK, gin.H{"products": products, "locale": locale})
 }
 
 func handleGetProduct(c *gin.Context) {
@@ -141,7 +397,23 @@ func handleGetProduct(c *gin.Context) {
 		return
 	}
 	
-	c.JSON(http.StatusOK, product)
+	variants, err := GetProductVariants(db, productID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération du produit"})
+		return
+	}
+	
+	locale, locales := negotiateLocale(c, product.MerchantID)
+	if locale != locales.DefaultLocale {
+		if err := localizeProducts(db, locale, []*Product{product}); err != nil {
+			log.Printf("Erreur lors de la traduction du produit: %v", err)
+		}
+		if err := localizeVariants(db, locale, variants); err != nil {
+			log.Printf("Erreur lors de la traduction des variantes: %v", err)
+		}
+	}
+	
+	c.JSON(http.StatusOK, ProductDetail{Product: *product, Variants: variants, Locale: locale})
 }
 
 func handleCreateProduct(c *gin.Context) {
@@ -163,11 +435,6 @@ func handleCreateProduct(c *gin.Context) {
 		return
 	}
 	
-	// Indexer dans Elasticsearch
-	if err := esClient.IndexProduct(product); err != nil {
-		log.Printf("Erreur lors de l'indexation Elasticsearch: %v", err)
-	}
-	
 	c.JSON(http.StatusCreated, product)
 }
 
@@ -199,11 +466,6 @@ func handleUpdateProduct(c *gin.Context) {
 		return
 	}
 	
-	// Mettre à jour dans Elasticsearch
-	if err := esClient.IndexProduct(updatedProduct); err != nil {
-		log.Printf("Erreur lors de la mise à jour Elasticsearch: %v", err)
-	}
-	
 	c.JSON(http.StatusOK, updatedProduct)
 }
 
@@ -229,11 +491,6 @@ func handleDeleteProduct(c *gin.Context) {
 		return
 	}
 	
-	// Supprimer d'Elasticsearch
-	if err := esClient.DeleteProduct(productID); err != nil {
-		log.Printf("Erreur lors de la suppression Elasticsearch: %v", err)
-	}
-	
 	c.JSON(http.StatusOK, gin.H{"message": "Produit supprimé"})
 }
 
@@ -257,6 +514,15 @@ func handleGetInventory(c *gin.Context) {
 		return
 	}
 	
+	inventory.Availability = inventory.AvailabilityFor(1)
+	
+	// Disponibilité par emplacement
+	inventory.Locations, err = GetLocationLevels(productID, variantIDPtr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération du stock"})
+		return
+	}
+	
 	c.JSON(http.StatusOK, inventory)
 }
 
@@ -277,40 +543,125 @@ func handleUpdateInventory(c *gin.Context) {
 	}
 	
 	var req struct {
-		VariantID *string `json:"variant_id,omitempty"`
-		Quantity  int     `json:"quantity" binding:"required"`
+		VariantID  *string `json:"variant_id,omitempty"`
+		LocationID string  `json:"location_id"` // emplacement par défaut si vide
+		StockChange
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	
-	err = UpdateInventory(productID, req.VariantID, req.Quantity)
+	movement, err := UpdateInventory(merchantID, productID, req.VariantID, req.LocationID, &req.StockChange)
+	if err == errLocationNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errInvalidStockChange) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err == ErrInsufficientStock {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour du stock"})
 		return
 	}
 	
-	c.JSON(http.StatusOK, gin.H{"message": "Stock mis à jour"})
+	c.JSON(http.StatusOK, gin.H{"message": "Stock mis à jour", "movement": movement})
 }
 
+// handleSearchProducts recherche dans le catalogue public : seuls les produits
+// actifs de la boutique demandée sont visibles
 func handleSearchProducts(c *gin.Context) {
-	var req struct {
-		Query   string                 `json:"query" binding:"required"`
-		Filters map[string]interface{} `json:"filters,omitempty"`
-	}
+	searchProducts(c, false)
+}
+
+// handleAdminSearchProducts recherche pour le back-office : le marchand
+// authentifié peut filtrer ses brouillons et produits inactifs
+func handleAdminSearchProducts(c *gin.Context) {
+	searchProducts(c, true)
+}
+
+func searchProducts(c *gin.Context, admin bool) {
+	var req SearchRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	
-	products, err := esClient.SearchProducts(req.Query, req.Filters)
+	// Seule la route authentifiée honore le filtre de statut : sur la route
+	// publique, un en-tête X-Merchant-ID ne prouve rien
+	if admin {
+		req.MerchantID = c.GetHeader("X-Merchant-ID")
+	} else {
+		if req.MerchantID == "" {
+			req.MerchantID = storefrontMerchantID(c)
+		}
+		req.Filters.Status = []string{"active"}
+	}
+	
+	if err := req.Normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	// La langue négociée privilégie l'analyseur correspondant et fixe la
+	// langue des produits et facettes renvoyés
+	locale, locales := negotiateLocale(c, req.MerchantID)
+	if req.Language == "" {
+		req.Language = locale
+	}
+	
+	// Les synonymes du marchand élargissent la requête sans la remplacer
+	variants, err := expandQueryWithSynonyms(req.MerchantID, req.Query)
+	if err != nil {
+		log.Printf("Erreur lors du chargement des synonymes: %v", err)
+	}
+	req.queryVariants = variants
+	
+	// Règles de merchandising du marchand (épinglage, relégation, boost, redirection)
+	merchandising, err := loadSearchMerchandising(req.MerchantID, req.Query)
+	if err != nil {
+		log.Printf("Erreur lors du chargement des règles de merchandising: %v", err)
+	}
+	req.merchandising = merchandising
+	
+	result, err := searchBackend.Search(&req)
 	if err != nil {
+		log.Printf("Erreur lors de la recherche: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la recherche"})
 		return
 	}
 	
-	c.JSON(http.StatusOK, gin.H{"products": products})
+	if locale != locales.DefaultLocale {
+		hits := make([]*Product, len(result.Products))
+		for i := range result.Products {
+			hits[i] = &result.Products[i].Product
+		}
+		if err := localizeProducts(db, locale, hits); err != nil {
+			log.Printf("Erreur lors de la traduction des résultats: %v", err)
+		}
+	}
+	
+	if err := labelCategoryFacets(result, locale); err != nil {
+		log.Printf("Erreur lors de la résolution des catégories: %v", err)
+	}
+	
+	if merchandising != nil {
+		result.RedirectURL = merchandising.RedirectURL
+	}
+	
+	// Journalisation pour l'analytique ; un échec ne bloque pas la recherche
+	if searchID, err := recordSearchEvent(&req, result.Total); err != nil {
+		log.Printf("Erreur lors de la journalisation de la recherche: %v", err)
+	} else {
+		result.SearchID = searchID
+	}
+	
+	c.JSON(http.StatusOK, result)
 }
 
 func authenticateMiddleware() gin.HandlerFunc {
@@ -327,10 +678,14 @@ func authenticateMiddleware() gin.HandlerFunc {
 	}
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
+// storefrontMerchantID retourne la boutique consultée sur une route publique :
+// l'en-tête X-Storefront-Merchant-ID posé par l'API Gateway d'après le domaine,
+// sinon ?merchant_id=. Il désigne la boutique affichée, pas un marchand authentifié.
+func storefrontMerchantID(c *gin.Context) string {
+	if merchantID := c.GetHeader("X-Storefront-Merchant-ID"); merchantID != "" {
+		return merchantID
+	}
+	return c.Query("merchant_id")
 }
 
+
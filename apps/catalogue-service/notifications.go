@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// notificationClient publie les événements marchands vers le webhook-service
+var notificationClient = &http.Client{Timeout: 10 * time.Second}
+
+// MerchantEvent représente un événement diffusé aux webhooks du marchand
+type MerchantEvent struct {
+	MerchantID string      `json:"merchant_id"`
+	EventType  string      `json:"event_type"`
+	Data       interface{} `json:"data"`
+}
+
+// publishMerchantEvent transmet un événement au webhook-service, qui le diffuse
+// aux webhooks actifs du marchand abonnés à ce type d'événement
+func publishMerchantEvent(merchantID, eventType string, data interface{}) error {
+	body, err := json.Marshal(MerchantEvent{MerchantID: merchantID, EventType: eventType, Data: data})
+	if err != nil {
+		return err
+	}
+
+	url := getEnv("WEBHOOK_SERVICE_URL", "http://localhost:8084") + "/api/v1/events"
+	resp, err := notificationClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook-service: statut %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendEmail envoie un e-mail texte via SMTP. Sans SMTP_HOST, le message est
+// seulement journalisé (environnement de développement).
+func sendEmail(to, subject, body string) error {
+	host := getEnv("SMTP_HOST", "")
+	from := getEnv("SMTP_FROM", "no-reply@omnisphere.local")
+	if host == "" {
+		log.Printf("E-mail (SMTP non configuré) à %s: %s", to, subject)
+		return nil
+	}
+
+	var auth smtp.Auth
+	if user := getEnv("SMTP_USERNAME", ""); user != "" {
+		auth = smtp.PlainAuth("", user, getEnv("SMTP_PASSWORD", ""), host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(host+":"+getEnv("SMTP_PORT", "587"), auth, from, []string{to}, []byte(msg))
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Formats de flux produits supportés
+const (
+	FeedFormatGoogle = "google" // Google Merchant Center (RSS 2.0)
+	FeedFormatMeta   = "meta"   // Catalogue Meta (CSV)
+)
+
+// feedFileNames associe chaque format au nom de fichier exposé dans l'URL publique
+var feedFileNames = map[string]string{
+	FeedFormatGoogle: "google.xml",
+	FeedFormatMeta:   "meta.csv",
+}
+
+// ProductFeed représente un flux produit planifié pour un marchand
+type ProductFeed struct {
+	ID           string     `json:"id"`
+	MerchantID   string     `json:"merchant_id"`
+	Format       string     `json:"format"`
+	Token        string     `json:"-"`
+	URL          string     `json:"url"`
+	StoreURL     string     `json:"store_url"`
+	Brand        string     `json:"brand,omitempty"`
+	ProductCount int        `json:"product_count"`
+	LastError    *string    `json:"last_error,omitempty"`
+	GeneratedAt  *time.Time `json:"generated_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// feedItem représente une ligne de flux (un produit ou une variante)
+type feedItem struct {
+	ID           string
+	GroupID      string
+	Title        string
+	Description  string
+	Link         string
+	ImageLink    string
+	ExtraImages  []string
+	Availability bool
+	Price        string
+	Brand        string
+	MPN          string
+	ProductType  string
+}
+
+// googleFeedItem est la représentation XML d'un article Google Merchant Center
+type googleFeedItem struct {
+	XMLName         xml.Name `xml:"item"`
+	ID              string   `xml:"g:id"`
+	Title           string   `xml:"title"`
+	Description     string   `xml:"description"`
+	Link            string   `xml:"link"`
+	ImageLink       string   `xml:"g:image_link,omitempty"`
+	AdditionalImage []string `xml:"g:additional_image_link,omitempty"`
+	Availability    string   `xml:"g:availability"`
+	Price           string   `xml:"g:price"`
+	Condition       string   `xml:"g:condition"`
+	Brand           string   `xml:"g:brand,omitempty"`
+	MPN             string   `xml:"g:mpn,omitempty"`
+	ItemGroupID     string   `xml:"g:item_group_id,omitempty"`
+	ProductType     string   `xml:"g:product_type,omitempty"`
+}
+
+// metaFeedHeader liste les colonnes du flux catalogue Meta
+var metaFeedHeader = []string{
+	"id", "title", "description", "availability", "condition", "price",
+	"link", "image_link", "additional_image_link", "brand", "item_group_id", "product_type",
+}
+
+// handleListFeeds liste les flux produits du marchand
+func handleListFeeds(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	rows, err := db.Query(
+		"SELECT id, merchant_id, format, token, store_url, COALESCE(brand, ''), product_count, last_error, generated_at, created_at, updated_at FROM product_feeds WHERE merchant_id = $1 ORDER BY format",
+		merchantID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des flux"})
+		return
+	}
+	defer rows.Close()
+
+	feeds := []ProductFeed{}
+	for rows.Next() {
+		feed, err := scanProductFeed(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors du scan"})
+			return
+		}
+		feeds = append(feeds, *feed)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"feeds": feeds})
+}
+
+// handleSaveFeed crée ou met à jour un flux produit puis le génère immédiatement
+func handleSaveFeed(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	var req struct {
+		Format   string `json:"format" binding:"required,oneof=google meta"`
+		StoreURL string `json:"store_url" binding:"required,url"`
+		Brand    string `json:"brand"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := generateFeedToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la création du flux"})
+		return
+	}
+
+	// Le token est conservé lors d'une mise à jour pour garder une URL stable
+	row := db.QueryRow(
+		`INSERT INTO product_feeds (merchant_id, format, token, store_url, brand)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (merchant_id, format)
+		 DO UPDATE SET store_url = $4, brand = $5, updated_at = NOW()
+		 RETURNING id, merchant_id, format, token, store_url, COALESCE(brand, ''), product_count, last_error, generated_at, created_at, updated_at`,
+		merchantID, req.Format, token, strings.TrimRight(req.StoreURL, "/"), req.Brand,
+	)
+	feed, err := scanProductFeed(row)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la sauvegarde du flux"})
+		return
+	}
+
+	if err := GenerateProductFeed(feed); err != nil {
+		log.Printf("Erreur lors de la génération du flux %s: %v", feed.ID, err)
+	}
+
+	c.JSON(http.StatusOK, feed)
+}
+
+// handleServeFeed sert le dernier flux généré à son URL publique stable
+func handleServeFeed(c *gin.Context) {
+	token := c.Param("token")
+	file := c.Param("file")
+
+	var format string
+	var content sql.NullString
+	var generatedAt sql.NullTime
+	err := db.QueryRow(
+		"SELECT format, content, generated_at FROM product_feeds WHERE token = $1",
+		token,
+	).Scan(&format, &content, &generatedAt)
+
+	if err == sql.ErrNoRows || (err == nil && feedFileNames[format] != file) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Flux introuvable"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération du flux"})
+		return
+	}
+	if !content.Valid {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Flux pas encore généré"})
+		return
+	}
+
+	contentType := "application/xml; charset=utf-8"
+	if format == FeedFormatMeta {
+		contentType = "text/csv; charset=utf-8"
+	}
+	if generatedAt.Valid {
+		c.Header("Last-Modified", generatedAt.Time.UTC().Format(http.TimeFormat))
+	}
+	c.Data(http.StatusOK, contentType, []byte(content.String))
+}
+
+// GenerateProductFeed génère le contenu d'un flux et l'enregistre
+func GenerateProductFeed(feed *ProductFeed) error {
+	return generateProductFeed(db, feed)
+}
+
+// generateProductFeed génère un flux et l'enregistre via q (la transaction qui
+// le verrouille, pour le planificateur)
+func generateProductFeed(q queryer, feed *ProductFeed) error {
+	var buf bytes.Buffer
+	var count int
+	var err error
+
+	switch feed.Format {
+	case FeedFormatGoogle:
+		count, err = writeGoogleFeed(&buf, feed)
+	case FeedFormatMeta:
+		count, err = writeMetaFeed(&buf, feed)
+	default:
+		err = fmt.Errorf("format de flux inconnu: %s", feed.Format)
+	}
+
+	if err != nil {
+		errMsg := err.Error()
+		feed.LastError = &errMsg
+		if _, dbErr := q.Exec(
+			"UPDATE product_feeds SET last_error = $1, updated_at = NOW() WHERE id = $2",
+			errMsg, feed.ID,
+		); dbErr != nil {
+			log.Printf("Erreur lors de l'enregistrement de l'échec du flux %s: %v", feed.ID, dbErr)
+		}
+		return err
+	}
+
+	now := time.Now()
+	_, err = q.Exec(
+		"UPDATE product_feeds SET content = $1, product_count = $2, last_error = NULL, generated_at = $3, updated_at = NOW() WHERE id = $4",
+		buf.String(), count, now, feed.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	feed.ProductCount = count
+	feed.LastError = nil
+	feed.GeneratedAt = &now
+	return nil
+}
+
+// RegenerateAllFeeds régénère les flux arrivés à échéance, un par un. Chaque
+// flux est verrouillé (SKIP LOCKED) pendant sa génération pour permettre
+// plusieurs instances ; un flux régénéré depuis moins de 90 % de l'intervalle
+// n'est plus à échéance, la marge absorbant la durée d'un passage.
+func RegenerateAllFeeds(interval time.Duration) {
+	due := interval * 9 / 10
+	attempted := []string{}
+	for {
+		feedID, err := regenerateNextFeed(due, attempted)
+		if err != nil {
+			log.Printf("Erreur lors de la régénération des flux: %v", err)
+			return
+		}
+		if feedID == "" {
+			return
+		}
+		// Un flux en échec reste à échéance : il n'est retenté qu'au passage suivant
+		attempted = append(attempted, feedID)
+	}
+}
+
+// regenerateNextFeed verrouille et régénère le plus ancien flux à échéance non
+// encore tenté ; retourne son identifiant, ou "" s'il n'y en a plus
+func regenerateNextFeed(due time.Duration, attempted []string) (string, error) {
+	var feedID string
+	err := withTx(func(tx *sql.Tx) error {
+		feed, err := scanProductFeed(tx.QueryRow(
+			`SELECT id, merchant_id, format, token, store_url, COALESCE(brand, ''), product_count, last_error, generated_at, created_at, updated_at
+			 FROM product_feeds
+			 WHERE (generated_at IS NULL OR generated_at <= NOW() - $1 * INTERVAL '1 second')
+			   AND NOT (id::text = ANY($2))
+			 ORDER BY generated_at NULLS FIRST
+			 LIMIT 1
+			 FOR UPDATE SKIP LOCKED`,
+			int(due.Seconds()), pq.Array(attempted),
+		))
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		feedID = feed.ID
+		// L'échec est enregistré dans last_error et validé avec la transaction
+		if err := generateProductFeed(tx, feed); err != nil {
+			log.Printf("Erreur lors de la génération du flux %s: %v", feed.ID, err)
+		}
+		return nil
+	})
+	return feedID, err
+}
+
+// StartFeedScheduler lance la régénération périodique des flux produits
+func StartFeedScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			RegenerateAllFeeds(interval)
+		}
+	}()
+}
+
+// forEachFeedItem décline chaque produit actif en articles de flux (un par variante)
+func forEachFeedItem(feed *ProductFeed, fn func(*feedItem) error) (int, error) {
+	count := 0
+	err := forEachExportProduct(feed.MerchantID, func(p *ExportProduct) error {
+		if p.Status != "active" {
+			return nil
+		}
+
+		item := feedItem{
+			ID:           p.ID,
+			Title:        p.Name,
+			Description:  p.Description,
+			Link:         feed.StoreURL + "/products/" + p.ID,
+			Availability: p.Available > 0,
+			Price:        formatFeedPrice(p.Price, p.Currency),
+			Brand:        feed.Brand,
+			MPN:          p.SKU,
+			ProductType:  p.CategoryName,
+		}
+		if len(p.Images) > 0 {
+			item.ImageLink = p.Images[0]
+			item.ExtraImages = p.Images[1:]
+		}
+
+		if len(p.Variants) == 0 {
+			count++
+			return fn(&item)
+		}
+
+		for _, v := range p.Variants {
+			variantItem := item
+			variantItem.ID = v.ID
+			variantItem.GroupID = p.ID
+			variantItem.Title = p.Name + " - " + v.Name
+			variantItem.Link = item.Link + "?variant_id=" + v.ID
+			variantItem.Availability = v.Available > 0
+			variantItem.MPN = v.SKU
+			if v.Price != nil {
+				variantItem.Price = formatFeedPrice(*v.Price, p.Currency)
+			}
+			count++
+			if err := fn(&variantItem); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// writeGoogleFeed écrit un flux RSS 2.0 au format Google Merchant Center
+func writeGoogleFeed(w io.Writer, feed *ProductFeed) (int, error) {
+	if _, err := io.WriteString(w, xml.Header+`<rss version="2.0" xmlns:g="http://base.google.com/ns/1.0"><channel>`); err != nil {
+		return 0, err
+	}
+
+	enc := xml.NewEncoder(w)
+	channel := []struct{ name, value string }{
+		{"title", feed.Brand},
+		{"link", feed.StoreURL},
+		{"description", "Flux produits " + feed.Brand},
+	}
+	for _, field := range channel {
+		if err := enc.EncodeElement(field.value, xml.StartElement{Name: xml.Name{Local: field.name}}); err != nil {
+			return 0, err
+		}
+	}
+
+	count, err := forEachFeedItem(feed, func(item *feedItem) error {
+		availability := "out_of_stock"
+		if item.Availability {
+			availability = "in_stock"
+		}
+		return enc.Encode(googleFeedItem{
+			ID:              item.ID,
+			Title:           item.Title,
+			Description:     item.Description,
+			Link:            item.Link,
+			ImageLink:       item.ImageLink,
+			AdditionalImage: item.ExtraImages,
+			Availability:    availability,
+			Price:           item.Price,
+			Condition:       "new",
+			Brand:           item.Brand,
+			MPN:             item.MPN,
+			ItemGroupID:     item.GroupID,
+			ProductType:     item.ProductType,
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := enc.Flush(); err != nil {
+		return 0, err
+	}
+
+	_, err = io.WriteString(w, "</channel></rss>\n")
+	return count, err
+}
+
+// writeMetaFeed écrit un flux CSV au format catalogue Meta
+func writeMetaFeed(w io.Writer, feed *ProductFeed) (int, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(metaFeedHeader); err != nil {
+		return 0, err
+	}
+
+	count, err := forEachFeedItem(feed, func(item *feedItem) error {
+		availability := "out of stock"
+		if item.Availability {
+			availability = "in stock"
+		}
+		return cw.Write([]string{
+			item.ID, item.Title, item.Description, availability, "new", item.Price,
+			item.Link, item.ImageLink, strings.Join(item.ExtraImages, ","),
+			item.Brand, item.GroupID, item.ProductType,
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	cw.Flush()
+	return count, cw.Error()
+}
+
+// scanProductFeed lit un flux depuis une ligne SQL
+func scanProductFeed(row interface{ Scan(...interface{}) error }) (*ProductFeed, error) {
+	var feed ProductFeed
+	var lastError sql.NullString
+	var generatedAt sql.NullTime
+
+	err := row.Scan(&feed.ID, &feed.MerchantID, &feed.Format, &feed.Token, &feed.StoreURL, &feed.Brand,
+		&feed.ProductCount, &lastError, &generatedAt, &feed.CreatedAt, &feed.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastError.Valid {
+		feed.LastError = &lastError.String
+	}
+	if generatedAt.Valid {
+		feed.GeneratedAt = &generatedAt.Time
+	}
+	feed.URL = "/api/v1/feeds/" + feed.Token + "/" + feedFileNames[feed.Format]
+
+	return &feed, nil
+}
+
+// generateFeedToken génère un token aléatoire non devinable pour l'URL publique
+func generateFeedToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// formatFeedPrice formate un prix au format attendu par les flux ("12.00 EUR")
+func formatFeedPrice(price float64, currency string) string {
+	return fmt.Sprintf("%.2f %s", price, strings.ToUpper(currency))
+}
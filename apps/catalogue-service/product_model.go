@@ -17,6 +17,25 @@ type Product struct {
 	Status      string    `json:"status" db:"status"` // active, inactive, draft
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+
+	SEOTitle        string `json:"seo_title,omitempty" db:"seo_title"`
+	MetaDescription string `json:"meta_description,omitempty" db:"meta_description"`
+
+	// Note moyenne et nombre des avis publiés
+	RatingAverage float64 `json:"rating_average" db:"rating_average"`
+	RatingCount   int     `json:"rating_count" db:"rating_count"`
+
+	// Produit numérique (fichiers téléchargeables, clés de licence) et expédition
+	IsDigital        bool `json:"is_digital" db:"is_digital"`
+	RequiresShipping bool `json:"requires_shipping" db:"requires_shipping"`
+}
+
+// ProductDetail est la fiche produit publique, avec ses variantes, dans la
+// langue de la réponse
+type ProductDetail struct {
+	Product
+	Variants []ProductVariant `json:"variants"`
+	Locale   string           `json:"locale"`
 }
 
 // ProductVariant représente une variante de produit (taille, couleur, etc.)
@@ -29,6 +48,10 @@ type ProductVariant struct {
 	Stock     int       `json:"stock" db:"stock"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+
+	// Valeurs effectives : celles de la variante ou, à défaut, du produit
+	IsDigital        bool `json:"is_digital" db:"is_digital"`
+	RequiresShipping bool `json:"requires_shipping" db:"requires_shipping"`
 }
 
 // Category représente une catégorie de produits
@@ -52,6 +75,10 @@ type CreateProductRequest struct {
 	CategoryID  string   `json:"category_id"`
 	Images      []string `json:"images"`
 	Tags        []string `json:"tags"`
+
+	IsDigital bool `json:"is_digital"`
+	// RequiresShipping vaut par défaut l'inverse de IsDigital
+	RequiresShipping *bool `json:"requires_shipping"`
 }
 
 // UpdateProductRequest représente une demande de mise à jour de produit
@@ -63,6 +90,12 @@ type UpdateProductRequest struct {
 	Images      *[]string `json:"images"`
 	Tags        *[]string `json:"tags"`
 	Status      *string   `json:"status"`
+
+	SEOTitle        *string `json:"seo_title"`
+	MetaDescription *string `json:"meta_description"`
+
+	IsDigital        *bool `json:"is_digital"`
+	RequiresShipping *bool `json:"requires_shipping"`
 }
 
 // CreateProduct crée un nouveau produit (utilise CreateProductDB)
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Statuts d'un bon de commande fournisseur
+const (
+	PurchaseOrderDraft             = "draft"
+	PurchaseOrderOrdered           = "ordered"
+	PurchaseOrderPartiallyReceived = "partially_received"
+	PurchaseOrderReceived          = "received"
+	PurchaseOrderCancelled         = "cancelled"
+)
+
+var (
+	errPurchaseOrderNotFound = errors.New("bon de commande introuvable")
+	// errPurchaseOrderStatus signale une opération incompatible avec le statut du bon
+	errPurchaseOrderStatus = errors.New("statut du bon de commande incompatible avec l'opération")
+)
+
+// PurchaseOrderItem représente une ligne d'un bon de commande
+type PurchaseOrderItem struct {
+	ID               string   `json:"id,omitempty"`
+	ProductID        string   `json:"product_id" binding:"required"`
+	VariantID        *string  `json:"variant_id,omitempty"`
+	QuantityOrdered  int      `json:"quantity_ordered" binding:"required,min=1"`
+	QuantityReceived int      `json:"quantity_received"`
+	UnitCost         *float64 `json:"unit_cost,omitempty" binding:"omitempty,min=0"`
+}
+
+// PurchaseOrder représente un bon de commande fournisseur, livré dans un emplacement de stock
+type PurchaseOrder struct {
+	ID         string              `json:"id"`
+	MerchantID string              `json:"merchant_id"`
+	SupplierID string              `json:"supplier_id"`
+	LocationID string              `json:"location_id"`
+	Status     string              `json:"status"`
+	ExpectedAt *string             `json:"expected_at,omitempty"` // AAAA-MM-JJ
+	Note       string              `json:"note,omitempty"`
+	Items      []PurchaseOrderItem `json:"items"`
+	OrderedAt  *time.Time          `json:"ordered_at,omitempty"`
+	ReceivedAt *time.Time          `json:"received_at,omitempty"`
+	CreatedAt  time.Time           `json:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+}
+
+// PurchaseOrderRequest représente une demande de création de bon de commande
+type PurchaseOrderRequest struct {
+	SupplierID string              `json:"supplier_id" binding:"required"`
+	LocationID string              `json:"location_id"` // emplacement par défaut si vide
+	ExpectedAt *string             `json:"expected_at,omitempty"`
+	Note       string              `json:"note"`
+	Items      []PurchaseOrderItem `json:"items" binding:"required,min=1,dive"`
+}
+
+// ReceiptLine représente une quantité reçue sur une ligne de bon de commande
+type ReceiptLine struct {
+	ItemID   string `json:"item_id" binding:"required"`
+	Quantity int    `json:"quantity" binding:"required,min=1"`
+}
+
+// ReceiptRequest représente une réception ; sans lignes, tout le reliquat est reçu
+type ReceiptRequest struct {
+	Items []ReceiptLine `json:"items" binding:"dive"`
+}
+
+const purchaseOrderColumns = `id, merchant_id, supplier_id, location_id, status, TO_CHAR(expected_at, 'YYYY-MM-DD'),
+	COALESCE(note, ''), ordered_at, received_at, created_at, updated_at`
+
+func scanPurchaseOrder(row interface{ Scan(...interface{}) error }) (*PurchaseOrder, error) {
+	var po PurchaseOrder
+	var expectedAt sql.NullString
+	var orderedAt, receivedAt sql.NullTime
+	err := row.Scan(&po.ID, &po.MerchantID, &po.SupplierID, &po.LocationID, &po.Status, &expectedAt,
+		&po.Note, &orderedAt, &receivedAt, &po.CreatedAt, &po.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if expectedAt.Valid {
+		po.ExpectedAt = &expectedAt.String
+	}
+	if orderedAt.Valid {
+		po.OrderedAt = &orderedAt.Time
+	}
+	if receivedAt.Valid {
+		po.ReceivedAt = &receivedAt.Time
+	}
+	return &po, nil
+}
+
+// loadPurchaseOrderItems charge les lignes d'un bon de commande
+func loadPurchaseOrderItems(q queryer, po *PurchaseOrder) error {
+	rows, err := q.Query(
+		`SELECT id, product_id, variant_id, quantity_ordered, quantity_received, unit_cost
+		 FROM purchase_order_items WHERE purchase_order_id = $1 ORDER BY product_id, id`,
+		po.ID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	po.Items = []PurchaseOrderItem{}
+	for rows.Next() {
+		var item PurchaseOrderItem
+		var variantID sql.NullString
+		var unitCost sql.NullFloat64
+		if err := rows.Scan(&item.ID, &item.ProductID, &variantID, &item.QuantityOrdered, &item.QuantityReceived, &unitCost); err != nil {
+			return err
+		}
+		if variantID.Valid {
+			item.VariantID = &variantID.String
+		}
+		if unitCost.Valid {
+			item.UnitCost = &unitCost.Float64
+		}
+		po.Items = append(po.Items, item)
+	}
+	return rows.Err()
+}
+
+// insertPurchaseOrder crée un bon de commande en brouillon et ses lignes
+func insertPurchaseOrder(tx *sql.Tx, merchantID string, req *PurchaseOrderRequest) (*PurchaseOrder, error) {
+	if err := checkSupplier(tx, merchantID, req.SupplierID); err != nil {
+		return nil, err
+	}
+	locationID, err := resolveLocationID(tx, merchantID, req.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	if req.ExpectedAt != nil {
+		if _, err := time.Parse("2006-01-02", *req.ExpectedAt); err != nil {
+			return nil, fmt.Errorf("%w: expected_at invalide (AAAA-MM-JJ)", errInvalidStockChange)
+		}
+	}
+
+	po, err := scanPurchaseOrder(tx.QueryRow(
+		`INSERT INTO purchase_orders (merchant_id, supplier_id, location_id, expected_at, note)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+		 RETURNING `+purchaseOrderColumns,
+		merchantID, req.SupplierID, locationID, req.ExpectedAt, req.Note,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range req.Items {
+		var owned bool
+		if err := tx.QueryRow(
+			"SELECT EXISTS(SELECT 1 FROM products WHERE id = $1 AND merchant_id = $2)",
+			item.ProductID, merchantID,
+		).Scan(&owned); err != nil {
+			return nil, err
+		}
+		if !owned {
+			return nil, fmt.Errorf("%w: produit %s introuvable", errInvalidStockChange, item.ProductID)
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO purchase_order_items (purchase_order_id, product_id, variant_id, quantity_ordered, unit_cost)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			po.ID, item.ProductID, item.VariantID, item.QuantityOrdered, item.UnitCost,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := loadPurchaseOrderItems(tx, po); err != nil {
+		return nil, err
+	}
+	return po, nil
+}
+
+// CreatePurchaseOrder crée un bon de commande en brouillon
+func CreatePurchaseOrder(merchantID string, req *PurchaseOrderRequest) (*PurchaseOrder, error) {
+	var po *PurchaseOrder
+	err := withTx(func(tx *sql.Tx) error {
+		var err error
+		po, err = insertPurchaseOrder(tx, merchantID, req)
+		return err
+	})
+	return po, err
+}
+
+// GenerateDraftPurchaseOrders crée un bon de commande en brouillon par
+// fournisseur pour les produits en stock bas, à hauteur de la quantité
+// suggérée. Les produits sans fournisseur habituel sont retournés à part.
+func GenerateDraftPurchaseOrders(merchantID, locationID string) ([]*PurchaseOrder, []LowStockItem, error) {
+	items, err := ListLowStockItems(merchantID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var supplierOrder []string
+	bySupplier := map[string][]PurchaseOrderItem{}
+	unassigned := []LowStockItem{}
+	for _, item := range items {
+		if item.Suggested <= 0 {
+			continue
+		}
+		if item.SupplierID == nil {
+			unassigned = append(unassigned, item)
+			continue
+		}
+		if _, ok := bySupplier[*item.SupplierID]; !ok {
+			supplierOrder = append(supplierOrder, *item.SupplierID)
+		}
+		bySupplier[*item.SupplierID] = append(bySupplier[*item.SupplierID], PurchaseOrderItem{
+			ProductID:       item.ProductID,
+			VariantID:       item.VariantID,
+			QuantityOrdered: item.Suggested,
+		})
+	}
+
+	orders := []*PurchaseOrder{}
+	err = withTx(func(tx *sql.Tx) error {
+		for _, supplierID := range supplierOrder {
+			po, err := insertPurchaseOrder(tx, merchantID, &PurchaseOrderRequest{
+				SupplierID: supplierID,
+				LocationID: locationID,
+				Note:       "Généré depuis les stocks bas",
+				Items:      bySupplier[supplierID],
+			})
+			if err != nil {
+				return err
+			}
+			orders = append(orders, po)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return orders, unassigned, nil
+}
+
+// GetPurchaseOrder retourne un bon de commande du marchand avec ses lignes
+func GetPurchaseOrder(merchantID, purchaseOrderID string) (*PurchaseOrder, error) {
+	po, err := scanPurchaseOrder(db.QueryRow(
+		"SELECT "+purchaseOrderColumns+" FROM purchase_orders WHERE id = $1 AND merchant_id = $2",
+		purchaseOrderID, merchantID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, errPurchaseOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := loadPurchaseOrderItems(db, po); err != nil {
+		return nil, err
+	}
+	return po, nil
+}
+
+// lockPurchaseOrder verrouille un bon de commande du marchand et vérifie son statut
+func lockPurchaseOrder(tx *sql.Tx, merchantID, purchaseOrderID string, allowed ...string) (*PurchaseOrder, error) {
+	po, err := scanPurchaseOrder(tx.QueryRow(
+		"SELECT "+purchaseOrderColumns+" FROM purchase_orders WHERE id = $1 AND merchant_id = $2 FOR UPDATE",
+		purchaseOrderID, merchantID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, errPurchaseOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range allowed {
+		if po.Status == status {
+			return po, loadPurchaseOrderItems(tx, po)
+		}
+	}
+	return nil, errPurchaseOrderStatus
+}
+
+// setPurchaseOrderStatus met à jour le statut d'un bon de commande et ses dates
+func setPurchaseOrderStatus(tx *sql.Tx, po *PurchaseOrder, status string) (*PurchaseOrder, error) {
+	items := po.Items
+	updated, err := scanPurchaseOrder(tx.QueryRow(
+		`UPDATE purchase_orders
+		 SET status = $1::text,
+		     ordered_at = CASE WHEN $1::text = 'ordered' THEN CURRENT_TIMESTAMP ELSE ordered_at END,
+		     received_at = CASE WHEN $1::text = 'received' THEN CURRENT_TIMESTAMP ELSE received_at END,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $2
+		 RETURNING `+purchaseOrderColumns,
+		status, po.ID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	updated.Items = items
+	return updated, nil
+}
+
+// SubmitPurchaseOrder passe un brouillon à l'état commandé
+func SubmitPurchaseOrder(merchantID, purchaseOrderID string) (*PurchaseOrder, error) {
+	var po *PurchaseOrder
+	err := withTx(func(tx *sql.Tx) error {
+		current, err := lockPurchaseOrder(tx, merchantID, purchaseOrderID, PurchaseOrderDraft)
+		if err != nil {
+			return err
+		}
+		po, err = setPurchaseOrderStatus(tx, current, PurchaseOrderOrdered)
+		return err
+	})
+	return po, err
+}
+
+// CancelPurchaseOrder annule un bon de commande dont rien n'a encore été reçu
+func CancelPurchaseOrder(merchantID, purchaseOrderID string) (*PurchaseOrder, error) {
+	var po *PurchaseOrder
+	err := withTx(func(tx *sql.Tx) error {
+		current, err := lockPurchaseOrder(tx, merchantID, purchaseOrderID, PurchaseOrderDraft, PurchaseOrderOrdered)
+		if err != nil {
+			return err
+		}
+		po, err = setPurchaseOrderStatus(tx, current, PurchaseOrderCancelled)
+		return err
+	})
+	return po, err
+}
+
+// ReceivePurchaseOrder enregistre une réception (totale ou partielle) : le stock
+// de l'emplacement de livraison est augmenté et chaque entrée est inscrite au
+// registre (motif restock, référence du bon de commande).
+func ReceivePurchaseOrder(merchantID, purchaseOrderID string, req *ReceiptRequest) (*PurchaseOrder, error) {
+	var po *PurchaseOrder
+	err := withTx(func(tx *sql.Tx) error {
+		current, err := lockPurchaseOrder(tx, merchantID, purchaseOrderID, PurchaseOrderOrdered, PurchaseOrderPartiallyReceived)
+		if err != nil {
+			return err
+		}
+
+		receipt := map[string]int{}
+		if len(req.Items) == 0 {
+			for _, item := range current.Items {
+				receipt[item.ID] = item.QuantityOrdered - item.QuantityReceived
+			}
+		}
+		for _, line := range req.Items {
+			receipt[line.ItemID] += line.Quantity
+		}
+
+		complete := true
+		for i := range current.Items {
+			item := &current.Items[i]
+			quantity := receipt[item.ID]
+			delete(receipt, item.ID)
+			if quantity > item.QuantityOrdered-item.QuantityReceived {
+				return fmt.Errorf("%w: quantité reçue supérieure au reliquat de la ligne %s", errInvalidStockChange, item.ID)
+			}
+			if quantity > 0 {
+				if err := receivePurchaseOrderItem(tx, current, item, quantity); err != nil {
+					return err
+				}
+			}
+			complete = complete && item.QuantityReceived == item.QuantityOrdered
+		}
+		if len(receipt) > 0 {
+			return fmt.Errorf("%w: ligne(s) absente(s) du bon de commande", errInvalidStockChange)
+		}
+
+		status := PurchaseOrderPartiallyReceived
+		if complete {
+			status = PurchaseOrderReceived
+		}
+		po, err = setPurchaseOrderStatus(tx, current, status)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notifySearchIndexer()
+	return po, nil
+}
+
+// receivePurchaseOrderItem fait entrer la quantité reçue d'une ligne en stock
+func receivePurchaseOrderItem(tx *sql.Tx, po *PurchaseOrder, item *PurchaseOrderItem, quantity int) error {
+	if _, err := tx.Exec(
+		"UPDATE purchase_order_items SET quantity_received = quantity_received + $1 WHERE id = $2",
+		quantity, item.ID,
+	); err != nil {
+		return err
+	}
+	item.QuantityReceived += quantity
+
+	if err := adjustLocationLevel(tx, po.LocationID, item.ProductID, item.VariantID, quantity, 0); err != nil {
+		return err
+	}
+	balance, err := adjustNetworkInventory(tx, item.ProductID, item.VariantID, quantity, false)
+	if err != nil {
+		return err
+	}
+	if _, err := recordInventoryMovement(tx, &InventoryMovement{
+		ProductID:    item.ProductID,
+		VariantID:    item.VariantID,
+		LocationID:   &po.LocationID,
+		Quantity:     quantity,
+		BalanceAfter: balance,
+		Reason:       ReasonRestock,
+		ReferenceID:  &po.ID,
+		Note:         "Réception bon de commande",
+		CreatedBy:    po.MerchantID,
+	}); err != nil {
+		return err
+	}
+	return enqueueSearchOutbox(tx, item.ProductID, OutboxOpIndex)
+}
+
+// handleListPurchaseOrders liste les bons de commande du marchand, filtrables par statut
+func handleListPurchaseOrders(c *gin.Context) {
+	rows, err := db.Query(
+		"SELECT "+purchaseOrderColumns+` FROM purchase_orders
+		 WHERE merchant_id = $1 AND ($2 = '' OR status = $2)
+		 ORDER BY created_at DESC LIMIT 200`,
+		c.GetHeader("X-Merchant-ID"), c.Query("status"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des bons de commande"})
+		return
+	}
+	defer rows.Close()
+
+	orders := []*PurchaseOrder{}
+	for rows.Next() {
+		po, err := scanPurchaseOrder(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des bons de commande"})
+			return
+		}
+		orders = append(orders, po)
+	}
+	rows.Close()
+
+	for _, po := range orders {
+		if err := loadPurchaseOrderItems(db, po); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des bons de commande"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"purchase_orders": orders})
+}
+
+// handleGetPurchaseOrder retourne un bon de commande
+func handleGetPurchaseOrder(c *gin.Context) {
+	po, err := GetPurchaseOrder(c.GetHeader("X-Merchant-ID"), c.Param("id"))
+	if err != nil {
+		respondPurchaseOrderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, po)
+}
+
+// handleCreatePurchaseOrder crée un bon de commande en brouillon
+func handleCreatePurchaseOrder(c *gin.Context) {
+	var req PurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	po, err := CreatePurchaseOrder(c.GetHeader("X-Merchant-ID"), &req)
+	if err != nil {
+		respondPurchaseOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, po)
+}
+
+// handleGeneratePurchaseOrders génère les brouillons depuis les stocks bas (?location_id= pour la livraison)
+func handleGeneratePurchaseOrders(c *gin.Context) {
+	orders, unassigned, err := GenerateDraftPurchaseOrders(c.GetHeader("X-Merchant-ID"), c.Query("location_id"))
+	if err != nil {
+		respondPurchaseOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"purchase_orders":  orders,
+		"without_supplier": unassigned,
+	})
+}
+
+// handleReceivePurchaseOrder enregistre une réception de marchandise
+func handleReceivePurchaseOrder(c *gin.Context) {
+	var req ReceiptRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	po, err := ReceivePurchaseOrder(c.GetHeader("X-Merchant-ID"), c.Param("id"), &req)
+	if err != nil {
+		respondPurchaseOrderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, po)
+}
+
+// handlePurchaseOrderAction retourne le handler d'une transition sans corps (submit, cancel)
+func handlePurchaseOrderAction(action func(merchantID, purchaseOrderID string) (*PurchaseOrder, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		po, err := action(c.GetHeader("X-Merchant-ID"), c.Param("id"))
+		if err != nil {
+			respondPurchaseOrderError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, po)
+	}
+}
+
+// respondPurchaseOrderError traduit les erreurs des bons de commande en réponses HTTP
+func respondPurchaseOrderError(c *gin.Context, err error) {
+	switch {
+	case err == errPurchaseOrderNotFound || err == errSupplierNotFound || err == errLocationNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err == errPurchaseOrderStatus:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errInvalidStockChange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors du traitement du bon de commande"})
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Stratégies de recommandation
+const (
+	// RecommendationSimilar : même catégorie et tags en commun
+	RecommendationSimilar = "similar"
+	// RecommendationBoughtTogether : produits achetés dans les mêmes commandes
+	RecommendationBoughtTogether = "bought_together"
+	// RecommendationRecentlyViewed : derniers produits consultés par le visiteur
+	RecommendationRecentlyViewed = "recently_viewed"
+)
+
+var recommendationStrategies = []string{RecommendationSimilar, RecommendationBoughtTogether, RecommendationRecentlyViewed}
+
+const (
+	defaultRecommendationLimit = 8
+	maxRecommendationLimit     = 24
+	// maxCartRecommendationProducts borne le nombre de produits du panier pris en compte
+	maxCartRecommendationProducts = 50
+	// copurchaseLookbackDays : ancienneté maximale des commandes prises en compte
+	copurchaseLookbackDays = 180
+	// copurchaseTopN : nombre de produits associés conservés par produit
+	copurchaseTopN = 20
+	// productViewRetentionDays : durée de conservation des consultations
+	productViewRetentionDays = 30
+	// copurchaseLockKey sérialise le recalcul entre les instances du service
+	copurchaseLockKey = 47_001
+)
+
+// RecommendedProduct est un produit recommandé avec son score (tags communs et
+// catégorie pour similar, nombre de commandes pour bought_together)
+type RecommendedProduct struct {
+	Product
+	Score float64 `json:"score,omitempty"`
+}
+
+// ProductViewRequest enregistre la consultation d'un produit par un visiteur
+type ProductViewRequest struct {
+	ProductID string `json:"product_id" binding:"required"`
+	VisitorID string `json:"visitor_id" binding:"required,max=64"`
+}
+
+type scoredProductID struct {
+	ID    string
+	Score float64
+}
+
+// SimilarProducts retourne les produits actifs partageant la catégorie ou des
+// tags avec les produits source ; la catégorie compte double
+func SimilarProducts(merchantID string, sourceIDs []string, limit int) ([]RecommendedProduct, error) {
+	return queryRecommendations(merchantID,
+		`WITH src AS (
+			SELECT category_id, tags FROM products WHERE merchant_id = $1 AND id = ANY($2)
+		 )
+		 SELECT p.id, SUM(
+			CASE WHEN p.category_id = src.category_id THEN 2 ELSE 0 END
+			+ cardinality(ARRAY(SELECT unnest(p.tags) INTERSECT SELECT unnest(src.tags)))
+		 ) AS score
+		 FROM products p
+		 JOIN src ON p.category_id = src.category_id OR p.tags && src.tags
+		 WHERE p.merchant_id = $1 AND p.status = 'active' AND NOT (p.id = ANY($2))
+		 GROUP BY p.id
+		 ORDER BY score DESC, MAX(p.updated_at) DESC
+		 LIMIT $3`,
+		merchantID, pq.Array(sourceIDs), limit,
+	)
+}
+
+// BoughtTogetherProducts lit la matrice d'achats conjoints précalculée
+func BoughtTogetherProducts(merchantID string, sourceIDs []string, limit int) ([]RecommendedProduct, error) {
+	return queryRecommendations(merchantID,
+		`SELECT c.related_product_id, SUM(c.order_count) AS score
+		 FROM product_copurchases c
+		 JOIN products p ON p.id = c.related_product_id AND p.status = 'active'
+		 WHERE c.merchant_id = $1 AND c.product_id = ANY($2) AND NOT (c.related_product_id = ANY($2))
+		 GROUP BY c.related_product_id
+		 ORDER BY score DESC
+		 LIMIT $3`,
+		merchantID, pq.Array(sourceIDs), limit,
+	)
+}
+
+// RecentlyViewedProducts retourne les derniers produits consultés par le visiteur
+func RecentlyViewedProducts(merchantID, visitorID string, excludeIDs []string, limit int) ([]RecommendedProduct, error) {
+	return queryRecommendations(merchantID,
+		`SELECT v.product_id, 0
+		 FROM product_views v
+		 JOIN products p ON p.id = v.product_id AND p.status = 'active'
+		 WHERE v.merchant_id = $1 AND v.visitor_id = $2 AND NOT (v.product_id = ANY($3))
+		 GROUP BY v.product_id
+		 ORDER BY MAX(v.viewed_at) DESC
+		 LIMIT $4`,
+		merchantID, visitorID, pq.Array(excludeIDs), limit,
+	)
+}
+
+// queryRecommendations exécute une requête retournant (id, score) puis charge
+// les produits dans l'ordre de la requête
+func queryRecommendations(merchantID, query string, args ...interface{}) ([]RecommendedProduct, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scored []scoredProductID
+	for rows.Next() {
+		var s scoredProductID
+		if err := rows.Scan(&s.ID, &s.Score); err != nil {
+			return nil, err
+		}
+		scored = append(scored, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return loadRecommendedProducts(merchantID, scored)
+}
+
+// loadRecommendedProducts charge les produits actifs en conservant l'ordre des scores
+func loadRecommendedProducts(merchantID string, scored []scoredProductID) ([]RecommendedProduct, error) {
+	result := []RecommendedProduct{}
+	if len(scored) == 0 {
+		return result, nil
+	}
+	ids := make([]string, len(scored))
+	for i, s := range scored {
+		ids[i] = s.ID
+	}
+
+	rows, err := db.Query(
+		"SELECT id, merchant_id, name, description, sku, price, currency, category_id, images, tags, status, created_at, updated_at, COALESCE(seo_title, ''), COALESCE(meta_description, ''), rating_average, rating_count, is_digital, requires_shipping FROM products WHERE merchant_id = $1 AND id = ANY($2) AND status = 'active'",
+		merchantID, pq.Array(ids),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := map[string]Product{}
+	for rows.Next() {
+		var p Product
+		var images, tags pq.StringArray
+		var categoryID sql.NullString
+		err := rows.Scan(&p.ID, &p.MerchantID, &p.Name, &p.Description, &p.SKU, &p.Price, &p.Currency, &categoryID, &images, &tags, &p.Status, &p.CreatedAt, &p.UpdatedAt, &p.SEOTitle, &p.MetaDescription, &p.RatingAverage, &p.RatingCount, &p.IsDigital, &p.RequiresShipping)
+		if err != nil {
+			return nil, err
+		}
+		p.Images = []string(images)
+		p.Tags = []string(tags)
+		p.CategoryID = categoryID.String
+		products[p.ID] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, s := range scored {
+		if p, ok := products[s.ID]; ok {
+			result = append(result, RecommendedProduct{Product: p, Score: s.Score})
+		}
+	}
+	return result, nil
+}
+
+// localizeRecommendations traduit les produits recommandés dans la langue négociée
+func localizeRecommendations(locale string, groups ...[]RecommendedProduct) {
+	var products []*Product
+	for _, group := range groups {
+		for i := range group {
+			products = append(products, &group[i].Product)
+		}
+	}
+	if err := localizeProducts(db, locale, products); err != nil {
+		log.Printf("Erreur lors de la traduction des recommandations: %v", err)
+	}
+}
+
+// RecordProductView enregistre une consultation ; retourne false si le
+// produit n'existe pas ou n'est pas actif
+func RecordProductView(req *ProductViewRequest) (bool, error) {
+	result, err := db.Exec(
+		`INSERT INTO product_views (merchant_id, visitor_id, product_id)
+		 SELECT merchant_id, $2, id FROM products WHERE id = $1 AND status = 'active'`,
+		req.ProductID, req.VisitorID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// RefreshCoPurchases recalcule la matrice d'achats conjoints à partir des
+// commandes payées du checkout et purge les consultations expirées. Le
+// recalcul est fait dans une transaction : les lectures voient l'ancienne
+// matrice jusqu'au commit. Retourne le nombre de paires calculées.
+func RefreshCoPurchases() (int64, error) {
+	var pairs int64
+	err := withTx(func(tx *sql.Tx) error {
+		// Une autre instance recalcule déjà la matrice
+		var locked bool
+		if err := tx.QueryRow("SELECT pg_try_advisory_xact_lock($1)", copurchaseLockKey).Scan(&locked); err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+
+		if _, err := tx.Exec("DELETE FROM product_copurchases"); err != nil {
+			return err
+		}
+		result, err := tx.Exec(
+			`INSERT INTO product_copurchases (product_id, related_product_id, merchant_id, order_count)
+			 SELECT product_id, related_product_id, merchant_id, order_count FROM (
+				SELECT a.product_id, b.product_id AS related_product_id, o.merchant_id,
+				       COUNT(DISTINCT o.id) AS order_count,
+				       ROW_NUMBER() OVER (PARTITION BY a.product_id ORDER BY COUNT(DISTINCT o.id) DESC) AS rank
+				FROM orders o
+				JOIN order_items a ON a.order_id = o.id
+				JOIN order_items b ON b.order_id = o.id AND b.product_id <> a.product_id
+				JOIN products pa ON pa.id = a.product_id AND pa.merchant_id = o.merchant_id
+				JOIN products pb ON pb.id = b.product_id AND pb.merchant_id = o.merchant_id
+				WHERE o.status IN ('paid', 'partially_refunded')
+				  AND o.created_at >= NOW() - $1 * INTERVAL '1 day'
+				GROUP BY a.product_id, b.product_id, o.merchant_id
+			 ) pairs
+			 WHERE rank <= $2`,
+			copurchaseLookbackDays, copurchaseTopN,
+		)
+		if err != nil {
+			return err
+		}
+		pairs, _ = result.RowsAffected()
+
+		_, err = tx.Exec(
+			"DELETE FROM product_views WHERE viewed_at < NOW() - $1 * INTERVAL '1 day'",
+			productViewRetentionDays,
+		)
+		return err
+	})
+	return pairs, err
+}
+
+// StartRecommendationRefresher recalcule la matrice d'achats conjoints au
+// démarrage puis à intervalle régulier
+func StartRecommendationRefresher(interval time.Duration) {
+	refresh := func() {
+		start := time.Now()
+		pairs, err := RefreshCoPurchases()
+		if err != nil {
+			log.Printf("Erreur lors du recalcul des achats conjoints: %v", err)
+			return
+		}
+		log.Printf("Achats conjoints recalculés: %d paire(s) en %s", pairs, time.Since(start).Round(time.Millisecond))
+	}
+
+	go func() {
+		refresh()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			refresh()
+		}
+	}()
+}
+
+// recommendationLimit lit ?limit= borné à maxRecommendationLimit
+func recommendationLimit(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultRecommendationLimit)))
+	if err != nil || limit <= 0 {
+		return defaultRecommendationLimit
+	}
+	if limit > maxRecommendationLimit {
+		return maxRecommendationLimit
+	}
+	return limit
+}
+
+// splitQueryList découpe un paramètre de requête séparé par des virgules
+func splitQueryList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// handleProductRecommendations retourne les recommandations d'une fiche
+// produit, par stratégie (?strategy=similar,bought_together,recently_viewed).
+// recently_viewed n'est calculé que si ?visitor_id= est fourni.
+func handleProductRecommendations(c *gin.Context) {
+	product, err := GetProductByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération du produit"})
+		return
+	}
+	if product == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Produit introuvable"})
+		return
+	}
+
+	strategies := recommendationStrategies
+	if requested := splitQueryList(c.Query("strategy")); len(requested) > 0 {
+		for _, strategy := range requested {
+			if !containsString(recommendationStrategies, strategy) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Stratégie inconnue: " + strategy})
+				return
+			}
+		}
+		strategies = requested
+	}
+
+	limit := recommendationLimit(c)
+	visitorID := c.Query("visitor_id")
+	source := []string{product.ID}
+
+	recommendations := map[string][]RecommendedProduct{}
+	for _, strategy := range strategies {
+		var products []RecommendedProduct
+		switch strategy {
+		case RecommendationSimilar:
+			products, err = SimilarProducts(product.MerchantID, source, limit)
+		case RecommendationBoughtTogether:
+			products, err = BoughtTogetherProducts(product.MerchantID, source, limit)
+		case RecommendationRecentlyViewed:
+			if visitorID == "" {
+				products = []RecommendedProduct{}
+			} else {
+				products, err = RecentlyViewedProducts(product.MerchantID, visitorID, source, limit)
+			}
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors du calcul des recommandations"})
+			return
+		}
+		recommendations[strategy] = products
+	}
+
+	locale, locales := negotiateLocale(c, product.MerchantID)
+	if locale != locales.DefaultLocale {
+		groups := make([][]RecommendedProduct, 0, len(recommendations))
+		for _, products := range recommendations {
+			groups = append(groups, products)
+		}
+		localizeRecommendations(locale, groups...)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id":      product.ID,
+		"recommendations": recommendations,
+		"locale":          locale,
+	})
+}
+
+// handleCartRecommendations recommande des produits pour un panier
+// (?product_ids=a,b) : achats conjoints d'abord, complétés par des produits
+// similaires
+func handleCartRecommendations(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+	if merchantID == "" {
+		merchantID = storefrontMerchantID(c)
+	}
+	if merchantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "merchant_id requis"})
+		return
+	}
+
+	cart := splitQueryList(c.Query("product_ids"))
+	if len(cart) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "product_ids requis"})
+		return
+	}
+	if len(cart) > maxCartRecommendationProducts {
+		cart = cart[:maxCartRecommendationProducts]
+	}
+	limit := recommendationLimit(c)
+
+	products, err := BoughtTogetherProducts(merchantID, cart, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors du calcul des recommandations"})
+		return
+	}
+	if len(products) < limit {
+		// Un produit acheté avec le panier peut aussi lui être similaire
+		similar, err := SimilarProducts(merchantID, cart, limit+len(products))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors du calcul des recommandations"})
+			return
+		}
+		seen := map[string]bool{}
+		for _, p := range products {
+			seen[p.ID] = true
+		}
+		for _, p := range similar {
+			if len(products) >= limit {
+				break
+			}
+			if !seen[p.ID] {
+				products = append(products, p)
+			}
+		}
+	}
+
+	locale, locales := negotiateLocale(c, merchantID)
+	if locale != locales.DefaultLocale {
+		localizeRecommendations(locale, products)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"products": products, "locale": locale})
+}
+
+// handleRecordProductView enregistre la consultation d'une fiche produit
+func handleRecordProductView(c *gin.Context) {
+	var req ProductViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	found, err := RecordProductView(&req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement de la consultation"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Produit introuvable"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
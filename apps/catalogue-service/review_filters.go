@@ -0,0 +1,111 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ReviewVerdict est le résultat d'un filtre d'avis : un statut vide accepte
+// l'avis, ReviewStatusPending l'envoie en modération, ReviewStatusSpam l'écarte
+type ReviewVerdict struct {
+	Status string
+	Reason string
+}
+
+// ReviewFilter est un point d'extension appliqué à chaque avis soumis avant
+// son enregistrement (anti-spam, grossièretés, service externe...)
+type ReviewFilter interface {
+	Name() string
+	Check(review *ProductReview, settings *ReviewSettings) ReviewVerdict
+}
+
+// reviewFilters sont appliqués dans l'ordre ; le premier verdict spam l'emporte
+var reviewFilters = []ReviewFilter{
+	spamReviewFilter{},
+	profanityReviewFilter{},
+}
+
+// moderateReview détermine l'état initial d'un avis : spam ou modération si
+// un filtre le signale, sinon publication selon le réglage auto_publish
+func moderateReview(review *ProductReview, settings *ReviewSettings) (status, reason string) {
+	for _, filter := range reviewFilters {
+		verdict := filter.Check(review, settings)
+		switch verdict.Status {
+		case ReviewStatusSpam:
+			return ReviewStatusSpam, filter.Name() + ": " + verdict.Reason
+		case ReviewStatusPending:
+			if status == "" {
+				status, reason = ReviewStatusPending, filter.Name()+": "+verdict.Reason
+			}
+		}
+	}
+	if status != "" {
+		return status, reason
+	}
+	if settings.AutoPublish {
+		return ReviewStatusPublished, ""
+	}
+	return ReviewStatusPending, ""
+}
+
+var reviewLinkPattern = regexp.MustCompile(`(?i)(https?://|www\.)\S+`)
+
+// spamReviewFilter repère les liens et les répétitions de caractères
+type spamReviewFilter struct{}
+
+func (spamReviewFilter) Name() string { return "spam" }
+
+func (spamReviewFilter) Check(review *ProductReview, _ *ReviewSettings) ReviewVerdict {
+	text := review.Title + " " + review.Body
+	switch links := len(reviewLinkPattern.FindAllString(text, -1)); {
+	case links > 1:
+		return ReviewVerdict{ReviewStatusSpam, "plusieurs liens"}
+	case links == 1:
+		return ReviewVerdict{ReviewStatusPending, "lien dans l'avis"}
+	}
+	if hasCharacterRun(text, 10) {
+		return ReviewVerdict{ReviewStatusPending, "caractères répétés"}
+	}
+	return ReviewVerdict{}
+}
+
+// hasCharacterRun indique si text contient n fois de suite le même caractère
+func hasCharacterRun(text string, n int) bool {
+	var last rune
+	run := 0
+	for _, r := range text {
+		if r == last {
+			run++
+		} else {
+			last, run = r, 1
+		}
+		if run >= n && !unicode.IsSpace(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultBlockedWords complète les mots bloqués par chaque marchand
+var defaultBlockedWords = []string{
+	"connard", "connasse", "encule", "enculé", "salope", "putain", "merde",
+	"fuck", "shit", "bitch", "asshole",
+}
+
+// profanityReviewFilter envoie en modération les avis contenant un mot bloqué
+type profanityReviewFilter struct{}
+
+func (profanityReviewFilter) Name() string { return "grossièretés" }
+
+func (profanityReviewFilter) Check(review *ProductReview, settings *ReviewSettings) ReviewVerdict {
+	words := strings.FieldsFunc(strings.ToLower(review.AuthorName+" "+review.Title+" "+review.Body), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if containsString(defaultBlockedWords, word) || containsString(settings.BlockedWords, word) {
+			return ReviewVerdict{ReviewStatusPending, "mot bloqué"}
+		}
+	}
+	return ReviewVerdict{}
+}
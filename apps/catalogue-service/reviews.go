@@ -0,0 +1,724 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// États de modération d'un avis
+const (
+	ReviewStatusPending   = "pending"   // en attente de modération
+	ReviewStatusPublished = "published" // visible sur le storefront
+	ReviewStatusRejected  = "rejected"  // refusé par le marchand
+	ReviewStatusSpam      = "spam"      // spam (filtre ou marchand)
+)
+
+const (
+	maxReviewBodyLength   = 5000
+	maxReviewPhotos       = 5
+	maxStructuredReviews  = 5
+	defaultReviewPageSize = 10
+)
+
+// reviewSorts associe les tris des avis publics à leur clause ORDER BY
+var reviewSorts = map[string]string{
+	"recent":      "created_at DESC",
+	"rating_desc": "rating DESC, created_at DESC",
+	"rating_asc":  "rating ASC, created_at DESC",
+}
+
+var errReviewNotFound = errors.New("avis introuvable")
+
+// checkoutClient appelle les endpoints internes du checkout-service
+var checkoutClient = &http.Client{Timeout: 10 * time.Second}
+
+// ProductReview est l'avis d'un acheteur vérifié sur un produit
+type ProductReview struct {
+	ID               string     `json:"id"`
+	MerchantID       string     `json:"merchant_id"`
+	ProductID        string     `json:"product_id"`
+	UserID           string     `json:"user_id,omitempty"`
+	OrderID          string     `json:"order_id,omitempty"`
+	AuthorName       string     `json:"author_name"`
+	Rating           int        `json:"rating"`
+	Title            string     `json:"title,omitempty"`
+	Body             string     `json:"body"`
+	Photos           []string   `json:"photos"`
+	Status           string     `json:"status,omitempty"`
+	ModerationReason string     `json:"moderation_reason,omitempty"`
+	ModeratedAt      *time.Time `json:"moderated_at,omitempty"`
+	MerchantReply    string     `json:"merchant_reply,omitempty"`
+	RepliedAt        *time.Time `json:"replied_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// public masque les informations réservées au marchand (client, commande, modération)
+func (r *ProductReview) public() *ProductReview {
+	out := *r
+	out.UserID = ""
+	out.OrderID = ""
+	out.Status = ""
+	out.ModerationReason = ""
+	out.ModeratedAt = nil
+	return &out
+}
+
+// ReviewRequest représente l'avis soumis par un client. OrderID est
+// facultatif : sans lui, la commande la plus récente contenant le produit
+// sert de preuve d'achat.
+type ReviewRequest struct {
+	OrderID    string   `json:"order_id"`
+	AuthorName string   `json:"author_name"`
+	Rating     int      `json:"rating"`
+	Title      string   `json:"title"`
+	Body       string   `json:"body"`
+	Photos     []string `json:"photos"`
+}
+
+// ReviewSummary agrège les avis publiés d'un produit
+type ReviewSummary struct {
+	RatingAverage float64     `json:"rating_average"`
+	RatingCount   int         `json:"rating_count"`
+	Distribution  map[int]int `json:"distribution"` // nombre d'avis par note
+}
+
+// ReviewSettings regroupe les réglages de modération du marchand
+type ReviewSettings struct {
+	AutoPublish  bool     `json:"auto_publish"`
+	BlockedWords []string `json:"blocked_words"`
+}
+
+// ReviewModerationRequest change l'état de modération d'un avis
+type ReviewModerationRequest struct {
+	Status string `json:"status" binding:"required,oneof=pending published rejected spam"`
+	Reason string `json:"reason"`
+}
+
+const reviewColumns = `id, merchant_id, product_id, user_id, order_id, author_name, rating, COALESCE(title, ''), body, photos,
+	status, COALESCE(moderation_reason, ''), moderated_at, COALESCE(merchant_reply, ''), replied_at, created_at, updated_at`
+
+func scanReview(row interface{ Scan(...interface{}) error }) (*ProductReview, error) {
+	var r ProductReview
+	var photos pq.StringArray
+	var moderatedAt, repliedAt sql.NullTime
+	err := row.Scan(&r.ID, &r.MerchantID, &r.ProductID, &r.UserID, &r.OrderID, &r.AuthorName, &r.Rating, &r.Title, &r.Body, &photos,
+		&r.Status, &r.ModerationReason, &moderatedAt, &r.MerchantReply, &repliedAt, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	r.Photos = []string(photos)
+	if moderatedAt.Valid {
+		r.ModeratedAt = &moderatedAt.Time
+	}
+	if repliedAt.Valid {
+		r.RepliedAt = &repliedAt.Time
+	}
+	return &r, nil
+}
+
+// validateReviewRequest normalise et vérifie un avis soumis
+func validateReviewRequest(req *ReviewRequest) ValidationErrors {
+	var errs ValidationErrors
+	req.AuthorName = strings.TrimSpace(req.AuthorName)
+	req.Title = strings.TrimSpace(req.Title)
+	req.Body = strings.TrimSpace(req.Body)
+
+	if req.AuthorName == "" || utf8.RuneCountInString(req.AuthorName) > 100 {
+		errs = append(errs, FieldError{"author_name", "nom requis (100 caractères maximum)"})
+	}
+	if req.Rating < 1 || req.Rating > 5 {
+		errs = append(errs, FieldError{"rating", "note entre 1 et 5"})
+	}
+	if utf8.RuneCountInString(req.Title) > 255 {
+		errs = append(errs, FieldError{"title", "255 caractères maximum"})
+	}
+	if req.Body == "" || utf8.RuneCountInString(req.Body) > maxReviewBodyLength {
+		errs = append(errs, FieldError{"body", fmt.Sprintf("texte requis (%d caractères maximum)", maxReviewBodyLength)})
+	}
+	if len(req.Photos) > maxReviewPhotos {
+		errs = append(errs, FieldError{"photos", fmt.Sprintf("au plus %d photos", maxReviewPhotos)})
+	}
+	for i, photo := range req.Photos {
+		u, err := url.Parse(photo)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, FieldError{fmt.Sprintf("photos[%d]", i), "URL invalide"})
+		}
+	}
+	return errs
+}
+
+// PurchaseVerification est la réponse du checkout-service pour un achat
+type PurchaseVerification struct {
+	Verified bool   `json:"verified"`
+	OrderID  string `json:"order_id"`
+}
+
+// verifyPurchase demande au checkout-service si le client a acheté le produit
+func verifyPurchase(userID, productID, orderID string) (*PurchaseVerification, error) {
+	query := url.Values{}
+	query.Set("user_id", userID)
+	query.Set("product_id", productID)
+	if orderID != "" {
+		query.Set("order_id", orderID)
+	}
+
+	resp, err := checkoutClient.Get(getEnv("CHECKOUT_SERVICE_URL", "http://localhost:8081") + "/api/v1/purchases/verify?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("checkout-service: statut %d", resp.StatusCode)
+	}
+	var verification PurchaseVerification
+	if err := json.NewDecoder(resp.Body).Decode(&verification); err != nil {
+		return nil, err
+	}
+	return &verification, nil
+}
+
+// GetReviewSettings retourne les réglages de modération (modération manuelle par défaut)
+func GetReviewSettings(q queryer, merchantID string) (*ReviewSettings, error) {
+	settings := &ReviewSettings{BlockedWords: []string{}}
+	var words pq.StringArray
+	err := q.QueryRow(
+		"SELECT auto_publish, blocked_words FROM review_settings WHERE merchant_id = $1",
+		merchantID,
+	).Scan(&settings.AutoPublish, &words)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(words) > 0 {
+		settings.BlockedWords = []string(words)
+	}
+	return settings, nil
+}
+
+// refreshProductRating recalcule la note agrégée du produit à partir de ses
+// avis publiés et planifie sa réindexation (tri par note de la recherche)
+func refreshProductRating(tx *sql.Tx, productID string) error {
+	_, err := tx.Exec(
+		`UPDATE products SET
+		     rating_average = COALESCE((SELECT ROUND(AVG(rating), 2) FROM product_reviews WHERE product_id = $1 AND status = 'published'), 0),
+		     rating_count = (SELECT COUNT(*) FROM product_reviews WHERE product_id = $1 AND status = 'published')
+		 WHERE id = $1`,
+		productID,
+	)
+	if err != nil {
+		return err
+	}
+	return enqueueSearchOutbox(tx, productID, OutboxOpIndex)
+}
+
+// GetReviewSummary retourne la note moyenne, le nombre et la répartition des avis publiés
+func GetReviewSummary(productID string) (*ReviewSummary, error) {
+	rows, err := db.Query(
+		"SELECT rating, COUNT(*) FROM product_reviews WHERE product_id = $1 AND status = 'published' GROUP BY rating",
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summary := &ReviewSummary{Distribution: map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}}
+	total := 0
+	for rows.Next() {
+		var rating, count int
+		if err := rows.Scan(&rating, &count); err != nil {
+			return nil, err
+		}
+		summary.Distribution[rating] = count
+		summary.RatingCount += count
+		total += rating * count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if summary.RatingCount > 0 {
+		summary.RatingAverage = float64(int(float64(total)/float64(summary.RatingCount)*100+0.5)) / 100
+	}
+	return summary, nil
+}
+
+// CreateReview enregistre l'avis après passage des filtres ; publié
+// directement, il met à jour la note du produit
+func CreateReview(product *Product, userID, orderID string, req *ReviewRequest, settings *ReviewSettings) (*ProductReview, error) {
+	review := &ProductReview{
+		MerchantID: product.MerchantID,
+		ProductID:  product.ID,
+		UserID:     userID,
+		OrderID:    orderID,
+		AuthorName: req.AuthorName,
+		Rating:     req.Rating,
+		Title:      req.Title,
+		Body:       req.Body,
+		Photos:     req.Photos,
+	}
+	if review.Photos == nil {
+		review.Photos = []string{}
+	}
+	status, reason := moderateReview(review, settings)
+
+	err := withTx(func(tx *sql.Tx) error {
+		var err error
+		review, err = scanReview(tx.QueryRow(
+			`INSERT INTO product_reviews (merchant_id, product_id, user_id, order_id, author_name, rating, title, body, photos, status, moderation_reason)
+			 VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10, NULLIF($11, ''))
+			 RETURNING `+reviewColumns,
+			review.MerchantID, review.ProductID, review.UserID, review.OrderID, review.AuthorName, review.Rating,
+			review.Title, review.Body, pq.Array(review.Photos), status, reason,
+		))
+		if err != nil {
+			return err
+		}
+		if status == ReviewStatusPublished {
+			return refreshProductRating(tx, product.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if review.Status == ReviewStatusPublished {
+		notifySearchIndexer()
+	}
+	return review, nil
+}
+
+// ModerateReview change l'état d'un avis et met à jour la note du produit
+func ModerateReview(merchantID, reviewID string, req *ReviewModerationRequest) (*ProductReview, error) {
+	var review *ProductReview
+	err := withTx(func(tx *sql.Tx) error {
+		var err error
+		review, err = scanReview(tx.QueryRow(
+			`UPDATE product_reviews
+			 SET status = $1, moderation_reason = NULLIF($2, ''), moderated_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			 WHERE id::text = $3 AND merchant_id = $4
+			 RETURNING `+reviewColumns,
+			req.Status, strings.TrimSpace(req.Reason), reviewID, merchantID,
+		))
+		if err == sql.ErrNoRows {
+			return errReviewNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return refreshProductRating(tx, review.ProductID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notifySearchIndexer()
+	return review, nil
+}
+
+// DeleteReview supprime un avis et met à jour la note du produit
+func DeleteReview(merchantID, reviewID string) error {
+	err := withTx(func(tx *sql.Tx) error {
+		var productID string
+		err := tx.QueryRow(
+			"DELETE FROM product_reviews WHERE id::text = $1 AND merchant_id = $2 RETURNING product_id",
+			reviewID, merchantID,
+		).Scan(&productID)
+		if err == sql.ErrNoRows {
+			return errReviewNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return refreshProductRating(tx, productID)
+	})
+	if err != nil {
+		return err
+	}
+
+	notifySearchIndexer()
+	return nil
+}
+
+// productStructuredData construit le JSON-LD schema.org Product de la fiche
+// produit, avec la note agrégée et les derniers avis publiés
+func productStructuredData(product *Product, reviews []*ProductReview) map[string]interface{} {
+	data := map[string]interface{}{
+		"@context": "https://schema.org",
+		"@type":    "Product",
+		"name":     product.Name,
+		"sku":      product.SKU,
+		"offers": map[string]interface{}{
+			"@type":         "Offer",
+			"price":         strconv.FormatFloat(product.Price, 'f', 2, 64),
+			"priceCurrency": product.Currency,
+		},
+	}
+	if product.Description != "" {
+		data["description"] = product.Description
+	}
+	if len(product.Images) > 0 {
+		data["image"] = product.Images
+	}
+
+	if product.RatingCount > 0 {
+		data["aggregateRating"] = map[string]interface{}{
+			"@type":       "AggregateRating",
+			"ratingValue": product.RatingAverage,
+			"reviewCount": product.RatingCount,
+			"bestRating":  5,
+			"worstRating": 1,
+		}
+	}
+	if len(reviews) > 0 {
+		items := make([]map[string]interface{}, 0, len(reviews))
+		for _, r := range reviews {
+			item := map[string]interface{}{
+				"@type":         "Review",
+				"author":        map[string]interface{}{"@type": "Person", "name": r.AuthorName},
+				"datePublished": r.CreatedAt.Format("2006-01-02"),
+				"reviewBody":    r.Body,
+				"reviewRating":  map[string]interface{}{"@type": "Rating", "ratingValue": r.Rating, "bestRating": 5, "worstRating": 1},
+			}
+			if r.Title != "" {
+				item["name"] = r.Title
+			}
+			items = append(items, item)
+		}
+		data["review"] = items
+	}
+	return data
+}
+
+// listPublishedReviews retourne une page d'avis publiés d'un produit
+func listPublishedReviews(productID, sort string, rating, limit, offset int) ([]*ProductReview, error) {
+	query := "SELECT " + reviewColumns + " FROM product_reviews WHERE product_id = $1 AND status = 'published'"
+	args := []interface{}{productID, limit, offset}
+	if rating > 0 {
+		query += " AND rating = $4"
+		args = append(args, rating)
+	}
+	rows, err := db.Query(query+" ORDER BY "+reviewSorts[sort]+" LIMIT $2 OFFSET $3", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []*ProductReview{}
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review.public())
+	}
+	return reviews, rows.Err()
+}
+
+// handleListProductReviews liste les avis publiés d'un produit
+// (?sort=recent|rating_desc|rating_asc, ?rating=1..5) avec leur synthèse
+func handleListProductReviews(c *gin.Context) {
+	product, err := GetProductByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération du produit"})
+		return
+	}
+	if product == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Produit introuvable"})
+		return
+	}
+
+	sort := c.DefaultQuery("sort", "recent")
+	if _, ok := reviewSorts[sort]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tri invalide (recent, rating_desc, rating_asc)"})
+		return
+	}
+	rating, _ := strconv.Atoi(c.Query("rating"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultReviewPageSize)))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 50 {
+		limit = defaultReviewPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	reviews, err := listPublishedReviews(product.ID, sort, rating, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des avis"})
+		return
+	}
+	summary, err := GetReviewSummary(product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des avis"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reviews": reviews, "summary": summary})
+}
+
+// handleProductStructuredData retourne le JSON-LD de la fiche produit, à
+// insérer dans une balise <script type="application/ld+json">
+func handleProductStructuredData(c *gin.Context) {
+	product, err := GetProductByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération du produit"})
+		return
+	}
+	if product == nil || product.Status != "active" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Produit introuvable"})
+		return
+	}
+
+	locale, locales := negotiateLocale(c, product.MerchantID)
+	if locale != locales.DefaultLocale {
+		if err := localizeProducts(db, locale, []*Product{product}); err != nil {
+			log.Printf("Erreur lors de la traduction du produit: %v", err)
+		}
+	}
+
+	reviews, err := listPublishedReviews(product.ID, "recent", 0, maxStructuredReviews, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des avis"})
+		return
+	}
+
+	body, err := json.Marshal(productStructuredData(product, reviews))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la génération des données structurées"})
+		return
+	}
+	c.Data(http.StatusOK, "application/ld+json; charset=utf-8", body)
+}
+
+// handleCreateReview enregistre l'avis d'un client authentifié (X-User-ID
+// posé par l'API Gateway) ayant acheté le produit
+func handleCreateReview(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Utilisateur non authentifié"})
+		return
+	}
+
+	product, err := GetProductByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération du produit"})
+		return
+	}
+	if product == nil || product.Status != "active" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Produit introuvable"})
+		return
+	}
+
+	var req ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errs := validateReviewRequest(&req); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	verification, err := verifyPurchase(userID, product.ID, req.OrderID)
+	if err != nil {
+		log.Printf("Erreur lors de la vérification d'achat: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Vérification de l'achat impossible"})
+		return
+	}
+	if !verification.Verified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Seuls les acheteurs du produit peuvent laisser un avis"})
+		return
+	}
+
+	settings, err := GetReviewSettings(db, product.MerchantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement de l'avis"})
+		return
+	}
+
+	review, err := CreateReview(product, userID, verification.OrderID, &req, settings)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Vous avez déjà laissé un avis sur ce produit"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement de l'avis"})
+		return
+	}
+
+	go func() {
+		if err := publishMerchantEvent(review.MerchantID, "review.submitted", review); err != nil {
+			log.Printf("Erreur lors de la publication de l'avis %s: %v", review.ID, err)
+		}
+	}()
+
+	// Le client voit l'état de son avis, pas le motif de modération
+	out := *review
+	out.ModerationReason = ""
+	c.JSON(http.StatusCreated, &out)
+}
+
+// handleListReviews liste les avis du marchand pour la modération
+// (?status=, ?product_id=)
+func handleListReviews(c *gin.Context) {
+	query := "SELECT " + reviewColumns + " FROM product_reviews WHERE merchant_id = $1"
+	args := []interface{}{c.GetHeader("X-Merchant-ID")}
+	if status := c.Query("status"); status != "" {
+		args = append(args, status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if productID := c.Query("product_id"); productID != "" {
+		args = append(args, productID)
+		query += fmt.Sprintf(" AND product_id::text = $%d", len(args))
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	args = append(args, limit, offset)
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des avis"})
+		return
+	}
+	defer rows.Close()
+
+	reviews := []*ProductReview{}
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des avis"})
+			return
+		}
+		reviews = append(reviews, review)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reviews": reviews})
+}
+
+// handleModerateReview publie, rejette ou marque un avis comme spam
+func handleModerateReview(c *gin.Context) {
+	var req ReviewModerationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	review, err := ModerateReview(c.GetHeader("X-Merchant-ID"), c.Param("id"), &req)
+	if err == errReviewNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avis non trouvé"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la modération de l'avis"})
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+// handleReplyReview enregistre la réponse publique du marchand (vide : supprimée)
+func handleReplyReview(c *gin.Context) {
+	var req struct {
+		Reply string `json:"reply"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Reply = strings.TrimSpace(req.Reply)
+	if utf8.RuneCountInString(req.Reply) > maxReviewBodyLength {
+		respondValidationErrors(c, ValidationErrors{{"reply", fmt.Sprintf("%d caractères maximum", maxReviewBodyLength)}})
+		return
+	}
+
+	review, err := scanReview(db.QueryRow(
+		`UPDATE product_reviews
+		 SET merchant_reply = NULLIF($1, ''), replied_at = CASE WHEN $1 = '' THEN NULL ELSE CURRENT_TIMESTAMP END,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE id::text = $2 AND merchant_id = $3
+		 RETURNING `+reviewColumns,
+		req.Reply, c.Param("id"), c.GetHeader("X-Merchant-ID"),
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avis non trouvé"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement de la réponse"})
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+// handleDeleteReview supprime définitivement un avis
+func handleDeleteReview(c *gin.Context) {
+	err := DeleteReview(c.GetHeader("X-Merchant-ID"), c.Param("id"))
+	if err == errReviewNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avis non trouvé"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la suppression de l'avis"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Avis supprimé"})
+}
+
+// handleGetReviewSettings retourne les réglages de modération du marchand
+func handleGetReviewSettings(c *gin.Context) {
+	settings, err := GetReviewSettings(db, c.GetHeader("X-Merchant-ID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des réglages des avis"})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// handleSaveReviewSettings enregistre les réglages de modération du marchand
+func handleSaveReviewSettings(c *gin.Context) {
+	var settings ReviewSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	words := []string{}
+	for _, word := range settings.BlockedWords {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" && !containsString(words, word) {
+			words = append(words, word)
+		}
+	}
+	settings.BlockedWords = words
+
+	_, err := db.Exec(
+		`INSERT INTO review_settings (merchant_id, auto_publish, blocked_words) VALUES ($1, $2, $3)
+		 ON CONFLICT (merchant_id) DO UPDATE SET auto_publish = $2, blocked_words = $3, updated_at = CURRENT_TIMESTAMP`,
+		c.GetHeader("X-Merchant-ID"), settings.AutoPublish, pq.Array(settings.BlockedWords),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement des réglages des avis"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
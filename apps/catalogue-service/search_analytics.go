@@ -0,0 +1,233 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAnalyticsRange limite la période couverte par un rapport
+const maxAnalyticsRange = 366 * 24 * time.Hour
+
+// SearchClickRequest représente le clic d'un acheteur sur un résultat de recherche
+type SearchClickRequest struct {
+	SearchID  string `json:"search_id" binding:"required"`
+	ProductID string `json:"product_id" binding:"required"`
+	Position  int    `json:"position"`
+}
+
+// SearchConversionRequest rattache une commande à la recherche qui l'a précédée
+type SearchConversionRequest struct {
+	SearchID string  `json:"search_id" binding:"required"`
+	OrderID  string  `json:"order_id" binding:"required"`
+	Amount   float64 `json:"amount"`
+}
+
+// QueryStat représente les statistiques d'une requête
+type QueryStat struct {
+	Query          string  `json:"query"`
+	Searches       int     `json:"searches"`
+	AvgResults     float64 `json:"avg_results"`
+	Clicks         int     `json:"clicks"`
+	ClickRate      float64 `json:"click_rate"`
+	Conversions    int     `json:"conversions"`
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// SearchAnalyticsReport représente le rapport d'analytique de recherche d'un marchand
+type SearchAnalyticsReport struct {
+	From              time.Time   `json:"from"`
+	To                time.Time   `json:"to"`
+	TotalSearches     int         `json:"total_searches"`
+	ZeroResultRate    float64     `json:"zero_result_rate"`
+	ClickRate         float64     `json:"click_rate"`
+	Conversions       int         `json:"conversions"`
+	ConversionRate    float64     `json:"conversion_rate"`
+	Revenue           float64     `json:"revenue"`
+	TopQueries        []QueryStat `json:"top_queries"`
+	ZeroResultQueries []QueryStat `json:"zero_result_queries"`
+}
+
+// recordSearchEvent journalise une recherche et retourne son identifiant
+func recordSearchEvent(req *SearchRequest, resultCount int) (string, error) {
+	var id string
+	err := db.QueryRow(
+		`INSERT INTO search_events (merchant_id, query, normalized_query, result_count, page, backend)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		req.MerchantID, req.Query, normalizeSearchQuery(req.Query), resultCount, req.Page, searchBackend.Name(),
+	).Scan(&id)
+	return id, err
+}
+
+// handleSearchClick enregistre le clic sur un produit depuis une page de résultats
+func handleSearchClick(c *gin.Context) {
+	var req SearchClickRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := db.Exec(
+		`INSERT INTO search_clicks (search_id, product_id, position)
+		 SELECT id, $2, NULLIF($3, 0) FROM search_events WHERE id = $1`,
+		req.SearchID, req.ProductID, req.Position,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement du clic"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recherche non trouvée"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// handleSearchConversion enregistre une commande issue d'une recherche
+func handleSearchConversion(c *gin.Context) {
+	var req SearchConversionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := db.Exec(
+		`INSERT INTO search_conversions (search_id, order_id, amount)
+		 SELECT id, $2, $3 FROM search_events WHERE id = $1
+		 ON CONFLICT (search_id, order_id) DO NOTHING`,
+		req.SearchID, req.OrderID, req.Amount,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement de la conversion"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var exists bool
+		db.QueryRow("SELECT EXISTS(SELECT 1 FROM search_events WHERE id = $1)", req.SearchID).Scan(&exists)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recherche non trouvée"})
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// handleSearchAnalytics retourne les requêtes les plus fréquentes, les requêtes
+// sans résultat et la conversion recherche → achat sur une période (30 jours par défaut)
+func handleSearchAnalytics(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from invalide (AAAA-MM-JJ)"})
+			return
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to invalide (AAAA-MM-JJ)"})
+			return
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) || to.Sub(from) > maxAnalyticsRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "période invalide"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	report, err := BuildSearchAnalyticsReport(merchantID, from, to, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors du calcul du rapport"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// BuildSearchAnalyticsReport calcule le rapport sur la période [from, to[.
+// Seules les premières pages sont comptées pour ne pas doubler les recherches paginées.
+func BuildSearchAnalyticsReport(merchantID string, from, to time.Time, limit int) (*SearchAnalyticsReport, error) {
+	report := &SearchAnalyticsReport{From: from, To: to}
+
+	var zeroResults, clicked int
+	err := db.QueryRow(
+		`SELECT COUNT(*),
+		        COUNT(*) FILTER (WHERE e.result_count = 0),
+		        COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM search_clicks sc WHERE sc.search_id = e.id)),
+		        COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM search_conversions cv WHERE cv.search_id = e.id)),
+		        COALESCE((SELECT SUM(cv.amount) FROM search_conversions cv
+		                  JOIN search_events ce ON ce.id = cv.search_id
+		                  WHERE ce.merchant_id = $1 AND ce.created_at >= $2 AND ce.created_at < $3), 0)
+		 FROM search_events e
+		 WHERE e.merchant_id = $1 AND e.created_at >= $2 AND e.created_at < $3 AND e.page = 1`,
+		merchantID, from, to,
+	).Scan(&report.TotalSearches, &zeroResults, &clicked, &report.Conversions, &report.Revenue)
+	if err != nil {
+		return nil, err
+	}
+	if report.TotalSearches > 0 {
+		report.ZeroResultRate = float64(zeroResults) / float64(report.TotalSearches)
+		report.ClickRate = float64(clicked) / float64(report.TotalSearches)
+		report.ConversionRate = float64(report.Conversions) / float64(report.TotalSearches)
+	}
+
+	if report.TopQueries, err = queryStats(merchantID, from, to, limit, false); err != nil {
+		return nil, err
+	}
+	if report.ZeroResultQueries, err = queryStats(merchantID, from, to, limit, true); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// queryStats agrège les recherches par requête normalisée, les plus fréquentes d'abord
+func queryStats(merchantID string, from, to time.Time, limit int, zeroResultsOnly bool) ([]QueryStat, error) {
+	rows, err := db.Query(
+		`SELECT e.normalized_query, COUNT(*), AVG(e.result_count),
+		        COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM search_clicks sc WHERE sc.search_id = e.id)),
+		        COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM search_conversions cv WHERE cv.search_id = e.id))
+		 FROM search_events e
+		 WHERE e.merchant_id = $1 AND e.created_at >= $2 AND e.created_at < $3 AND e.page = 1
+		   AND e.normalized_query <> '' AND (NOT $4 OR e.result_count = 0)
+		 GROUP BY e.normalized_query
+		 ORDER BY COUNT(*) DESC, e.normalized_query
+		 LIMIT $5`,
+		merchantID, from, to, zeroResultsOnly, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []QueryStat{}
+	for rows.Next() {
+		var s QueryStat
+		var avg sql.NullFloat64
+		if err := rows.Scan(&s.Query, &s.Searches, &avg, &s.Clicks, &s.Conversions); err != nil {
+			return nil, err
+		}
+		s.AvgResults = avg.Float64
+		if s.Searches > 0 {
+			s.ClickRate = float64(s.Clicks) / float64(s.Searches)
+			s.ConversionRate = float64(s.Conversions) / float64(s.Searches)
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Backends de recherche sélectionnables via SEARCH_BACKEND
+const (
+	SearchBackendElasticsearch = "elasticsearch"
+	SearchBackendPostgres      = "postgres"
+	// SearchBackendAuto utilise Elasticsearch et bascule sur Postgres s'il est indisponible
+	SearchBackendAuto = "auto"
+)
+
+// searchFallbackCooldown est la durée pendant laquelle un backend défaillant n'est plus sollicité
+const searchFallbackCooldown = 30 * time.Second
+
+// searchBackend est le backend utilisé par les routes de recherche
+var searchBackend SearchBackend
+
+// searchIndexingEnabled indique si les modifications doivent être propagées à Elasticsearch
+var searchIndexingEnabled = true
+
+// SearchBackend abstrait le moteur utilisé pour la recherche et l'autocomplétion
+type SearchBackend interface {
+	Name() string
+	Search(req *SearchRequest) (*SearchResult, error)
+	Suggest(merchantID, prefix string, size int) ([]Suggestion, error)
+	Ping() error
+}
+
+// newSearchBackend construit le backend correspondant à la configuration
+func newSearchBackend(mode string) (SearchBackend, error) {
+	switch mode {
+	case SearchBackendElasticsearch:
+		return &elasticsearchBackend{client: esClient}, nil
+	case SearchBackendPostgres:
+		return &postgresSearchBackend{}, nil
+	case SearchBackendAuto:
+		return &fallbackSearchBackend{
+			primary:   &elasticsearchBackend{client: esClient},
+			secondary: &postgresSearchBackend{},
+		}, nil
+	}
+	return nil, fmt.Errorf("backend de recherche inconnu: %s (elasticsearch, postgres ou auto)", mode)
+}
+
+// elasticsearchBackend expose le client Elasticsearch comme backend de recherche
+type elasticsearchBackend struct {
+	client *ElasticsearchClient
+}
+
+func (b *elasticsearchBackend) Name() string {
+	return SearchBackendElasticsearch
+}
+
+func (b *elasticsearchBackend) Search(req *SearchRequest) (*SearchResult, error) {
+	return b.client.SearchProducts(req)
+}
+
+func (b *elasticsearchBackend) Suggest(merchantID, prefix string, size int) ([]Suggestion, error) {
+	return b.client.SuggestProducts(merchantID, prefix, size)
+}
+
+func (b *elasticsearchBackend) Ping() error {
+	return b.client.Ping()
+}
+
+// fallbackSearchBackend interroge le backend principal et bascule sur le
+// secondaire en cas d'erreur. Un backend principal qui ne répond plus au ping
+// est écarté pendant searchFallbackCooldown pour ne pas ralentir chaque requête.
+type fallbackSearchBackend struct {
+	primary   SearchBackend
+	secondary SearchBackend
+
+	mu             sync.Mutex
+	unhealthyUntil time.Time
+}
+
+func (b *fallbackSearchBackend) Name() string {
+	return b.primary.Name() + "+" + b.secondary.Name()
+}
+
+func (b *fallbackSearchBackend) Search(req *SearchRequest) (*SearchResult, error) {
+	if b.primaryAvailable() {
+		result, err := b.primary.Search(req)
+		if err == nil {
+			return result, nil
+		}
+		b.primaryFailed(err)
+	}
+	return b.secondary.Search(req)
+}
+
+func (b *fallbackSearchBackend) Suggest(merchantID, prefix string, size int) ([]Suggestion, error) {
+	if b.primaryAvailable() {
+		suggestions, err := b.primary.Suggest(merchantID, prefix, size)
+		if err == nil {
+			return suggestions, nil
+		}
+		b.primaryFailed(err)
+	}
+	return b.secondary.Suggest(merchantID, prefix, size)
+}
+
+// Ping réussit tant que l'un des deux backends répond
+func (b *fallbackSearchBackend) Ping() error {
+	if err := b.primary.Ping(); err == nil {
+		return nil
+	}
+	return b.secondary.Ping()
+}
+
+func (b *fallbackSearchBackend) primaryAvailable() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Now().After(b.unhealthyUntil)
+}
+
+// primaryFailed écarte le backend principal s'il ne répond plus ; une erreur
+// isolée (requête invalide) ne fait basculer que la requête courante
+func (b *fallbackSearchBackend) primaryFailed(err error) {
+	log.Printf("Recherche %s en échec, bascule sur %s: %v", b.primary.Name(), b.secondary.Name(), err)
+	if pingErr := b.primary.Ping(); pingErr == nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.unhealthyUntil = time.Now().Add(searchFallbackCooldown)
+	b.mu.Unlock()
+	log.Printf("Backend %s indisponible, %s utilisé pendant %s", b.primary.Name(), b.secondary.Name(), searchFallbackCooldown)
+}
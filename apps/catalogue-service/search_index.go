@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// productIndexDefinition retourne les settings (analyseurs) et mappings explicites
+// de l'index produits ; le mapping dynamique est désactivé
+func productIndexDefinition() map[string]interface{} {
+	return map[string]interface{}{
+		"settings": map[string]interface{}{
+			"analysis": map[string]interface{}{
+				"filter": map[string]interface{}{
+					"french_elision": map[string]interface{}{
+						"type":          "elision",
+						"articles_case": true,
+						"articles":      []string{"l", "m", "t", "qu", "n", "s", "j", "d", "c", "jusqu", "quoiqu", "lorsqu", "puisqu"},
+					},
+					"french_stop":     map[string]interface{}{"type": "stop", "stopwords": "_french_"},
+					"french_stemmer":  map[string]interface{}{"type": "stemmer", "language": "light_french"},
+					"english_stop":    map[string]interface{}{"type": "stop", "stopwords": "_english_"},
+					"english_stemmer": map[string]interface{}{"type": "stemmer", "language": "english"},
+					"english_possessive": map[string]interface{}{
+						"type":     "stemmer",
+						"language": "possessive_english",
+					},
+					"german_stop":    map[string]interface{}{"type": "stop", "stopwords": "_german_"},
+					"german_stemmer": map[string]interface{}{"type": "stemmer", "language": "light_german"},
+					"dutch_stop":     map[string]interface{}{"type": "stop", "stopwords": "_dutch_"},
+					"dutch_stemmer":  map[string]interface{}{"type": "stemmer", "language": "dutch"},
+					"autocomplete_ngram": map[string]interface{}{
+						"type":     "edge_ngram",
+						"min_gram": 2,
+						"max_gram": 20,
+					},
+				},
+				"analyzer": map[string]interface{}{
+					"product_text": map[string]interface{}{
+						"type":      "custom",
+						"tokenizer": "standard",
+						"filter":    []string{"lowercase", "asciifolding"},
+					},
+					"product_text_fr": map[string]interface{}{
+						"type":      "custom",
+						"tokenizer": "standard",
+						"filter":    []string{"french_elision", "lowercase", "french_stop", "asciifolding", "french_stemmer"},
+					},
+					"product_text_en": map[string]interface{}{
+						"type":      "custom",
+						"tokenizer": "standard",
+						"filter":    []string{"english_possessive", "lowercase", "english_stop", "asciifolding", "english_stemmer"},
+					},
+					"product_text_de": map[string]interface{}{
+						"type":      "custom",
+						"tokenizer": "standard",
+						"filter":    []string{"lowercase", "german_stop", "german_normalization", "german_stemmer"},
+					},
+					"product_text_nl": map[string]interface{}{
+						"type":      "custom",
+						"tokenizer": "standard",
+						"filter":    []string{"lowercase", "dutch_stop", "asciifolding", "dutch_stemmer"},
+					},
+					"autocomplete_index": map[string]interface{}{
+						"type":      "custom",
+						"tokenizer": "standard",
+						"filter":    []string{"lowercase", "asciifolding", "autocomplete_ngram"},
+					},
+				},
+				"normalizer": map[string]interface{}{
+					"sort_normalizer": map[string]interface{}{
+						"type":   "custom",
+						"filter": []string{"lowercase", "asciifolding"},
+					},
+				},
+			},
+		},
+		"mappings": map[string]interface{}{
+			"dynamic":    "strict",
+			"properties": productIndexProperties(),
+		},
+	}
+}
+
+// productIndexProperties décrit les champs d'un ProductDocument
+func productIndexProperties() map[string]interface{} {
+	return map[string]interface{}{
+		"id":          map[string]interface{}{"type": "keyword"},
+		"merchant_id": map[string]interface{}{"type": "keyword"},
+		"name": map[string]interface{}{
+			"type":     "text",
+			"analyzer": "product_text",
+			"fields": map[string]interface{}{
+				"fr":   map[string]interface{}{"type": "text", "analyzer": "product_text_fr"},
+				"en":   map[string]interface{}{"type": "text", "analyzer": "product_text_en"},
+				"sort": map[string]interface{}{"type": "keyword", "normalizer": "sort_normalizer"},
+				"autocomplete": map[string]interface{}{
+					"type":            "text",
+					"analyzer":        "autocomplete_index",
+					"search_analyzer": "product_text",
+				},
+			},
+		},
+		"description": map[string]interface{}{
+			"type":     "text",
+			"analyzer": "product_text",
+			"fields": map[string]interface{}{
+				"fr": map[string]interface{}{"type": "text", "analyzer": "product_text_fr"},
+				"en": map[string]interface{}{"type": "text", "analyzer": "product_text_en"},
+			},
+		},
+		"sku":             map[string]interface{}{"type": "keyword"},
+		"price":           map[string]interface{}{"type": "scaled_float", "scaling_factor": 100},
+		"currency":        map[string]interface{}{"type": "keyword"},
+		"category_id":     map[string]interface{}{"type": "keyword"},
+		"images":          map[string]interface{}{"type": "keyword", "index": false},
+		"tags":            map[string]interface{}{"type": "keyword"},
+		"variant_options": map[string]interface{}{"type": "keyword"},
+		"status":          map[string]interface{}{"type": "keyword"},
+		"available":       map[string]interface{}{"type": "integer"},
+		"in_stock":        map[string]interface{}{"type": "boolean"},
+		"rating_average":  map[string]interface{}{"type": "scaled_float", "scaling_factor": 100},
+		"rating_count":    map[string]interface{}{"type": "integer"},
+		"created_at":      map[string]interface{}{"type": "date"},
+		"updated_at":      map[string]interface{}{"type": "date"},
+		"translations":    map[string]interface{}{"properties": translationIndexProperties()},
+	}
+}
+
+// translationIndexProperties décrit les champs traduits, analysés dans leur langue
+func translationIndexProperties() map[string]interface{} {
+	properties := make(map[string]interface{}, len(catalogueLocales))
+	for locale := range catalogueLocales {
+		text := map[string]interface{}{"type": "text", "analyzer": "product_text_" + locale}
+		properties[locale] = map[string]interface{}{
+			"properties": map[string]interface{}{"name": text, "description": text},
+		}
+	}
+	return properties
+}
+
+// EnsureProductIndex crée l'index produits et son alias au démarrage s'ils
+// n'existent pas. Un index existant reçoit les nouveaux champs du mapping ;
+// un nouvel analyseur (sous-champs fr/en/autocomplete, traductions de/nl)
+// nécessite la commande reindex.
+func (es *ElasticsearchClient) EnsureProductIndex() error {
+	indices, concrete, err := es.GetAliasIndices(productsIndexAlias)
+	if err != nil {
+		return err
+	}
+
+	if len(indices) == 0 && !concrete {
+		newIndex := fmt.Sprintf("%s_v%d", productsIndexAlias, time.Now().Unix())
+		if err := es.CreateIndex(newIndex, productIndexDefinition()); err != nil {
+			return err
+		}
+		log.Printf("Index %s créé", newIndex)
+		return es.SwapAlias(productsIndexAlias, newIndex, nil, false)
+	}
+
+	if concrete {
+		log.Printf("L'index %s n'est pas un alias (mapping dynamique), lancer la commande reindex", productsIndexAlias)
+	}
+
+	_, err = es.doJSON("PUT", "/"+productsIndexAlias+"/_mapping", map[string]interface{}{
+		"properties": productIndexProperties(),
+	}, nil)
+	return err
+}
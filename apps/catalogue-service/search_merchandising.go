@@ -0,0 +1,403 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Actions de merchandising
+const (
+	MerchandisingPin      = "pin"      // épingle les produits en tête, dans l'ordre donné
+	MerchandisingBury     = "bury"     // relègue les produits en fin de résultats
+	MerchandisingBoost    = "boost"    // multiplie la pertinence des produits d'un tag ou d'une catégorie
+	MerchandisingRedirect = "redirect" // renvoie la recherche vers une URL
+)
+
+// Types de correspondance entre une règle et la requête saisie
+const (
+	MatchExact    = "exact"
+	MatchContains = "contains"
+	MatchAny      = "any" // s'applique à toutes les recherches du marchand
+)
+
+// buriedWeight est le facteur appliqué à la pertinence d'un produit relégué
+const buriedWeight = 0.001
+
+// MerchandisingRule représente une règle de merchandising d'un marchand
+type MerchandisingRule struct {
+	ID          string    `json:"id"`
+	MerchantID  string    `json:"merchant_id"`
+	Query       string    `json:"query"`
+	MatchType   string    `json:"match_type"`
+	Action      string    `json:"action"`
+	ProductIDs  []string  `json:"product_ids"`
+	Tags        []string  `json:"tags"`
+	CategoryIDs []string  `json:"category_ids"`
+	Boost       float64   `json:"boost"`
+	RedirectURL string    `json:"redirect_url,omitempty"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// MerchandisingRuleRequest représente une demande de création ou de mise à jour de règle
+type MerchandisingRuleRequest struct {
+	Query       string   `json:"query"`
+	MatchType   string   `json:"match_type"`
+	Action      string   `json:"action" binding:"required,oneof=pin bury boost redirect"`
+	ProductIDs  []string `json:"product_ids"`
+	Tags        []string `json:"tags"`
+	CategoryIDs []string `json:"category_ids"`
+	Boost       float64  `json:"boost"`
+	RedirectURL string   `json:"redirect_url"`
+	Active      *bool    `json:"active"`
+}
+
+// searchBoost multiplie la pertinence des produits portant l'un des tags ou catégories
+type searchBoost struct {
+	Tags        []string
+	CategoryIDs []string
+	Weight      float64
+}
+
+// searchMerchandising regroupe les règles applicables à une recherche
+type searchMerchandising struct {
+	Pinned      []string
+	Buried      []string
+	Boosts      []searchBoost
+	RedirectURL string
+}
+
+func (m *searchMerchandising) empty() bool {
+	return m == nil || (len(m.Pinned) == 0 && len(m.Buried) == 0 && len(m.Boosts) == 0)
+}
+
+// normalizeSearchQuery met une requête sous la forme utilisée par les règles et l'analytique
+func normalizeSearchQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// loadSearchMerchandising charge les règles actives du marchand correspondant à la requête.
+// Les règles sont appliquées dans l'ordre de création ; la première redirection l'emporte.
+func loadSearchMerchandising(merchantID, query string) (*searchMerchandising, error) {
+	normalized := normalizeSearchQuery(query)
+
+	rows, err := db.Query(
+		`SELECT action, product_ids, tags, category_ids, boost, COALESCE(redirect_url, '')
+		 FROM merchandising_rules
+		 WHERE merchant_id = $1 AND active
+		   AND (match_type = 'any'
+		        OR (match_type = 'exact' AND query = $2)
+		        OR (match_type = 'contains' AND $2 <> '' AND position(query IN $2) > 0))
+		 ORDER BY created_at`,
+		merchantID, normalized,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := &searchMerchandising{}
+	pinned := map[string]bool{}
+	for rows.Next() {
+		var action, redirectURL string
+		var productIDs, tags, categoryIDs pq.StringArray
+		var boost float64
+		if err := rows.Scan(&action, &productIDs, &tags, &categoryIDs, &boost, &redirectURL); err != nil {
+			return nil, err
+		}
+
+		switch action {
+		case MerchandisingPin:
+			for _, id := range productIDs {
+				if !pinned[id] {
+					pinned[id] = true
+					m.Pinned = append(m.Pinned, id)
+				}
+			}
+		case MerchandisingBury:
+			m.Buried = append(m.Buried, productIDs...)
+		case MerchandisingBoost:
+			m.Boosts = append(m.Boosts, searchBoost{Tags: tags, CategoryIDs: categoryIDs, Weight: boost})
+		case MerchandisingRedirect:
+			if m.RedirectURL == "" {
+				m.RedirectURL = redirectURL
+			}
+		}
+	}
+
+	return m, rows.Err()
+}
+
+// applyElasticsearchMerchandising enveloppe la requête textuelle : les boosts et
+// relégations passent par function_score, les épinglages par une requête pinned
+func applyElasticsearchMerchandising(query interface{}, m *searchMerchandising) interface{} {
+	if m.empty() {
+		return query
+	}
+
+	var functions []interface{}
+	for _, boost := range m.Boosts {
+		var should []interface{}
+		if len(boost.Tags) > 0 {
+			should = append(should, termsFilter("tags", boost.Tags))
+		}
+		if len(boost.CategoryIDs) > 0 {
+			should = append(should, termsFilter("category_id", boost.CategoryIDs))
+		}
+		if len(should) == 0 {
+			continue
+		}
+		functions = append(functions, map[string]interface{}{
+			"filter": map[string]interface{}{"bool": map[string]interface{}{"should": should}},
+			"weight": boost.Weight,
+		})
+	}
+	if len(m.Buried) > 0 {
+		functions = append(functions, map[string]interface{}{
+			"filter": map[string]interface{}{"ids": map[string]interface{}{"values": m.Buried}},
+			"weight": buriedWeight,
+		})
+	}
+
+	if len(functions) > 0 {
+		query = map[string]interface{}{
+			"function_score": map[string]interface{}{
+				"query":      query,
+				"functions":  functions,
+				"score_mode": "multiply",
+				"boost_mode": "multiply",
+			},
+		}
+	}
+
+	if len(m.Pinned) > 0 {
+		query = map[string]interface{}{
+			"pinned": map[string]interface{}{
+				"ids":     m.Pinned,
+				"organic": query,
+			},
+		}
+	}
+
+	return query
+}
+
+// postgresMerchandisingScore applique les règles au score SQL d'un produit
+func (q *pgSearchQuery) postgresMerchandisingScore(score string, m *searchMerchandising) string {
+	if m.empty() {
+		return score
+	}
+
+	factors := []string{"(1 + " + score + ")"}
+	for _, boost := range m.Boosts {
+		factors = append(factors, fmt.Sprintf(
+			"CASE WHEN p.tags && %s::text[] OR p.category_id::text = ANY(%s::text[]) THEN %s ELSE 1 END",
+			q.arg(pq.Array(boost.Tags)), q.arg(pq.Array(boost.CategoryIDs)), q.arg(boost.Weight),
+		))
+	}
+	if len(m.Buried) > 0 {
+		factors = append(factors, fmt.Sprintf(
+			"CASE WHEN p.id::text = ANY(%s::text[]) THEN %v ELSE 1 END",
+			q.arg(pq.Array(m.Buried)), buriedWeight,
+		))
+	}
+	expr := strings.Join(factors, " * ")
+
+	if len(m.Pinned) > 0 {
+		// Les produits épinglés passent devant tous les autres, dans l'ordre de la règle
+		pinned := q.arg(pq.Array(m.Pinned))
+		expr = fmt.Sprintf(
+			"CASE WHEN p.id::text = ANY(%[1]s::text[]) THEN 1000000 - array_position(%[1]s::text[], p.id::text) ELSE %[2]s END",
+			pinned, expr,
+		)
+	}
+	return expr
+}
+
+// validateMerchandisingRule normalise la requête et vérifie la cohérence de la règle
+func validateMerchandisingRule(req *MerchandisingRuleRequest) error {
+	req.Query = normalizeSearchQuery(req.Query)
+	if req.MatchType == "" {
+		req.MatchType = MatchExact
+	}
+	if req.MatchType != MatchExact && req.MatchType != MatchContains && req.MatchType != MatchAny {
+		return errors.New("match_type invalide (exact, contains ou any)")
+	}
+	if req.MatchType != MatchAny && req.Query == "" {
+		return errors.New("query requise")
+	}
+
+	switch req.Action {
+	case MerchandisingPin, MerchandisingBury:
+		if len(req.ProductIDs) == 0 {
+			return errors.New("product_ids requis")
+		}
+	case MerchandisingBoost:
+		if len(req.Tags) == 0 && len(req.CategoryIDs) == 0 {
+			return errors.New("tags ou category_ids requis")
+		}
+		if req.Boost <= 0 {
+			return errors.New("boost doit être positif")
+		}
+	case MerchandisingRedirect:
+		if req.MatchType == MatchAny {
+			return errors.New("une redirection doit cibler une requête")
+		}
+		u, err := url.Parse(req.RedirectURL)
+		if err != nil || req.RedirectURL == "" || (u.IsAbs() && u.Scheme != "https" && u.Scheme != "http") {
+			return errors.New("redirect_url invalide")
+		}
+	}
+
+	if req.Action != MerchandisingBoost {
+		req.Boost = 1
+	}
+	if req.ProductIDs == nil {
+		req.ProductIDs = []string{}
+	}
+	if req.Tags == nil {
+		req.Tags = []string{}
+	}
+	if req.CategoryIDs == nil {
+		req.CategoryIDs = []string{}
+	}
+	return nil
+}
+
+const merchandisingRuleColumns = `id, merchant_id, query, match_type, action, product_ids, tags, category_ids,
+	boost, COALESCE(redirect_url, ''), active, created_at, updated_at`
+
+func scanMerchandisingRule(row interface{ Scan(...interface{}) error }) (*MerchandisingRule, error) {
+	var rule MerchandisingRule
+	var productIDs, tags, categoryIDs pq.StringArray
+	err := row.Scan(&rule.ID, &rule.MerchantID, &rule.Query, &rule.MatchType, &rule.Action,
+		&productIDs, &tags, &categoryIDs, &rule.Boost, &rule.RedirectURL, &rule.Active,
+		&rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	rule.ProductIDs = []string(productIDs)
+	rule.Tags = []string(tags)
+	rule.CategoryIDs = []string(categoryIDs)
+	return &rule, nil
+}
+
+// handleListMerchandisingRules liste les règles de merchandising du marchand
+func handleListMerchandisingRules(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	rows, err := db.Query(
+		"SELECT "+merchandisingRuleColumns+" FROM merchandising_rules WHERE merchant_id = $1 ORDER BY created_at",
+		merchantID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des règles"})
+		return
+	}
+	defer rows.Close()
+
+	rules := []*MerchandisingRule{}
+	for rows.Next() {
+		rule, err := scanMerchandisingRule(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des règles"})
+			return
+		}
+		rules = append(rules, rule)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// handleCreateMerchandisingRule crée une règle de merchandising
+func handleCreateMerchandisingRule(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	var req MerchandisingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateMerchandisingRule(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	active := req.Active == nil || *req.Active
+
+	rule, err := scanMerchandisingRule(db.QueryRow(
+		`INSERT INTO merchandising_rules
+		 (merchant_id, query, match_type, action, product_ids, tags, category_ids, boost, redirect_url, active)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10)
+		 RETURNING `+merchandisingRuleColumns,
+		merchantID, req.Query, req.MatchType, req.Action, pq.Array(req.ProductIDs), pq.Array(req.Tags),
+		pq.Array(req.CategoryIDs), req.Boost, req.RedirectURL, active,
+	))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la création de la règle"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// handleUpdateMerchandisingRule remplace une règle de merchandising
+func handleUpdateMerchandisingRule(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	var req MerchandisingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateMerchandisingRule(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	active := req.Active == nil || *req.Active
+
+	rule, err := scanMerchandisingRule(db.QueryRow(
+		`UPDATE merchandising_rules
+		 SET query = $1, match_type = $2, action = $3, product_ids = $4, tags = $5, category_ids = $6,
+		     boost = $7, redirect_url = NULLIF($8, ''), active = $9, updated_at = NOW()
+		 WHERE id = $10 AND merchant_id = $11
+		 RETURNING `+merchandisingRuleColumns,
+		req.Query, req.MatchType, req.Action, pq.Array(req.ProductIDs), pq.Array(req.Tags),
+		pq.Array(req.CategoryIDs), req.Boost, req.RedirectURL, active, c.Param("id"), merchantID,
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Règle non trouvée"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour de la règle"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// handleDeleteMerchandisingRule supprime une règle de merchandising
+func handleDeleteMerchandisingRule(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	result, err := db.Exec("DELETE FROM merchandising_rules WHERE id = $1 AND merchant_id = $2", c.Param("id"), merchantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la suppression de la règle"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Règle non trouvée"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Règle supprimée"})
+}
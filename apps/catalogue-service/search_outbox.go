@@ -0,0 +1,366 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Opérations d'indexation enregistrées dans l'outbox
+const (
+	OutboxOpIndex  = "index"
+	OutboxOpDelete = "delete"
+)
+
+const (
+	// outboxBatchSize est le nombre maximal d'entrées traitées par appel _bulk
+	outboxBatchSize = 500
+	// outboxMaxAttempts au-delà duquel une entrée n'est plus retentée (visible par check-drift)
+	outboxMaxAttempts = 15
+	// outboxMaxBackoff plafonne le délai entre deux tentatives
+	outboxMaxBackoff = time.Hour
+	// outboxClaimTimeout au-delà duquel une entrée réclamée par une instance
+	// arrêtée en cours de traitement est reprise
+	outboxClaimTimeout = 5 * time.Minute
+	// outboxPurgeInterval espace les purges des entrées traitées
+	outboxPurgeInterval = time.Hour
+)
+
+// searchIndexerWake réveille le worker d'indexation sans attendre le prochain tick
+var searchIndexerWake = make(chan struct{}, 1)
+
+// outboxEntry représente une entrée en attente dans l'outbox d'indexation
+type outboxEntry struct {
+	ID        int64
+	ProductID string
+	Operation string
+	Attempts  int
+}
+
+// enqueueSearchOutbox inscrit une opération d'indexation dans la transaction courante,
+// de sorte qu'elle ne soit visible par le worker que si la modification est validée
+func enqueueSearchOutbox(q queryer, productID, operation string) error {
+	// Avec le backend Postgres seul, la base est la source de la recherche
+	if !searchIndexingEnabled {
+		return nil
+	}
+	_, err := q.Exec(
+		"INSERT INTO search_outbox (product_id, operation) VALUES ($1, $2)",
+		productID, operation,
+	)
+	return err
+}
+
+// notifySearchIndexer demande au worker de traiter l'outbox dès que possible
+func notifySearchIndexer() {
+	select {
+	case searchIndexerWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartSearchIndexer lance le worker qui synchronise l'outbox vers Elasticsearch
+func StartSearchIndexer() {
+	interval, err := time.ParseDuration(getEnv("SEARCH_INDEXER_INTERVAL", "5s"))
+	if err != nil {
+		log.Fatalf("SEARCH_INDEXER_INTERVAL invalide: %v", err)
+	}
+	retention, err := time.ParseDuration(getEnv("SEARCH_OUTBOX_RETENTION", "168h"))
+	if err != nil || retention <= 0 {
+		log.Fatalf("SEARCH_OUTBOX_RETENTION invalide: %v", getEnv("SEARCH_OUTBOX_RETENTION", ""))
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var lastPurge time.Time
+		for {
+			select {
+			case <-ticker.C:
+			case <-searchIndexerWake:
+			}
+
+			// Vider l'outbox tant que des lots complets sont traités
+			for {
+				processed, err := ProcessSearchOutbox()
+				if err != nil {
+					log.Printf("Erreur du worker d'indexation: %v", err)
+					break
+				}
+				if processed < outboxBatchSize {
+					break
+				}
+			}
+
+			if time.Since(lastPurge) >= outboxPurgeInterval {
+				if purged, err := purgeSearchOutbox(retention); err != nil {
+					log.Printf("Erreur lors de la purge de l'outbox d'indexation: %v", err)
+				} else if purged > 0 {
+					log.Printf("%d entrées traitées purgées de l'outbox d'indexation", purged)
+				}
+				lastPurge = time.Now()
+			}
+		}
+	}()
+}
+
+// ProcessSearchOutbox traite un lot d'entrées de l'outbox en un seul appel _bulk.
+// Les entrées sont réclamées puis la réclamation est validée avant l'appel à
+// Elasticsearch : aucun verrou n'est tenu pendant l'indexation.
+func ProcessSearchOutbox() (int, error) {
+	entries, err := claimSearchOutbox()
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+
+	// Regrouper par produit : seule la dernière opération compte
+	latest := map[string]outboxEntry{}
+	entryIDs := map[string][]int64{}
+	var order []string
+	for _, e := range entries {
+		if _, seen := latest[e.ProductID]; !seen {
+			order = append(order, e.ProductID)
+		}
+		latest[e.ProductID] = e
+		entryIDs[e.ProductID] = append(entryIDs[e.ProductID], e.ID)
+	}
+
+	var toIndex []string
+	for _, productID := range order {
+		if latest[productID].Operation == OutboxOpIndex {
+			toIndex = append(toIndex, productID)
+		}
+	}
+
+	// En cas d'erreur, les entrées réclamées sont reprises après outboxClaimTimeout
+	documents, err := loadProductDocuments(db, toIndex)
+	if err != nil {
+		return 0, err
+	}
+
+	actions := make([]BulkIndexAction, 0, len(order))
+	for _, productID := range order {
+		action := BulkIndexAction{ProductID: productID}
+		// Un produit supprimé entre-temps est retiré de l'index
+		if doc, ok := documents[productID]; ok && latest[productID].Operation == OutboxOpIndex {
+			action.Document = doc
+		}
+		actions = append(actions, action)
+	}
+
+	failed, bulkErr := esClient.BulkIndex(productsIndexAlias, actions)
+	if bulkErr != nil {
+		// Échec global (cluster indisponible) : tout le lot est replanifié
+		failed = map[string]string{}
+		for _, productID := range order {
+			failed[productID] = bulkErr.Error()
+		}
+	}
+
+	err = withTx(func(tx *sql.Tx) error {
+		var done []int64
+		for _, productID := range order {
+			reason, isFailed := failed[productID]
+			if !isFailed {
+				done = append(done, entryIDs[productID]...)
+				continue
+			}
+
+			attempts := latest[productID].Attempts + 1
+			_, err := tx.Exec(
+				`UPDATE search_outbox
+				 SET attempts = attempts + 1, last_error = $1, next_attempt_at = NOW() + ($2 * INTERVAL '1 second')
+				 WHERE id = ANY($3)`,
+				reason, int(outboxBackoff(attempts).Seconds()), pq.Array(entryIDs[productID]),
+			)
+			if err != nil {
+				return err
+			}
+			if attempts >= outboxMaxAttempts {
+				log.Printf("Indexation abandonnée pour le produit %s après %d tentatives: %s", productID, attempts, reason)
+			}
+		}
+
+		if len(done) == 0 {
+			return nil
+		}
+		_, err := tx.Exec(
+			"UPDATE search_outbox SET processed_at = NOW() WHERE id = ANY($1)",
+			pq.Array(done),
+		)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(entries), nil
+}
+
+// claimSearchOutbox réclame un lot d'entrées dues en repoussant leur prochaine
+// tentative de outboxClaimTimeout ; les autres instances les ignorent (SKIP LOCKED
+// pendant la réclamation, next_attempt_at ensuite)
+func claimSearchOutbox() ([]outboxEntry, error) {
+	rows, err := db.Query(
+		`UPDATE search_outbox SET next_attempt_at = NOW() + ($3 * INTERVAL '1 second')
+		 WHERE id IN (
+		     SELECT id FROM search_outbox
+		     WHERE processed_at IS NULL AND attempts < $1 AND next_attempt_at <= NOW()
+		     ORDER BY id
+		     LIMIT $2
+		     FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING id, product_id, operation, attempts`,
+		outboxMaxAttempts, outboxBatchSize, int(outboxClaimTimeout.Seconds()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []outboxEntry
+	for rows.Next() {
+		var e outboxEntry
+		if err := rows.Scan(&e.ID, &e.ProductID, &e.Operation, &e.Attempts); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING ne garantit pas l'ordre : la dernière opération d'un produit
+	// doit rester la dernière
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+// purgeSearchOutbox supprime les entrées traitées depuis plus longtemps que la
+// rétention ; les entrées abandonnées sont gardées pour check-drift
+func purgeSearchOutbox(retention time.Duration) (int64, error) {
+	result, err := db.Exec(
+		"DELETE FROM search_outbox WHERE processed_at < NOW() - ($1 * INTERVAL '1 second')",
+		int(retention.Seconds()),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// outboxBackoff calcule le délai exponentiel avant la prochaine tentative
+func outboxBackoff(attempts int) time.Duration {
+	backoff := 5 * time.Second
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > outboxMaxBackoff {
+		backoff = outboxMaxBackoff
+	}
+	return backoff
+}
+
+// productAvailabilityJoin joint à products (p) le stock disponible du produit
+// (inv.available), tel qu'indexé et comparé par check-drift. Une variante en
+// rupture avec des commandes en attente (réservé > quantité) compte pour zéro
+// au lieu de masquer le stock des autres variantes.
+const productAvailabilityJoin = `LEFT JOIN (
+		     SELECT product_id, SUM(GREATEST(quantity - reserved, 0)) AS available
+		     FROM inventory GROUP BY product_id
+		 ) inv ON inv.product_id = p.id`
+
+// loadProductDocuments charge les documents d'indexation (produit + disponibilité)
+func loadProductDocuments(q queryer, productIDs []string) (map[string]*ProductDocument, error) {
+	documents := map[string]*ProductDocument{}
+	if len(productIDs) == 0 {
+		return documents, nil
+	}
+
+	rows, err := q.Query(
+		`SELECT p.id, p.merchant_id, p.name, COALESCE(p.description, ''), p.sku, p.price, p.currency,
+		        p.category_id, p.images, p.tags, p.status, p.created_at, p.updated_at,
+		        p.rating_average, p.rating_count, COALESCE(inv.available, 0),
+		        ARRAY(SELECT v.name FROM product_variants v WHERE v.product_id = p.id ORDER BY v.name)
+		 FROM products p
+		 `+productAvailabilityJoin+`
+		 WHERE p.id = ANY($1)`,
+		pq.Array(productIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var doc ProductDocument
+		var categoryID sql.NullString
+		var imagesArray pq.StringArray
+		var tagsArray pq.StringArray
+		var variantOptions pq.StringArray
+
+		err := rows.Scan(&doc.ID, &doc.MerchantID, &doc.Name, &doc.Description, &doc.SKU, &doc.Price, &doc.Currency,
+			&categoryID, &imagesArray, &tagsArray, &doc.Status, &doc.CreatedAt, &doc.UpdatedAt,
+			&doc.RatingAverage, &doc.RatingCount, &doc.Available, &variantOptions)
+		if err != nil {
+			return nil, err
+		}
+
+		if categoryID.Valid {
+			doc.CategoryID = categoryID.String
+		}
+		doc.Images = []string(imagesArray)
+		doc.Tags = []string(tagsArray)
+		doc.VariantOptions = []string(variantOptions)
+		doc.InStock = doc.Available > 0
+
+		documents[doc.ID] = &doc
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return documents, loadDocumentTranslations(q, productIDs, documents)
+}
+
+// loadDocumentTranslations ajoute aux documents les champs traduits de chaque langue
+func loadDocumentTranslations(q queryer, productIDs []string, documents map[string]*ProductDocument) error {
+	rows, err := q.Query(
+		`SELECT product_id, locale, COALESCE(name, ''), COALESCE(description, '')
+		 FROM product_translations WHERE product_id = ANY($1)`,
+		pq.Array(productIDs),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID, locale string
+		var t DocumentTranslation
+		if err := rows.Scan(&productID, &locale, &t.Name, &t.Description); err != nil {
+			return err
+		}
+		doc, ok := documents[productID]
+		if _, known := catalogueLocales[locale]; !ok || !known {
+			continue
+		}
+		if doc.Translations == nil {
+			doc.Translations = map[string]DocumentTranslation{}
+		}
+		doc.Translations[locale] = t
+	}
+	return rows.Err()
+}
+
+// outboxStats retourne le nombre d'entrées en attente et abandonnées
+func outboxStats() (pending, dead int, err error) {
+	err = db.QueryRow(
+		"SELECT COUNT(*) FILTER (WHERE attempts < $1), COUNT(*) FILTER (WHERE attempts >= $1) FROM search_outbox WHERE processed_at IS NULL",
+		outboxMaxAttempts,
+	).Scan(&pending, &dead)
+	return pending, dead, err
+}
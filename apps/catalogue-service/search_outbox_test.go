@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeElasticsearch branche esClient sur un faux cluster servi par handler
+func fakeElasticsearch(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previous := esClient
+	esClient = &ElasticsearchClient{BaseURL: server.URL, Client: server.Client()}
+	t.Cleanup(func() {
+		esClient = previous
+		server.Close()
+	})
+}
+
+// enqueueTestOutbox inscrit une opération d'indexation pour le produit
+func enqueueTestOutbox(t *testing.T, productID string) int64 {
+	t.Helper()
+	var id int64
+	if err := db.QueryRow(
+		"INSERT INTO search_outbox (product_id, operation) VALUES ($1, $2) RETURNING id",
+		productID, OutboxOpIndex,
+	).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestProcessSearchOutboxHoldsNoLockDuringBulk(t *testing.T) {
+	openTestDB(t)
+	productID, _ := createTestProduct(t, testMerchantID(t))
+	entryID := enqueueTestOutbox(t, productID)
+
+	var lockErr error
+	fakeElasticsearch(t, func(w http.ResponseWriter, r *http.Request) {
+		// Une autre instance doit pouvoir verrouiller l'entrée pendant l'appel _bulk
+		tx, err := db.Begin()
+		if err != nil {
+			lockErr = err
+		} else {
+			_, lockErr = tx.Exec("SELECT id FROM search_outbox WHERE id = $1 FOR UPDATE NOWAIT", entryID)
+			tx.Rollback()
+		}
+		io.WriteString(w, `{"errors": false, "items": []}`)
+	})
+
+	processed, err := ProcessSearchOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed != 1 {
+		t.Fatalf("%d entrées traitées, attendu 1", processed)
+	}
+	if lockErr != nil {
+		t.Errorf("entrée verrouillée pendant l'appel _bulk: %v", lockErr)
+	}
+
+	var done bool
+	if err := db.QueryRow("SELECT processed_at IS NOT NULL FROM search_outbox WHERE id = $1", entryID).Scan(&done); err != nil {
+		t.Fatal(err)
+	}
+	if !done {
+		t.Error("entrée non marquée comme traitée")
+	}
+}
+
+func TestProcessSearchOutboxReschedulesFailedBatch(t *testing.T) {
+	openTestDB(t)
+	productID, _ := createTestProduct(t, testMerchantID(t))
+	entryID := enqueueTestOutbox(t, productID)
+
+	fakeElasticsearch(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "cluster indisponible", http.StatusServiceUnavailable)
+	})
+
+	if _, err := ProcessSearchOutbox(); err != nil {
+		t.Fatal(err)
+	}
+
+	var attempts int
+	var pending, scheduled bool
+	if err := db.QueryRow(
+		"SELECT attempts, processed_at IS NULL, next_attempt_at > NOW() FROM search_outbox WHERE id = $1",
+		entryID,
+	).Scan(&attempts, &pending, &scheduled); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 1 || !pending || !scheduled {
+		t.Errorf("attempts=%d pending=%v replanifiée=%v, attendu 1 tentative replanifiée", attempts, pending, scheduled)
+	}
+
+	// Déjà réclamée puis replanifiée : un second passage ne la reprend pas
+	processed, err := ProcessSearchOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed != 0 {
+		t.Errorf("%d entrées retraitées avant leur échéance", processed)
+	}
+}
+
+func TestPurgeSearchOutboxKeepsRecentAndPendingEntries(t *testing.T) {
+	openTestDB(t)
+	productID, _ := createTestProduct(t, testMerchantID(t))
+
+	old := enqueueTestOutbox(t, productID)
+	recent := enqueueTestOutbox(t, productID)
+	pending := enqueueTestOutbox(t, productID)
+	if _, err := db.Exec(
+		`UPDATE search_outbox SET processed_at = CASE id WHEN $1 THEN NOW() - INTERVAL '10 days' ELSE NOW() END
+		 WHERE id IN ($1, $2)`,
+		old, recent,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := purgeSearchOutbox(7 * 24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Errorf("%d entrées purgées, attendu 1", purged)
+	}
+
+	var remaining int
+	if err := db.QueryRow("SELECT COUNT(*) FROM search_outbox WHERE id IN ($1, $2)", recent, pending).Scan(&remaining); err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 2 {
+		t.Errorf("%d entrées récentes ou en attente conservées, attendu 2", remaining)
+	}
+}
+
+func TestCheckSearchDriftDetectsStockChanges(t *testing.T) {
+	openTestDB(t)
+	productID, variantID := createTestProduct(t, testMerchantID(t))
+	if _, err := db.Exec(
+		"INSERT INTO inventory (product_id, variant_id, quantity) VALUES ($1, $2, 3)",
+		productID, variantID,
+	); err != nil {
+		t.Fatal(err)
+	}
+	var updatedAt time.Time
+	if err := db.QueryRow("SELECT updated_at FROM products WHERE id = $1", productID).Scan(&updatedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	// Le document indexé a la bonne date mais un stock épuisé depuis réapprovisionné
+	fakeElasticsearch(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/products/_search") {
+			io.WriteString(w, `{"hits": {"hits": []}}`)
+			return
+		}
+		hit := map[string]interface{}{
+			"_id":     productID,
+			"_source": IndexedState{UpdatedAt: updatedAt, Available: 0, InStock: false},
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"_scroll_id": "scroll",
+			"hits":       map[string]interface{}{"hits": []interface{}{hit}},
+		})
+	})
+
+	report, err := CheckSearchDrift()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Stale) != 1 || report.Stale[0] != productID {
+		t.Errorf("documents obsolètes %v, attendu [%s]", report.Stale, productID)
+	}
+}
+
+func TestIndexedStateMatches(t *testing.T) {
+	now := time.Now()
+	state := IndexedState{UpdatedAt: now, Available: 3, InStock: true}
+
+	tests := []struct {
+		name    string
+		indexed IndexedState
+		want    bool
+	}{
+		{"identique", state, true},
+		{"précision milliseconde", IndexedState{UpdatedAt: now.Truncate(time.Millisecond), Available: 3, InStock: true}, true},
+		{"mise à jour", IndexedState{UpdatedAt: now.Add(time.Second), Available: 3, InStock: true}, false},
+		{"stock", IndexedState{UpdatedAt: now, Available: 1, InStock: true}, false},
+		{"disponibilité", IndexedState{UpdatedAt: now, Available: 3, InStock: false}, false},
+	}
+	for _, tt := range tests {
+		if got := indexedStateMatches(state, tt.indexed); got != tt.want {
+			t.Errorf("%s: indexedStateMatches = %v, attendu %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProductDocumentIgnoresBackorderedVariants(t *testing.T) {
+	openTestDB(t)
+	productID, backordered := createTestProduct(t, testMerchantID(t))
+	var stocked string
+	if err := db.QueryRow(
+		"INSERT INTO product_variants (product_id, name, sku) VALUES ($1, 'Autre variante', $2) RETURNING id",
+		productID, "SKU-"+productID,
+	).Scan(&stocked); err != nil {
+		t.Fatal(err)
+	}
+
+	// 3 unités vendues en réapprovisionnement sur une variante (stock négatif),
+	// 5 unités de l'autre
+	if _, err := db.Exec(
+		"INSERT INTO inventory (product_id, variant_id, quantity, policy) VALUES ($1, $2, -3, 'backorder'), ($1, $3, 5, 'deny')",
+		productID, backordered, stocked,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	documents, err := loadProductDocuments(db, []string{productID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := documents[productID]
+	if doc == nil {
+		t.Fatal("document non chargé")
+	}
+	if doc.Available != 5 || !doc.InStock {
+		t.Errorf("available=%d in_stock=%v, attendu 5 en stock", doc.Available, doc.InStock)
+	}
+}
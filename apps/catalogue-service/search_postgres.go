@@ -0,0 +1,332 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// pgTrigramThreshold est la similarité minimale pour une correspondance approximative
+const pgTrigramThreshold = 0.3
+
+// pgSearchSorts associe les tris exposés par l'API aux tris SQL
+var pgSearchSorts = map[string]string{
+	"relevance":  "score DESC, created_at DESC, id",
+	"price_asc":  "price ASC, id",
+	"price_desc": "price DESC, id",
+	"newest":     "created_at DESC, id",
+	"name_asc":   "lower(name) ASC, id",
+	"rating":     "rating_average DESC, rating_count DESC, id",
+}
+
+// postgresSearchBackend recherche directement dans la base via tsvector et
+// pg_trgm ; il ne nécessite aucun cluster et suffit aux petits catalogues
+type postgresSearchBackend struct{}
+
+func (b *postgresSearchBackend) Name() string {
+	return SearchBackendPostgres
+}
+
+func (b *postgresSearchBackend) Ping() error {
+	return db.Ping()
+}
+
+// pgSearchQuery accumule les paramètres d'une requête SQL construite dynamiquement
+type pgSearchQuery struct {
+	args []interface{}
+}
+
+func (q *pgSearchQuery) arg(v interface{}) string {
+	q.args = append(q.args, v)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+// matchedProducts retourne la CTE des produits du marchand correspondant au texte,
+// avant application des filtres facettés
+func (q *pgSearchQuery) matchedProducts(req *SearchRequest) string {
+	score := "0::float8"
+	textCond := ""
+	if req.Query != "" {
+		variants := req.queryVariants
+		if len(variants) == 0 {
+			variants = []string{req.Query}
+		}
+
+		configs := []string{"simple", "french", "english"}
+		if config := catalogueLocales[req.Language]; config != "" && req.Language != "fr" && req.Language != "en" {
+			configs = append(configs, config)
+		}
+
+		var tsqueries []string
+		for _, variant := range variants {
+			v := q.arg(variant) + "::text"
+			for _, config := range configs {
+				tsqueries = append(tsqueries, fmt.Sprintf("websearch_to_tsquery('%s', %s)", config, v))
+			}
+		}
+		tsq := strings.Join(tsqueries, " || ")
+		query := q.arg(req.Query) + "::text"
+		words := q.arg(pq.Array(strings.Fields(strings.ToLower(req.Query))))
+
+		// Les traductions du produit, toutes langues confondues, sont aussi interrogées
+		translationRank := fmt.Sprintf(
+			"COALESCE((SELECT MAX(ts_rank(t.search_vector, %s)) FROM product_translations t WHERE t.product_id = p.id AND t.search_vector @@ (%s)), 0)",
+			tsq, tsq,
+		)
+		score = fmt.Sprintf("ts_rank(p.search_vector, %s) + %s + similarity(p.name, %s)", tsq, translationRank, query)
+		pinnedCond := ""
+		if req.merchandising != nil && len(req.merchandising.Pinned) > 0 {
+			// Un produit épinglé apparaît même s'il ne correspond pas au texte
+			pinnedCond = fmt.Sprintf(" OR p.id::text = ANY(%s::text[])", q.arg(pq.Array(req.merchandising.Pinned)))
+		}
+		textCond = fmt.Sprintf(
+			" AND (p.search_vector @@ (%s) OR similarity(p.name, %s) > %v OR p.sku = %s OR p.tags && %s::text[]%s"+
+				" OR EXISTS (SELECT 1 FROM product_translations t WHERE t.product_id = p.id AND t.search_vector @@ (%s)))",
+			tsq, query, pgTrigramThreshold, query, words, pinnedCond, tsq,
+		)
+	}
+	score = q.postgresMerchandisingScore(score, req.merchandising)
+
+	return fmt.Sprintf(`matched AS (
+	SELECT p.id, p.merchant_id, p.name, COALESCE(p.description, '') AS description, p.sku, p.price, p.currency,
+	       p.category_id, p.images, p.tags, p.status, p.created_at, p.updated_at,
+	       p.rating_average, p.rating_count, COALESCE(inv.available, 0) AS available,
+	       ARRAY(SELECT v.name FROM product_variants v WHERE v.product_id = p.id ORDER BY v.name)::text[] AS variant_options,
+	       %s AS score
+	FROM products p
+	%s
+	WHERE p.merchant_id = %s AND p.status = ANY(%s::text[])%s
+)`, score, productAvailabilityJoin, q.arg(req.MerchantID), q.arg(pq.Array(req.Filters.Status)), textCond)
+}
+
+// facetConditions retourne les conditions SQL des filtres facettés, hors facette exclue
+func (q *pgSearchQuery) facetConditions(filters *SearchFilters, exclude string) string {
+	conds := []string{"TRUE"}
+	if len(filters.CategoryIDs) > 0 && exclude != "categories" {
+		conds = append(conds, fmt.Sprintf("category_id::text = ANY(%s)", q.arg(pq.Array(filters.CategoryIDs))))
+	}
+	if len(filters.Tags) > 0 && exclude != "tags" {
+		conds = append(conds, fmt.Sprintf("tags && %s::text[]", q.arg(pq.Array(filters.Tags))))
+	}
+	if len(filters.VariantOptions) > 0 && exclude != "variant_options" {
+		conds = append(conds, fmt.Sprintf("variant_options && %s::text[]", q.arg(pq.Array(filters.VariantOptions))))
+	}
+	if filters.InStock != nil && exclude != "availability" {
+		conds = append(conds, fmt.Sprintf("(available > 0) = %s", q.arg(*filters.InStock)))
+	}
+	if exclude != "price" {
+		if filters.MinPrice != nil {
+			conds = append(conds, fmt.Sprintf("price >= %s", q.arg(*filters.MinPrice)))
+		}
+		if filters.MaxPrice != nil {
+			conds = append(conds, fmt.Sprintf("price <= %s", q.arg(*filters.MaxPrice)))
+		}
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// Search exécute la recherche paginée puis calcule chaque facette en ignorant
+// son propre filtre, comme le post_filter Elasticsearch
+func (b *postgresSearchBackend) Search(req *SearchRequest) (*SearchResult, error) {
+	result := &SearchResult{
+		Page:     req.Page,
+		PageSize: req.PageSize,
+		Products: []SearchHit{},
+		Facets:   map[string][]FacetValue{},
+	}
+
+	if err := b.searchHits(req, result); err != nil {
+		return nil, err
+	}
+
+	for _, facet := range []string{"categories", "tags", "variant_options", "availability"} {
+		values, err := b.termsFacet(req, facet)
+		if err != nil {
+			return nil, err
+		}
+		result.Facets[facet] = values
+	}
+
+	prices, err := b.priceFacet(req)
+	if err != nil {
+		return nil, err
+	}
+	result.Facets["price"] = prices
+
+	return result, nil
+}
+
+func (b *postgresSearchBackend) searchHits(req *SearchRequest, result *SearchResult) error {
+	q := &pgSearchQuery{}
+	cte := q.matchedProducts(req)
+	where := q.facetConditions(&req.Filters, "")
+
+	highlights := "'', ''"
+	if req.Query != "" {
+		query := q.arg(req.Query) + "::text"
+		highlights = fmt.Sprintf(
+			`ts_headline('simple', name, websearch_to_tsquery('simple', %[1]s), 'StartSel=<em>, StopSel=</em>, HighlightAll=true'),
+			 ts_headline('simple', description, websearch_to_tsquery('simple', %[1]s), 'StartSel=<em>, StopSel=</em>, MaxFragments=2, MaxWords=25, MinWords=10')`,
+			query,
+		)
+	}
+
+	rows, err := db.Query(fmt.Sprintf(
+		`WITH %s
+		 SELECT id, merchant_id, name, description, sku, price, currency, category_id, images, tags, status,
+		        created_at, updated_at, rating_average, rating_count, available, score, %s, COUNT(*) OVER()
+		 FROM matched
+		 WHERE %s
+		 ORDER BY %s
+		 LIMIT %s OFFSET %s`,
+		cte, highlights, where, pgSearchSorts[req.Sort], q.arg(req.PageSize), q.arg((req.Page-1)*req.PageSize),
+	), q.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hit SearchHit
+		var categoryID sql.NullString
+		var imagesArray, tagsArray pq.StringArray
+		var nameHighlight, descriptionHighlight string
+
+		err := rows.Scan(&hit.ID, &hit.MerchantID, &hit.Name, &hit.Description, &hit.SKU, &hit.Price, &hit.Currency,
+			&categoryID, &imagesArray, &tagsArray, &hit.Status, &hit.CreatedAt, &hit.UpdatedAt,
+			&hit.RatingAverage, &hit.RatingCount, &hit.Available, &hit.Score, &nameHighlight, &descriptionHighlight, &result.Total)
+		if err != nil {
+			return err
+		}
+
+		if categoryID.Valid {
+			hit.CategoryID = categoryID.String
+		}
+		hit.Images = []string(imagesArray)
+		hit.Tags = []string(tagsArray)
+		hit.InStock = hit.Available > 0
+
+		// Comme Elasticsearch, seuls les champs effectivement surlignés sont retournés
+		if strings.Contains(nameHighlight, "<em>") {
+			hit.Highlights = map[string][]string{"name": {nameHighlight}}
+		}
+		if strings.Contains(descriptionHighlight, "<em>") {
+			if hit.Highlights == nil {
+				hit.Highlights = map[string][]string{}
+			}
+			hit.Highlights["description"] = []string{descriptionHighlight}
+		}
+
+		result.Products = append(result.Products, hit)
+	}
+
+	return rows.Err()
+}
+
+// termsFacet compte les produits par valeur d'une facette à valeurs discrètes
+func (b *postgresSearchBackend) termsFacet(req *SearchRequest, facet string) ([]FacetValue, error) {
+	q := &pgSearchQuery{}
+	cte := q.matchedProducts(req)
+	where := q.facetConditions(&req.Filters, facet)
+
+	var selectSQL string
+	switch facet {
+	case "categories":
+		selectSQL = fmt.Sprintf("SELECT category_id::text, COUNT(*) FROM matched WHERE category_id IS NOT NULL AND %s GROUP BY 1", where)
+	case "tags":
+		selectSQL = fmt.Sprintf("SELECT t, COUNT(*) FROM matched, unnest(tags) t WHERE %s GROUP BY 1", where)
+	case "variant_options":
+		selectSQL = fmt.Sprintf("SELECT o, COUNT(*) FROM matched, unnest(variant_options) o WHERE %s GROUP BY 1", where)
+	case "availability":
+		selectSQL = fmt.Sprintf("SELECT (available > 0)::text, COUNT(*) FROM matched WHERE %s GROUP BY 1", where)
+	default:
+		return nil, fmt.Errorf("facette inconnue: %s", facet)
+	}
+
+	rows, err := db.Query(fmt.Sprintf("WITH %s %s ORDER BY 2 DESC, 1 LIMIT 50", cte, selectSQL), q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []FacetValue{}
+	for rows.Next() {
+		var v FacetValue
+		if err := rows.Scan(&v.Value, &v.Count); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// priceFacet compte les produits par tranche de prix (borne basse incluse, haute exclue)
+func (b *postgresSearchBackend) priceFacet(req *SearchRequest) ([]FacetValue, error) {
+	q := &pgSearchQuery{}
+	cte := q.matchedProducts(req)
+	where := q.facetConditions(&req.Filters, "price")
+
+	counts := make([]string, 0, len(defaultPriceBuckets))
+	for _, bucket := range defaultPriceBuckets {
+		conds := []string{"TRUE"}
+		if bucket.From != nil {
+			conds = append(conds, fmt.Sprintf("price >= %s", q.arg(*bucket.From)))
+		}
+		if bucket.To != nil {
+			conds = append(conds, fmt.Sprintf("price < %s", q.arg(*bucket.To)))
+		}
+		counts = append(counts, fmt.Sprintf("COUNT(*) FILTER (WHERE %s)", strings.Join(conds, " AND ")))
+	}
+
+	dest := make([]interface{}, len(defaultPriceBuckets))
+	values := make([]FacetValue, len(defaultPriceBuckets))
+	for i, bucket := range defaultPriceBuckets {
+		values[i].Value = bucket.Key
+		dest[i] = &values[i].Count
+	}
+
+	err := db.QueryRow(
+		fmt.Sprintf("WITH %s SELECT %s FROM matched WHERE %s", cte, strings.Join(counts, ", "), where),
+		q.args...,
+	).Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Suggest propose les produits dont le nom commence par le préfixe, puis ceux
+// dont un mot commence par le préfixe, puis les correspondances approximatives
+func (b *postgresSearchBackend) Suggest(merchantID, prefix string, size int) ([]Suggestion, error) {
+	pattern := escapeLikePattern(strings.ToLower(prefix))
+
+	rows, err := db.Query(
+		`SELECT id, name FROM products
+		 WHERE merchant_id = $1 AND status = 'active'
+		   AND (lower(name) LIKE $2::text || '%' OR lower(name) LIKE '% ' || $2::text || '%' OR similarity(name, $3::text) > $4)
+		 ORDER BY (lower(name) LIKE $2::text || '%') DESC, similarity(name, $3::text) DESC, name
+		 LIMIT $5`,
+		merchantID, pattern, prefix, pgTrigramThreshold, size,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var s Suggestion
+		if err := rows.Scan(&s.ProductID, &s.Name); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+	return suggestions, rows.Err()
+}
+
+// escapeLikePattern neutralise les caractères spéciaux de LIKE
+func escapeLikePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
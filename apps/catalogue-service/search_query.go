@@ -0,0 +1,389 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+	// maxSearchWindow correspond à index.max_result_window d'Elasticsearch
+	maxSearchWindow = 10000
+)
+
+// searchSorts associe les tris exposés par l'API aux tris Elasticsearch
+var searchSorts = map[string][]interface{}{
+	"relevance":  {"_score", map[string]interface{}{"created_at": "desc"}},
+	"price_asc":  {map[string]interface{}{"price": "asc"}},
+	"price_desc": {map[string]interface{}{"price": "desc"}},
+	"newest":     {map[string]interface{}{"created_at": "desc"}},
+	"name_asc":   {map[string]interface{}{"name.sort": "asc"}},
+	"rating":     {map[string]interface{}{"rating_average": "desc"}, map[string]interface{}{"rating_count": "desc"}},
+}
+
+// PriceBucket représente une tranche de prix pour la facette prix
+type PriceBucket struct {
+	Key  string   `json:"key"`
+	From *float64 `json:"from,omitempty"`
+	To   *float64 `json:"to,omitempty"`
+}
+
+// defaultPriceBuckets définit les tranches de prix de la facette
+var defaultPriceBuckets = []PriceBucket{
+	{Key: "0-25", To: floatPtr(25)},
+	{Key: "25-50", From: floatPtr(25), To: floatPtr(50)},
+	{Key: "50-100", From: floatPtr(50), To: floatPtr(100)},
+	{Key: "100-200", From: floatPtr(100), To: floatPtr(200)},
+	{Key: "200+", From: floatPtr(200)},
+}
+
+// SearchFilters représente les filtres de recherche
+type SearchFilters struct {
+	CategoryIDs    []string `json:"category_ids,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	MinPrice       *float64 `json:"min_price,omitempty"`
+	MaxPrice       *float64 `json:"max_price,omitempty"`
+	VariantOptions []string `json:"variant_options,omitempty"`
+	InStock        *bool    `json:"in_stock,omitempty"`
+	Status         []string `json:"status,omitempty"`
+}
+
+// SearchRequest représente une recherche produits
+type SearchRequest struct {
+	Query      string        `json:"query"`
+	MerchantID string        `json:"merchant_id"`
+	Filters    SearchFilters `json:"filters"`
+	Sort       string        `json:"sort"`
+	Page       int           `json:"page"`
+	PageSize   int           `json:"page_size"`
+	Language   string        `json:"language,omitempty"` // fr, en, de, nl : privilégie les champs de la langue
+
+	// queryVariants contient la requête et ses variantes issues des synonymes du marchand
+	queryVariants []string
+	// merchandising contient les règles du marchand applicables à la requête
+	merchandising *searchMerchandising
+}
+
+// SearchHit représente un produit trouvé avec ses extraits surlignés
+type SearchHit struct {
+	Product
+	Available  int                 `json:"available"`
+	InStock    bool                `json:"in_stock"`
+	Score      float64             `json:"score,omitempty"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// FacetValue représente une valeur de facette et son nombre de produits
+type FacetValue struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int    `json:"count"`
+}
+
+// SearchResult représente le résultat paginé d'une recherche
+type SearchResult struct {
+	Total    int                     `json:"total"`
+	Page     int                     `json:"page"`
+	PageSize int                     `json:"page_size"`
+	Products []SearchHit             `json:"products"`
+	Facets   map[string][]FacetValue `json:"facets"`
+	// SearchID identifie la recherche pour le suivi des clics et conversions
+	SearchID string `json:"search_id,omitempty"`
+	// RedirectURL est renseignée lorsqu'une règle redirige la requête
+	RedirectURL string `json:"redirect_url,omitempty"`
+}
+
+// Normalize valide la requête et applique les valeurs par défaut
+func (r *SearchRequest) Normalize() error {
+	if r.MerchantID == "" {
+		return errors.New("merchant_id requis")
+	}
+	if r.Sort == "" {
+		r.Sort = "relevance"
+	}
+	if _, ok := searchSorts[r.Sort]; !ok {
+		return fmt.Errorf("tri invalide: %s", r.Sort)
+	}
+	if r.Page < 1 {
+		r.Page = 1
+	}
+	if r.PageSize < 1 {
+		r.PageSize = defaultSearchPageSize
+	}
+	if r.PageSize > maxSearchPageSize {
+		r.PageSize = maxSearchPageSize
+	}
+	if _, ok := catalogueLocales[r.Language]; r.Language != "" && !ok {
+		return fmt.Errorf("langue non supportée: %s", r.Language)
+	}
+	if r.Page*r.PageSize > maxSearchWindow {
+		return fmt.Errorf("pagination limitée aux %d premiers résultats", maxSearchWindow)
+	}
+	if len(r.Filters.Status) == 0 {
+		r.Filters.Status = []string{"active"}
+	}
+	for _, status := range r.Filters.Status {
+		if !isValidProductStatus(status) {
+			return fmt.Errorf("statut invalide: %s", status)
+		}
+	}
+	return nil
+}
+
+// buildSearchBody construit la requête Elasticsearch. Les filtres de scope
+// (marchand, statut) s'appliquent à tout ; les filtres facettés passent en
+// post_filter pour que chaque facette ignore son propre filtre (sélection multiple).
+func buildSearchBody(req *SearchRequest) map[string]interface{} {
+	var must interface{} = map[string]interface{}{"match_all": map[string]interface{}{}}
+	if req.Query != "" {
+		must = buildTextQuery(req)
+	}
+
+	scope := []interface{}{
+		termFilter("merchant_id", req.MerchantID),
+		termsFilter("status", req.Filters.Status),
+	}
+
+	facetFilters := map[string]interface{}{}
+	if len(req.Filters.CategoryIDs) > 0 {
+		facetFilters["categories"] = termsFilter("category_id", req.Filters.CategoryIDs)
+	}
+	if len(req.Filters.Tags) > 0 {
+		facetFilters["tags"] = termsFilter("tags", req.Filters.Tags)
+	}
+	if len(req.Filters.VariantOptions) > 0 {
+		facetFilters["variant_options"] = termsFilter("variant_options", req.Filters.VariantOptions)
+	}
+	if req.Filters.InStock != nil {
+		facetFilters["availability"] = termFilter("in_stock", *req.Filters.InStock)
+	}
+	if req.Filters.MinPrice != nil || req.Filters.MaxPrice != nil {
+		priceRange := map[string]interface{}{}
+		if req.Filters.MinPrice != nil {
+			priceRange["gte"] = *req.Filters.MinPrice
+		}
+		if req.Filters.MaxPrice != nil {
+			priceRange["lte"] = *req.Filters.MaxPrice
+		}
+		facetFilters["price"] = map[string]interface{}{
+			"range": map[string]interface{}{"price": priceRange},
+		}
+	}
+
+	priceRanges := make([]map[string]interface{}, 0, len(defaultPriceBuckets))
+	for _, bucket := range defaultPriceBuckets {
+		r := map[string]interface{}{"key": bucket.Key}
+		if bucket.From != nil {
+			r["from"] = *bucket.From
+		}
+		if bucket.To != nil {
+			r["to"] = *bucket.To
+		}
+		priceRanges = append(priceRanges, r)
+	}
+
+	facetAggs := map[string]map[string]interface{}{
+		"categories":      {"terms": map[string]interface{}{"field": "category_id", "size": 50}},
+		"tags":            {"terms": map[string]interface{}{"field": "tags", "size": 50}},
+		"variant_options": {"terms": map[string]interface{}{"field": "variant_options", "size": 50}},
+		"availability":    {"terms": map[string]interface{}{"field": "in_stock"}},
+		"price":           {"range": map[string]interface{}{"field": "price", "ranges": priceRanges}},
+	}
+
+	aggs := map[string]interface{}{}
+	for name, agg := range facetAggs {
+		aggs[name] = map[string]interface{}{
+			"filter": boolFilter(otherFilters(facetFilters, name)),
+			"aggs":   map[string]interface{}{"values": agg},
+		}
+	}
+
+	body := map[string]interface{}{
+		"from":             (req.Page - 1) * req.PageSize,
+		"size":             req.PageSize,
+		"track_total_hits": true,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must":   applyElasticsearchMerchandising(must, req.merchandising),
+				"filter": scope,
+			},
+		},
+		"post_filter": boolFilter(otherFilters(facetFilters, "")),
+		"aggs":        aggs,
+		"sort":        searchSorts[req.Sort],
+		"highlight": map[string]interface{}{
+			"pre_tags":  []string{"<em>"},
+			"post_tags": []string{"</em>"},
+			"fields": map[string]interface{}{
+				"name":        map[string]interface{}{"number_of_fragments": 0},
+				"description": map[string]interface{}{"fragment_size": 150, "number_of_fragments": 2},
+			},
+		},
+	}
+
+	return body
+}
+
+// searchTextFields retourne les champs interrogés, la langue demandée étant
+// privilégiée ; les traductions de toutes les langues sont interrogées
+func searchTextFields(language string) []string {
+	fields := []string{"name^3", "name.fr^2", "name.en^2", "tags^2", "description", "description.fr", "description.en", "sku",
+		"translations.*.name^2", "translations.*.description"}
+	if language == "fr" || language == "en" {
+		fields = append(fields, "name."+language+"^4", "description."+language+"^2")
+	}
+	if language != "" {
+		fields = append(fields, "translations."+language+".name^4", "translations."+language+".description^2")
+	}
+	return fields
+}
+
+// buildTextQuery construit la requête plein texte : la requête d'origine est
+// privilégiée, ses variantes (synonymes) élargissent les résultats, et la
+// tolérance aux fautes de frappe est assurée par la fuzziness AUTO
+func buildTextQuery(req *SearchRequest) map[string]interface{} {
+	variants := req.queryVariants
+	if len(variants) == 0 {
+		variants = []string{req.Query}
+	}
+
+	should := make([]interface{}, 0, len(variants)+1)
+	for i, variant := range variants {
+		boost := 1.0
+		if i == 0 {
+			boost = 2.0
+		}
+		should = append(should, map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":  variant,
+				"fields": searchTextFields(req.Language),
+				"boost":  boost,
+			},
+		})
+	}
+
+	// Correspondance approximative, moins bien notée qu'une correspondance exacte
+	should = append(should, map[string]interface{}{
+		"multi_match": map[string]interface{}{
+			"query":         req.Query,
+			"fields":        []string{"name", "name.fr", "name.en", "description", "translations.*.name"},
+			"fuzziness":     "AUTO",
+			"prefix_length": 1,
+			"boost":         0.5,
+		},
+	})
+
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should":               should,
+			"minimum_should_match": 1,
+		},
+	}
+}
+
+// searchResponse est la forme décodée d'une réponse _search
+type searchResponse struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Score     float64             `json:"_score"`
+			Source    SearchHit           `json:"_source"`
+			Highlight map[string][]string `json:"highlight"`
+		} `json:"hits"`
+	} `json:"hits"`
+	Aggregations map[string]struct {
+		Values struct {
+			Buckets []struct {
+				Key         interface{} `json:"key"`
+				KeyAsString string      `json:"key_as_string"`
+				DocCount    int         `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"values"`
+	} `json:"aggregations"`
+}
+
+// toSearchResult convertit la réponse Elasticsearch en résultat d'API
+func (resp *searchResponse) toSearchResult(req *SearchRequest) *SearchResult {
+	result := &SearchResult{
+		Total:    resp.Hits.Total.Value,
+		Page:     req.Page,
+		PageSize: req.PageSize,
+		Products: make([]SearchHit, 0, len(resp.Hits.Hits)),
+		Facets:   map[string][]FacetValue{},
+	}
+
+	for _, hit := range resp.Hits.Hits {
+		product := hit.Source
+		product.Score = hit.Score
+		product.Highlights = hit.Highlight
+		result.Products = append(result.Products, product)
+	}
+
+	for name, agg := range resp.Aggregations {
+		values := make([]FacetValue, 0, len(agg.Values.Buckets))
+		for _, bucket := range agg.Values.Buckets {
+			value := bucket.KeyAsString
+			if value == "" {
+				value = fmt.Sprint(bucket.Key)
+			}
+			values = append(values, FacetValue{Value: value, Count: bucket.DocCount})
+		}
+		result.Facets[name] = values
+	}
+
+	return result
+}
+
+// otherFilters retourne les filtres facettés sauf celui de la facette exclue
+func otherFilters(filters map[string]interface{}, exclude string) []interface{} {
+	clauses := []interface{}{}
+	for name, clause := range filters {
+		if name != exclude {
+			clauses = append(clauses, clause)
+		}
+	}
+	return clauses
+}
+
+func boolFilter(clauses []interface{}) map[string]interface{} {
+	return map[string]interface{}{"bool": map[string]interface{}{"filter": clauses}}
+}
+
+func termFilter(field string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"term": map[string]interface{}{field: value}}
+}
+
+func termsFilter(field string, values []string) map[string]interface{} {
+	return map[string]interface{}{"terms": map[string]interface{}{field: values}}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+// labelCategoryFacets renseigne le nom des catégories de la facette categories
+// dans la langue demandée
+func labelCategoryFacets(result *SearchResult, locale string) error {
+	values := result.Facets["categories"]
+	if len(values) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(values))
+	for _, v := range values {
+		ids = append(ids, v.Value)
+	}
+
+	names, err := categoryNames(db, ids, locale)
+	if err != nil {
+		return err
+	}
+
+	for i := range values {
+		values[i].Label = names[values[i].Value]
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// reindexBatchSize est le nombre de produits envoyés par appel _bulk lors d'une réindexation
+const reindexBatchSize = 500
+
+// DriftReport résume les écarts entre la base de données et l'index de recherche
+type DriftReport struct {
+	DBCount        int      `json:"db_count"`
+	IndexCount     int      `json:"index_count"`
+	MissingInIndex []string `json:"missing_in_index"`
+	OrphanInIndex  []string `json:"orphan_in_index"`
+	Stale          []string `json:"stale"`
+	OutboxPending  int      `json:"outbox_pending"`
+	OutboxDead     int      `json:"outbox_dead"`
+}
+
+// HasDrift indique si des écarts ont été détectés
+func (r *DriftReport) HasDrift() bool {
+	return len(r.MissingInIndex) > 0 || len(r.OrphanInIndex) > 0 || len(r.Stale) > 0
+}
+
+// runCommand exécute une commande d'administration et retourne le code de sortie
+func runCommand(args []string) int {
+	switch args[0] {
+	case "reindex":
+		newIndex, err := ReindexAll()
+		if err != nil {
+			log.Printf("Erreur lors de la réindexation: %v", err)
+			return 1
+		}
+		log.Printf("Réindexation terminée, l'alias %s pointe vers %s", productsIndexAlias, newIndex)
+		return 0
+
+	case "check-drift":
+		fs := flag.NewFlagSet("check-drift", flag.ContinueOnError)
+		repair := fs.Bool("repair", false, "planifier la réindexation des produits en écart")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+
+		report, err := CheckSearchDrift()
+		if err != nil {
+			log.Printf("Erreur lors de la vérification: %v", err)
+			return 1
+		}
+		log.Printf("Base: %d produits, index: %d documents, absents de l'index: %d, orphelins: %d, obsolètes: %d, outbox en attente: %d, abandonnées: %d",
+			report.DBCount, report.IndexCount, len(report.MissingInIndex), len(report.OrphanInIndex),
+			len(report.Stale), report.OutboxPending, report.OutboxDead)
+
+		if *repair && report.HasDrift() {
+			if err := RepairSearchDrift(report); err != nil {
+				log.Printf("Erreur lors de la réparation: %v", err)
+				return 1
+			}
+			log.Println("Réindexation des écarts planifiée dans l'outbox")
+			return 0
+		}
+		if report.HasDrift() {
+			return 3
+		}
+		return 0
+
+	case "reconcile-inventory":
+		return runReconcileCommand(args[1:])
+
+	default:
+		log.Printf("Commande inconnue: %s (commandes: reindex, check-drift [-repair], reconcile-inventory [-apply])", args[0])
+		return 2
+	}
+}
+
+// ReindexAll reconstruit l'index dans un nouvel index versionné puis bascule
+// l'alias de manière atomique, sans interruption de la recherche
+func ReindexAll() (string, error) {
+	newIndex := fmt.Sprintf("%s_v%d", productsIndexAlias, time.Now().Unix())
+	if err := esClient.CreateIndex(newIndex, productIndexDefinition()); err != nil {
+		return "", err
+	}
+
+	// Les modifications survenues pendant la copie seront rejouées sur l'alias après la bascule
+	startedAt := time.Now()
+
+	lastID := ""
+	total := 0
+	for {
+		var ids []string
+		rows, err := db.Query(
+			"SELECT id FROM products WHERE id::text > $1 ORDER BY id::text LIMIT $2",
+			lastID, reindexBatchSize,
+		)
+		if err != nil {
+			return "", err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return "", err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+
+		if len(ids) == 0 {
+			break
+		}
+		lastID = ids[len(ids)-1]
+
+		documents, err := loadProductDocuments(db, ids)
+		if err != nil {
+			return "", err
+		}
+
+		actions := make([]BulkIndexAction, 0, len(documents))
+		for _, id := range ids {
+			if doc, ok := documents[id]; ok {
+				actions = append(actions, BulkIndexAction{ProductID: id, Document: doc})
+			}
+		}
+
+		failed, err := esClient.BulkIndex(newIndex, actions)
+		if err != nil {
+			return "", err
+		}
+		if len(failed) > 0 {
+			return "", fmt.Errorf("%d document(s) en échec lors de la réindexation", len(failed))
+		}
+		total += len(actions)
+		log.Printf("Réindexation: %d produits indexés", total)
+	}
+
+	oldIndices, concrete, err := esClient.GetAliasIndices(productsIndexAlias)
+	if err != nil {
+		return "", err
+	}
+	if err := esClient.SwapAlias(productsIndexAlias, newIndex, oldIndices, concrete); err != nil {
+		return "", err
+	}
+
+	for _, old := range oldIndices {
+		if err := esClient.DeleteIndex(old); err != nil {
+			log.Printf("Impossible de supprimer l'ancien index %s: %v", old, err)
+		}
+	}
+
+	// Rejouer les modifications survenues pendant la réindexation
+	if _, err := db.Exec(
+		`INSERT INTO search_outbox (product_id, operation)
+		 SELECT DISTINCT product_id, 'index' FROM search_outbox WHERE created_at >= $1`,
+		startedAt,
+	); err != nil {
+		log.Printf("Impossible de replanifier les modifications concurrentes: %v", err)
+	}
+
+	return newIndex, nil
+}
+
+// CheckSearchDrift compare les produits en base avec les documents indexés
+func CheckSearchDrift() (*DriftReport, error) {
+	report := &DriftReport{
+		MissingInIndex: []string{},
+		OrphanInIndex:  []string{},
+		Stale:          []string{},
+	}
+
+	// Seuls les identifiants, dates de mise à jour et stocks sont gardés en
+	// mémoire ; un mouvement de stock ne modifie pas updated_at
+	dbStates := map[string]IndexedState{}
+	rows, err := db.Query(`SELECT p.id, p.updated_at, COALESCE(inv.available, 0) FROM products p ` + productAvailabilityJoin)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id string
+		var state IndexedState
+		if err := rows.Scan(&id, &state.UpdatedAt, &state.Available); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		state.InStock = state.Available > 0
+		dbStates[id] = state
+	}
+	rows.Close()
+	report.DBCount = len(dbStates)
+
+	seen := map[string]bool{}
+	err = esClient.ScrollDocuments(productsIndexAlias, func(id string, indexed IndexedState) error {
+		report.IndexCount++
+		seen[id] = true
+
+		dbState, ok := dbStates[id]
+		if !ok {
+			report.OrphanInIndex = append(report.OrphanInIndex, id)
+			return nil
+		}
+		if !indexedStateMatches(dbState, indexed) {
+			report.Stale = append(report.Stale, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for id := range dbStates {
+		if !seen[id] {
+			report.MissingInIndex = append(report.MissingInIndex, id)
+		}
+	}
+
+	report.OutboxPending, report.OutboxDead, err = outboxStats()
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// indexedStateMatches indique si le document indexé reflète l'état en base
+func indexedStateMatches(dbState, indexed IndexedState) bool {
+	return dbState.UpdatedAt.Truncate(time.Millisecond).Equal(indexed.UpdatedAt.Truncate(time.Millisecond)) &&
+		dbState.Available == indexed.Available &&
+		dbState.InStock == indexed.InStock
+}
+
+// RepairSearchDrift planifie dans l'outbox la correction des écarts détectés
+func RepairSearchDrift(report *DriftReport) error {
+	toIndex := append(append([]string{}, report.MissingInIndex...), report.Stale...)
+
+	return withTx(func(tx *sql.Tx) error {
+		if len(toIndex) > 0 {
+			if _, err := tx.Exec(
+				"INSERT INTO search_outbox (product_id, operation) SELECT unnest($1::uuid[]), 'index'",
+				pq.Array(toIndex),
+			); err != nil {
+				return err
+			}
+		}
+		if len(report.OrphanInIndex) > 0 {
+			if _, err := tx.Exec(
+				"INSERT INTO search_outbox (product_id, operation) SELECT unnest($1::uuid[]), 'delete'",
+				pq.Array(report.OrphanInIndex),
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
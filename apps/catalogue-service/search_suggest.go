@@ -0,0 +1,312 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const (
+	// maxSuggestions plafonne le nombre de suggestions retournées
+	maxSuggestions = 10
+	// maxSynonymTerms limite la taille d'un ensemble de synonymes
+	maxSynonymTerms = 20
+)
+
+// Suggestion représente une proposition d'autocomplétion
+type Suggestion struct {
+	ProductID string `json:"product_id"`
+	Name      string `json:"name"`
+}
+
+// SynonymSet représente un ensemble de termes équivalents pour un marchand
+type SynonymSet struct {
+	ID         string    `json:"id"`
+	MerchantID string    `json:"merchant_id"`
+	Terms      []string  `json:"terms"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SynonymSetRequest représente une demande de création ou de mise à jour de synonymes
+type SynonymSetRequest struct {
+	Terms []string `json:"terms" binding:"required,min=2"`
+}
+
+// SuggestProducts retourne les noms de produits actifs commençant par le préfixe saisi
+func (es *ElasticsearchClient) SuggestProducts(merchantID, prefix string, size int) ([]Suggestion, error) {
+	body := map[string]interface{}{
+		"size":    size,
+		"_source": []string{"id", "name"},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": map[string]interface{}{
+					"multi_match": map[string]interface{}{
+						"query":     prefix,
+						"fields":    []string{"name.autocomplete"},
+						"operator":  "and",
+						"fuzziness": "AUTO",
+						// Le début du mot doit être exact pour rester pertinent
+						"prefix_length": 2,
+					},
+				},
+				"should": map[string]interface{}{
+					"match_phrase_prefix": map[string]interface{}{"name": prefix},
+				},
+				"filter": []interface{}{
+					termFilter("merchant_id", merchantID),
+					termFilter("status", "active"),
+				},
+			},
+		},
+	}
+
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				Source struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if _, err := es.doJSON("POST", "/"+productsIndexAlias+"/_search", body, &resp); err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]Suggestion, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		suggestions = append(suggestions, Suggestion{ProductID: hit.Source.ID, Name: hit.Source.Name})
+	}
+	return suggestions, nil
+}
+
+// handleAutocomplete propose des produits au fil de la saisie du storefront
+func handleAutocomplete(c *gin.Context) {
+	merchantID := storefrontMerchantID(c)
+	prefix := strings.TrimSpace(c.Query("q"))
+	if merchantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "merchant_id requis"})
+		return
+	}
+	if len([]rune(prefix)) < 2 {
+		c.JSON(http.StatusOK, gin.H{"suggestions": []Suggestion{}})
+		return
+	}
+
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "5"))
+	if size < 1 || size > maxSuggestions {
+		size = maxSuggestions
+	}
+
+	suggestions, err := searchBackend.Suggest(merchantID, prefix, size)
+	if err != nil {
+		log.Printf("Erreur lors de l'autocomplétion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'autocomplétion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+// expandQueryWithSynonyms retourne la requête suivie de ses variantes obtenues en
+// remplaçant chaque terme connu par ses synonymes (« tee » -> « t-shirt »)
+func expandQueryWithSynonyms(merchantID, query string) ([]string, error) {
+	variants := []string{query}
+	if merchantID == "" || query == "" {
+		return variants, nil
+	}
+
+	normalized := normalizeSearchQuery(query)
+	rows, err := db.Query(
+		`SELECT terms FROM search_synonyms
+		 WHERE merchant_id = $1 AND EXISTS (
+		     SELECT 1 FROM unnest(terms) t WHERE position(t IN $2) > 0
+		 )`,
+		merchantID, normalized,
+	)
+	if err != nil {
+		return variants, err
+	}
+	defer rows.Close()
+
+	seen := map[string]bool{normalized: true}
+	for rows.Next() {
+		var terms pq.StringArray
+		if err := rows.Scan(&terms); err != nil {
+			return variants, err
+		}
+		for _, term := range terms {
+			if !containsWord(normalized, term) {
+				continue
+			}
+			for _, synonym := range terms {
+				if synonym == term {
+					continue
+				}
+				variant := replaceWord(normalized, term, synonym)
+				if !seen[variant] {
+					seen[variant] = true
+					variants = append(variants, variant)
+				}
+			}
+		}
+	}
+
+	return variants, rows.Err()
+}
+
+// containsWord indique si le terme apparaît comme mot (ou groupe de mots) entier
+func containsWord(text, term string) bool {
+	return strings.Contains(" "+text+" ", " "+term+" ")
+}
+
+// replaceWord remplace les occurrences entières d'un terme par un autre
+func replaceWord(text, term, replacement string) string {
+	replaced := strings.ReplaceAll(" "+text+" ", " "+term+" ", " "+replacement+" ")
+	return strings.TrimSpace(replaced)
+}
+
+// normalizeSynonymTerms met les termes en minuscules et retire les doublons
+func normalizeSynonymTerms(terms []string) []string {
+	seen := map[string]bool{}
+	var normalized []string
+	for _, term := range terms {
+		term = normalizeSearchQuery(term)
+		if term == "" || seen[term] {
+			continue
+		}
+		seen[term] = true
+		normalized = append(normalized, term)
+	}
+	return normalized
+}
+
+// handleListSynonyms liste les ensembles de synonymes du marchand
+func handleListSynonyms(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	rows, err := db.Query(
+		"SELECT id, merchant_id, terms, created_at, updated_at FROM search_synonyms WHERE merchant_id = $1 ORDER BY created_at",
+		merchantID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des synonymes"})
+		return
+	}
+	defer rows.Close()
+
+	sets := []SynonymSet{}
+	for rows.Next() {
+		var set SynonymSet
+		var terms pq.StringArray
+		if err := rows.Scan(&set.ID, &set.MerchantID, &terms, &set.CreatedAt, &set.UpdatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des synonymes"})
+			return
+		}
+		set.Terms = []string(terms)
+		sets = append(sets, set)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"synonyms": sets})
+}
+
+// bindSynonymSet valide et normalise le corps d'une requête de synonymes
+func bindSynonymSet(c *gin.Context) ([]string, bool) {
+	var req SynonymSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	terms := normalizeSynonymTerms(req.Terms)
+	if len(terms) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "au moins deux termes distincts sont requis"})
+		return nil, false
+	}
+	if len(terms) > maxSynonymTerms {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "trop de termes dans l'ensemble"})
+		return nil, false
+	}
+	return terms, true
+}
+
+// handleCreateSynonyms crée un ensemble de synonymes
+func handleCreateSynonyms(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	terms, ok := bindSynonymSet(c)
+	if !ok {
+		return
+	}
+
+	var set SynonymSet
+	var stored pq.StringArray
+	err := db.QueryRow(
+		`INSERT INTO search_synonyms (merchant_id, terms) VALUES ($1, $2)
+		 RETURNING id, merchant_id, terms, created_at, updated_at`,
+		merchantID, pq.Array(terms),
+	).Scan(&set.ID, &set.MerchantID, &stored, &set.CreatedAt, &set.UpdatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la création des synonymes"})
+		return
+	}
+	set.Terms = []string(stored)
+
+	c.JSON(http.StatusCreated, set)
+}
+
+// handleUpdateSynonyms remplace les termes d'un ensemble de synonymes
+func handleUpdateSynonyms(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+	id := c.Param("id")
+
+	terms, ok := bindSynonymSet(c)
+	if !ok {
+		return
+	}
+
+	var set SynonymSet
+	var stored pq.StringArray
+	err := db.QueryRow(
+		`UPDATE search_synonyms SET terms = $1, updated_at = NOW()
+		 WHERE id = $2 AND merchant_id = $3
+		 RETURNING id, merchant_id, terms, created_at, updated_at`,
+		pq.Array(terms), id, merchantID,
+	).Scan(&set.ID, &set.MerchantID, &stored, &set.CreatedAt, &set.UpdatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Synonymes non trouvés"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour des synonymes"})
+		return
+	}
+	set.Terms = []string(stored)
+
+	c.JSON(http.StatusOK, set)
+}
+
+// handleDeleteSynonyms supprime un ensemble de synonymes
+func handleDeleteSynonyms(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	result, err := db.Exec("DELETE FROM search_synonyms WHERE id = $1 AND merchant_id = $2", c.Param("id"), merchantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la suppression des synonymes"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Synonymes non trouvés"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Synonymes supprimés"})
+}
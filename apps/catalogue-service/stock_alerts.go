@@ -0,0 +1,446 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Types d'alertes de stock
+const (
+	AlertLowStock   = "low_stock"
+	AlertOutOfStock = "out_of_stock"
+)
+
+const (
+	// stockAlertBatchSize est le nombre d'alertes publiées par passe
+	stockAlertBatchSize = 100
+	// stockAlertMaxAttempts est le nombre de tentatives de publication d'une alerte
+	stockAlertMaxAttempts = 5
+)
+
+// ReorderSettings représente le seuil et la quantité de réapprovisionnement d'un produit/variante
+type ReorderSettings struct {
+	VariantID       *string `json:"variant_id,omitempty"`
+	ReorderPoint    *int    `json:"reorder_point" binding:"omitempty,min=0"`    // nil désactive l'alerte de stock bas
+	ReorderQuantity *int    `json:"reorder_quantity" binding:"omitempty,min=1"` // quantité commandée au fournisseur
+	SupplierID      *string `json:"supplier_id,omitempty"`                      // fournisseur habituel
+}
+
+// LowStockItem représente un produit/variante sous son seuil de réapprovisionnement ou en rupture
+type LowStockItem struct {
+	ProductID       string  `json:"product_id"`
+	VariantID       *string `json:"variant_id,omitempty"`
+	Name            string  `json:"name"`
+	SKU             string  `json:"sku"`
+	Available       int     `json:"available"`
+	ReorderPoint    *int    `json:"reorder_point,omitempty"`
+	ReorderQuantity *int    `json:"reorder_quantity,omitempty"`
+	SupplierID      *string `json:"supplier_id,omitempty"`
+	OnOrder         int     `json:"on_order"` // quantité attendue sur les bons de commande ouverts
+	Suggested       int     `json:"suggested_quantity"`
+	Status          string  `json:"status"` // low_stock, out_of_stock
+}
+
+// StockAlertSettings représente les préférences d'alerte du marchand
+type StockAlertSettings struct {
+	Enabled     bool   `json:"enabled"`
+	NotifyEmail string `json:"notify_email" binding:"omitempty,email"`
+}
+
+// StockAlert représente une alerte de stock publiée (ou à publier)
+type StockAlert struct {
+	ID           string     `json:"id"`
+	ProductID    string     `json:"product_id"`
+	VariantID    *string    `json:"variant_id,omitempty"`
+	Type         string     `json:"type"`
+	Available    int        `json:"available"`
+	ReorderPoint *int       `json:"reorder_point,omitempty"`
+	DeliveredAt  *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// suggestedQuantity retourne la quantité à commander : la quantité de
+// réapprovisionnement, à défaut de quoi le stock est ramené au-dessus du seuil.
+// Les quantités déjà en commande sont déduites.
+func (item *LowStockItem) suggestedQuantity() int {
+	quantity := 0
+	switch {
+	case item.ReorderQuantity != nil:
+		quantity = *item.ReorderQuantity
+	case item.ReorderPoint != nil:
+		quantity = *item.ReorderPoint - item.Available + 1
+	default:
+		quantity = 1 - item.Available
+	}
+	return quantity - item.OnOrder
+}
+
+// ListLowStockItems retourne les produits actifs du marchand en rupture ou sous leur seuil
+func ListLowStockItems(merchantID string) ([]LowStockItem, error) {
+	rows, err := db.Query(
+		`SELECT i.product_id, i.variant_id, p.name || COALESCE(' - ' || v.name, ''), COALESCE(v.sku, p.sku),
+		        i.quantity - i.reserved, i.reorder_point, i.reorder_quantity, i.supplier_id,
+		        COALESCE((
+		            SELECT SUM(poi.quantity_ordered - poi.quantity_received)
+		            FROM purchase_order_items poi
+		            JOIN purchase_orders po ON po.id = poi.purchase_order_id
+		            WHERE po.status IN ('draft', 'ordered', 'partially_received')
+		              AND poi.product_id = i.product_id AND poi.variant_id IS NOT DISTINCT FROM i.variant_id
+		        ), 0)
+		 FROM inventory i
+		 JOIN products p ON p.id = i.product_id
+		 LEFT JOIN product_variants v ON v.id = i.variant_id
+		 WHERE p.merchant_id = $1 AND p.status = 'active'
+		   AND (i.quantity - i.reserved <= 0 OR i.quantity - i.reserved <= i.reorder_point)
+		 ORDER BY i.quantity - i.reserved, p.name`,
+		merchantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []LowStockItem{}
+	for rows.Next() {
+		var item LowStockItem
+		var variantID, supplierID sql.NullString
+		var reorderPoint, reorderQuantity sql.NullInt64
+		if err := rows.Scan(&item.ProductID, &variantID, &item.Name, &item.SKU, &item.Available,
+			&reorderPoint, &reorderQuantity, &supplierID, &item.OnOrder); err != nil {
+			return nil, err
+		}
+		if variantID.Valid {
+			item.VariantID = &variantID.String
+		}
+		if supplierID.Valid {
+			item.SupplierID = &supplierID.String
+		}
+		if reorderPoint.Valid {
+			v := int(reorderPoint.Int64)
+			item.ReorderPoint = &v
+		}
+		if reorderQuantity.Valid {
+			v := int(reorderQuantity.Int64)
+			item.ReorderQuantity = &v
+		}
+		item.Suggested = item.suggestedQuantity()
+		item.Status = AlertLowStock
+		if item.Available <= 0 {
+			item.Status = AlertOutOfStock
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// DetectStockAlerts compare le stock disponible aux seuils et crée une alerte
+// pour chaque produit qui vient de passer en stock bas ou en rupture. L'état
+// signalé est mémorisé : une alerte n'est pas répétée tant que le stock n'est
+// pas remonté, et un réassort partiel (rupture → stock bas) n'en crée pas.
+func DetectStockAlerts() (int, error) {
+	result, err := db.Exec(
+		`WITH levels AS (
+		     SELECT i.product_id, i.variant_id, p.merchant_id, i.reorder_point,
+		            i.quantity - i.reserved AS available,
+		            i.stock_status AS previous_status,
+		            CASE
+		                WHEN i.quantity - i.reserved <= 0 THEN 'out_of_stock'
+		                WHEN i.quantity - i.reserved <= i.reorder_point THEN 'low_stock'
+		                ELSE 'in_stock'
+		            END AS status
+		     FROM inventory i
+		     JOIN products p ON p.id = i.product_id
+		     WHERE p.status = 'active'
+		 ), changed AS (
+		     UPDATE inventory i SET stock_status = l.status
+		     FROM levels l
+		     WHERE i.product_id = l.product_id AND i.variant_id IS NOT DISTINCT FROM l.variant_id
+		       AND i.stock_status <> l.status
+		     RETURNING l.merchant_id, l.product_id, l.variant_id, l.status, l.previous_status, l.available, l.reorder_point
+		 )
+		 INSERT INTO stock_alerts (merchant_id, product_id, variant_id, type, available, reorder_point)
+		 SELECT c.merchant_id, c.product_id, c.variant_id, c.status, c.available, c.reorder_point
+		 FROM changed c
+		 WHERE c.status <> 'in_stock'
+		   AND NOT (c.previous_status = 'out_of_stock' AND c.status = 'low_stock')
+		   AND NOT EXISTS (SELECT 1 FROM stock_alert_settings s WHERE s.merchant_id = c.merchant_id AND NOT s.enabled)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
+// pendingStockAlert est une alerte à publier avec le contexte du produit
+type pendingStockAlert struct {
+	StockAlert
+	MerchantID  string
+	Name        string
+	SKU         string
+	NotifyEmail string
+}
+
+// DeliverStockAlerts publie les alertes en attente (webhook inventory.low_stock
+// ou inventory.out_of_stock, et e-mail si le marchand en a configuré un). Une
+// alerte en échec est retentée aux passes suivantes.
+func DeliverStockAlerts() (int, error) {
+	delivered := 0
+	err := withTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(
+			`SELECT a.id, a.merchant_id, a.product_id, a.variant_id, a.type, a.available, a.reorder_point, a.created_at,
+			        p.name || COALESCE(' - ' || v.name, ''), COALESCE(v.sku, p.sku), COALESCE(s.notify_email, '')
+			 FROM stock_alerts a
+			 JOIN products p ON p.id = a.product_id
+			 LEFT JOIN product_variants v ON v.id = a.variant_id
+			 LEFT JOIN stock_alert_settings s ON s.merchant_id = a.merchant_id
+			 WHERE a.delivered_at IS NULL AND a.attempts < $1
+			 ORDER BY a.created_at
+			 LIMIT $2
+			 FOR UPDATE OF a SKIP LOCKED`,
+			stockAlertMaxAttempts, stockAlertBatchSize,
+		)
+		if err != nil {
+			return err
+		}
+		var alerts []pendingStockAlert
+		for rows.Next() {
+			var a pendingStockAlert
+			var variantID sql.NullString
+			var reorderPoint sql.NullInt64
+			if err := rows.Scan(&a.ID, &a.MerchantID, &a.ProductID, &variantID, &a.Type, &a.Available, &reorderPoint,
+				&a.CreatedAt, &a.Name, &a.SKU, &a.NotifyEmail); err != nil {
+				rows.Close()
+				return err
+			}
+			if variantID.Valid {
+				a.VariantID = &variantID.String
+			}
+			if reorderPoint.Valid {
+				v := int(reorderPoint.Int64)
+				a.ReorderPoint = &v
+			}
+			alerts = append(alerts, a)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for i := range alerts {
+			a := &alerts[i]
+			if err := deliverStockAlert(a); err != nil {
+				log.Printf("Erreur lors de la publication de l'alerte de stock %s: %v", a.ID, err)
+				if _, err := tx.Exec(
+					"UPDATE stock_alerts SET attempts = attempts + 1, last_error = $1 WHERE id = $2",
+					err.Error(), a.ID,
+				); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := tx.Exec(
+				"UPDATE stock_alerts SET attempts = attempts + 1, last_error = NULL, delivered_at = CURRENT_TIMESTAMP WHERE id = $1",
+				a.ID,
+			); err != nil {
+				return err
+			}
+			delivered++
+		}
+		return nil
+	})
+	return delivered, err
+}
+
+// deliverStockAlert publie une alerte par webhook puis par e-mail
+func deliverStockAlert(a *pendingStockAlert) error {
+	data := map[string]interface{}{
+		"alert_id":      a.ID,
+		"product_id":    a.ProductID,
+		"variant_id":    a.VariantID,
+		"name":          a.Name,
+		"sku":           a.SKU,
+		"available":     a.Available,
+		"reorder_point": a.ReorderPoint,
+		"detected_at":   a.CreatedAt,
+	}
+	if err := publishMerchantEvent(a.MerchantID, "inventory."+a.Type, data); err != nil {
+		return err
+	}
+
+	if a.NotifyEmail == "" {
+		return nil
+	}
+	subject := fmt.Sprintf("Stock bas : %s (%s)", a.Name, a.SKU)
+	body := fmt.Sprintf("Le stock disponible de %s (%s) est de %d.", a.Name, a.SKU, a.Available)
+	if a.Type == AlertOutOfStock {
+		subject = fmt.Sprintf("Rupture de stock : %s (%s)", a.Name, a.SKU)
+	} else if a.ReorderPoint != nil {
+		body += fmt.Sprintf(" Seuil de réapprovisionnement : %d.", *a.ReorderPoint)
+	}
+	return sendEmail(a.NotifyEmail, subject, body)
+}
+
+// StartStockAlertMonitor lance la détection et la publication périodiques des alertes de stock
+func StartStockAlertMonitor(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			detected, err := DetectStockAlerts()
+			if err != nil {
+				log.Printf("Erreur lors de la détection des stocks bas: %v", err)
+			} else if detected > 0 {
+				log.Printf("%d alerte(s) de stock détectée(s)", detected)
+			}
+
+			for {
+				delivered, err := DeliverStockAlerts()
+				if err != nil {
+					log.Printf("Erreur lors de la publication des alertes de stock: %v", err)
+					break
+				}
+				if delivered < stockAlertBatchSize {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// handleUpdateReorderSettings définit le seuil, la quantité et le fournisseur de réapprovisionnement
+func handleUpdateReorderSettings(c *gin.Context) {
+	productID := c.Param("productId")
+	merchantID := c.GetHeader("X-Merchant-ID")
+	if !authorizeInventoryProduct(c, productID) {
+		return
+	}
+
+	var req ReorderSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.SupplierID != nil {
+		err := checkSupplier(db, merchantID, *req.SupplierID)
+		if err == errSupplierNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la vérification du fournisseur"})
+			return
+		}
+	}
+
+	result, err := db.Exec(
+		`UPDATE inventory
+		 SET reorder_point = $1, reorder_quantity = $2, supplier_id = $3, updated_at = CURRENT_TIMESTAMP
+		 WHERE product_id = $4 AND (variant_id = $5 OR (variant_id IS NULL AND $5 IS NULL))`,
+		req.ReorderPoint, req.ReorderQuantity, req.SupplierID, productID, req.VariantID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour du réapprovisionnement"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stock introuvable"})
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+// handleListLowStock liste les produits en rupture ou sous leur seuil, avec la quantité suggérée
+func handleListLowStock(c *gin.Context) {
+	items, err := ListLowStockItems(c.GetHeader("X-Merchant-ID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des stocks bas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handleListStockAlerts liste les alertes de stock récentes du marchand
+func handleListStockAlerts(c *gin.Context) {
+	rows, err := db.Query(
+		`SELECT id, product_id, variant_id, type, available, reorder_point, delivered_at, created_at
+		 FROM stock_alerts WHERE merchant_id = $1
+		 ORDER BY created_at DESC LIMIT 100`,
+		c.GetHeader("X-Merchant-ID"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des alertes"})
+		return
+	}
+	defer rows.Close()
+
+	alerts := []StockAlert{}
+	for rows.Next() {
+		var a StockAlert
+		var variantID sql.NullString
+		var reorderPoint sql.NullInt64
+		var deliveredAt sql.NullTime
+		if err := rows.Scan(&a.ID, &a.ProductID, &variantID, &a.Type, &a.Available, &reorderPoint,
+			&deliveredAt, &a.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des alertes"})
+			return
+		}
+		if variantID.Valid {
+			a.VariantID = &variantID.String
+		}
+		if reorderPoint.Valid {
+			v := int(reorderPoint.Int64)
+			a.ReorderPoint = &v
+		}
+		if deliveredAt.Valid {
+			a.DeliveredAt = &deliveredAt.Time
+		}
+		alerts = append(alerts, a)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alerts": alerts})
+}
+
+// handleGetStockAlertSettings retourne les préférences d'alerte du marchand (activées par défaut)
+func handleGetStockAlertSettings(c *gin.Context) {
+	settings := StockAlertSettings{Enabled: true}
+	err := db.QueryRow(
+		"SELECT enabled, COALESCE(notify_email, '') FROM stock_alert_settings WHERE merchant_id = $1",
+		c.GetHeader("X-Merchant-ID"),
+	).Scan(&settings.Enabled, &settings.NotifyEmail)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des préférences d'alerte"})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// handleSaveStockAlertSettings enregistre les préférences d'alerte du marchand
+func handleSaveStockAlertSettings(c *gin.Context) {
+	var settings StockAlertSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	settings.NotifyEmail = strings.TrimSpace(settings.NotifyEmail)
+
+	_, err := db.Exec(
+		`INSERT INTO stock_alert_settings (merchant_id, enabled, notify_email) VALUES ($1, $2, NULLIF($3, ''))
+		 ON CONFLICT (merchant_id) DO UPDATE SET enabled = $2, notify_email = NULLIF($3, ''), updated_at = CURRENT_TIMESTAMP`,
+		c.GetHeader("X-Merchant-ID"), settings.Enabled, settings.NotifyEmail,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement des préférences d'alerte"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
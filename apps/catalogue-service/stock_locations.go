@@ -0,0 +1,327 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errLocationNotFound est retournée pour un emplacement inconnu ou d'un autre marchand
+var errLocationNotFound = errors.New("emplacement introuvable")
+
+// StockLocation représente un lieu de stockage : entrepôt ou magasin
+type StockLocation struct {
+	ID            string    `json:"id"`
+	MerchantID    string    `json:"merchant_id"`
+	Name          string    `json:"name"`
+	Code          string    `json:"code"`
+	Type          string    `json:"type"` // warehouse, store
+	Country       string    `json:"country,omitempty"`
+	Priority      int       `json:"priority"` // plus petit = prioritaire pour l'allocation
+	FulfilsOnline bool      `json:"fulfils_online"`
+	IsDefault     bool      `json:"is_default"`
+	Active        bool      `json:"active"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// StockLocationRequest représente une demande de création ou de mise à jour d'emplacement
+type StockLocationRequest struct {
+	Name          string `json:"name" binding:"required"`
+	Code          string `json:"code" binding:"required"`
+	Type          string `json:"type"`
+	Country       string `json:"country"`
+	Priority      *int   `json:"priority"`
+	FulfilsOnline *bool  `json:"fulfils_online"`
+	IsDefault     bool   `json:"is_default"`
+	Active        *bool  `json:"active"`
+}
+
+// LocationLevel représente le stock d'un produit dans un emplacement
+type LocationLevel struct {
+	LocationID   string `json:"location_id"`
+	LocationName string `json:"location_name"`
+	LocationCode string `json:"location_code"`
+	LocationType string `json:"location_type"`
+	Quantity     int    `json:"quantity"`
+	Incoming     int    `json:"incoming"`
+}
+
+const stockLocationColumns = `id, merchant_id, name, code, type, COALESCE(country, ''), priority,
+	fulfils_online, is_default, active, created_at, updated_at`
+
+func scanStockLocation(row interface{ Scan(...interface{}) error }) (*StockLocation, error) {
+	var l StockLocation
+	err := row.Scan(&l.ID, &l.MerchantID, &l.Name, &l.Code, &l.Type, &l.Country, &l.Priority,
+		&l.FulfilsOnline, &l.IsDefault, &l.Active, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// defaultLocationID retourne l'emplacement par défaut du marchand, créé au besoin
+func defaultLocationID(tx *sql.Tx, merchantID string) (string, error) {
+	if _, err := tx.Exec(
+		`INSERT INTO stock_locations (merchant_id, name, code, is_default)
+		 SELECT $1, 'Entrepôt principal', 'DEFAULT', TRUE
+		 WHERE NOT EXISTS (SELECT 1 FROM stock_locations WHERE merchant_id = $1 AND is_default)
+		 ON CONFLICT DO NOTHING`,
+		merchantID,
+	); err != nil {
+		return "", err
+	}
+
+	var id string
+	err := tx.QueryRow("SELECT id FROM stock_locations WHERE merchant_id = $1 AND is_default", merchantID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", errLocationNotFound
+	}
+	return id, err
+}
+
+// resolveLocationID vérifie qu'un emplacement appartient au marchand ; vide désigne l'emplacement par défaut
+func resolveLocationID(tx *sql.Tx, merchantID, locationID string) (string, error) {
+	if locationID == "" {
+		return defaultLocationID(tx, merchantID)
+	}
+
+	var exists bool
+	if err := tx.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM stock_locations WHERE id = $1 AND merchant_id = $2)",
+		locationID, merchantID,
+	).Scan(&exists); err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", errLocationNotFound
+	}
+	return locationID, nil
+}
+
+// lockLocationLevel crée au besoin puis verrouille le stock d'un produit dans un emplacement
+func lockLocationLevel(tx *sql.Tx, locationID, productID string, variantID *string) (quantity, incoming int, err error) {
+	if _, err = tx.Exec(
+		"INSERT INTO inventory_levels (location_id, product_id, variant_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		locationID, productID, variantID,
+	); err != nil {
+		return 0, 0, err
+	}
+	err = tx.QueryRow(
+		`SELECT quantity, incoming FROM inventory_levels
+		 WHERE location_id = $1 AND product_id = $2 AND variant_id IS NOT DISTINCT FROM $3
+		 FOR UPDATE`,
+		locationID, productID, variantID,
+	).Scan(&quantity, &incoming)
+	return quantity, incoming, err
+}
+
+// adjustLocationLevel applique une variation au stock d'un emplacement ; une
+// sortie ne peut pas rendre le stock de l'emplacement négatif
+func adjustLocationLevel(tx *sql.Tx, locationID, productID string, variantID *string, delta, incomingDelta int) error {
+	if _, _, err := lockLocationLevel(tx, locationID, productID, variantID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(
+		`UPDATE inventory_levels
+		 SET quantity = quantity + $1, incoming = incoming + $2, updated_at = CURRENT_TIMESTAMP
+		 WHERE location_id = $3 AND product_id = $4 AND variant_id IS NOT DISTINCT FROM $5
+		   AND ($1 >= 0 OR quantity + $1 >= 0) AND ($2 >= 0 OR incoming + $2 >= 0)`,
+		delta, incomingDelta, locationID, productID, variantID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrInsufficientStock
+	}
+	return nil
+}
+
+// adjustNetworkInventory applique une variation au stock total du réseau et
+// retourne le nouveau solde. Le total peut être négatif du montant des
+// reliquats ouverts : une entrée est toujours acceptée, et une sortie ne le
+// rend négatif que si la politique de stock autorise la vente sans stock. Avec
+// protectReserved, une sortie ne peut pas entamer le stock réservé (transferts) ;
+// une correction d'inventaire le peut.
+func adjustNetworkInventory(tx *sql.Tx, productID string, variantID *string, delta int, protectReserved bool) (int, error) {
+	if _, err := tx.Exec(
+		"INSERT INTO inventory (product_id, variant_id, quantity, reserved) VALUES ($1, $2, 0, 0) ON CONFLICT (product_id, variant_id) DO NOTHING",
+		productID, variantID,
+	); err != nil {
+		return 0, err
+	}
+
+	var balance int
+	err := tx.QueryRow(
+		`UPDATE inventory SET quantity = quantity + $1, updated_at = CURRENT_TIMESTAMP
+		 WHERE product_id = $2 AND (variant_id = $3 OR (variant_id IS NULL AND $3 IS NULL))
+		   AND ($1 >= 0 OR quantity + $1 >= 0 OR policy <> 'deny')
+		   AND (NOT $4 OR $1 >= 0 OR quantity - reserved + $1 >= 0)
+		 RETURNING quantity`,
+		delta, productID, variantID, protectReserved,
+	).Scan(&balance)
+	if err == sql.ErrNoRows {
+		return 0, ErrInsufficientStock
+	}
+	return balance, err
+}
+
+// GetLocationLevels retourne le stock d'un produit dans chaque emplacement actif
+func GetLocationLevels(productID string, variantID *string) ([]LocationLevel, error) {
+	// Sans variante, le stock de chaque emplacement cumule les variantes du produit
+	rows, err := db.Query(
+		`SELECT l.id, l.name, l.code, l.type, SUM(il.quantity), SUM(il.incoming)
+		 FROM inventory_levels il
+		 JOIN stock_locations l ON l.id = il.location_id
+		 WHERE il.product_id = $1 AND ($2::uuid IS NULL OR il.variant_id = $2) AND l.active
+		 GROUP BY l.id
+		 ORDER BY l.priority, l.name`,
+		productID, variantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	levels := []LocationLevel{}
+	for rows.Next() {
+		var level LocationLevel
+		if err := rows.Scan(&level.LocationID, &level.LocationName, &level.LocationCode, &level.LocationType,
+			&level.Quantity, &level.Incoming); err != nil {
+			return nil, err
+		}
+		levels = append(levels, level)
+	}
+	return levels, rows.Err()
+}
+
+// validateStockLocation normalise et vérifie une demande d'emplacement
+func validateStockLocation(req *StockLocationRequest) error {
+	req.Code = strings.ToUpper(strings.TrimSpace(req.Code))
+	req.Country = strings.ToUpper(strings.TrimSpace(req.Country))
+	if req.Type == "" {
+		req.Type = "warehouse"
+	}
+	if req.Type != "warehouse" && req.Type != "store" {
+		return errors.New("type invalide (warehouse ou store)")
+	}
+	if req.Country != "" && len(req.Country) != 2 {
+		return errors.New("country doit être un code pays ISO à deux lettres")
+	}
+	return nil
+}
+
+// handleListLocations liste les emplacements du marchand
+func handleListLocations(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	rows, err := db.Query(
+		"SELECT "+stockLocationColumns+" FROM stock_locations WHERE merchant_id = $1 ORDER BY priority, name",
+		merchantID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des emplacements"})
+		return
+	}
+	defer rows.Close()
+
+	locations := []*StockLocation{}
+	for rows.Next() {
+		location, err := scanStockLocation(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des emplacements"})
+			return
+		}
+		locations = append(locations, location)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"locations": locations})
+}
+
+// handleSaveLocation crée un emplacement (POST) ou le met à jour (PUT /locations/:id)
+func handleSaveLocation(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+	locationID := c.Param("id")
+
+	var req StockLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateStockLocation(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	priority := 100
+	if req.Priority != nil {
+		priority = *req.Priority
+	}
+	fulfilsOnline := req.FulfilsOnline == nil || *req.FulfilsOnline
+	active := req.Active == nil || *req.Active
+	if req.IsDefault && !active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "l'emplacement par défaut doit être actif"})
+		return
+	}
+
+	var location *StockLocation
+	err := withTx(func(tx *sql.Tx) error {
+		// Un seul emplacement par défaut par marchand
+		if req.IsDefault {
+			if _, err := tx.Exec(
+				"UPDATE stock_locations SET is_default = FALSE WHERE merchant_id = $1 AND is_default AND id::text <> $2",
+				merchantID, locationID,
+			); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if locationID == "" {
+			location, err = scanStockLocation(tx.QueryRow(
+				`INSERT INTO stock_locations (merchant_id, name, code, type, country, priority, fulfils_online, is_default, active)
+				 VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9)
+				 RETURNING `+stockLocationColumns,
+				merchantID, req.Name, req.Code, req.Type, req.Country, priority, fulfilsOnline, req.IsDefault, active,
+			))
+			return err
+		}
+
+		location, err = scanStockLocation(tx.QueryRow(
+			`UPDATE stock_locations
+			 SET name = $1, code = $2, type = $3, country = NULLIF($4, ''), priority = $5, fulfils_online = $6,
+			     is_default = is_default OR $7, active = $8, updated_at = CURRENT_TIMESTAMP
+			 WHERE id = $9 AND merchant_id = $10 AND NOT (is_default AND NOT $8)
+			 RETURNING `+stockLocationColumns,
+			req.Name, req.Code, req.Type, req.Country, priority, fulfilsOnline, req.IsDefault, active, locationID, merchantID,
+		))
+		if err == sql.ErrNoRows {
+			return errLocationNotFound
+		}
+		return err
+	})
+	if err == errLocationNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Emplacement non trouvé (ou emplacement par défaut désactivé)"})
+		return
+	}
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Un emplacement utilise déjà ce code"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement de l'emplacement"})
+		return
+	}
+
+	status := http.StatusOK
+	if locationID == "" {
+		status = http.StatusCreated
+	}
+	c.JSON(status, location)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestProductInventorySumsVariants(t *testing.T) {
+	openTestDB(t)
+	merchantID := testMerchantID(t)
+	productID, first := createTestProduct(t, merchantID)
+	var second string
+	if err := db.QueryRow(
+		"INSERT INTO product_variants (product_id, name, sku) VALUES ($1, 'Autre variante', $2) RETURNING id",
+		productID, "SKU-"+productID,
+	).Scan(&second); err != nil {
+		t.Fatal(err)
+	}
+	for variantID, stock := range map[string]int{first: 3, second: 4} {
+		variantID, delta := variantID, stock
+		if _, err := UpdateInventory(merchantID, productID, &variantID, "", &StockChange{Delta: &delta, Reason: ReasonRestock}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// inventory n'a pas de ligne au niveau du produit : le stock cumule les variantes
+	inventory, err := GetInventory(productID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inventory.Quantity != 7 || inventory.Available != 7 {
+		t.Errorf("quantity=%d available=%d, attendu 7", inventory.Quantity, inventory.Available)
+	}
+
+	levels, err := GetLocationLevels(productID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(levels) != 1 || levels[0].Quantity != 7 {
+		t.Errorf("stock par emplacement %+v, attendu 7 dans l'emplacement par défaut", levels)
+	}
+
+	var exported *ExportProduct
+	if err := forEachExportProduct(merchantID, func(p *ExportProduct) error {
+		if p.ID == productID {
+			exported = p
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if exported == nil || exported.Quantity != 7 || exported.Available != 7 {
+		t.Errorf("produit exporté %+v, attendu 7 unités", exported)
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Statuts d'un transfert de stock
+const (
+	TransferDraft     = "draft"
+	TransferInTransit = "in_transit"
+	TransferReceived  = "received"
+	TransferCancelled = "cancelled"
+)
+
+var (
+	errTransferNotFound = errors.New("transfert introuvable")
+	// errTransferStatus signale une transition de statut non autorisée
+	errTransferStatus = errors.New("statut du transfert incompatible avec l'opération")
+)
+
+// StockTransferItem représente une ligne d'un transfert
+type StockTransferItem struct {
+	ProductID string  `json:"product_id" binding:"required"`
+	VariantID *string `json:"variant_id,omitempty"`
+	Quantity  int     `json:"quantity" binding:"required,min=1"`
+}
+
+// StockTransfer représente un transfert de stock entre deux emplacements. Pendant
+// le transit, la marchandise a quitté l'emplacement source et figure en
+// « incoming » dans l'emplacement de destination.
+type StockTransfer struct {
+	ID             string              `json:"id"`
+	MerchantID     string              `json:"merchant_id"`
+	FromLocationID string              `json:"from_location_id"`
+	ToLocationID   string              `json:"to_location_id"`
+	Status         string              `json:"status"`
+	Note           string              `json:"note,omitempty"`
+	Items          []StockTransferItem `json:"items"`
+	ShippedAt      *time.Time          `json:"shipped_at,omitempty"`
+	ReceivedAt     *time.Time          `json:"received_at,omitempty"`
+	CreatedAt      time.Time           `json:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at"`
+}
+
+// StockTransferRequest représente une demande de création de transfert
+type StockTransferRequest struct {
+	FromLocationID string              `json:"from_location_id" binding:"required"`
+	ToLocationID   string              `json:"to_location_id" binding:"required"`
+	Note           string              `json:"note"`
+	Items          []StockTransferItem `json:"items" binding:"required,min=1,dive"`
+}
+
+const stockTransferColumns = `id, merchant_id, from_location_id, to_location_id, status, COALESCE(note, ''),
+	shipped_at, received_at, created_at, updated_at`
+
+func scanStockTransfer(row interface{ Scan(...interface{}) error }) (*StockTransfer, error) {
+	var t StockTransfer
+	var shippedAt, receivedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.MerchantID, &t.FromLocationID, &t.ToLocationID, &t.Status, &t.Note,
+		&shippedAt, &receivedAt, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if shippedAt.Valid {
+		t.ShippedAt = &shippedAt.Time
+	}
+	if receivedAt.Valid {
+		t.ReceivedAt = &receivedAt.Time
+	}
+	return &t, nil
+}
+
+// loadTransferItems charge les lignes d'un transfert
+func loadTransferItems(q queryer, transfer *StockTransfer) error {
+	rows, err := q.Query(
+		"SELECT product_id, variant_id, quantity FROM stock_transfer_items WHERE transfer_id = $1 ORDER BY product_id",
+		transfer.ID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	transfer.Items = []StockTransferItem{}
+	for rows.Next() {
+		var item StockTransferItem
+		var variantID sql.NullString
+		if err := rows.Scan(&item.ProductID, &variantID, &item.Quantity); err != nil {
+			return err
+		}
+		if variantID.Valid {
+			item.VariantID = &variantID.String
+		}
+		transfer.Items = append(transfer.Items, item)
+	}
+	return rows.Err()
+}
+
+// CreateStockTransfer enregistre un transfert en brouillon ; le stock n'est pas encore déplacé
+func CreateStockTransfer(merchantID string, req *StockTransferRequest) (*StockTransfer, error) {
+	if req.FromLocationID == req.ToLocationID {
+		return nil, fmt.Errorf("%w: emplacements source et destination identiques", errInvalidStockChange)
+	}
+
+	var transfer *StockTransfer
+	err := withTx(func(tx *sql.Tx) error {
+		for _, locationID := range []string{req.FromLocationID, req.ToLocationID} {
+			if _, err := resolveLocationID(tx, merchantID, locationID); err != nil {
+				return err
+			}
+		}
+		for _, item := range req.Items {
+			var owned bool
+			if err := tx.QueryRow(
+				"SELECT EXISTS(SELECT 1 FROM products WHERE id = $1 AND merchant_id = $2)",
+				item.ProductID, merchantID,
+			).Scan(&owned); err != nil {
+				return err
+			}
+			if !owned {
+				return fmt.Errorf("%w: produit %s introuvable", errInvalidStockChange, item.ProductID)
+			}
+		}
+
+		var err error
+		transfer, err = scanStockTransfer(tx.QueryRow(
+			`INSERT INTO stock_transfers (merchant_id, from_location_id, to_location_id, note)
+			 VALUES ($1, $2, $3, NULLIF($4, ''))
+			 RETURNING `+stockTransferColumns,
+			merchantID, req.FromLocationID, req.ToLocationID, req.Note,
+		))
+		if err != nil {
+			return err
+		}
+		for _, item := range req.Items {
+			if _, err := tx.Exec(
+				"INSERT INTO stock_transfer_items (transfer_id, product_id, variant_id, quantity) VALUES ($1, $2, $3, $4)",
+				transfer.ID, item.ProductID, item.VariantID, item.Quantity,
+			); err != nil {
+				return err
+			}
+		}
+		transfer.Items = req.Items
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// GetStockTransfer retourne un transfert du marchand avec ses lignes
+func GetStockTransfer(merchantID, transferID string) (*StockTransfer, error) {
+	transfer, err := scanStockTransfer(db.QueryRow(
+		"SELECT "+stockTransferColumns+" FROM stock_transfers WHERE id = $1 AND merchant_id = $2",
+		transferID, merchantID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, errTransferNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := loadTransferItems(db, transfer); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// transitionStockTransfer verrouille le transfert, vérifie son statut et applique
+// les mouvements de stock de la transition dans la même transaction
+func transitionStockTransfer(merchantID, transferID string, from []string, apply func(tx *sql.Tx, t *StockTransfer) (string, error)) (*StockTransfer, error) {
+	var transfer *StockTransfer
+	err := withTx(func(tx *sql.Tx) error {
+		var err error
+		transfer, err = scanStockTransfer(tx.QueryRow(
+			"SELECT "+stockTransferColumns+" FROM stock_transfers WHERE id = $1 AND merchant_id = $2 FOR UPDATE",
+			transferID, merchantID,
+		))
+		if err == sql.ErrNoRows {
+			return errTransferNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		allowed := false
+		for _, status := range from {
+			allowed = allowed || transfer.Status == status
+		}
+		if !allowed {
+			return errTransferStatus
+		}
+		if err := loadTransferItems(tx, transfer); err != nil {
+			return err
+		}
+
+		status, err := apply(tx, transfer)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range transfer.Items {
+			if err := enqueueSearchOutbox(tx, item.ProductID, OutboxOpIndex); err != nil {
+				return err
+			}
+		}
+
+		items := transfer.Items
+		transfer, err = scanStockTransfer(tx.QueryRow(
+			`UPDATE stock_transfers
+			 SET status = $1::text,
+			     shipped_at = CASE WHEN $1::text = 'in_transit' THEN CURRENT_TIMESTAMP ELSE shipped_at END,
+			     received_at = CASE WHEN $1::text = 'received' THEN CURRENT_TIMESTAMP ELSE received_at END,
+			     updated_at = CURRENT_TIMESTAMP
+			 WHERE id = $2
+			 RETURNING `+stockTransferColumns,
+			status, transferID,
+		))
+		if err != nil {
+			return err
+		}
+		transfer.Items = items
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notifySearchIndexer()
+	return transfer, nil
+}
+
+// recordTransferMovement inscrit un mouvement de transfert au registre
+func recordTransferMovement(tx *sql.Tx, t *StockTransfer, item StockTransferItem, locationID string, quantity, balance int) error {
+	reason := ReasonTransferIn
+	if quantity < 0 {
+		reason = ReasonTransferOut
+	}
+	_, err := recordInventoryMovement(tx, &InventoryMovement{
+		ProductID:    item.ProductID,
+		VariantID:    item.VariantID,
+		LocationID:   &locationID,
+		Quantity:     quantity,
+		BalanceAfter: balance,
+		Reason:       reason,
+		ReferenceID:  &t.ID,
+		CreatedBy:    t.MerchantID,
+	})
+	return err
+}
+
+// ShipStockTransfer fait sortir la marchandise de l'emplacement source ; elle
+// devient « incoming » à destination et n'est plus vendable tant qu'elle n'est
+// pas reçue. Le stock réservé n'est pas transférable.
+func ShipStockTransfer(merchantID, transferID string) (*StockTransfer, error) {
+	return transitionStockTransfer(merchantID, transferID, []string{TransferDraft},
+		func(tx *sql.Tx, t *StockTransfer) (string, error) {
+			for _, item := range t.Items {
+				if err := adjustLocationLevel(tx, t.FromLocationID, item.ProductID, item.VariantID, -item.Quantity, 0); err != nil {
+					return "", err
+				}
+				if err := adjustLocationLevel(tx, t.ToLocationID, item.ProductID, item.VariantID, 0, item.Quantity); err != nil {
+					return "", err
+				}
+				balance, err := adjustNetworkInventory(tx, item.ProductID, item.VariantID, -item.Quantity, true)
+				if err != nil {
+					return "", err
+				}
+				if err := recordTransferMovement(tx, t, item, t.FromLocationID, -item.Quantity, balance); err != nil {
+					return "", err
+				}
+			}
+			return TransferInTransit, nil
+		})
+}
+
+// ReceiveStockTransfer fait entrer la marchandise en transit dans l'emplacement de destination
+func ReceiveStockTransfer(merchantID, transferID string) (*StockTransfer, error) {
+	return transitionStockTransfer(merchantID, transferID, []string{TransferInTransit},
+		func(tx *sql.Tx, t *StockTransfer) (string, error) {
+			for _, item := range t.Items {
+				if err := adjustLocationLevel(tx, t.ToLocationID, item.ProductID, item.VariantID, item.Quantity, -item.Quantity); err != nil {
+					return "", err
+				}
+				balance, err := adjustNetworkInventory(tx, item.ProductID, item.VariantID, item.Quantity, false)
+				if err != nil {
+					return "", err
+				}
+				if err := recordTransferMovement(tx, t, item, t.ToLocationID, item.Quantity, balance); err != nil {
+					return "", err
+				}
+			}
+			return TransferReceived, nil
+		})
+}
+
+// CancelStockTransfer annule un brouillon, ou un transfert en transit dont la
+// marchandise retourne alors dans l'emplacement source
+func CancelStockTransfer(merchantID, transferID string) (*StockTransfer, error) {
+	return transitionStockTransfer(merchantID, transferID, []string{TransferDraft, TransferInTransit},
+		func(tx *sql.Tx, t *StockTransfer) (string, error) {
+			if t.Status == TransferDraft {
+				return TransferCancelled, nil
+			}
+			for _, item := range t.Items {
+				if err := adjustLocationLevel(tx, t.ToLocationID, item.ProductID, item.VariantID, 0, -item.Quantity); err != nil {
+					return "", err
+				}
+				if err := adjustLocationLevel(tx, t.FromLocationID, item.ProductID, item.VariantID, item.Quantity, 0); err != nil {
+					return "", err
+				}
+				balance, err := adjustNetworkInventory(tx, item.ProductID, item.VariantID, item.Quantity, false)
+				if err != nil {
+					return "", err
+				}
+				if err := recordTransferMovement(tx, t, item, t.FromLocationID, item.Quantity, balance); err != nil {
+					return "", err
+				}
+			}
+			return TransferCancelled, nil
+		})
+}
+
+// handleCreateTransfer crée un transfert en brouillon
+func handleCreateTransfer(c *gin.Context) {
+	var req StockTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transfer, err := CreateStockTransfer(c.GetHeader("X-Merchant-ID"), &req)
+	if err != nil {
+		respondTransferError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, transfer)
+}
+
+// handleListTransfers liste les transferts du marchand, filtrables par statut
+func handleListTransfers(c *gin.Context) {
+	rows, err := db.Query(
+		"SELECT "+stockTransferColumns+` FROM stock_transfers
+		 WHERE merchant_id = $1 AND ($2 = '' OR status = $2)
+		 ORDER BY created_at DESC LIMIT 200`,
+		c.GetHeader("X-Merchant-ID"), c.Query("status"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des transferts"})
+		return
+	}
+	defer rows.Close()
+
+	transfers := []*StockTransfer{}
+	for rows.Next() {
+		transfer, err := scanStockTransfer(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des transferts"})
+			return
+		}
+		transfers = append(transfers, transfer)
+	}
+	rows.Close()
+
+	for _, transfer := range transfers {
+		if err := loadTransferItems(db, transfer); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des transferts"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transfers": transfers})
+}
+
+// handleGetTransfer retourne un transfert
+func handleGetTransfer(c *gin.Context) {
+	transfer, err := GetStockTransfer(c.GetHeader("X-Merchant-ID"), c.Param("id"))
+	if err != nil {
+		respondTransferError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, transfer)
+}
+
+// handleTransferAction retourne le handler d'une transition (ship, receive, cancel)
+func handleTransferAction(action func(merchantID, transferID string) (*StockTransfer, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transfer, err := action(c.GetHeader("X-Merchant-ID"), c.Param("id"))
+		if err != nil {
+			respondTransferError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, transfer)
+	}
+}
+
+// respondTransferError traduit les erreurs des transferts en réponses HTTP
+func respondTransferError(c *gin.Context, err error) {
+	switch {
+	case err == errTransferNotFound || err == errLocationNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err == errTransferStatus || err == ErrInsufficientStock:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errInvalidStockChange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors du traitement du transfert"})
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -55,12 +56,18 @@ type ThemeLayout struct {
 	Shadow          string `json:"shadow"`
 }
 
-// handleGetStorefrontConfig récupère la configuration du storefront
+// handleGetStorefrontConfig récupère la configuration publiée du storefront, ou
+// le brouillon avec un lien de prévisualisation signé (?preview_token=)
 func handleGetStorefrontConfig(c *gin.Context) {
+	if token := c.Query("preview_token"); token != "" {
+		serveStorefrontPreview(c, token, false)
+		return
+	}
+
 	merchantID := c.GetHeader("X-Merchant-ID")
 	if merchantID == "" {
 		// Essayer de récupérer depuis les query params pour le storefront public
-		merchantID = c.Query("merchant_id")
+		merchantID = storefrontMerchantID(c)
 	}
 	if merchantID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Merchant ID manquant"})
@@ -93,11 +100,22 @@ func handleGetStorefrontConfig(c *gin.Context) {
 	config.MerchantID = merchantID
 
 	if sectionsJSON.Valid {
-		json.Unmarshal([]byte(sectionsJSON.String), &config.Sections)
+		if err := json.Unmarshal([]byte(sectionsJSON.String), &config.Sections); err != nil {
+			log.Printf("Sections du storefront illisibles (marchand %s): %v", merchantID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Configuration du storefront illisible"})
+			return
+		}
+	}
+	if config.Sections == nil {
+		config.Sections = []Section{}
 	}
 
 	if themeJSON.Valid {
-		json.Unmarshal([]byte(themeJSON.String), &config.Theme)
+		if err := json.Unmarshal([]byte(themeJSON.String), &config.Theme); err != nil {
+			log.Printf("Thème du storefront illisible (marchand %s): %v", merchantID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Configuration du storefront illisible"})
+			return
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -106,7 +124,50 @@ func handleGetStorefrontConfig(c *gin.Context) {
 	})
 }
 
-// handleSaveStorefrontConfig sauvegarde la configuration du storefront
+// serveStorefrontPreview répond avec le contenu désigné par un lien de prévisualisation
+func serveStorefrontPreview(c *gin.Context, token string, themeOnly bool) {
+	merchantID, ref, ok := checkPreviewToken(c, token)
+	if !ok {
+		return
+	}
+
+	snapshot, err := loadStorefrontSnapshot(db, merchantID, ref)
+	if err != nil {
+		respondStorefrontVersionError(c, err, "Erreur lors de la récupération")
+		return
+	}
+
+	if themeOnly {
+		c.JSON(http.StatusOK, gin.H{"theme": snapshot.Theme, "preview": true})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"sections": snapshot.Sections,
+		"theme":    snapshot.Theme,
+		"preview":  true,
+		"version":  ref,
+	})
+}
+
+// checkPreviewToken vérifie un lien de prévisualisation et retourne le marchand
+// et la référence (draft ou numéro de version) qu'il désigne
+func checkPreviewToken(c *gin.Context, token string) (merchantID, ref string, ok bool) {
+	merchantID, ref, err := verifyPreviewToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return "", "", false
+	}
+	if requested := storefrontMerchantID(c); requested != "" && requested != merchantID {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errInvalidPreviewToken.Error()})
+		return "", "", false
+	}
+	// Un brouillon ne doit pas être mis en cache par un CDN
+	c.Header("Cache-Control", "no-store")
+	return merchantID, ref, true
+}
+
+// handleSaveStorefrontConfig enregistre le brouillon du storefront ; il est mis
+// en ligne par une publication (POST /store-builder/publish)
 func handleSaveStorefrontConfig(c *gin.Context) {
 	merchantID := c.GetHeader("X-Merchant-ID")
 	if merchantID == "" {
@@ -124,20 +185,32 @@ func handleSaveStorefrontConfig(c *gin.Context) {
 		return
 	}
 
+	if errs := append(ValidateSections(req.Sections), ValidateTheme(req.Theme)...); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+	if req.Sections == nil {
+		req.Sections = []Section{}
+	}
+
 	sectionsJSON, _ := json.Marshal(req.Sections)
-	var themeJSON []byte
+	// Sans thème dans la requête, le thème du brouillon est conservé
+	var themeJSON interface{}
 	if req.Theme != nil {
-		themeJSON, _ = json.Marshal(req.Theme)
+		encoded, _ := json.Marshal(req.Theme)
+		themeJSON = string(encoded)
 	}
 
 	_, err := db.Exec(
-		`INSERT INTO storefront_configs (merchant_id, sections, theme, updated_at)
-		 VALUES ($1, $2, $3, NOW())
+		`INSERT INTO storefront_configs (merchant_id, draft_sections, draft_theme, draft_updated_at, draft_updated_by)
+		 VALUES ($1, $2, $3, NOW(), $4)
 		 ON CONFLICT (merchant_id) 
-		 DO UPDATE SET sections = $2, theme = $3, updated_at = NOW()`,
+		 DO UPDATE SET draft_sections = $2, draft_theme = COALESCE($3, storefront_configs.draft_theme),
+		     draft_updated_at = NOW(), draft_updated_by = $4`,
 		merchantID,
 		string(sectionsJSON),
-		string(themeJSON),
+		themeJSON,
+		storefrontAuthor(c),
 	)
 
 	if err != nil {
@@ -145,10 +218,14 @@ func handleSaveStorefrontConfig(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Configuration sauvegardée"})
+	response := gin.H{"message": "Brouillon sauvegardé"}
+	if req.Theme != nil {
+		response["contrast_warnings"] = CheckThemeContrast(req.Theme)
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-// handleSaveTheme sauvegarde uniquement le thème
+// handleSaveTheme sauvegarde uniquement le thème du brouillon
 func handleSaveTheme(c *gin.Context) {
 	merchantID := c.GetHeader("X-Merchant-ID")
 	if merchantID == "" {
@@ -162,31 +239,55 @@ func handleSaveTheme(c *gin.Context) {
 		return
 	}
 
-	themeJSON, _ := json.Marshal(theme)
+	if errs := ValidateTheme(&theme); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
 
-	_, err := db.Exec(
-		`INSERT INTO storefront_configs (merchant_id, theme, updated_at)
-		 VALUES ($1, $2, NOW())
+	if err := saveDraftTheme(merchantID, storefrontAuthor(c), &theme); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la sauvegarde"})
+		return
+	}
+
+	// Les contrastes insuffisants sont signalés sans bloquer l'enregistrement
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Thème sauvegardé",
+		"contrast_warnings": CheckThemeContrast(&theme),
+	})
+}
+
+// saveDraftTheme remplace le thème du brouillon
+func saveDraftTheme(merchantID, author string, theme *Theme) error {
+	themeJSON, err := json.Marshal(theme)
+	if err != nil {
+		return err
+	}
+
+	// À la création, les sections valent [] (valeur par défaut de la colonne) et
+	// non NULL : seul le thème du brouillon est modifié
+	_, err = db.Exec(
+		`INSERT INTO storefront_configs (merchant_id, draft_theme, draft_updated_at, draft_updated_by)
+		 VALUES ($1, $2, NOW(), $3)
 		 ON CONFLICT (merchant_id) 
-		 DO UPDATE SET theme = $2, updated_at = NOW()`,
+		 DO UPDATE SET draft_theme = $2, draft_updated_at = NOW(), draft_updated_by = $3`,
 		merchantID,
 		string(themeJSON),
+		author,
 	)
+	return err
+}
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la sauvegarde"})
+// handleGetTheme récupère uniquement le thème publié (ou celui d'un lien de prévisualisation)
+func handleGetTheme(c *gin.Context) {
+	if token := c.Query("preview_token"); token != "" {
+		serveStorefrontPreview(c, token, true)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Thème sauvegardé"})
-}
-
-// handleGetTheme récupère uniquement le thème
-func handleGetTheme(c *gin.Context) {
 	merchantID := c.GetHeader("X-Merchant-ID")
 	if merchantID == "" {
 		// Essayer de récupérer depuis les query params pour le storefront public
-		merchantID = c.Query("merchant_id")
+		merchantID = storefrontMerchantID(c)
 	}
 	if merchantID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Merchant ID manquant"})
@@ -199,18 +300,22 @@ func handleGetTheme(c *gin.Context) {
 		merchantID,
 	).Scan(&themeJSON)
 
-	if err == sql.ErrNoRows || !themeJSON.Valid {
-		c.JSON(http.StatusOK, gin.H{"theme": nil})
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération"})
 		return
 	}
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération"})
+	if err == sql.ErrNoRows || !themeJSON.Valid {
+		c.JSON(http.StatusOK, gin.H{"theme": nil})
 		return
 	}
 
 	var theme Theme
-	json.Unmarshal([]byte(themeJSON.String), &theme)
+	if err := json.Unmarshal([]byte(themeJSON.String), &theme); err != nil {
+		log.Printf("Thème du storefront illisible (marchand %s): %v", merchantID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Configuration du storefront illisible"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"theme": theme})
 }
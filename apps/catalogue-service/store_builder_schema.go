@@ -0,0 +1,469 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JSONSchema est le sous-ensemble de JSON Schema utilisé pour décrire les données
+// des sections. Il est exposé tel quel à l'éditeur pour générer les formulaires.
+type JSONSchema struct {
+	Type                 string                 `json:"type"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Format               string                 `json:"format,omitempty"` // uri, color, html
+	Enum                 []string               `json:"enum,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+}
+
+// SectionType décrit un type de section disponible dans le store builder
+type SectionType struct {
+	Type        string      `json:"type"`
+	Label       string      `json:"label"`
+	Description string      `json:"description"`
+	Schema      *JSONSchema `json:"schema"`
+}
+
+// FieldError représente une erreur de validation rattachée à un champ
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors regroupe les erreurs de validation d'une configuration
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 0 {
+		return "configuration invalide"
+	}
+	return fmt.Sprintf("configuration invalide: %s: %s", e[0].Field, e[0].Message)
+}
+
+// Limites de la configuration du storefront
+const (
+	maxStorefrontSections = 100
+	maxSectionIDLength    = 64
+)
+
+func intPtr(v int) *int    { return &v }
+func boolPtr(v bool) *bool { return &v }
+func textSchema(title string, max int) *JSONSchema {
+	return &JSONSchema{Type: "string", Title: title, MaxLength: intPtr(max)}
+}
+func urlSchema(title string) *JSONSchema {
+	return &JSONSchema{Type: "string", Title: title, Format: "uri", MaxLength: intPtr(2048)}
+}
+func objectSchema(properties map[string]*JSONSchema, required ...string) *JSONSchema {
+	return &JSONSchema{Type: "object", Properties: properties, Required: required, AdditionalProperties: boolPtr(false)}
+}
+
+// sectionTypes est le registre des types de section, dans l'ordre de la palette
+// de l'éditeur. Les schémas reflètent les props des composants du storefront ;
+// une section ajoutée est enregistrée vide, ses champs de premier niveau sont
+// donc facultatifs (le composant applique ses valeurs par défaut).
+var sectionTypes = []SectionType{
+	{
+		Type:        "hero",
+		Label:       "Bannière principale",
+		Description: "Grand visuel d'accroche avec titre et bouton d'action",
+		Schema: objectSchema(map[string]*JSONSchema{
+			"title":    textSchema("Titre", 120),
+			"subtitle": textSchema("Sous-titre", 300),
+			"imageUrl": urlSchema("Image de fond"),
+			"ctaText":  textSchema("Texte du bouton", 40),
+			"ctaUrl":   urlSchema("Lien du bouton"),
+		}),
+	},
+	{
+		Type:        "productGrid",
+		Label:       "Grille de produits",
+		Description: "Sélection de produits du catalogue",
+		Schema: objectSchema(map[string]*JSONSchema{
+			"title":      textSchema("Titre", 120),
+			"limit":      {Type: "integer", Title: "Nombre de produits", Minimum: floatPtr(1), Maximum: floatPtr(48), Default: 8},
+			"category":   textSchema("Catégorie", 100),
+			"collection": textSchema("Collection (handle)", 64),
+		}),
+	},
+	{
+		Type:        "testimonials",
+		Label:       "Témoignages",
+		Description: "Avis de clients",
+		Schema: objectSchema(map[string]*JSONSchema{
+			"title": textSchema("Titre", 120),
+			"testimonials": {
+				Type:     "array",
+				Title:    "Témoignages",
+				MaxItems: intPtr(12),
+				Items: objectSchema(map[string]*JSONSchema{
+					"name":    textSchema("Nom", 80),
+					"role":    textSchema("Rôle", 80),
+					"content": textSchema("Témoignage", 1000),
+					"avatar":  urlSchema("Photo"),
+				}, "name", "content"),
+			},
+		}),
+	},
+	{
+		Type:        "features",
+		Label:       "Points forts",
+		Description: "Liste d'arguments avec icône",
+		Schema: objectSchema(map[string]*JSONSchema{
+			"title": textSchema("Titre", 120),
+			"features": {
+				Type:     "array",
+				Title:    "Points forts",
+				MaxItems: intPtr(12),
+				Items: objectSchema(map[string]*JSONSchema{
+					"icon":        textSchema("Icône", 16),
+					"title":       textSchema("Titre", 80),
+					"description": textSchema("Description", 300),
+				}, "title"),
+			},
+		}),
+	},
+	{
+		Type:        "banner",
+		Label:       "Bandeau",
+		Description: "Message promotionnel sur fond coloré ou image",
+		Schema: objectSchema(map[string]*JSONSchema{
+			"text":            textSchema("Texte", 200),
+			"imageUrl":        urlSchema("Image de fond"),
+			"backgroundColor": {Type: "string", Title: "Couleur de fond", Format: "color", Default: "#3B82F6"},
+			"textColor":       {Type: "string", Title: "Couleur du texte", Format: "color", Default: "#FFFFFF"},
+		}),
+	},
+	{
+		Type:        "richText",
+		Label:       "Texte enrichi",
+		Description: "Contenu HTML libre",
+		Schema: objectSchema(map[string]*JSONSchema{
+			"content": {Type: "string", Title: "Contenu", Format: "html", MaxLength: intPtr(50000)},
+		}),
+	},
+	{
+		Type:        "imageGallery",
+		Label:       "Galerie d'images",
+		Description: "Grille d'images",
+		Schema: objectSchema(map[string]*JSONSchema{
+			"title": textSchema("Titre", 120),
+			"images": {
+				Type:     "array",
+				Title:    "Images",
+				MinItems: intPtr(1),
+				MaxItems: intPtr(24),
+				Items:    urlSchema("Image"),
+			},
+		}),
+	},
+}
+
+// lookupSectionType retourne la définition d'un type de section
+func lookupSectionType(sectionType string) *SectionType {
+	for i := range sectionTypes {
+		if sectionTypes[i].Type == sectionType {
+			return &sectionTypes[i]
+		}
+	}
+	return nil
+}
+
+// ValidateSections vérifie les sections d'une configuration : identifiants
+// uniques, type connu et données conformes au schéma du type
+func ValidateSections(sections []Section) ValidationErrors {
+	return validateSectionList("sections", sections)
+}
+
+// validateSectionList valide une liste de sections ; prefix situe la liste dans
+// la configuration (sections de l'accueil ou pages[i].sections)
+func validateSectionList(prefix string, sections []Section) ValidationErrors {
+	var errs ValidationErrors
+	if len(sections) > maxStorefrontSections {
+		errs = append(errs, FieldError{prefix, fmt.Sprintf("au plus %d sections", maxStorefrontSections)})
+		return errs
+	}
+
+	seen := make(map[string]bool, len(sections))
+	for i, section := range sections {
+		path := fmt.Sprintf("%s[%d]", prefix, i)
+		switch {
+		case section.ID == "":
+			errs = append(errs, FieldError{path + ".id", "identifiant requis"})
+		case len(section.ID) > maxSectionIDLength:
+			errs = append(errs, FieldError{path + ".id", fmt.Sprintf("au plus %d caractères", maxSectionIDLength)})
+		case seen[section.ID]:
+			errs = append(errs, FieldError{path + ".id", "identifiant en double"})
+		}
+		seen[section.ID] = true
+
+		definition := lookupSectionType(section.Type)
+		if definition == nil {
+			errs = append(errs, FieldError{path + ".type", fmt.Sprintf("type de section inconnu: %q", section.Type)})
+			continue
+		}
+		validateSchemaValue(definition.Schema, section.Data, path+".data", &errs)
+	}
+	return errs
+}
+
+// validateSchemaValue valide une valeur décodée depuis JSON contre un schéma
+func validateSchemaValue(schema *JSONSchema, value interface{}, path string, errs *ValidationErrors) {
+	fail := func(message string) {
+		*errs = append(*errs, FieldError{path, message})
+	}
+
+	switch schema.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			fail("chaîne attendue")
+			return
+		}
+		length := len([]rune(s))
+		if schema.MinLength != nil && length < *schema.MinLength {
+			fail(fmt.Sprintf("au moins %d caractères", *schema.MinLength))
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			fail(fmt.Sprintf("au plus %d caractères", *schema.MaxLength))
+		}
+		if len(schema.Enum) > 0 && !containsString(schema.Enum, s) {
+			fail("valeur non autorisée, attendu: " + strings.Join(schema.Enum, ", "))
+		}
+		if s == "" {
+			return
+		}
+		switch schema.Format {
+		case "uri":
+			if !isSafeURL(s) {
+				fail("URL invalide (http, https ou chemin relatif)")
+			}
+		case "color":
+			if !isValidColor(s) {
+				fail("couleur invalide (#RGB, #RRGGBB, rgb() ou hsl())")
+			}
+		}
+
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			fail("nombre attendu")
+			return
+		}
+		if schema.Type == "integer" && n != math.Trunc(n) {
+			fail("entier attendu")
+		}
+		if schema.Minimum != nil && n < *schema.Minimum {
+			fail(fmt.Sprintf("doit être supérieur ou égal à %g", *schema.Minimum))
+		}
+		if schema.Maximum != nil && n > *schema.Maximum {
+			fail(fmt.Sprintf("doit être inférieur ou égal à %g", *schema.Maximum))
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("booléen attendu")
+		}
+
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			fail("tableau attendu")
+			return
+		}
+		if schema.MinItems != nil && len(items) < *schema.MinItems {
+			fail(fmt.Sprintf("au moins %d éléments", *schema.MinItems))
+		}
+		if schema.MaxItems != nil && len(items) > *schema.MaxItems {
+			fail(fmt.Sprintf("au plus %d éléments", *schema.MaxItems))
+		}
+		if schema.Items != nil {
+			for i, item := range items {
+				validateSchemaValue(schema.Items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			fail("objet attendu")
+			return
+		}
+		for _, name := range schema.Required {
+			if v, present := object[name]; !present || v == nil || v == "" {
+				*errs = append(*errs, FieldError{path + "." + name, "champ requis"})
+			}
+		}
+		// Ordre stable des erreurs pour l'éditeur
+		keys := make([]string, 0, len(object))
+		for k := range object {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			property, known := schema.Properties[k]
+			if !known {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					*errs = append(*errs, FieldError{path + "." + k, "champ inconnu"})
+				}
+				continue
+			}
+			if object[k] == nil {
+				continue
+			}
+			validateSchemaValue(property, object[k], path+"."+k, errs)
+		}
+	}
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isSafeURL accepte les URL http(s) absolues et les chemins relatifs au site
+func isSafeURL(s string) bool {
+	if strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "//") {
+		return true
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+var (
+	hexColorPattern  = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	funcColorPattern = regexp.MustCompile(`^(rgb|rgba|hsl|hsla)\(\s*[0-9.]+%?\s*(,\s*[0-9.]+%?\s*){2}(,\s*[0-9.]+%?\s*)?\)$`)
+	// fontNamePattern : nom de police, éventuellement entre guillemets
+	fontNamePattern = regexp.MustCompile(`^("[A-Za-z0-9 \-]+"|'[A-Za-z0-9 \-]+'|[A-Za-z0-9][A-Za-z0-9 \-]*)$`)
+	// shadowPattern exclut les caractères permettant d'injecter du CSS
+	shadowPattern  = regexp.MustCompile(`^[A-Za-z0-9 #%.,()\-]*$`)
+	headingPattern = regexp.MustCompile(`^h[1-6]$`)
+)
+
+// isValidColor accepte les couleurs hexadécimales et les notations rgb()/hsl()
+func isValidColor(s string) bool {
+	return hexColorPattern.MatchString(s) || funcColorPattern.MatchString(s)
+}
+
+// ValidateTheme vérifie les couleurs, la typographie et la mise en page d'un
+// thème ; les champs vides sont remplacés par les valeurs par défaut du storefront
+func ValidateTheme(theme *Theme) ValidationErrors {
+	var errs ValidationErrors
+	if theme == nil {
+		return errs
+	}
+
+	colors := []struct {
+		field string
+		value string
+	}{
+		{"primary", theme.Colors.Primary},
+		{"secondary", theme.Colors.Secondary},
+		{"background", theme.Colors.Background},
+		{"text", theme.Colors.Text},
+		{"link", theme.Colors.Link},
+		{"button", theme.Colors.Button},
+	}
+	for _, color := range colors {
+		if color.value != "" && !isValidColor(color.value) {
+			errs = append(errs, FieldError{"theme.colors." + color.field, "couleur invalide (#RGB, #RRGGBB, rgb() ou hsl())"})
+		}
+	}
+
+	typography := theme.Typography
+	if typography.FontFamily != "" {
+		if message := validateFontFamily(typography.FontFamily); message != "" {
+			errs = append(errs, FieldError{"theme.typography.font_family", message})
+		}
+	}
+	checkRange := func(field string, value, min, max float64) {
+		if value != 0 && (value < min || value > max) {
+			errs = append(errs, FieldError{field, fmt.Sprintf("doit être compris entre %g et %g", min, max)})
+		}
+	}
+	checkRange("theme.typography.base_size", float64(typography.BaseSize), 10, 32)
+	checkRange("theme.typography.line_height", typography.LineHeight, 1, 3)
+	if typography.FontWeight != 0 && (typography.FontWeight < 100 || typography.FontWeight > 900 || typography.FontWeight%100 != 0) {
+		errs = append(errs, FieldError{"theme.typography.font_weight", "graisse invalide (100 à 900, par pas de 100)"})
+	}
+	headings := make([]string, 0, len(typography.HeadingSizes))
+	for level := range typography.HeadingSizes {
+		headings = append(headings, level)
+	}
+	sort.Strings(headings)
+	for _, level := range headings {
+		field := "theme.typography.heading_sizes." + level
+		if !headingPattern.MatchString(level) {
+			errs = append(errs, FieldError{field, "niveau de titre inconnu (h1 à h6)"})
+			continue
+		}
+		checkRange(field, float64(typography.HeadingSizes[level]), 10, 96)
+	}
+
+	layout := theme.Layout
+	checkRange("theme.layout.container_width", float64(layout.ContainerWidth), 320, 2560)
+	if layout.Padding < 0 || layout.Padding > 200 {
+		errs = append(errs, FieldError{"theme.layout.padding", "doit être compris entre 0 et 200"})
+	}
+	if layout.Margin < 0 || layout.Margin > 200 {
+		errs = append(errs, FieldError{"theme.layout.margin", "doit être compris entre 0 et 200"})
+	}
+	if layout.BorderRadius < 0 || layout.BorderRadius > 100 {
+		errs = append(errs, FieldError{"theme.layout.border_radius", "doit être compris entre 0 et 100"})
+	}
+	if len(layout.Shadow) > 200 || !shadowPattern.MatchString(layout.Shadow) {
+		errs = append(errs, FieldError{"theme.layout.shadow", "ombre CSS invalide"})
+	}
+	return errs
+}
+
+// validateFontFamily vérifie une pile de polices CSS (« Inter, sans-serif »)
+func validateFontFamily(value string) string {
+	if len(value) > 200 {
+		return "au plus 200 caractères"
+	}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || !fontNamePattern.MatchString(name) {
+			return fmt.Sprintf("nom de police invalide: %q", name)
+		}
+	}
+	return ""
+}
+
+// respondValidationErrors répond 422 avec le détail des champs invalides
+func respondValidationErrors(c *gin.Context, errs ValidationErrors) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":  "Configuration invalide",
+		"fields": errs,
+	})
+}
+
+// handleListSectionTypes retourne le registre des types de section et leur schéma
+func handleListSectionTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"section_types": sectionTypes})
+}
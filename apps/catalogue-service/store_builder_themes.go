@@ -0,0 +1,555 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Format des fichiers d'export de thème
+const (
+	themeBundleFormat  = "omnisphere-theme"
+	themeBundleVersion = 1
+)
+
+// Seuils WCAG 2.1 niveau AA
+const (
+	wcagAANormalText = 4.5
+	wcagAALargeText  = 3.0
+)
+
+var errThemePresetNotFound = errors.New("thème prédéfini introuvable")
+
+// ThemePreset représente un thème prédéfini proposé dans l'éditeur
+type ThemePreset struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Theme       Theme  `json:"theme"`
+}
+
+// ThemeBundle représente un thème exporté, portable d'une boutique à l'autre
+type ThemeBundle struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	Name       string    `json:"name,omitempty"`
+	ExportedAt time.Time `json:"exported_at"`
+	Theme      Theme     `json:"theme"`
+}
+
+// ContrastWarning signale une paire de couleurs sous le seuil WCAG AA
+type ContrastWarning struct {
+	Pair       string  `json:"pair"`
+	Foreground string  `json:"foreground"`
+	Background string  `json:"background"`
+	Ratio      float64 `json:"ratio"`
+	Required   float64 `json:"required"`
+	Message    string  `json:"message"`
+}
+
+// defaultTheme reprend les valeurs par défaut du storefront (lib/theme.ts)
+func defaultTheme() Theme {
+	return Theme{
+		Colors: ThemeColors{
+			Primary:    "#3B82F6",
+			Secondary:  "#8B5CF6",
+			Background: "#FFFFFF",
+			Text:       "#1F2937",
+			Link:       "#3B82F6",
+			Button:     "#3B82F6",
+		},
+		Typography: ThemeTypography{
+			FontFamily:   "Inter, sans-serif",
+			BaseSize:     16,
+			HeadingSizes: map[string]int{"h1": 48, "h2": 36, "h3": 30, "h4": 24, "h5": 20, "h6": 18},
+			LineHeight:   1.5,
+			FontWeight:   400,
+		},
+		Layout: ThemeLayout{
+			ContainerWidth: 1200,
+			Padding:        16,
+			Margin:         16,
+			BorderRadius:   8,
+			Shadow:         "0 1px 3px rgba(0,0,0,0.1)",
+		},
+	}
+}
+
+// themePresets est la bibliothèque de thèmes prédéfinis ; chacun respecte les
+// contrastes AA pour le texte, les liens et les boutons
+var themePresets = []ThemePreset{
+	{
+		ID:          "classic",
+		Name:        "Classique",
+		Description: "Bleu sobre sur fond blanc",
+		// Le bleu par défaut des liens et boutons n'atteint pas AA sur fond blanc
+		Theme: presetFrom(func(t *Theme) {
+			t.Colors.Link = "#2563EB"
+			t.Colors.Button = "#2563EB"
+		}),
+	},
+	{
+		ID:          "minimal",
+		Name:        "Minimaliste",
+		Description: "Noir et blanc, angles droits, sans ombre",
+		Theme: presetFrom(func(t *Theme) {
+			t.Colors = ThemeColors{Primary: "#111827", Secondary: "#6B7280", Background: "#FFFFFF", Text: "#111827", Link: "#111827", Button: "#111827"}
+			t.Typography.FontFamily = "Helvetica, Arial, sans-serif"
+			t.Layout.BorderRadius = 0
+			t.Layout.Shadow = "none"
+		}),
+	},
+	{
+		ID:          "dark",
+		Name:        "Nuit",
+		Description: "Fond sombre et accents violets",
+		Theme: presetFrom(func(t *Theme) {
+			t.Colors = ThemeColors{Primary: "#A78BFA", Secondary: "#F472B6", Background: "#111827", Text: "#F9FAFB", Link: "#C4B5FD", Button: "#6D28D9"}
+			t.Layout.Shadow = "0 1px 3px rgba(0,0,0,0.6)"
+		}),
+	},
+	{
+		ID:          "elegant",
+		Name:        "Élégant",
+		Description: "Typographie à empattements et tons chauds",
+		Theme: presetFrom(func(t *Theme) {
+			t.Colors = ThemeColors{Primary: "#7C2D12", Secondary: "#B45309", Background: "#FFFBF5", Text: "#292524", Link: "#9A3412", Button: "#7C2D12"}
+			t.Typography.FontFamily = "'Playfair Display', Georgia, serif"
+			t.Typography.LineHeight = 1.7
+			t.Layout.ContainerWidth = 1100
+			t.Layout.BorderRadius = 2
+		}),
+	},
+	{
+		ID:          "vibrant",
+		Name:        "Éclatant",
+		Description: "Couleurs vives et coins arrondis",
+		Theme: presetFrom(func(t *Theme) {
+			t.Colors = ThemeColors{Primary: "#DB2777", Secondary: "#F59E0B", Background: "#FFFFFF", Text: "#1F2937", Link: "#BE185D", Button: "#BE185D"}
+			t.Typography.FontFamily = "Poppins, sans-serif"
+			t.Typography.FontWeight = 500
+			t.Layout.BorderRadius = 16
+			t.Layout.Shadow = "0 4px 12px rgba(0,0,0,0.15)"
+		}),
+	},
+}
+
+// presetFrom construit un thème prédéfini à partir du thème par défaut
+func presetFrom(customize func(t *Theme)) Theme {
+	theme := defaultTheme()
+	customize(&theme)
+	return theme
+}
+
+// lookupThemePreset retourne un thème prédéfini par identifiant
+func lookupThemePreset(id string) *ThemePreset {
+	for i := range themePresets {
+		if themePresets[i].ID == id {
+			return &themePresets[i]
+		}
+	}
+	return nil
+}
+
+// resolvedTheme complète un thème avec les valeurs par défaut ; une valeur
+// invalide (thème enregistré avant la validation) est remplacée par le défaut
+// pour ne jamais produire de CSS arbitraire
+func resolvedTheme(theme *Theme) Theme {
+	resolved := defaultTheme()
+	if theme == nil {
+		return resolved
+	}
+
+	color := func(dest *string, value string) {
+		if value != "" && isValidColor(value) {
+			*dest = value
+		}
+	}
+	color(&resolved.Colors.Primary, theme.Colors.Primary)
+	color(&resolved.Colors.Secondary, theme.Colors.Secondary)
+	color(&resolved.Colors.Background, theme.Colors.Background)
+	color(&resolved.Colors.Text, theme.Colors.Text)
+	color(&resolved.Colors.Link, theme.Colors.Link)
+	color(&resolved.Colors.Button, theme.Colors.Button)
+
+	typography := theme.Typography
+	if typography.FontFamily != "" && validateFontFamily(typography.FontFamily) == "" {
+		resolved.Typography.FontFamily = typography.FontFamily
+	}
+	if typography.BaseSize >= 10 && typography.BaseSize <= 32 {
+		resolved.Typography.BaseSize = typography.BaseSize
+	}
+	if typography.LineHeight >= 1 && typography.LineHeight <= 3 {
+		resolved.Typography.LineHeight = typography.LineHeight
+	}
+	if typography.FontWeight >= 100 && typography.FontWeight <= 900 && typography.FontWeight%100 == 0 {
+		resolved.Typography.FontWeight = typography.FontWeight
+	}
+	for level, size := range typography.HeadingSizes {
+		if _, known := resolved.Typography.HeadingSizes[level]; known && size >= 10 && size <= 96 {
+			resolved.Typography.HeadingSizes[level] = size
+		}
+	}
+
+	layout := theme.Layout
+	if layout.ContainerWidth >= 320 && layout.ContainerWidth <= 2560 {
+		resolved.Layout.ContainerWidth = layout.ContainerWidth
+	}
+	// 0 est une valeur légitime pour les espacements et les arrondis : ils ne
+	// reprennent le défaut que si la mise en page est absente du thème
+	if layout != (ThemeLayout{}) {
+		resolved.Layout.Padding = clampInt(layout.Padding, 0, 200)
+		resolved.Layout.Margin = clampInt(layout.Margin, 0, 200)
+		resolved.Layout.BorderRadius = clampInt(layout.BorderRadius, 0, 100)
+	}
+	if layout.Shadow != "" && len(layout.Shadow) <= 200 && shadowPattern.MatchString(layout.Shadow) {
+		resolved.Layout.Shadow = layout.Shadow
+	}
+	return resolved
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// CompileThemeCSS compile un thème en feuille de variables CSS, avec les noms
+// utilisés par styles/theme-variables.css du storefront
+func CompileThemeCSS(theme *Theme) string {
+	t := resolvedTheme(theme)
+
+	var b strings.Builder
+	b.WriteString(":root {\n")
+	variable := func(name, value string) {
+		fmt.Fprintf(&b, "  --%s: %s;\n", name, value)
+	}
+	variable("color-primary", t.Colors.Primary)
+	variable("color-secondary", t.Colors.Secondary)
+	variable("color-background", t.Colors.Background)
+	variable("color-text", t.Colors.Text)
+	variable("color-link", t.Colors.Link)
+	variable("color-button", t.Colors.Button)
+
+	variable("font-family", t.Typography.FontFamily)
+	variable("font-size-base", fmt.Sprintf("%dpx", t.Typography.BaseSize))
+	levels := make([]string, 0, len(t.Typography.HeadingSizes))
+	for level := range t.Typography.HeadingSizes {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	for _, level := range levels {
+		variable("font-size-"+level, fmt.Sprintf("%dpx", t.Typography.HeadingSizes[level]))
+	}
+	variable("line-height", strconv.FormatFloat(t.Typography.LineHeight, 'f', -1, 64))
+	variable("font-weight", strconv.Itoa(t.Typography.FontWeight))
+
+	variable("container-width", fmt.Sprintf("%dpx", t.Layout.ContainerWidth))
+	variable("padding", fmt.Sprintf("%dpx", t.Layout.Padding))
+	variable("margin", fmt.Sprintf("%dpx", t.Layout.Margin))
+	variable("border-radius", fmt.Sprintf("%dpx", t.Layout.BorderRadius))
+	variable("shadow", t.Layout.Shadow)
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// parseColor convertit une couleur CSS validée par isValidColor en RGB (0-255).
+// La transparence est ignorée : la couleur est supposée posée sur un fond opaque.
+func parseColor(s string) (r, g, b float64, ok bool) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if strings.HasPrefix(s, "#") {
+		h := s[1:]
+		if len(h) == 3 || len(h) == 4 {
+			h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+		}
+		if len(h) < 6 {
+			return 0, 0, 0, false
+		}
+		v, err := strconv.ParseUint(h[:6], 16, 32)
+		if err != nil {
+			return 0, 0, 0, false
+		}
+		return float64(v >> 16 & 0xff), float64(v >> 8 & 0xff), float64(v & 0xff), true
+	}
+
+	open := strings.Index(s, "(")
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return 0, 0, 0, false
+	}
+	name := s[:open]
+	parts := strings.Split(s[open+1:len(s)-1], ",")
+	if len(parts) < 3 {
+		return 0, 0, 0, false
+	}
+	values := make([]float64, 3)
+	for i := 0; i < 3; i++ {
+		part := strings.TrimSpace(parts[i])
+		percent := strings.HasSuffix(part, "%")
+		v, err := strconv.ParseFloat(strings.TrimSuffix(part, "%"), 64)
+		if err != nil {
+			return 0, 0, 0, false
+		}
+		if percent && strings.HasPrefix(name, "rgb") {
+			v = v * 255 / 100
+		}
+		values[i] = v
+	}
+
+	if strings.HasPrefix(name, "rgb") {
+		return clampColor(values[0]), clampColor(values[1]), clampColor(values[2]), true
+	}
+	// hsl : teinte en degrés, saturation et luminosité en pourcentage
+	h := math.Mod(values[0], 360) / 360
+	if h < 0 {
+		h++
+	}
+	sat := math.Min(values[1], 100) / 100
+	l := math.Min(values[2], 100) / 100
+	if sat == 0 {
+		return l * 255, l * 255, l * 255, true
+	}
+	q := l * (1 + sat)
+	if l >= 0.5 {
+		q = l + sat - l*sat
+	}
+	p := 2*l - q
+	hue := func(t float64) float64 {
+		if t < 0 {
+			t++
+		}
+		if t > 1 {
+			t--
+		}
+		switch {
+		case t < 1.0/6:
+			return p + (q-p)*6*t
+		case t < 0.5:
+			return q
+		case t < 2.0/3:
+			return p + (q-p)*(2.0/3-t)*6
+		}
+		return p
+	}
+	return hue(h+1.0/3) * 255, hue(h) * 255, hue(h-1.0/3) * 255, true
+}
+
+func clampColor(v float64) float64 {
+	return math.Max(0, math.Min(255, v))
+}
+
+// relativeLuminance calcule la luminance relative WCAG d'une couleur
+func relativeLuminance(r, g, b float64) float64 {
+	channel := func(c float64) float64 {
+		c /= 255
+		if c <= 0.03928 {
+			return c / 12.92
+		}
+		return math.Pow((c+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(r) + 0.7152*channel(g) + 0.0722*channel(b)
+}
+
+// contrastRatio calcule le rapport de contraste WCAG entre deux couleurs
+func contrastRatio(foreground, background string) (float64, bool) {
+	fr, fg, fb, ok := parseColor(foreground)
+	if !ok {
+		return 0, false
+	}
+	br, bg, bb, ok := parseColor(background)
+	if !ok {
+		return 0, false
+	}
+	l1 := relativeLuminance(fr, fg, fb)
+	l2 := relativeLuminance(br, bg, bb)
+	if l1 < l2 {
+		l1, l2 = l2, l1
+	}
+	return (l1 + 0.05) / (l2 + 0.05), true
+}
+
+// CheckThemeContrast vérifie les contrastes WCAG AA du thème (valeurs par
+// défaut comprises) : texte et liens sur le fond, texte blanc des boutons
+func CheckThemeContrast(theme *Theme) []ContrastWarning {
+	t := resolvedTheme(theme)
+	pairs := []struct {
+		name       string
+		foreground string
+		background string
+		required   float64
+	}{
+		{"text/background", t.Colors.Text, t.Colors.Background, wcagAANormalText},
+		{"link/background", t.Colors.Link, t.Colors.Background, wcagAANormalText},
+		{"button_text/button", "#FFFFFF", t.Colors.Button, wcagAANormalText},
+		{"primary/background", t.Colors.Primary, t.Colors.Background, wcagAALargeText},
+	}
+
+	warnings := []ContrastWarning{}
+	for _, pair := range pairs {
+		ratio, ok := contrastRatio(pair.foreground, pair.background)
+		if !ok || ratio >= pair.required {
+			continue
+		}
+		warnings = append(warnings, ContrastWarning{
+			Pair:       pair.name,
+			Foreground: pair.foreground,
+			Background: pair.background,
+			Ratio:      math.Round(ratio*100) / 100,
+			Required:   pair.required,
+			Message:    fmt.Sprintf("contraste %.2f:1 insuffisant (AA exige %.1f:1)", ratio, pair.required),
+		})
+	}
+	return warnings
+}
+
+// handleListThemePresets retourne la bibliothèque de thèmes prédéfinis
+func handleListThemePresets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"presets": themePresets})
+}
+
+// handleApplyThemePreset remplace le thème du brouillon par un thème prédéfini
+func handleApplyThemePreset(c *gin.Context) {
+	preset := lookupThemePreset(c.Param("id"))
+	if preset == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errThemePresetNotFound.Error()})
+		return
+	}
+
+	theme := preset.Theme
+	if err := saveDraftTheme(c.GetHeader("X-Merchant-ID"), storefrontAuthor(c), &theme); err != nil {
+		log.Printf("Erreur lors de l'application du thème %s: %v", preset.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la sauvegarde"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Thème appliqué au brouillon",
+		"theme":             theme,
+		"contrast_warnings": CheckThemeContrast(&theme),
+	})
+}
+
+// handleExportTheme exporte le thème (brouillon par défaut, ?from=live ou un
+// numéro de version) sous forme de fichier JSON portable
+func handleExportTheme(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	snapshot, err := loadStorefrontSnapshot(db, merchantID, c.DefaultQuery("from", StorefrontRefDraft))
+	if err != nil {
+		respondStorefrontVersionError(c, err, "Erreur lors de l'export du thème")
+		return
+	}
+	var theme *Theme
+	if snapshot.Theme != nil {
+		if err := json.Unmarshal(snapshot.Theme, &theme); err != nil {
+			log.Printf("Thème du storefront illisible (marchand %s): %v", merchantID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Configuration du storefront illisible"})
+			return
+		}
+	}
+
+	bundle := ThemeBundle{
+		Format:     themeBundleFormat,
+		Version:    themeBundleVersion,
+		Name:       c.Query("name"),
+		ExportedAt: time.Now().UTC(),
+		Theme:      resolvedTheme(theme),
+	}
+	c.Header("Content-Disposition", `attachment; filename="theme.json"`)
+	c.JSON(http.StatusOK, bundle)
+}
+
+// handleImportTheme importe un thème exporté dans le brouillon
+func handleImportTheme(c *gin.Context) {
+	var bundle ThemeBundle
+	if err := c.ShouldBindJSON(&bundle); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if bundle.Format != themeBundleFormat {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("format de fichier inconnu (attendu: %s)", themeBundleFormat)})
+		return
+	}
+	if bundle.Version < 1 || bundle.Version > themeBundleVersion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("version de fichier non prise en charge: %d", bundle.Version)})
+		return
+	}
+	if errs := ValidateTheme(&bundle.Theme); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	if err := saveDraftTheme(c.GetHeader("X-Merchant-ID"), storefrontAuthor(c), &bundle.Theme); err != nil {
+		log.Printf("Erreur lors de l'import du thème: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la sauvegarde"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Thème importé dans le brouillon",
+		"theme":             bundle.Theme,
+		"contrast_warnings": CheckThemeContrast(&bundle.Theme),
+	})
+}
+
+// handleGetThemeCSS sert le thème publié compilé en variables CSS. L'ETag permet
+// aux navigateurs et au CDN de revalider sans retélécharger la feuille.
+func handleGetThemeCSS(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+	if merchantID == "" {
+		merchantID = storefrontMerchantID(c)
+	}
+	ref := StorefrontRefLive
+	if token := c.Query("preview_token"); token != "" {
+		var ok bool
+		if merchantID, ref, ok = checkPreviewToken(c, token); !ok {
+			return
+		}
+	}
+	if merchantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Merchant ID manquant"})
+		return
+	}
+
+	var theme *Theme
+	snapshot, err := loadStorefrontSnapshot(db, merchantID, ref)
+	switch {
+	case err == errStorefrontNotConfigured:
+		// Thème par défaut
+	case err != nil:
+		respondStorefrontVersionError(c, err, "Erreur lors de la récupération du thème")
+		return
+	case snapshot.Theme != nil:
+		if err := json.Unmarshal(snapshot.Theme, &theme); err != nil {
+			log.Printf("Thème du storefront illisible (marchand %s): %v", merchantID, err)
+		}
+	}
+
+	css := CompileThemeCSS(theme)
+	sum := sha256.Sum256([]byte(css))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("ETag", etag)
+	if ref == StorefrontRefLive {
+		c.Header("Cache-Control", "public, max-age=300, must-revalidate")
+	}
+	if match := c.GetHeader("If-None-Match"); match != "" && (match == etag || match == "*") {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "text/css; charset=utf-8", []byte(css))
+}
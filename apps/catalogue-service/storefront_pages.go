@@ -0,0 +1,665 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Types de page du storefront. L'accueil (/) reste porté par les sections de la
+// configuration ; les gabarits collection et produit s'appliquent aux URL
+// /collections/:handle et /products/:slug.
+const (
+	PageTypeHome       = "home"
+	PageTypePage       = "page"       // page de contenu (à propos, FAQ...)
+	PageTypeLanding    = "landing"    // page d'atterrissage à URL libre
+	PageTypeCollection = "collection" // gabarit des pages collection
+	PageTypeProduct    = "product"    // gabarit des fiches produit
+)
+
+// Menus proposés par défaut dans l'éditeur
+const (
+	MenuHeader = "header"
+	MenuFooter = "footer"
+)
+
+// Limites des pages et menus du storefront
+const (
+	maxStorefrontPages = 200
+	maxStorefrontMenus = 20
+	maxMenuItems       = 50
+	maxMenuDepth       = 3
+)
+
+var (
+	errPageNotFound = errors.New("page introuvable")
+	errPageExists   = errors.New("une page avec ce handle existe déjà")
+	errMenuNotFound = errors.New("menu introuvable")
+)
+
+// reservedPagePaths sont servis par les pages natives du storefront
+var reservedPagePaths = []string{"/products", "/collections", "/checkout", "/account", "/privacy", "/data-deletion", "/api"}
+
+var (
+	pageHandlePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+	pagePathPattern   = regexp.MustCompile(`^(/[a-z0-9][a-z0-9_-]*)+$`)
+)
+
+// StorefrontPage représente une page construite avec le store builder
+type StorefrontPage struct {
+	Handle   string    `json:"handle"`
+	Type     string    `json:"type"`
+	Title    string    `json:"title"`
+	Path     string    `json:"path,omitempty"`   // pages et landing pages
+	Target   string    `json:"target,omitempty"` // gabarits : handle de la collection ou slug du produit (tous si vide)
+	Sections []Section `json:"sections"`
+	SEO      *PageSEO  `json:"seo,omitempty"`
+}
+
+// PageSEO représente les métadonnées de référencement d'une page
+type PageSEO struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// StorefrontMenu représente un menu de navigation (en-tête, pied de page...)
+type StorefrontMenu struct {
+	Handle string     `json:"handle"`
+	Title  string     `json:"title"`
+	Items  []MenuItem `json:"items"`
+}
+
+// MenuItem représente un lien de menu, éventuellement avec des sous-liens
+type MenuItem struct {
+	Label string     `json:"label"`
+	URL   string     `json:"url"`
+	Items []MenuItem `json:"items,omitempty"`
+}
+
+// ResolvedPage représente la page servie pour un chemin du storefront
+type ResolvedPage struct {
+	Path     string            `json:"path"`
+	Type     string            `json:"type"`
+	Handle   string            `json:"handle,omitempty"`
+	Title    string            `json:"title,omitempty"`
+	SEO      *PageSEO          `json:"seo,omitempty"`
+	Params   map[string]string `json:"params,omitempty"` // handle de la collection ou slug du produit
+	Sections []Section         `json:"sections"`
+}
+
+// normalizePagePath ramène un chemin à sa forme canonique (/a-propos)
+func normalizePagePath(path string) string {
+	path, _, _ = strings.Cut(strings.TrimSpace(path), "?")
+	path = strings.ToLower(strings.TrimRight(path, "/"))
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// isReservedPagePath indique si un chemin est servi par une page native
+func isReservedPagePath(path string) bool {
+	for _, reserved := range reservedPagePaths {
+		if path == reserved || strings.HasPrefix(path, reserved+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePages vérifie les pages : handle et chemin uniques, un seul gabarit
+// par cible et sections conformes au registre
+func ValidatePages(pages []StorefrontPage) ValidationErrors {
+	var errs ValidationErrors
+	if len(pages) > maxStorefrontPages {
+		return append(errs, FieldError{"pages", fmt.Sprintf("au plus %d pages", maxStorefrontPages)})
+	}
+
+	handles := map[string]bool{}
+	paths := map[string]bool{}
+	templates := map[string]bool{}
+	for i, page := range pages {
+		prefix := fmt.Sprintf("pages[%d]", i)
+		switch {
+		case !pageHandlePattern.MatchString(page.Handle):
+			errs = append(errs, FieldError{prefix + ".handle", "handle invalide (minuscules, chiffres et tirets)"})
+		case handles[page.Handle]:
+			errs = append(errs, FieldError{prefix + ".handle", "handle en double"})
+		}
+		handles[page.Handle] = true
+
+		if strings.TrimSpace(page.Title) == "" {
+			errs = append(errs, FieldError{prefix + ".title", "champ requis"})
+		} else if len([]rune(page.Title)) > 120 {
+			errs = append(errs, FieldError{prefix + ".title", "au plus 120 caractères"})
+		}
+
+		switch page.Type {
+		case PageTypePage, PageTypeLanding:
+			switch {
+			case !pagePathPattern.MatchString(page.Path):
+				errs = append(errs, FieldError{prefix + ".path", "chemin invalide (ex. /a-propos)"})
+			case isReservedPagePath(page.Path):
+				errs = append(errs, FieldError{prefix + ".path", "chemin réservé par le storefront"})
+			case paths[page.Path]:
+				errs = append(errs, FieldError{prefix + ".path", "chemin déjà utilisé par une autre page"})
+			}
+			paths[page.Path] = true
+			if page.Target != "" {
+				errs = append(errs, FieldError{prefix + ".target", "réservé aux gabarits collection et produit"})
+			}
+		case PageTypeCollection, PageTypeProduct:
+			if page.Path != "" {
+				errs = append(errs, FieldError{prefix + ".path", "un gabarit est servi sous /collections ou /products"})
+			}
+			if page.Target != "" && !pageHandlePattern.MatchString(page.Target) {
+				errs = append(errs, FieldError{prefix + ".target", "handle ou slug invalide"})
+			}
+			key := page.Type + ":" + page.Target
+			if templates[key] {
+				errs = append(errs, FieldError{prefix + ".target", "un gabarit existe déjà pour cette cible"})
+			}
+			templates[key] = true
+		default:
+			errs = append(errs, FieldError{prefix + ".type", "type invalide (page, landing, collection, product)"})
+		}
+
+		if page.SEO != nil {
+			if len([]rune(page.SEO.Title)) > 70 {
+				errs = append(errs, FieldError{prefix + ".seo.title", "au plus 70 caractères"})
+			}
+			if len([]rune(page.SEO.Description)) > 320 {
+				errs = append(errs, FieldError{prefix + ".seo.description", "au plus 320 caractères"})
+			}
+		}
+
+		errs = append(errs, validateSectionList(prefix+".sections", page.Sections)...)
+	}
+	return errs
+}
+
+// ValidateMenus vérifie les menus de navigation
+func ValidateMenus(menus []StorefrontMenu) ValidationErrors {
+	var errs ValidationErrors
+	if len(menus) > maxStorefrontMenus {
+		return append(errs, FieldError{"menus", fmt.Sprintf("au plus %d menus", maxStorefrontMenus)})
+	}
+
+	handles := map[string]bool{}
+	for i, menu := range menus {
+		prefix := fmt.Sprintf("menus[%d]", i)
+		switch {
+		case !pageHandlePattern.MatchString(menu.Handle):
+			errs = append(errs, FieldError{prefix + ".handle", "handle invalide (minuscules, chiffres et tirets)"})
+		case handles[menu.Handle]:
+			errs = append(errs, FieldError{prefix + ".handle", "handle en double"})
+		}
+		handles[menu.Handle] = true
+		if len([]rune(menu.Title)) > 80 {
+			errs = append(errs, FieldError{prefix + ".title", "au plus 80 caractères"})
+		}
+		validateMenuItems(prefix+".items", menu.Items, 1, &errs)
+	}
+	return errs
+}
+
+// validateMenuItems valide les liens d'un niveau de menu et leurs sous-liens
+func validateMenuItems(prefix string, items []MenuItem, depth int, errs *ValidationErrors) {
+	if len(items) > maxMenuItems {
+		*errs = append(*errs, FieldError{prefix, fmt.Sprintf("au plus %d liens", maxMenuItems)})
+		return
+	}
+	for i, item := range items {
+		path := fmt.Sprintf("%s[%d]", prefix, i)
+		if strings.TrimSpace(item.Label) == "" {
+			*errs = append(*errs, FieldError{path + ".label", "champ requis"})
+		} else if len([]rune(item.Label)) > 80 {
+			*errs = append(*errs, FieldError{path + ".label", "au plus 80 caractères"})
+		}
+		if !isSafeURL(item.URL) {
+			*errs = append(*errs, FieldError{path + ".url", "URL invalide (http, https ou chemin relatif)"})
+		}
+		if len(item.Items) == 0 {
+			continue
+		}
+		if depth >= maxMenuDepth {
+			*errs = append(*errs, FieldError{path + ".items", fmt.Sprintf("au plus %d niveaux d'imbrication", maxMenuDepth)})
+			continue
+		}
+		validateMenuItems(path+".items", item.Items, depth+1, errs)
+	}
+}
+
+// resolveStorefrontPath retourne la page servie pour un chemin : accueil, page
+// ou landing page par chemin exact, puis gabarit collection/produit (ciblé, à
+// défaut générique)
+func resolveStorefrontPath(home []Section, pages []StorefrontPage, path string) (*ResolvedPage, error) {
+	path = normalizePagePath(path)
+	if path == "/" {
+		return &ResolvedPage{Path: path, Type: PageTypeHome, Sections: home}, nil
+	}
+
+	for _, page := range pages {
+		if (page.Type == PageTypePage || page.Type == PageTypeLanding) && page.Path == path {
+			return resolvedFromPage(path, page, nil), nil
+		}
+	}
+
+	templateTypes := map[string]string{"collections": PageTypeCollection, "products": PageTypeProduct}
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	pageType, ok := templateTypes[segments[0]]
+	if !ok || len(segments) != 2 || segments[1] == "" {
+		return nil, errPageNotFound
+	}
+	var generic *StorefrontPage
+	for i, page := range pages {
+		if page.Type != pageType {
+			continue
+		}
+		if page.Target == segments[1] {
+			return resolvedFromPage(path, page, map[string]string{"handle": segments[1]}), nil
+		}
+		if page.Target == "" {
+			generic = &pages[i]
+		}
+	}
+	if generic == nil {
+		// Sans gabarit, le storefront utilise sa page native
+		return nil, errPageNotFound
+	}
+	return resolvedFromPage(path, *generic, map[string]string{"handle": segments[1]}), nil
+}
+
+func resolvedFromPage(path string, page StorefrontPage, params map[string]string) *ResolvedPage {
+	sections := page.Sections
+	if sections == nil {
+		sections = []Section{}
+	}
+	return &ResolvedPage{
+		Path:     path,
+		Type:     page.Type,
+		Handle:   page.Handle,
+		Title:    page.Title,
+		SEO:      page.SEO,
+		Params:   params,
+		Sections: sections,
+	}
+}
+
+// updateStorefrontDraft modifie une liste du brouillon (pages ou menus) sous
+// verrou : la liste courante est décodée dans dest, puis mutate la modifie et
+// la valide avant l'écriture. part est une constante du code, jamais une saisie.
+func updateStorefrontDraft(merchantID, author, part string, dest interface{}, mutate func() error) error {
+	return withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(
+			"INSERT INTO storefront_configs (merchant_id) VALUES ($1) ON CONFLICT (merchant_id) DO NOTHING",
+			merchantID,
+		); err != nil {
+			return err
+		}
+		if err := lockStorefrontConfig(tx, merchantID); err != nil {
+			return err
+		}
+
+		var current string
+		err := tx.QueryRow(
+			fmt.Sprintf("SELECT COALESCE(draft_%[1]s, %[1]s, '[]') FROM storefront_configs WHERE merchant_id = $1", part),
+			merchantID,
+		).Scan(&current)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(current), dest); err != nil {
+			return fmt.Errorf("%s du brouillon illisibles: %w", part, err)
+		}
+
+		if err := mutate(); err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(dest)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			fmt.Sprintf("UPDATE storefront_configs SET draft_%s = $2, draft_updated_at = NOW(), draft_updated_by = $3 WHERE merchant_id = $1", part),
+			merchantID, string(encoded), author,
+		)
+		return err
+	})
+}
+
+// loadDraftPages retourne les pages du brouillon
+func loadDraftPages(merchantID string) ([]StorefrontPage, error) {
+	pages := []StorefrontPage{}
+	var raw sql.NullString
+	err := db.QueryRow(
+		"SELECT COALESCE(draft_pages, pages) FROM storefront_configs WHERE merchant_id = $1",
+		merchantID,
+	).Scan(&raw)
+	if err == sql.ErrNoRows || (err == nil && !raw.Valid) {
+		return pages, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(raw.String), &pages); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// loadDraftMenus retourne les menus du brouillon
+func loadDraftMenus(merchantID string) ([]StorefrontMenu, error) {
+	menus := []StorefrontMenu{}
+	var raw sql.NullString
+	err := db.QueryRow(
+		"SELECT COALESCE(draft_menus, menus) FROM storefront_configs WHERE merchant_id = $1",
+		merchantID,
+	).Scan(&raw)
+	if err == sql.ErrNoRows || (err == nil && !raw.Valid) {
+		return menus, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(raw.String), &menus); err != nil {
+		return nil, err
+	}
+	return menus, nil
+}
+
+// prepareStorefrontPage complète une page avant validation : chemin par défaut
+// des pages de contenu et liste de sections vide
+func prepareStorefrontPage(page *StorefrontPage) {
+	if page.Path != "" {
+		page.Path = normalizePagePath(page.Path)
+	}
+	if page.Path == "" && page.Type == PageTypePage {
+		page.Path = "/pages/" + page.Handle
+	}
+	if page.Path == "" && page.Type == PageTypeLanding {
+		page.Path = "/" + page.Handle
+	}
+	if page.Sections == nil {
+		page.Sections = []Section{}
+	}
+}
+
+// findPage retourne l'index d'une page par handle (-1 si absente)
+func findPage(pages []StorefrontPage, handle string) int {
+	for i := range pages {
+		if pages[i].Handle == handle {
+			return i
+		}
+	}
+	return -1
+}
+
+// respondStorefrontPageError traduit les erreurs de pages et menus en réponses HTTP
+func respondStorefrontPageError(c *gin.Context, err error, message string) {
+	switch err {
+	case errPageNotFound, errMenuNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errPageExists:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		respondStorefrontVersionError(c, err, message)
+	}
+}
+
+// handleListStorefrontPages liste les pages du brouillon
+func handleListStorefrontPages(c *gin.Context) {
+	pages, err := loadDraftPages(c.GetHeader("X-Merchant-ID"))
+	if err != nil {
+		respondStorefrontPageError(c, err, "Erreur lors de la récupération des pages")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pages": pages})
+}
+
+// handleGetStorefrontPage retourne une page du brouillon
+func handleGetStorefrontPage(c *gin.Context) {
+	pages, err := loadDraftPages(c.GetHeader("X-Merchant-ID"))
+	if err != nil {
+		respondStorefrontPageError(c, err, "Erreur lors de la récupération de la page")
+		return
+	}
+	i := findPage(pages, c.Param("handle"))
+	if i < 0 {
+		respondStorefrontPageError(c, errPageNotFound, "")
+		return
+	}
+
+	c.JSON(http.StatusOK, pages[i])
+}
+
+// handleCreateStorefrontPage ajoute une page au brouillon
+func handleCreateStorefrontPage(c *gin.Context) {
+	var page StorefrontPage
+	if err := c.ShouldBindJSON(&page); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	prepareStorefrontPage(&page)
+
+	var pages []StorefrontPage
+	err := updateStorefrontDraft(c.GetHeader("X-Merchant-ID"), storefrontAuthor(c), "pages", &pages, func() error {
+		if findPage(pages, page.Handle) >= 0 {
+			return errPageExists
+		}
+		pages = append(pages, page)
+		if errs := ValidatePages(pages); len(errs) > 0 {
+			return errs
+		}
+		return nil
+	})
+	if err != nil {
+		respondStorefrontPageError(c, err, "Erreur lors de la création de la page")
+		return
+	}
+
+	c.JSON(http.StatusCreated, page)
+}
+
+// handleUpdateStorefrontPage remplace une page du brouillon
+func handleUpdateStorefrontPage(c *gin.Context) {
+	var page StorefrontPage
+	if err := c.ShouldBindJSON(&page); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page.Handle = c.Param("handle")
+	prepareStorefrontPage(&page)
+
+	var pages []StorefrontPage
+	err := updateStorefrontDraft(c.GetHeader("X-Merchant-ID"), storefrontAuthor(c), "pages", &pages, func() error {
+		i := findPage(pages, page.Handle)
+		if i < 0 {
+			return errPageNotFound
+		}
+		pages[i] = page
+		if errs := ValidatePages(pages); len(errs) > 0 {
+			return errs
+		}
+		return nil
+	})
+	if err != nil {
+		respondStorefrontPageError(c, err, "Erreur lors de la mise à jour de la page")
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// handleDeleteStorefrontPage retire une page du brouillon
+func handleDeleteStorefrontPage(c *gin.Context) {
+	handle := c.Param("handle")
+
+	var pages []StorefrontPage
+	err := updateStorefrontDraft(c.GetHeader("X-Merchant-ID"), storefrontAuthor(c), "pages", &pages, func() error {
+		i := findPage(pages, handle)
+		if i < 0 {
+			return errPageNotFound
+		}
+		pages = append(pages[:i], pages[i+1:]...)
+		return nil
+	})
+	if err != nil {
+		respondStorefrontPageError(c, err, "Erreur lors de la suppression de la page")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Page supprimée"})
+}
+
+// handleListStorefrontMenus liste les menus du brouillon
+func handleListStorefrontMenus(c *gin.Context) {
+	menus, err := loadDraftMenus(c.GetHeader("X-Merchant-ID"))
+	if err != nil {
+		respondStorefrontPageError(c, err, "Erreur lors de la récupération des menus")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"menus": menus})
+}
+
+// handleSaveStorefrontMenu crée ou remplace un menu du brouillon
+func handleSaveStorefrontMenu(c *gin.Context) {
+	var menu StorefrontMenu
+	if err := c.ShouldBindJSON(&menu); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	menu.Handle = c.Param("handle")
+	if menu.Items == nil {
+		menu.Items = []MenuItem{}
+	}
+
+	var menus []StorefrontMenu
+	err := updateStorefrontDraft(c.GetHeader("X-Merchant-ID"), storefrontAuthor(c), "menus", &menus, func() error {
+		replaced := false
+		for i := range menus {
+			if menus[i].Handle == menu.Handle {
+				menus[i] = menu
+				replaced = true
+			}
+		}
+		if !replaced {
+			menus = append(menus, menu)
+		}
+		if errs := ValidateMenus(menus); len(errs) > 0 {
+			return errs
+		}
+		return nil
+	})
+	if err != nil {
+		respondStorefrontPageError(c, err, "Erreur lors de la sauvegarde du menu")
+		return
+	}
+
+	c.JSON(http.StatusOK, menu)
+}
+
+// handleDeleteStorefrontMenu retire un menu du brouillon
+func handleDeleteStorefrontMenu(c *gin.Context) {
+	handle := c.Param("handle")
+
+	var menus []StorefrontMenu
+	err := updateStorefrontDraft(c.GetHeader("X-Merchant-ID"), storefrontAuthor(c), "menus", &menus, func() error {
+		for i := range menus {
+			if menus[i].Handle == handle {
+				menus = append(menus[:i], menus[i+1:]...)
+				return nil
+			}
+		}
+		return errMenuNotFound
+	})
+	if err != nil {
+		respondStorefrontPageError(c, err, "Erreur lors de la suppression du menu")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Menu supprimé"})
+}
+
+// handleResolveStorefrontPage retourne la page publiée servie pour un chemin
+// (?path=/a-propos), avec le thème et les menus ; un lien de prévisualisation
+// (?preview_token=) sert le brouillon ou une version
+func handleResolveStorefrontPage(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+	if merchantID == "" {
+		merchantID = storefrontMerchantID(c)
+	}
+	ref := StorefrontRefLive
+	preview := false
+	if token := c.Query("preview_token"); token != "" {
+		var ok bool
+		if merchantID, ref, ok = checkPreviewToken(c, token); !ok {
+			return
+		}
+		preview = true
+	}
+	if merchantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Merchant ID manquant"})
+		return
+	}
+
+	snapshot, err := loadStorefrontSnapshot(db, merchantID, ref)
+	if err == errStorefrontNotConfigured {
+		// Sans configuration, seul l'accueil (vide) est résolu
+		snapshot, err = &StorefrontSnapshot{}, nil
+	}
+	if err != nil {
+		respondStorefrontVersionError(c, err, "Erreur lors de la récupération de la page")
+		return
+	}
+
+	var home []Section
+	var pages []StorefrontPage
+	var menus []StorefrontMenu
+	for _, part := range []struct {
+		raw  json.RawMessage
+		dest interface{}
+	}{
+		{snapshot.Sections, &home},
+		{snapshot.Pages, &pages},
+		{snapshot.Menus, &menus},
+	} {
+		if part.raw == nil {
+			continue
+		}
+		if err := json.Unmarshal(part.raw, part.dest); err != nil {
+			log.Printf("Configuration du storefront illisible (marchand %s): %v", merchantID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Configuration du storefront illisible"})
+			return
+		}
+	}
+	if home == nil {
+		home = []Section{}
+	}
+	if menus == nil {
+		menus = []StorefrontMenu{}
+	}
+
+	page, err := resolveStorefrontPath(home, pages, c.DefaultQuery("path", "/"))
+	if err != nil {
+		respondStorefrontPageError(c, err, "Erreur lors de la récupération de la page")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"page":    page,
+		"theme":   snapshot.Theme,
+		"menus":   menus,
+		"preview": preview,
+	})
+}
@@ -0,0 +1,999 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Statuts d'une version du storefront
+const (
+	StorefrontVersionScheduled = "scheduled"
+	StorefrontVersionPublished = "published"
+	StorefrontVersionCancelled = "cancelled"
+)
+
+// Références acceptées en plus d'un numéro de version
+const (
+	StorefrontRefDraft = "draft" // brouillon en cours d'édition
+	StorefrontRefLive  = "live"  // configuration publiée
+)
+
+const (
+	// defaultPreviewTTL est la durée de validité d'un lien de prévisualisation
+	defaultPreviewTTL = 24 * time.Hour
+	// maxPreviewTTL plafonne la durée demandée
+	maxPreviewTTL = 7 * 24 * time.Hour
+)
+
+var (
+	errStorefrontNotConfigured   = errors.New("aucune configuration de storefront")
+	errStorefrontVersionNotFound = errors.New("version introuvable")
+	errStorefrontVersionStatus   = errors.New("seule une version planifiée peut être annulée")
+	errInvalidStorefrontRef      = errors.New("référence de version invalide (numéro, draft ou live)")
+	errInvalidPreviewToken       = errors.New("lien de prévisualisation invalide ou expiré")
+)
+
+// StorefrontVersion représente un instantané publié (ou planifié) de la configuration
+type StorefrontVersion struct {
+	ID          string          `json:"id"`
+	MerchantID  string          `json:"merchant_id"`
+	Version     int             `json:"version"`
+	Status      string          `json:"status"`
+	Message     string          `json:"message,omitempty"`
+	Author      string          `json:"author,omitempty"`
+	ScheduledAt *time.Time      `json:"scheduled_at,omitempty"`
+	PublishedAt *time.Time      `json:"published_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Sections    json.RawMessage `json:"sections,omitempty"`
+	Theme       json.RawMessage `json:"theme,omitempty"`
+	Pages       json.RawMessage `json:"pages,omitempty"`
+	Menus       json.RawMessage `json:"menus,omitempty"`
+	// CancelledVersions liste les publications planifiées annulées par une mise
+	// en ligne immédiate ou un retour arrière
+	CancelledVersions []int `json:"cancelled_versions,omitempty"`
+}
+
+// StorefrontSnapshot représente le contenu versionné du storefront : sections de
+// l'accueil, thème, pages et menus de navigation
+type StorefrontSnapshot struct {
+	Sections json.RawMessage
+	Theme    json.RawMessage
+	Pages    json.RawMessage
+	Menus    json.RawMessage
+}
+
+// PublishRequest représente une demande de publication du brouillon
+type PublishRequest struct {
+	Message     string     `json:"message"`
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"` // publication différée
+}
+
+// StorefrontChange représente une valeur modifiée entre deux versions
+type StorefrontChange struct {
+	Path string      `json:"path"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// StorefrontDiff représente les différences entre deux versions du storefront
+type StorefrontDiff struct {
+	From             string             `json:"from"`
+	To               string             `json:"to"`
+	SectionsAdded    []string           `json:"sections_added"`
+	SectionsRemoved  []string           `json:"sections_removed"`
+	SectionsModified []string           `json:"sections_modified"`
+	Reordered        bool               `json:"reordered"`
+	PagesAdded       []string           `json:"pages_added"`
+	PagesRemoved     []string           `json:"pages_removed"`
+	PagesModified    []string           `json:"pages_modified"`
+	Changes          []StorefrontChange `json:"changes"`
+}
+
+const storefrontVersionColumns = `id, merchant_id, version, status, COALESCE(message, ''), COALESCE(author, ''),
+	scheduled_at, published_at, created_at`
+
+func scanStorefrontVersion(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*StorefrontVersion, error) {
+	var v StorefrontVersion
+	var scheduledAt, publishedAt sql.NullTime
+	dest := append([]interface{}{&v.ID, &v.MerchantID, &v.Version, &v.Status, &v.Message, &v.Author,
+		&scheduledAt, &publishedAt, &v.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if scheduledAt.Valid {
+		v.ScheduledAt = &scheduledAt.Time
+	}
+	if publishedAt.Valid {
+		v.PublishedAt = &publishedAt.Time
+	}
+	return &v, nil
+}
+
+// rawJSON convertit une colonne JSONB nullable
+func rawJSON(s sql.NullString) json.RawMessage {
+	if !s.Valid {
+		return nil
+	}
+	return json.RawMessage(s.String)
+}
+
+// jsonArg convertit un contenu JSON en paramètre SQL (NULL si absent)
+func jsonArg(raw json.RawMessage) interface{} {
+	if raw == nil {
+		return nil
+	}
+	return string(raw)
+}
+
+// loadStorefrontSnapshot retourne le contenu d'une référence : draft, live ou
+// numéro de version
+func loadStorefrontSnapshot(q queryer, merchantID, ref string) (*StorefrontSnapshot, error) {
+	var sections, theme, pages, menus sql.NullString
+	var err error
+	switch ref {
+	case StorefrontRefDraft:
+		err = q.QueryRow(
+			`SELECT COALESCE(draft_sections, sections), COALESCE(draft_theme, theme),
+			        COALESCE(draft_pages, pages), COALESCE(draft_menus, menus)
+			 FROM storefront_configs WHERE merchant_id = $1`,
+			merchantID,
+		).Scan(&sections, &theme, &pages, &menus)
+	case StorefrontRefLive:
+		err = q.QueryRow(
+			"SELECT sections, theme, pages, menus FROM storefront_configs WHERE merchant_id = $1",
+			merchantID,
+		).Scan(&sections, &theme, &pages, &menus)
+	default:
+		version, convErr := strconv.Atoi(ref)
+		if convErr != nil {
+			return nil, errInvalidStorefrontRef
+		}
+		err = q.QueryRow(
+			"SELECT sections, theme, pages, menus FROM storefront_versions WHERE merchant_id = $1 AND version = $2",
+			merchantID, version,
+		).Scan(&sections, &theme, &pages, &menus)
+		if err == sql.ErrNoRows {
+			return nil, errStorefrontVersionNotFound
+		}
+	}
+	if err == sql.ErrNoRows {
+		return nil, errStorefrontNotConfigured
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &StorefrontSnapshot{
+		Sections: rawJSON(sections),
+		Theme:    rawJSON(theme),
+		Pages:    rawJSON(pages),
+		Menus:    rawJSON(menus),
+	}, nil
+}
+
+// validateStorefrontSnapshot valide un instantané sérialisé
+func validateStorefrontSnapshot(snapshot *StorefrontSnapshot) error {
+	var sections []Section
+	var theme *Theme
+	var pages []StorefrontPage
+	var menus []StorefrontMenu
+	decoded := []struct {
+		field string
+		raw   json.RawMessage
+		dest  interface{}
+	}{
+		{"sections", snapshot.Sections, &sections},
+		{"theme", snapshot.Theme, &theme},
+		{"pages", snapshot.Pages, &pages},
+		{"menus", snapshot.Menus, &menus},
+	}
+	for _, d := range decoded {
+		if d.raw == nil {
+			continue
+		}
+		if err := json.Unmarshal(d.raw, d.dest); err != nil {
+			return ValidationErrors{{d.field, "format invalide"}}
+		}
+	}
+
+	errs := ValidateSections(sections)
+	errs = append(errs, ValidateTheme(theme)...)
+	errs = append(errs, ValidatePages(pages)...)
+	errs = append(errs, ValidateMenus(menus)...)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// createStorefrontVersion inscrit un instantané avec le numéro de version suivant
+func createStorefrontVersion(tx *sql.Tx, merchantID string, snapshot *StorefrontSnapshot, author, message string, scheduledAt *time.Time) (*StorefrontVersion, error) {
+	status := StorefrontVersionPublished
+	if scheduledAt != nil {
+		status = StorefrontVersionScheduled
+	}
+
+	// La ligne storefront_configs est verrouillée par l'appelant : la numérotation est séquentielle
+	return scanStorefrontVersion(tx.QueryRow(
+		`INSERT INTO storefront_versions (merchant_id, version, sections, theme, pages, menus, status, message, author, scheduled_at)
+		 SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9
+		 FROM storefront_versions WHERE merchant_id = $1
+		 RETURNING `+storefrontVersionColumns,
+		merchantID, jsonArg(snapshot.Sections), jsonArg(snapshot.Theme), jsonArg(snapshot.Pages), jsonArg(snapshot.Menus),
+		status, message, author, scheduledAt,
+	))
+}
+
+// applyStorefrontVersion met une version en ligne
+func applyStorefrontVersion(tx *sql.Tx, merchantID string, version int) error {
+	if _, err := tx.Exec(
+		`UPDATE storefront_configs c
+		 SET sections = COALESCE(v.sections, '[]'), theme = v.theme, pages = COALESCE(v.pages, '[]'),
+		     menus = COALESCE(v.menus, '[]'), published_version = v.version, updated_at = NOW()
+		 FROM storefront_versions v
+		 WHERE c.merchant_id = $1 AND v.merchant_id = $1 AND v.version = $2`,
+		merchantID, version,
+	); err != nil {
+		return err
+	}
+	_, err := tx.Exec(
+		`UPDATE storefront_versions SET status = 'published', published_at = NOW()
+		 WHERE merchant_id = $1 AND version = $2`,
+		merchantID, version,
+	)
+	return err
+}
+
+// cancelScheduledStorefrontVersions annule les publications planifiées antérieures
+// à une version mise en ligne : elles remettraient en ligne un contenu plus ancien.
+// Les versions annulées sont retournées pour en informer le marchand.
+func cancelScheduledStorefrontVersions(tx *sql.Tx, merchantID string, version int) ([]int, error) {
+	rows, err := tx.Query(
+		`UPDATE storefront_versions SET status = 'cancelled'
+		 WHERE merchant_id = $1 AND version < $2 AND status = 'scheduled'
+		 RETURNING version`,
+		merchantID, version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cancelled []int
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		cancelled = append(cancelled, v)
+	}
+	sort.Ints(cancelled)
+	return cancelled, rows.Err()
+}
+
+// clearStorefrontDraft réinitialise le brouillon après une mise en ligne
+func clearStorefrontDraft(tx *sql.Tx, merchantID string) error {
+	_, err := tx.Exec(
+		`UPDATE storefront_configs
+		 SET draft_sections = NULL, draft_theme = NULL, draft_pages = NULL, draft_menus = NULL,
+		     draft_updated_at = NULL, draft_updated_by = NULL
+		 WHERE merchant_id = $1`,
+		merchantID,
+	)
+	return err
+}
+
+// lockStorefrontConfig verrouille la configuration du marchand
+func lockStorefrontConfig(tx *sql.Tx, merchantID string) error {
+	var exists bool
+	err := tx.QueryRow("SELECT true FROM storefront_configs WHERE merchant_id = $1 FOR UPDATE", merchantID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return errStorefrontNotConfigured
+	}
+	return err
+}
+
+// PublishStorefront crée une version à partir du brouillon. Sans date, la version
+// est mise en ligne immédiatement, le brouillon est réinitialisé et les
+// publications planifiées en attente sont annulées (CancelledVersions) ; avec
+// une date future, elle est publiée par le job de publication planifiée.
+func PublishStorefront(merchantID, author string, req *PublishRequest) (*StorefrontVersion, error) {
+	var version *StorefrontVersion
+	var cancelled []int
+	err := withTx(func(tx *sql.Tx) error {
+		if err := lockStorefrontConfig(tx, merchantID); err != nil {
+			return err
+		}
+		snapshot, err := loadStorefrontSnapshot(tx, merchantID, StorefrontRefDraft)
+		if err != nil {
+			return err
+		}
+		// Un brouillon enregistré avant l'ajout d'un contrôle ne doit pas être mis en ligne
+		if err := validateStorefrontSnapshot(snapshot); err != nil {
+			return err
+		}
+
+		scheduledAt := req.ScheduledAt
+		if scheduledAt != nil && !scheduledAt.After(time.Now()) {
+			scheduledAt = nil
+		}
+		version, err = createStorefrontVersion(tx, merchantID, snapshot, author, req.Message, scheduledAt)
+		if err != nil {
+			return err
+		}
+		if scheduledAt != nil {
+			return nil
+		}
+
+		if err := applyStorefrontVersion(tx, merchantID, version.Version); err != nil {
+			return err
+		}
+		if cancelled, err = cancelScheduledStorefrontVersions(tx, merchantID, version.Version); err != nil {
+			return err
+		}
+		return clearStorefrontDraft(tx, merchantID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	version, err = getStorefrontVersion(db, merchantID, version.Version)
+	if err != nil {
+		return nil, err
+	}
+	version.CancelledVersions = cancelled
+	return version, nil
+}
+
+// RollbackStorefront remet en ligne le contenu d'une version antérieure sous la
+// forme d'une nouvelle version : l'historique reste linéaire. Les publications
+// planifiées en attente sont annulées (CancelledVersions).
+func RollbackStorefront(merchantID, author string, target int) (*StorefrontVersion, error) {
+	var version *StorefrontVersion
+	var cancelled []int
+	err := withTx(func(tx *sql.Tx) error {
+		if err := lockStorefrontConfig(tx, merchantID); err != nil {
+			return err
+		}
+		snapshot, err := loadStorefrontSnapshot(tx, merchantID, strconv.Itoa(target))
+		if err != nil {
+			return err
+		}
+
+		version, err = createStorefrontVersion(tx, merchantID, snapshot, author,
+			fmt.Sprintf("Retour à la version %d", target), nil)
+		if err != nil {
+			return err
+		}
+		if err := applyStorefrontVersion(tx, merchantID, version.Version); err != nil {
+			return err
+		}
+		if cancelled, err = cancelScheduledStorefrontVersions(tx, merchantID, version.Version); err != nil {
+			return err
+		}
+		return clearStorefrontDraft(tx, merchantID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	version, err = getStorefrontVersion(db, merchantID, version.Version)
+	if err != nil {
+		return nil, err
+	}
+	version.CancelledVersions = cancelled
+	return version, nil
+}
+
+// CancelScheduledStorefrontVersion annule une publication planifiée
+func CancelScheduledStorefrontVersion(merchantID string, version int) error {
+	result, err := db.Exec(
+		`UPDATE storefront_versions SET status = 'cancelled'
+		 WHERE merchant_id = $1 AND version = $2 AND status = 'scheduled'`,
+		merchantID, version,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+	if _, err := getStorefrontVersion(db, merchantID, version); err != nil {
+		return err
+	}
+	return errStorefrontVersionStatus
+}
+
+// getStorefrontVersion retourne une version avec son contenu
+func getStorefrontVersion(q queryer, merchantID string, version int) (*StorefrontVersion, error) {
+	var sections, theme, pages, menus sql.NullString
+	v, err := scanStorefrontVersion(q.QueryRow(
+		"SELECT "+storefrontVersionColumns+", sections, theme, pages, menus FROM storefront_versions WHERE merchant_id = $1 AND version = $2",
+		merchantID, version,
+	), &sections, &theme, &pages, &menus)
+	if err == sql.ErrNoRows {
+		return nil, errStorefrontVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.Sections = rawJSON(sections)
+	v.Theme = rawJSON(theme)
+	v.Pages = rawJSON(pages)
+	v.Menus = rawJSON(menus)
+	return v, nil
+}
+
+// PublishDueStorefrontVersions met en ligne les versions planifiées arrivées à
+// échéance, marchand par marchand. La configuration du marchand est verrouillée
+// avant la comparaison avec la version en ligne, comme pour une publication
+// immédiate ; un marchand en cours de publication (SKIP LOCKED) est repris au
+// prochain passage. La dernière version échue l'emporte : les précédentes, comme
+// celles antérieures à la version en ligne, sont annulées.
+func PublishDueStorefrontVersions() (int, error) {
+	rows, err := db.Query(
+		`SELECT DISTINCT merchant_id FROM storefront_versions
+		 WHERE status = 'scheduled' AND scheduled_at <= NOW()`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var merchantIDs []string
+	for rows.Next() {
+		var merchantID string
+		if err := rows.Scan(&merchantID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		merchantIDs = append(merchantIDs, merchantID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, merchantID := range merchantIDs {
+		applied, err := publishDueStorefrontVersion(merchantID)
+		if err != nil {
+			return published, err
+		}
+		if applied {
+			published++
+		}
+	}
+	return published, nil
+}
+
+// publishDueStorefrontVersion met en ligne la dernière version échue du marchand
+func publishDueStorefrontVersion(merchantID string) (bool, error) {
+	applied := false
+	err := withTx(func(tx *sql.Tx) error {
+		var publishedVersion int
+		err := tx.QueryRow(
+			`SELECT COALESCE(published_version, 0) FROM storefront_configs
+			 WHERE merchant_id = $1 FOR UPDATE SKIP LOCKED`,
+			merchantID,
+		).Scan(&publishedVersion)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// La ligne de la version est aussi verrouillée : une annulation manuelle
+		// concurrente l'emporte ou attend
+		var version int
+		err = tx.QueryRow(
+			`SELECT version FROM storefront_versions
+			 WHERE merchant_id = $1 AND status = 'scheduled' AND scheduled_at <= NOW()
+			 ORDER BY version DESC LIMIT 1
+			 FOR UPDATE`,
+			merchantID,
+		).Scan(&version)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if version > publishedVersion {
+			if err := applyStorefrontVersion(tx, merchantID, version); err != nil {
+				return err
+			}
+			applied = true
+		} else {
+			// Une version plus récente a été mise en ligne entre-temps
+			version = publishedVersion + 1
+		}
+		_, err = cancelScheduledStorefrontVersions(tx, merchantID, version)
+		return err
+	})
+	return applied, err
+}
+
+// StartStorefrontPublisher lance la publication périodique des versions planifiées
+func StartStorefrontPublisher(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			published, err := PublishDueStorefrontVersions()
+			if err != nil {
+				log.Printf("Erreur lors de la publication planifiée du storefront: %v", err)
+				continue
+			}
+			if published > 0 {
+				log.Printf("%d version(s) de storefront publiée(s)", published)
+			}
+		}
+	}()
+}
+
+// DiffStorefront compare deux références (numéro de version, draft ou live)
+func DiffStorefront(merchantID, from, to string) (*StorefrontDiff, error) {
+	fromSnapshot, err := loadStorefrontSnapshot(db, merchantID, from)
+	if err != nil {
+		return nil, err
+	}
+	toSnapshot, err := loadStorefrontSnapshot(db, merchantID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &StorefrontDiff{
+		From:             from,
+		To:               to,
+		SectionsAdded:    []string{},
+		SectionsRemoved:  []string{},
+		SectionsModified: []string{},
+		PagesAdded:       []string{},
+		PagesRemoved:     []string{},
+		PagesModified:    []string{},
+		Changes:          []StorefrontChange{},
+	}
+
+	// Les sections sont comparées par identifiant, indépendamment de leur position
+	before, beforeOrder := itemsByKey(fromSnapshot.Sections, "id")
+	after, afterOrder := itemsByKey(toSnapshot.Sections, "id")
+	diff.SectionsAdded, diff.SectionsRemoved, diff.SectionsModified = compareItems(before, beforeOrder, after, afterOrder)
+	diff.Reordered = !reflect.DeepEqual(commonOrder(beforeOrder, after), commonOrder(afterOrder, before))
+
+	// Les pages sont comparées par handle
+	pagesBefore, pagesBeforeOrder := itemsByKey(fromSnapshot.Pages, "handle")
+	pagesAfter, pagesAfterOrder := itemsByKey(toSnapshot.Pages, "handle")
+	diff.PagesAdded, diff.PagesRemoved, diff.PagesModified = compareItems(pagesBefore, pagesBeforeOrder, pagesAfter, pagesAfterOrder)
+	menusBefore, _ := itemsByKey(fromSnapshot.Menus, "handle")
+	menusAfter, _ := itemsByKey(toSnapshot.Menus, "handle")
+
+	old := map[string]interface{}{}
+	current := map[string]interface{}{}
+	flattenJSON("sections", toInterfaceMap(before), old)
+	flattenJSON("sections", toInterfaceMap(after), current)
+	flattenJSON("theme", decodeJSON(fromSnapshot.Theme), old)
+	flattenJSON("theme", decodeJSON(toSnapshot.Theme), current)
+	flattenJSON("pages", toInterfaceMap(pagesBefore), old)
+	flattenJSON("pages", toInterfaceMap(pagesAfter), current)
+	flattenJSON("menus", toInterfaceMap(menusBefore), old)
+	flattenJSON("menus", toInterfaceMap(menusAfter), current)
+
+	for path, value := range old {
+		if next, ok := current[path]; !ok || !reflect.DeepEqual(value, next) {
+			diff.Changes = append(diff.Changes, StorefrontChange{Path: path, From: value, To: current[path]})
+		}
+	}
+	for path, value := range current {
+		if _, ok := old[path]; !ok {
+			diff.Changes = append(diff.Changes, StorefrontChange{Path: path, To: value})
+		}
+	}
+	sort.Slice(diff.Changes, func(i, j int) bool { return diff.Changes[i].Path < diff.Changes[j].Path })
+
+	return diff, nil
+}
+
+// decodeJSON décode une valeur JSON quelconque (nil si absente ou invalide)
+func decodeJSON(raw json.RawMessage) interface{} {
+	if raw == nil {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil
+	}
+	return v
+}
+
+// itemsByKey indexe une liste d'objets par clé (id des sections, handle des
+// pages et menus ; la position sert à défaut) et retourne leur ordre
+func itemsByKey(raw json.RawMessage, key string) (map[string]interface{}, []string) {
+	byKey := map[string]interface{}{}
+	order := []string{}
+	list, _ := decodeJSON(raw).([]interface{})
+	for i, item := range list {
+		id := strconv.Itoa(i)
+		if object, ok := item.(map[string]interface{}); ok {
+			if s, ok := object[key].(string); ok && s != "" {
+				id = s
+			}
+		}
+		byKey[id] = item
+		order = append(order, id)
+	}
+	return byKey, order
+}
+
+// compareItems liste les éléments ajoutés, supprimés et modifiés entre deux versions
+func compareItems(before map[string]interface{}, beforeOrder []string, after map[string]interface{}, afterOrder []string) (added, removed, modified []string) {
+	added, removed, modified = []string{}, []string{}, []string{}
+	for _, id := range beforeOrder {
+		if _, ok := after[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	for _, id := range afterOrder {
+		previous, ok := before[id]
+		if !ok {
+			added = append(added, id)
+		} else if !reflect.DeepEqual(previous, after[id]) {
+			modified = append(modified, id)
+		}
+	}
+	return added, removed, modified
+}
+
+// commonOrder retourne l'ordre des sections présentes dans les deux versions
+func commonOrder(order []string, other map[string]interface{}) []string {
+	common := []string{}
+	for _, id := range order {
+		if _, ok := other[id]; ok {
+			common = append(common, id)
+		}
+	}
+	return common
+}
+
+// toInterfaceMap évite un chemin vide (« sections », « pages ») lorsqu'une version n'a aucun élément
+func toInterfaceMap(m map[string]interface{}) interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// flattenJSON aplatit une valeur JSON en chemins pointés (theme.colors.primary)
+func flattenJSON(prefix string, v interface{}, out map[string]interface{}) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if len(value) == 0 {
+			out[prefix] = value
+		}
+		for key, child := range value {
+			flattenJSON(prefix+"."+key, child, out)
+		}
+	case []interface{}:
+		if len(value) == 0 {
+			out[prefix] = value
+		}
+		for i, child := range value {
+			flattenJSON(fmt.Sprintf("%s[%d]", prefix, i), child, out)
+		}
+	case nil:
+	default:
+		out[prefix] = value
+	}
+}
+
+// previewSecret retourne la clé de signature des liens de prévisualisation
+func previewSecret() []byte {
+	return []byte(getEnv("STOREFRONT_PREVIEW_SECRET", "preview-secret-change-in-production"))
+}
+
+// signPreviewToken signe un lien de prévisualisation : marchand, référence
+// (draft ou numéro de version) et date d'expiration
+func signPreviewToken(merchantID, ref string, expiresAt time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString(
+		[]byte(merchantID + "|" + ref + "|" + strconv.FormatInt(expiresAt.Unix(), 10)),
+	)
+	mac := hmac.New(sha256.New, previewSecret())
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyPreviewToken vérifie la signature et l'expiration d'un lien de prévisualisation
+func verifyPreviewToken(token string) (merchantID, ref string, err error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", "", errInvalidPreviewToken
+	}
+	given, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return "", "", errInvalidPreviewToken
+	}
+	mac := hmac.New(sha256.New, previewSecret())
+	mac.Write([]byte(payload))
+	if !hmac.Equal(given, mac.Sum(nil)) {
+		return "", "", errInvalidPreviewToken
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", "", errInvalidPreviewToken
+	}
+	parts := strings.Split(string(decoded), "|")
+	if len(parts) != 3 {
+		return "", "", errInvalidPreviewToken
+	}
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return "", "", errInvalidPreviewToken
+	}
+	return parts[0], parts[1], nil
+}
+
+// respondStorefrontVersionError traduit les erreurs de versionnage en réponses HTTP
+func respondStorefrontVersionError(c *gin.Context, err error, message string) {
+	var invalid ValidationErrors
+	if errors.As(err, &invalid) {
+		respondValidationErrors(c, invalid)
+		return
+	}
+	switch err {
+	case errStorefrontNotConfigured, errStorefrontVersionNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errStorefrontVersionStatus:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errInvalidStorefrontRef:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// storefrontAuthor identifie l'auteur d'une modification
+func storefrontAuthor(c *gin.Context) string {
+	if userID := c.GetHeader("X-User-ID"); userID != "" {
+		return userID
+	}
+	return c.GetHeader("X-Merchant-ID")
+}
+
+// handleGetStorefrontDraft retourne le brouillon en cours d'édition
+func handleGetStorefrontDraft(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	var sections, theme, pages, menus sql.NullString
+	var draftSections, draftTheme, draftPages, draftMenus sql.NullString
+	var publishedVersion sql.NullInt64
+	var draftUpdatedAt sql.NullTime
+	var draftUpdatedBy sql.NullString
+	err := db.QueryRow(
+		`SELECT sections, theme, pages, menus, draft_sections, draft_theme, draft_pages, draft_menus,
+		        published_version, draft_updated_at, draft_updated_by
+		 FROM storefront_configs WHERE merchant_id = $1`,
+		merchantID,
+	).Scan(&sections, &theme, &pages, &menus, &draftSections, &draftTheme, &draftPages, &draftMenus,
+		&publishedVersion, &draftUpdatedAt, &draftUpdatedBy)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, gin.H{
+			"sections":    []Section{},
+			"theme":       nil,
+			"pages":       []StorefrontPage{},
+			"menus":       []StorefrontMenu{},
+			"has_changes": false,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération du brouillon"})
+		return
+	}
+
+	// Chaque partie du brouillon vaut la version publiée tant qu'elle n'a pas été modifiée
+	response := gin.H{
+		"has_changes": draftSections.Valid || draftTheme.Valid || draftPages.Valid || draftMenus.Valid,
+	}
+	parts := []struct {
+		key         string
+		live, draft sql.NullString
+	}{
+		{"sections", sections, draftSections},
+		{"theme", theme, draftTheme},
+		{"pages", pages, draftPages},
+		{"menus", menus, draftMenus},
+	}
+	for _, part := range parts {
+		response[part.key] = rawJSON(part.live)
+		if part.draft.Valid {
+			response[part.key] = rawJSON(part.draft)
+		}
+	}
+	if publishedVersion.Valid {
+		response["published_version"] = publishedVersion.Int64
+	}
+	if draftUpdatedAt.Valid {
+		response["updated_at"] = draftUpdatedAt.Time
+		response["updated_by"] = draftUpdatedBy.String
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handlePublishStorefront publie le brouillon, immédiatement ou à une date donnée
+func handlePublishStorefront(c *gin.Context) {
+	var req PublishRequest
+	// Le corps est facultatif
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	version, err := PublishStorefront(c.GetHeader("X-Merchant-ID"), storefrontAuthor(c), &req)
+	if err != nil {
+		respondStorefrontVersionError(c, err, "Erreur lors de la publication")
+		return
+	}
+
+	status := http.StatusOK
+	if version.Status == StorefrontVersionScheduled {
+		status = http.StatusAccepted
+	}
+	c.JSON(status, version)
+}
+
+// handleListStorefrontVersions liste l'historique des versions (sans leur contenu)
+func handleListStorefrontVersions(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	rows, err := db.Query(
+		"SELECT "+storefrontVersionColumns+` FROM storefront_versions
+		 WHERE merchant_id = $1 ORDER BY version DESC LIMIT $2`,
+		c.GetHeader("X-Merchant-ID"), limit,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des versions"})
+		return
+	}
+	defer rows.Close()
+
+	versions := []*StorefrontVersion{}
+	for rows.Next() {
+		version, err := scanStorefrontVersion(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des versions"})
+			return
+		}
+		versions = append(versions, version)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// parseVersionParam lit le numéro de version de l'URL
+func parseVersionParam(c *gin.Context) (int, bool) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "numéro de version invalide"})
+		return 0, false
+	}
+	return version, true
+}
+
+// handleGetStorefrontVersion retourne une version avec son contenu
+func handleGetStorefrontVersion(c *gin.Context) {
+	version, ok := parseVersionParam(c)
+	if !ok {
+		return
+	}
+
+	v, err := getStorefrontVersion(db, c.GetHeader("X-Merchant-ID"), version)
+	if err != nil {
+		respondStorefrontVersionError(c, err, "Erreur lors de la récupération de la version")
+		return
+	}
+
+	c.JSON(http.StatusOK, v)
+}
+
+// handleDiffStorefrontVersions compare deux versions (?from=3&to=draft)
+func handleDiffStorefrontVersions(c *gin.Context) {
+	from := c.DefaultQuery("from", StorefrontRefLive)
+	to := c.DefaultQuery("to", StorefrontRefDraft)
+
+	diff, err := DiffStorefront(c.GetHeader("X-Merchant-ID"), from, to)
+	if err != nil {
+		respondStorefrontVersionError(c, err, "Erreur lors de la comparaison des versions")
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// handleRollbackStorefront remet en ligne une version antérieure
+func handleRollbackStorefront(c *gin.Context) {
+	version, ok := parseVersionParam(c)
+	if !ok {
+		return
+	}
+
+	v, err := RollbackStorefront(c.GetHeader("X-Merchant-ID"), storefrontAuthor(c), version)
+	if err != nil {
+		respondStorefrontVersionError(c, err, "Erreur lors du retour à la version")
+		return
+	}
+
+	c.JSON(http.StatusOK, v)
+}
+
+// handleCancelStorefrontSchedule annule une publication planifiée
+func handleCancelStorefrontSchedule(c *gin.Context) {
+	version, ok := parseVersionParam(c)
+	if !ok {
+		return
+	}
+
+	if err := CancelScheduledStorefrontVersion(c.GetHeader("X-Merchant-ID"), version); err != nil {
+		respondStorefrontVersionError(c, err, "Erreur lors de l'annulation de la publication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Publication planifiée annulée"})
+}
+
+// handleCreatePreviewToken génère un lien signé pour prévisualiser le brouillon
+// (ou une version) sur le storefront
+func handleCreatePreviewToken(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+
+	var req struct {
+		Version          *int `json:"version,omitempty"` // brouillon si absent
+		ExpiresInMinutes int  `json:"expires_in_minutes"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ref := StorefrontRefDraft
+	if req.Version != nil {
+		if _, err := getStorefrontVersion(db, merchantID, *req.Version); err != nil {
+			respondStorefrontVersionError(c, err, "Erreur lors de la création du lien de prévisualisation")
+			return
+		}
+		ref = strconv.Itoa(*req.Version)
+	}
+
+	ttl := defaultPreviewTTL
+	if req.ExpiresInMinutes > 0 {
+		ttl = time.Duration(req.ExpiresInMinutes) * time.Minute
+	}
+	if ttl > maxPreviewTTL {
+		ttl = maxPreviewTTL
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":      signPreviewToken(merchantID, ref, expiresAt),
+		"expires_at": expiresAt,
+	})
+}
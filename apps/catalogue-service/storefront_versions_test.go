@@ -0,0 +1,161 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// storefrontVersionStatus retourne le statut d'une version du marchand
+func storefrontVersionStatus(t *testing.T, merchantID string, version int) string {
+	t.Helper()
+	v, err := getStorefrontVersion(db, merchantID, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v.Status
+}
+
+func publishedStorefrontVersion(t *testing.T, merchantID string) int {
+	t.Helper()
+	var version int
+	if err := db.QueryRow("SELECT published_version FROM storefront_configs WHERE merchant_id = $1", merchantID).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestImmediatePublishCancelsPendingSchedules(t *testing.T) {
+	openTestDB(t)
+	merchantID := testMerchantID(t)
+	if _, err := db.Exec("INSERT INTO storefront_configs (merchant_id) VALUES ($1)", merchantID); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+
+	scheduled, err := PublishStorefront(merchantID, "test", &PublishRequest{ScheduledAt: &later})
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, err := PublishStorefront(merchantID, "test", &PublishRequest{Message: "Correction"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := storefrontVersionStatus(t, merchantID, scheduled.Version); status != StorefrontVersionCancelled {
+		t.Errorf("version planifiée %s après une publication immédiate, attendu %s", status, StorefrontVersionCancelled)
+	}
+	if len(live.CancelledVersions) != 1 || live.CancelledVersions[0] != scheduled.Version {
+		t.Errorf("versions annulées signalées %v, attendu [%d]", live.CancelledVersions, scheduled.Version)
+	}
+
+	scheduled, err = PublishStorefront(merchantID, "test", &PublishRequest{ScheduledAt: &later})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollback, err := RollbackStorefront(merchantID, "test", live.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := storefrontVersionStatus(t, merchantID, scheduled.Version); status != StorefrontVersionCancelled {
+		t.Errorf("version planifiée %s après un retour arrière, attendu %s", status, StorefrontVersionCancelled)
+	}
+	if len(rollback.CancelledVersions) != 1 || rollback.CancelledVersions[0] != scheduled.Version {
+		t.Errorf("versions annulées signalées %v, attendu [%d]", rollback.CancelledVersions, scheduled.Version)
+	}
+	if version := publishedStorefrontVersion(t, merchantID); version != rollback.Version {
+		t.Errorf("version en ligne %d, attendu %d", version, rollback.Version)
+	}
+}
+
+func TestPublisherSkipsSchedulesOlderThanLiveVersion(t *testing.T) {
+	openTestDB(t)
+	merchantID := testMerchantID(t)
+	if _, err := db.Exec("INSERT INTO storefront_configs (merchant_id) VALUES ($1)", merchantID); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+
+	older, err := PublishStorefront(merchantID, "test", &PublishRequest{ScheduledAt: &later})
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, err := PublishStorefront(merchantID, "test", &PublishRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newer, err := PublishStorefront(merchantID, "test", &PublishRequest{ScheduledAt: &later})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Une version planifiée restée en attente malgré la publication plus récente
+	// (publiée par une instance concurrente), puis toutes deux arrivées à échéance
+	if _, err := db.Exec(
+		`UPDATE storefront_versions SET status = 'scheduled', scheduled_at = NOW() - INTERVAL '1 minute'
+		 WHERE merchant_id = $1 AND version IN ($2, $3)`,
+		merchantID, older.Version, newer.Version,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	published, err := PublishDueStorefrontVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published != 1 {
+		t.Errorf("%d versions publiées, attendu 1", published)
+	}
+	if status := storefrontVersionStatus(t, merchantID, older.Version); status != StorefrontVersionCancelled {
+		t.Errorf("version %d antérieure à la version %d en ligne : %s, attendu %s", older.Version, live.Version, status, StorefrontVersionCancelled)
+	}
+	if version := publishedStorefrontVersion(t, merchantID); version != newer.Version {
+		t.Errorf("version en ligne %d, attendu %d", version, newer.Version)
+	}
+}
+
+func TestPublisherWaitsForConcurrentPublish(t *testing.T) {
+	openTestDB(t)
+	merchantID := testMerchantID(t)
+	if _, err := db.Exec("INSERT INTO storefront_configs (merchant_id) VALUES ($1)", merchantID); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	scheduled, err := PublishStorefront(merchantID, "test", &PublishRequest{ScheduledAt: &later})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(
+		"UPDATE storefront_versions SET scheduled_at = NOW() - INTERVAL '1 minute' WHERE merchant_id = $1 AND version = $2",
+		merchantID, scheduled.Version,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// Une publication immédiate en cours tient le verrou de la configuration
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := lockStorefrontConfig(tx, merchantID); err != nil {
+		t.Fatal(err)
+	}
+
+	published, err := PublishDueStorefrontVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published != 0 {
+		t.Errorf("%d versions publiées pendant une publication concurrente, attendu 0", published)
+	}
+	if status := storefrontVersionStatus(t, merchantID, scheduled.Version); status != StorefrontVersionScheduled {
+		t.Errorf("version %s, attendu %s jusqu'au prochain passage", status, StorefrontVersionScheduled)
+	}
+	tx.Rollback()
+
+	if published, err = PublishDueStorefrontVersions(); err != nil {
+		t.Fatal(err)
+	}
+	if published != 1 || publishedStorefrontVersion(t, merchantID) != scheduled.Version {
+		t.Errorf("version %d non publiée une fois le verrou libéré", scheduled.Version)
+	}
+}
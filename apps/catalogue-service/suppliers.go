@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// errSupplierNotFound est retournée pour un fournisseur inconnu ou d'un autre marchand
+var errSupplierNotFound = errors.New("fournisseur introuvable")
+
+// Supplier représente un fournisseur auprès duquel le marchand se réapprovisionne
+type Supplier struct {
+	ID           string    `json:"id"`
+	MerchantID   string    `json:"merchant_id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email,omitempty"`
+	Phone        string    `json:"phone,omitempty"`
+	LeadTimeDays int       `json:"lead_time_days"` // délai de livraison habituel
+	Notes        string    `json:"notes,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// SupplierRequest représente une demande de création ou de mise à jour de fournisseur
+type SupplierRequest struct {
+	Name         string `json:"name" binding:"required"`
+	Email        string `json:"email" binding:"omitempty,email"`
+	Phone        string `json:"phone"`
+	LeadTimeDays int    `json:"lead_time_days" binding:"min=0"`
+	Notes        string `json:"notes"`
+}
+
+const supplierColumns = `id, merchant_id, name, COALESCE(email, ''), COALESCE(phone, ''), lead_time_days,
+	COALESCE(notes, ''), created_at, updated_at`
+
+func scanSupplier(row interface{ Scan(...interface{}) error }) (*Supplier, error) {
+	var s Supplier
+	err := row.Scan(&s.ID, &s.MerchantID, &s.Name, &s.Email, &s.Phone, &s.LeadTimeDays,
+		&s.Notes, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// checkSupplier vérifie qu'un fournisseur appartient au marchand
+func checkSupplier(q queryer, merchantID, supplierID string) error {
+	var exists bool
+	if err := q.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM suppliers WHERE id = $1 AND merchant_id = $2)",
+		supplierID, merchantID,
+	).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errSupplierNotFound
+	}
+	return nil
+}
+
+// isForeignKeyViolation indique si l'erreur provient d'une contrainte de clé étrangère
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// handleListSuppliers liste les fournisseurs du marchand
+func handleListSuppliers(c *gin.Context) {
+	rows, err := db.Query(
+		"SELECT "+supplierColumns+" FROM suppliers WHERE merchant_id = $1 ORDER BY name",
+		c.GetHeader("X-Merchant-ID"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des fournisseurs"})
+		return
+	}
+	defer rows.Close()
+
+	suppliers := []*Supplier{}
+	for rows.Next() {
+		supplier, err := scanSupplier(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des fournisseurs"})
+			return
+		}
+		suppliers = append(suppliers, supplier)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suppliers": suppliers})
+}
+
+// handleSaveSupplier crée un fournisseur (POST) ou le met à jour (PUT /suppliers/:id)
+func handleSaveSupplier(c *gin.Context) {
+	merchantID := c.GetHeader("X-Merchant-ID")
+	supplierID := c.Param("id")
+
+	var req SupplierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name requis"})
+		return
+	}
+
+	var supplier *Supplier
+	var err error
+	if supplierID == "" {
+		supplier, err = scanSupplier(db.QueryRow(
+			`INSERT INTO suppliers (merchant_id, name, email, phone, lead_time_days, notes)
+			 VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, NULLIF($6, ''))
+			 RETURNING `+supplierColumns,
+			merchantID, req.Name, req.Email, req.Phone, req.LeadTimeDays, req.Notes,
+		))
+	} else {
+		supplier, err = scanSupplier(db.QueryRow(
+			`UPDATE suppliers
+			 SET name = $1, email = NULLIF($2, ''), phone = NULLIF($3, ''), lead_time_days = $4,
+			     notes = NULLIF($5, ''), updated_at = CURRENT_TIMESTAMP
+			 WHERE id = $6 AND merchant_id = $7
+			 RETURNING `+supplierColumns,
+			req.Name, req.Email, req.Phone, req.LeadTimeDays, req.Notes, supplierID, merchantID,
+		))
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Fournisseur non trouvé"})
+		return
+	}
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Un fournisseur porte déjà ce nom"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement du fournisseur"})
+		return
+	}
+
+	status := http.StatusOK
+	if supplierID == "" {
+		status = http.StatusCreated
+	}
+	c.JSON(status, supplier)
+}
+
+// handleDeleteSupplier supprime un fournisseur sans bon de commande
+func handleDeleteSupplier(c *gin.Context) {
+	result, err := db.Exec(
+		"DELETE FROM suppliers WHERE id = $1 AND merchant_id = $2",
+		c.Param("id"), c.GetHeader("X-Merchant-ID"),
+	)
+	if isForeignKeyViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ce fournisseur a des bons de commande"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la suppression du fournisseur"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Fournisseur non trouvé"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Fournisseur supprimé"})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// migrationsDir contient les migrations appliquées à la base de test
+const migrationsDir = "../../shared/database_migrations/catalogue-service"
+
+// openTestDB branche db sur la base CATALOGUE_TEST_DATABASE_URL, dans un schéma
+// propre au test où toutes les migrations sont appliquées. Sans base
+// configurée, le test est ignoré.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	url := os.Getenv("CATALOGUE_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("CATALOGUE_TEST_DATABASE_URL non définie")
+	}
+
+	admin, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("connexion à la base de test: %v", err)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatalf("création du schéma de test: %v", err)
+	}
+
+	separator := "?"
+	if strings.Contains(url, "?") {
+		separator = "&"
+	}
+	conn, err := sql.Open("postgres", url+separator+"search_path="+schema+",public")
+	if err != nil {
+		t.Fatalf("connexion au schéma de test: %v", err)
+	}
+
+	previous := db
+	db = conn
+	t.Cleanup(func() {
+		db = previous
+		conn.Close()
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	files, err := filepath.Glob(filepath.Join(migrationsDir, "*.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(migration)); err != nil {
+			t.Fatalf("migration %s: %v", filepath.Base(file), err)
+		}
+	}
+}
+
+// createTestProduct crée un produit et une variante pour le marchand et
+// retourne leurs identifiants
+func createTestProduct(t *testing.T, merchantID string) (productID, variantID string) {
+	t.Helper()
+	sku := fmt.Sprintf("TEST-%d", time.Now().UnixNano())
+	if err := db.QueryRow(
+		"INSERT INTO products (merchant_id, name, sku, price) VALUES ($1, 'Produit de test', $2, 10) RETURNING id",
+		merchantID, sku,
+	).Scan(&productID); err != nil {
+		t.Fatalf("création du produit: %v", err)
+	}
+	if err := db.QueryRow(
+		"INSERT INTO product_variants (product_id, name, sku) VALUES ($1, 'Variante de test', $2) RETURNING id",
+		productID, sku+"-V",
+	).Scan(&variantID); err != nil {
+		t.Fatalf("création de la variante: %v", err)
+	}
+	return productID, variantID
+}
+
+// testMerchantID retourne un identifiant de marchand propre au test
+func testMerchantID(t *testing.T) string {
+	t.Helper()
+	var id string
+	if err := db.QueryRow("SELECT gen_random_uuid()::text").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
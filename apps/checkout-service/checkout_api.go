@@ -1,11 +1,5 @@
 package main
 
-import (
-	"net/http"
-
-	"github.com/gin-gonic/gin"
-)
-
 // Cart représente un panier d'achat
 type Cart struct {
 	ID        string    `json:"id"`
@@ -20,6 +14,7 @@ type Cart struct {
 // CartItem représente un article dans le panier
 type CartItem struct {
 	ProductID string  `json:"product_id"`
+	VariantID *string `json:"variant_id,omitempty"`
 	Quantity  int     `json:"quantity"`
 	Price     float64 `json:"price"`
 	Subtotal  float64 `json:"subtotal"`
@@ -29,7 +24,8 @@ type CartItem struct {
 type CheckoutRequest struct {
 	CartID         string  `json:"cart_id" binding:"required"`
 	PaymentMethod  string  `json:"payment_method" binding:"required"`
-	ShippingAddress Address `json:"shipping_address" binding:"required"`
+	// ShippingAddress n'est requise que si une ligne du panier est expédiée
+	ShippingAddress *Address `json:"shipping_address,omitempty"`
 	BillingAddress  Address `json:"billing_address" binding:"required"`
 	DiscountCode   *string `json:"discount_code,omitempty"`
 }
@@ -49,6 +45,7 @@ type CheckoutResponse struct {
 	Status      string `json:"status"`
 	PaymentIntentID string `json:"payment_intent_id,omitempty"`
 	ClientSecret string `json:"client_secret,omitempty"`
+	Items       []OrderItem `json:"items,omitempty"` // lignes avec leur mode d'exécution
 }
 
 // Les fonctions GetCart, AddToCart, RemoveFromCart sont maintenant dans database.go
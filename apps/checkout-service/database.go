@@ -51,6 +51,7 @@ type Order struct {
 	BillingAddress  json.RawMessage `json:"billing_address" db:"billing_address"`
 	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time       `json:"updated_at" db:"updated_at"`
+	Items          []OrderItem     `json:"items,omitempty"`
 }
 
 // GetOrCreateCart récupère ou crée un panier pour un utilisateur
@@ -111,6 +112,7 @@ func GetOrCreateCart(userID, merchantID string) (*Cart, error) {
 
 		items = append(items, CartItem{
 			ProductID: item.ProductID,
+			VariantID: item.VariantID,
 			Quantity:  item.Quantity,
 			Price:     item.Price,
 			Subtotal:  item.Price * float64(item.Quantity),
@@ -173,7 +175,7 @@ func updateCartTotal(cartID string) error {
 }
 
 // CreateOrder crée une nouvelle commande
-func CreateOrder(userID, merchantID string, totalAmount float64, currency string, shippingAddr, billingAddr Address, paymentIntentID *string) (*Order, error) {
+func CreateOrder(userID, merchantID string, totalAmount float64, currency string, shippingAddr *Address, billingAddr Address, paymentIntentID *string) (*Order, error) {
 	shippingJSON, _ := json.Marshal(shippingAddr)
 	billingJSON, _ := json.Marshal(billingAddr)
 
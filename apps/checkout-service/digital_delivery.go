@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// LineDelivery indique comment une ligne du panier est livrée, d'après le
+// produit ou la variante du catalogue-service
+type LineDelivery struct {
+	IsDigital        bool `json:"is_digital"`
+	RequiresShipping bool `json:"requires_shipping"`
+}
+
+// getLineDelivery récupère le type de livraison d'une ligne ; la valeur de la
+// variante, déjà résolue par le catalogue-service, prime sur celle du produit
+func getLineDelivery(item CartItem) (*LineDelivery, error) {
+	resp, err := inventoryClient.Get(getEnv("CATALOGUE_SERVICE_URL", "http://localhost:8082") + "/api/v1/products/" + item.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("catalogue-service: statut %d", resp.StatusCode)
+	}
+
+	var product struct {
+		LineDelivery
+		Variants []struct {
+			ID string `json:"id"`
+			LineDelivery
+		} `json:"variants"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&product); err != nil {
+		return nil, err
+	}
+
+	if item.VariantID != nil {
+		for _, v := range product.Variants {
+			if v.ID == *item.VariantID {
+				return &v.LineDelivery, nil
+			}
+		}
+	}
+	return &product.LineDelivery, nil
+}
+
+// fulfilDigitalOrder demande au catalogue-service de livrer les lignes
+// numériques d'une commande payée (liens de téléchargement, clés de licence).
+// La livraison est idempotente : Stripe peut rejouer l'événement.
+func fulfilDigitalOrder(orderID string) error {
+	order, err := GetOrder(orderID)
+	if err != nil {
+		return err
+	}
+	if order == nil {
+		return fmt.Errorf("commande %s introuvable", orderID)
+	}
+	lines, err := GetOrderItems(orderID)
+	if err != nil {
+		return err
+	}
+
+	items := []map[string]interface{}{}
+	for _, item := range lines {
+		if !item.IsDigital {
+			continue
+		}
+		items = append(items, map[string]interface{}{
+			"order_item_id": item.ID,
+			"product_id":    item.ProductID,
+			"variant_id":    item.VariantID,
+		})
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	return postInventory("/digital/fulfilments", "", map[string]interface{}{
+		"order_id":    order.ID,
+		"user_id":     order.UserID,
+		"merchant_id": order.MerchantID,
+		"items":       items,
+	}, nil)
+}
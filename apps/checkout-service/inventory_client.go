@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// orderReservationTTL est la durée pendant laquelle le stock d'une commande reste
+// réservé en attendant la confirmation du paiement
+const orderReservationTTL = time.Hour
+
+// errOutOfStock est retournée lorsque la politique de stock refuse une ligne
+var errOutOfStock = errors.New("stock insuffisant")
+
+// inventoryClient appelle les endpoints internes de stock du catalogue-service
+var inventoryClient = &http.Client{Timeout: 10 * time.Second}
+
+// StockReservation représente une réservation retournée par le catalogue-service
+type StockReservation struct {
+	ID          string `json:"id"`
+	Quantity    int    `json:"quantity"`
+	Backordered int    `json:"backordered"` // unités réservées au-delà du stock
+	Fulfilment  string `json:"fulfilment"`  // in_stock, backorder, preorder
+}
+
+// postInventory envoie une requête au catalogue-service ; un 409 est traduit en errOutOfStock
+func postInventory(path, idempotencyKey string, payload, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, getEnv("CATALOGUE_SERVICE_URL", "http://localhost:8082")+"/api/v1"+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := inventoryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return errOutOfStock
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("catalogue-service: statut %d", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// reserveOrderLine réserve le stock d'une ligne de commande. Le catalogue-service
+// applique la politique de stock du produit et indique si la ligne part en
+// réapprovisionnement ou en précommande.
+func reserveOrderLine(orderID string, item CartItem) (*StockReservation, error) {
+	key := "order:" + orderID + ":" + item.ProductID
+	if item.VariantID != nil {
+		key += ":" + *item.VariantID
+	}
+
+	var reservation StockReservation
+	err := postInventory("/inventory/reservations", key, map[string]interface{}{
+		"product_id":  item.ProductID,
+		"variant_id":  item.VariantID,
+		"quantity":    item.Quantity,
+		"owner_type":  "order",
+		"owner_id":    orderID,
+		"ttl_seconds": int(orderReservationTTL.Seconds()),
+	}, &reservation)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// releaseOrderReservations libère le stock réservé pour une commande annulée ou non payée
+func releaseOrderReservations(orderID string) error {
+	return postInventory("/inventory/reservations/release", "", map[string]string{
+		"owner_type": "order",
+		"owner_id":   orderID,
+	}, nil)
+}
+
+// deductOrderStock déduit le stock des lignes d'une commande payée en consommant
+// ses réservations ; la clé d'idempotence par ligne rend les retries sans effet
+func deductOrderStock(orderID string) error {
+	items, err := GetOrderItems(orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		// Les lignes numériques ne consomment pas de stock
+		if item.IsDigital {
+			continue
+		}
+		err := postInventory("/inventory/deductions", "order:"+orderID+":"+item.ID+":deduct", map[string]interface{}{
+			"product_id": item.ProductID,
+			"variant_id": item.VariantID,
+			"quantity":   item.Quantity,
+			"order_id":   orderID,
+			"owner_type": "order",
+			"owner_id":   orderID,
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("ligne %s: %w", item.ID, err)
+		}
+	}
+	return nil
+}
@@ -46,6 +46,9 @@ func main() {
 		api.PUT("/orders/:id/status", authenticateMiddleware(), handleUpdateOrderStatus)
 		api.POST("/orders/:id/refund", authenticateMiddleware(), handleRefundOrder)
 		
+		// Vérification d'achat (appel interne du catalogue-service pour les avis, non exposé par l'API Gateway)
+		api.GET("/purchases/verify", handleVerifyPurchase)
+		
 		// Routes compte client
 		api.GET("/account/orders", authenticateMiddleware(), handleGetUserOrders)
 		api.GET("/account/addresses", authenticateMiddleware(), handleGetAddresses)
@@ -269,6 +272,27 @@ func handleCheckout(c *gin.Context) {
 		}
 	}
 
+	// Type de livraison de chaque ligne : l'adresse de livraison n'est exigée
+	// que si au moins une ligne est expédiée
+	deliveries := make([]*LineDelivery, len(cart.Items))
+	requiresShipping := false
+	for i, item := range cart.Items {
+		deliveries[i], err = getLineDelivery(item)
+		if err != nil {
+			log.Printf("Erreur lors de la récupération de la livraison du produit %s: %v", item.ProductID, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Produit introuvable", "product_id": item.ProductID})
+			return
+		}
+		requiresShipping = requiresShipping || deliveries[i].RequiresShipping
+	}
+	if requiresShipping && req.ShippingAddress == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Adresse de livraison requise"})
+		return
+	}
+	if !requiresShipping {
+		req.ShippingAddress = nil
+	}
+
 	// Créer la commande
 	order, err := CreateOrder(userID, merchantID, finalTotal, cart.Currency, req.ShippingAddress, req.BillingAddress, nil)
 	if err != nil {
@@ -276,10 +300,38 @@ func handleCheckout(c *gin.Context) {
 		return
 	}
 
+	// Réserver le stock de chaque ligne selon la politique de stock du produit ;
+	// les lignes en réapprovisionnement ou en précommande sont signalées. Les
+	// lignes numériques ne réservent pas de stock.
+	for i, item := range cart.Items {
+		reservation := &StockReservation{}
+		var err error
+		if !deliveries[i].IsDigital {
+			reservation, err = reserveOrderLine(order.ID, item)
+		}
+		if err == errOutOfStock {
+			cancelUnplacedOrder(order.ID)
+			c.JSON(http.StatusConflict, gin.H{"error": "Stock insuffisant", "product_id": item.ProductID, "variant_id": item.VariantID})
+			return
+		}
+		var line *OrderItem
+		if err == nil {
+			line, err = CreateOrderItem(order.ID, item, reservation, deliveries[i])
+		}
+		if err != nil {
+			cancelUnplacedOrder(order.ID)
+			log.Printf("Erreur lors de la réservation du stock de la commande %s: %v", order.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la réservation du stock"})
+			return
+		}
+		order.Items = append(order.Items, *line)
+	}
+
 	// Créer le PaymentIntent Stripe
 	amount := int64(finalTotal * 100) // Convertir en centimes
 	paymentIntentID, clientSecret, err := CreatePaymentIntent(amount, cart.Currency, merchantID)
 	if err != nil {
+		cancelUnplacedOrder(order.ID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la création du paiement"})
 		return
 	}
@@ -302,9 +354,20 @@ func handleCheckout(c *gin.Context) {
 		Status:          order.Status,
 		PaymentIntentID: paymentIntentID,
 		ClientSecret:    clientSecret,
+		Items:           order.Items,
 	})
 }
 
+// cancelUnplacedOrder annule une commande dont le checkout a échoué et libère le stock déjà réservé
+func cancelUnplacedOrder(orderID string) {
+	if err := releaseOrderReservations(orderID); err != nil {
+		log.Printf("Erreur lors de la libération du stock de la commande %s: %v", orderID, err)
+	}
+	if err := UpdateOrderStatus(orderID, "cancelled"); err != nil {
+		log.Printf("Erreur lors de l'annulation de la commande %s: %v", orderID, err)
+	}
+}
+
 func handleStripeWebhook(c *gin.Context) {
 	HandleStripeWebhook(c)
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+)
+
+// Modes d'exécution d'une ligne de commande
+const (
+	FulfilmentInStock   = "in_stock"
+	FulfilmentBackorder = "backorder"
+	FulfilmentPreorder  = "preorder"
+)
+
+// OrderItem représente une ligne de commande
+type OrderItem struct {
+	ID                  string  `json:"id"`
+	ProductID           string  `json:"product_id"`
+	VariantID           *string `json:"variant_id,omitempty"`
+	Quantity            int     `json:"quantity"`
+	Price               float64 `json:"price"`
+	Fulfilment          string  `json:"fulfilment"`           // in_stock, backorder, preorder
+	BackorderedQuantity int     `json:"backordered_quantity"` // unités à expédier à l'arrivée du stock
+	IsDigital           bool    `json:"is_digital"`           // livrée par téléchargement ou clé de licence
+	RequiresShipping    bool    `json:"requires_shipping"`
+}
+
+// CreateOrderItem enregistre une ligne de commande avec le mode d'exécution de
+// sa réservation et son type de livraison
+func CreateOrderItem(orderID string, item CartItem, reservation *StockReservation, delivery *LineDelivery) (*OrderItem, error) {
+	line := OrderItem{
+		ProductID:           item.ProductID,
+		VariantID:           item.VariantID,
+		Quantity:            item.Quantity,
+		Price:               item.Price,
+		Fulfilment:          reservation.Fulfilment,
+		BackorderedQuantity: reservation.Backordered,
+		IsDigital:           delivery.IsDigital,
+		RequiresShipping:    delivery.RequiresShipping,
+	}
+	if line.Fulfilment == "" {
+		line.Fulfilment = FulfilmentInStock
+	}
+
+	err := db.QueryRow(
+		`INSERT INTO order_items (order_id, product_id, variant_id, quantity, price, fulfilment, backordered_quantity, reservation_id, is_digital, requires_shipping)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::uuid, $9, $10)
+		 RETURNING id`,
+		orderID, line.ProductID, line.VariantID, line.Quantity, line.Price, line.Fulfilment, line.BackorderedQuantity, reservation.ID,
+		line.IsDigital, line.RequiresShipping,
+	).Scan(&line.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &line, nil
+}
+
+// GetOrderItems récupère les lignes d'une commande
+func GetOrderItems(orderID string) ([]OrderItem, error) {
+	rows, err := db.Query(
+		`SELECT id, product_id, variant_id, quantity, price, fulfilment, backordered_quantity, is_digital, requires_shipping
+		 FROM order_items WHERE order_id = $1 ORDER BY created_at, id`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []OrderItem{}
+	for rows.Next() {
+		var item OrderItem
+		var variantID sql.NullString
+		err := rows.Scan(&item.ID, &item.ProductID, &variantID, &item.Quantity, &item.Price, &item.Fulfilment, &item.BackorderedQuantity, &item.IsDigital, &item.RequiresShipping)
+		if err != nil {
+			return nil, err
+		}
+		if variantID.Valid {
+			item.VariantID = &variantID.String
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -22,10 +22,21 @@ func handleGetOrders(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
 
-	rows, err := db.Query(
-		"SELECT id, user_id, merchant_id, status, total_amount, currency, payment_intent_id, shipping_address, billing_address, created_at, updated_at FROM orders WHERE merchant_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3",
-		merchantID, limit, offset,
-	)
+	// ?fulfilment=backorder|preorder : commandes ayant au moins une ligne à expédier plus tard
+	query := "SELECT id, user_id, merchant_id, status, total_amount, currency, payment_intent_id, shipping_address, billing_address, created_at, updated_at FROM orders WHERE merchant_id = $1"
+	args := []interface{}{merchantID, limit, offset}
+	switch fulfilment := c.Query("fulfilment"); fulfilment {
+	case "":
+	case FulfilmentBackorder, FulfilmentPreorder:
+		query += " AND EXISTS (SELECT 1 FROM order_items oi WHERE oi.order_id = orders.id AND oi.fulfilment = $4)"
+		args = append(args, fulfilment)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fulfilment invalide (backorder, preorder)"})
+		return
+	}
+	query += " ORDER BY created_at DESC LIMIT $2 OFFSET $3"
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des commandes"})
 		return
@@ -67,6 +78,12 @@ func handleGetOrder(c *gin.Context) {
 		return
 	}
 
+	order.Items, err = GetOrderItems(orderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération de la commande"})
+		return
+	}
+
 	c.JSON(http.StatusOK, order)
 }
 
@@ -99,6 +116,13 @@ func handleUpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
+	// Une commande annulée avant paiement rend son stock réservé
+	if req.Status == "cancelled" {
+		if err := releaseOrderReservations(orderID); err != nil {
+			log.Printf("Erreur lors de la libération du stock de la commande %s: %v", orderID, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Statut mis à jour"})
 }
 
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PurchaseVerification indique si un client a acheté un produit, pour les
+// avis « achat vérifié » du catalogue-service
+type PurchaseVerification struct {
+	Verified    bool       `json:"verified"`
+	OrderID     string     `json:"order_id,omitempty"`
+	PurchasedAt *time.Time `json:"purchased_at,omitempty"`
+}
+
+// VerifyPurchase cherche la commande la plus récente du client contenant le
+// produit ; orderID restreint la recherche à une commande. Une commande non
+// payée, échouée, annulée ou entièrement remboursée ne compte pas.
+func VerifyPurchase(userID, productID, orderID string) (*PurchaseVerification, error) {
+	var verification PurchaseVerification
+	var purchasedAt time.Time
+	err := db.QueryRow(
+		`SELECT o.id, o.created_at FROM orders o
+		 WHERE o.user_id = $1 AND ($3 = '' OR o.id::text = $3)
+		   AND o.status NOT IN ('pending', 'failed', 'cancelled', 'refunded')
+		   AND EXISTS (SELECT 1 FROM order_items oi WHERE oi.order_id = o.id AND oi.product_id::text = $2)
+		 ORDER BY o.created_at DESC
+		 LIMIT 1`,
+		userID, productID, orderID,
+	).Scan(&verification.OrderID, &purchasedAt)
+	if err == sql.ErrNoRows {
+		return &verification, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	verification.Verified = true
+	verification.PurchasedAt = &purchasedAt
+	return &verification, nil
+}
+
+// handleVerifyPurchase vérifie un achat (?user_id=&product_id=&order_id=)
+func handleVerifyPurchase(c *gin.Context) {
+	userID := c.Query("user_id")
+	productID := c.Query("product_id")
+	if userID == "" || productID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id et product_id requis"})
+		return
+	}
+
+	verification, err := VerifyPurchase(userID, productID, c.Query("order_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la vérification de l'achat"})
+		return
+	}
+
+	c.JSON(http.StatusOK, verification)
+}
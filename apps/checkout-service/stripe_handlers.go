@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"io"
 	"log"
@@ -96,12 +95,27 @@ func HandleStripeWebhook(c *gin.Context) {
 		}
 
 		// Mettre à jour le statut de la commande
-		_, err = db.Exec(
-			"UPDATE orders SET status = 'paid', updated_at = CURRENT_TIMESTAMP WHERE payment_intent_id = $1",
+		var orderID string
+		err = db.QueryRow(
+			"UPDATE orders SET status = 'paid', updated_at = CURRENT_TIMESTAMP WHERE payment_intent_id = $1 RETURNING id",
 			pi.ID,
-		)
+		).Scan(&orderID)
 		if err != nil {
 			log.Printf("Erreur lors de la mise à jour de la commande: %v", err)
+		} else if err := deductOrderStock(orderID); err != nil {
+			// Les déductions sont idempotentes : Stripe rejouera l'événement
+			log.Printf("Erreur lors de la déduction du stock de la commande %s: %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la déduction du stock"})
+			return
+		}
+
+		// Livraison des produits numériques (téléchargements, clés de licence)
+		if orderID != "" {
+			if err := fulfilDigitalOrder(orderID); err != nil {
+				log.Printf("Erreur lors de la livraison numérique de la commande %s: %v", orderID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la livraison des produits numériques"})
+				return
+			}
 		}
 
 		// TODO: Publier un événement Kafka order.paid
@@ -114,13 +128,16 @@ func HandleStripeWebhook(c *gin.Context) {
 			return
 		}
 
-		// Mettre à jour le statut de la commande
-		_, err = db.Exec(
-			"UPDATE orders SET status = 'failed', updated_at = CURRENT_TIMESTAMP WHERE payment_intent_id = $1",
+		// Mettre à jour le statut de la commande et libérer le stock réservé
+		var orderID string
+		err = db.QueryRow(
+			"UPDATE orders SET status = 'failed', updated_at = CURRENT_TIMESTAMP WHERE payment_intent_id = $1 RETURNING id",
 			pi.ID,
-		)
+		).Scan(&orderID)
 		if err != nil {
 			log.Printf("Erreur lors de la mise à jour de la commande: %v", err)
+		} else if err := releaseOrderReservations(orderID); err != nil {
+			log.Printf("Erreur lors de la libération du stock de la commande %s: %v", orderID, err)
 		}
 
 	default:
@@ -37,6 +37,9 @@ func main() {
 		api.PUT("/webhooks/:id", authenticateMiddleware(), handleUpdateWebhook)
 		api.DELETE("/webhooks/:id", authenticateMiddleware(), handleDeleteWebhook)
 		api.POST("/webhooks/:id/test", authenticateMiddleware(), handleTestWebhook)
+
+		// Publication d'événements par les autres services (appel interne, non exposé par l'API Gateway)
+		api.POST("/events", handlePublishEvent)
 	}
 
 	srv := &http.Server{
@@ -325,6 +328,58 @@ func handleTestWebhook(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Webhook de test envoyé avec succès"})
 }
 
+// EventRequest représente un événement publié par un service pour un marchand
+type EventRequest struct {
+	MerchantID string      `json:"merchant_id" binding:"required"`
+	EventType  string      `json:"event_type" binding:"required"`
+	Data       interface{} `json:"data"`
+}
+
+// handlePublishEvent diffuse un événement aux webhooks actifs du marchand abonnés à ce type
+func handlePublishEvent(c *gin.Context) {
+	var req EventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := db.Query(
+		"SELECT url, secret FROM webhooks WHERE merchant_id = $1 AND event_type = $2 AND is_active = true",
+		req.MerchantID, req.EventType,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	defer rows.Close()
+
+	var targets []Webhook
+	for rows.Next() {
+		var w Webhook
+		if err := rows.Scan(&w.URL, &w.Secret); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+			return
+		}
+		targets = append(targets, w)
+	}
+
+	payload := map[string]interface{}{
+		"event_type": req.EventType,
+		"timestamp":  time.Now().Unix(),
+		"data":       req.Data,
+	}
+	delivered := 0
+	for _, w := range targets {
+		if err := sendWebhook(w.URL, w.Secret, payload); err != nil {
+			log.Printf("Erreur lors de l'envoi du webhook %s vers %s: %v", req.EventType, w.URL, err)
+			continue
+		}
+		delivered++
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"delivered": delivered, "subscribers": len(targets)})
+}
+
 func sendWebhook(url, secret string, payload map[string]interface{}) error {
 	// TODO: Implémenter l'envoi HTTP POST avec signature HMAC
 	// Pour l'instant, on log juste
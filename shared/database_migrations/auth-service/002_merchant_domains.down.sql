@@ -0,0 +1,3 @@
+-- Rollback des domaines personnalisés
+
+DROP TABLE IF EXISTS merchant_domains;
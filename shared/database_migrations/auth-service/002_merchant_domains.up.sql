@@ -0,0 +1,24 @@
+-- Domaines personnalisés des storefronts
+-- Un domaine est rattaché à un marchand après vérification d'un enregistrement TXT
+-- (_omnisphere-verify.<domaine> = omnisphere-verify=<token>)
+
+CREATE TABLE IF NOT EXISTS merchant_domains (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL REFERENCES merchant_accounts(id) ON DELETE CASCADE,
+    hostname VARCHAR(253) NOT NULL,
+    verification_token VARCHAR(64) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'verified', 'failed')),
+    verified_at TIMESTAMP,
+    last_checked_at TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (merchant_id, hostname)
+);
+
+CREATE INDEX idx_merchant_domains_merchant_id ON merchant_domains(merchant_id);
+
+-- Un domaine vérifié ne sert qu'une seule boutique
+CREATE UNIQUE INDEX idx_merchant_domains_verified_hostname
+    ON merchant_domains(hostname) WHERE status = 'verified';
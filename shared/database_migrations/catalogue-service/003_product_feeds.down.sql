@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_product_feeds_merchant_id;
+DROP TABLE IF EXISTS product_feeds;
@@ -0,0 +1,19 @@
+-- Migration pour les flux produits planifiés (Google Merchant Center, Meta)
+
+CREATE TABLE IF NOT EXISTS product_feeds (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    format VARCHAR(20) NOT NULL CHECK (format IN ('google', 'meta')),
+    token VARCHAR(64) UNIQUE NOT NULL,
+    store_url VARCHAR(500) NOT NULL,
+    brand VARCHAR(255),
+    content TEXT,
+    product_count INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    generated_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (merchant_id, format)
+);
+
+CREATE INDEX idx_product_feeds_merchant_id ON product_feeds(merchant_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_search_outbox_product_id;
+DROP INDEX IF EXISTS idx_search_outbox_processed_at;
+DROP INDEX IF EXISTS idx_search_outbox_pending;
+DROP TABLE IF EXISTS search_outbox;
@@ -0,0 +1,16 @@
+-- Migration pour l'outbox transactionnelle d'indexation Elasticsearch
+
+CREATE TABLE IF NOT EXISTS search_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    product_id UUID NOT NULL,
+    operation VARCHAR(20) NOT NULL CHECK (operation IN ('index', 'delete')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    processed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_search_outbox_pending ON search_outbox(next_attempt_at) WHERE processed_at IS NULL;
+CREATE INDEX idx_search_outbox_processed_at ON search_outbox(processed_at) WHERE processed_at IS NOT NULL;
+CREATE INDEX idx_search_outbox_product_id ON search_outbox(product_id);
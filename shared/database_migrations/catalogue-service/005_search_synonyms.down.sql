@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_search_synonyms_merchant_id;
+DROP TABLE IF EXISTS search_synonyms;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS merchandising_rules;
+DROP TABLE IF EXISTS search_conversions;
+DROP TABLE IF EXISTS search_clicks;
+DROP TABLE IF EXISTS search_events;
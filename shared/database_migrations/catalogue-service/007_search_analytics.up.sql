@@ -0,0 +1,51 @@
+-- Migration pour l'analytique de recherche et les règles de merchandising
+
+CREATE TABLE IF NOT EXISTS search_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    query TEXT NOT NULL,
+    normalized_query TEXT NOT NULL,
+    result_count INTEGER NOT NULL,
+    page INTEGER NOT NULL DEFAULT 1,
+    backend VARCHAR(50),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_search_events_merchant_created ON search_events(merchant_id, created_at);
+CREATE INDEX idx_search_events_normalized_query ON search_events(merchant_id, normalized_query);
+
+CREATE TABLE IF NOT EXISTS search_clicks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    search_id UUID NOT NULL REFERENCES search_events(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL,
+    position INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_search_clicks_search_id ON search_clicks(search_id);
+
+CREATE TABLE IF NOT EXISTS search_conversions (
+    search_id UUID NOT NULL REFERENCES search_events(id) ON DELETE CASCADE,
+    order_id VARCHAR(255) NOT NULL,
+    amount DECIMAL(10, 2),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (search_id, order_id)
+);
+
+CREATE TABLE IF NOT EXISTS merchandising_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    query TEXT NOT NULL DEFAULT '',
+    match_type VARCHAR(20) NOT NULL DEFAULT 'exact' CHECK (match_type IN ('exact', 'contains', 'any')),
+    action VARCHAR(20) NOT NULL CHECK (action IN ('pin', 'bury', 'boost', 'redirect')),
+    product_ids UUID[] NOT NULL DEFAULT '{}',
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    category_ids UUID[] NOT NULL DEFAULT '{}',
+    boost DECIMAL(6, 2) NOT NULL DEFAULT 1,
+    redirect_url TEXT,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_merchandising_rules_merchant_id ON merchandising_rules(merchant_id) WHERE active;
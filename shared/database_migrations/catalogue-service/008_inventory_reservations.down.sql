@@ -0,0 +1,3 @@
+ALTER TABLE inventory DROP CONSTRAINT IF EXISTS inventory_reserved_non_negative;
+DROP TABLE IF EXISTS inventory_operations;
+DROP TABLE IF EXISTS inventory_reservations;
@@ -0,0 +1,32 @@
+-- Migration pour les réservations de stock avec expiration et les clés d'idempotence
+
+CREATE TABLE IF NOT EXISTS inventory_reservations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id UUID REFERENCES product_variants(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    owner_type VARCHAR(20) NOT NULL CHECK (owner_type IN ('cart', 'order')),
+    owner_id VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'released', 'consumed', 'expired')),
+    idempotency_key VARCHAR(255) UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_inventory_reservations_owner ON inventory_reservations(owner_type, owner_id) WHERE status = 'active';
+CREATE INDEX idx_inventory_reservations_expires_at ON inventory_reservations(expires_at) WHERE status = 'active';
+
+-- Opérations de stock déjà appliquées, pour qu'un retry ne décrémente pas deux fois
+CREATE TABLE IF NOT EXISTS inventory_operations (
+    idempotency_key VARCHAR(255) PRIMARY KEY,
+    operation VARCHAR(20) NOT NULL,
+    product_id UUID NOT NULL,
+    variant_id UUID,
+    quantity INTEGER NOT NULL,
+    reference_id VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Filet de sécurité : une libération ne peut pas rendre la réserve négative
+ALTER TABLE inventory ADD CONSTRAINT inventory_reserved_non_negative CHECK (reserved >= 0) NOT VALID;
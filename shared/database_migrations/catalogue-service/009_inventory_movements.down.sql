@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_inventory_movements_reference_id;
+DROP INDEX IF EXISTS idx_inventory_movements_product;
+DROP TABLE IF EXISTS inventory_movements;
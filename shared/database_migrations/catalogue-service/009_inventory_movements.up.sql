@@ -0,0 +1,24 @@
+-- Migration pour le registre des mouvements de stock
+
+CREATE TABLE IF NOT EXISTS inventory_movements (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id UUID REFERENCES product_variants(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('in', 'out', 'adjustment')),
+    -- Variation signée : positive en entrée, négative en sortie
+    quantity INTEGER NOT NULL,
+    balance_after INTEGER NOT NULL,
+    reason VARCHAR(30) NOT NULL CHECK (reason IN ('opening_balance', 'sale', 'return', 'restock', 'shrinkage', 'count_correction')),
+    reference_id VARCHAR(255),
+    note TEXT,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_inventory_movements_product ON inventory_movements(product_id, variant_id, created_at);
+CREATE INDEX idx_inventory_movements_reference_id ON inventory_movements(reference_id) WHERE reference_id IS NOT NULL;
+
+-- Solde d'ouverture : le stock existant devient le premier mouvement du registre
+INSERT INTO inventory_movements (product_id, variant_id, type, quantity, balance_after, reason, created_by)
+SELECT product_id, variant_id, 'adjustment', quantity, quantity, 'opening_balance', 'system'
+FROM inventory;
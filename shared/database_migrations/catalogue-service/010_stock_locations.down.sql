@@ -0,0 +1,9 @@
+ALTER TABLE inventory_movements DROP CONSTRAINT IF EXISTS inventory_movements_reason_check;
+ALTER TABLE inventory_movements ADD CONSTRAINT inventory_movements_reason_check
+    CHECK (reason IN ('opening_balance', 'sale', 'return', 'restock', 'shrinkage', 'count_correction')) NOT VALID;
+ALTER TABLE inventory_movements DROP COLUMN IF EXISTS location_id;
+DROP TABLE IF EXISTS allocation_settings;
+DROP TABLE IF EXISTS stock_transfer_items;
+DROP TABLE IF EXISTS stock_transfers;
+DROP TABLE IF EXISTS inventory_levels;
+DROP TABLE IF EXISTS stock_locations;
@@ -0,0 +1,89 @@
+-- Migration pour les emplacements de stock (entrepôts, magasins), les transferts et l'allocation
+
+CREATE TABLE IF NOT EXISTS stock_locations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    code VARCHAR(50) NOT NULL,
+    type VARCHAR(20) NOT NULL DEFAULT 'warehouse' CHECK (type IN ('warehouse', 'store')),
+    country VARCHAR(2),
+    priority INTEGER NOT NULL DEFAULT 100,
+    fulfils_online BOOLEAN NOT NULL DEFAULT TRUE,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (merchant_id, code)
+);
+
+CREATE UNIQUE INDEX idx_stock_locations_default ON stock_locations(merchant_id) WHERE is_default;
+
+-- Stock par emplacement ; la table inventory conserve le total du réseau
+CREATE TABLE IF NOT EXISTS inventory_levels (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    location_id UUID NOT NULL REFERENCES stock_locations(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id UUID REFERENCES product_variants(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL DEFAULT 0 CHECK (quantity >= 0),
+    incoming INTEGER NOT NULL DEFAULT 0 CHECK (incoming >= 0), -- en transit vers cet emplacement
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_inventory_levels_item ON inventory_levels(
+    location_id, product_id, COALESCE(variant_id, '00000000-0000-0000-0000-000000000000'::uuid)
+);
+CREATE INDEX idx_inventory_levels_product ON inventory_levels(product_id, variant_id);
+
+CREATE TABLE IF NOT EXISTS stock_transfers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    from_location_id UUID NOT NULL REFERENCES stock_locations(id),
+    to_location_id UUID NOT NULL REFERENCES stock_locations(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'in_transit', 'received', 'cancelled')),
+    note TEXT,
+    shipped_at TIMESTAMP,
+    received_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (from_location_id <> to_location_id)
+);
+
+CREATE INDEX idx_stock_transfers_merchant_id ON stock_transfers(merchant_id, created_at);
+
+CREATE TABLE IF NOT EXISTS stock_transfer_items (
+    transfer_id UUID NOT NULL REFERENCES stock_transfers(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id),
+    variant_id UUID REFERENCES product_variants(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0)
+);
+
+CREATE INDEX idx_stock_transfer_items_transfer_id ON stock_transfer_items(transfer_id);
+
+CREATE TABLE IF NOT EXISTS allocation_settings (
+    merchant_id UUID PRIMARY KEY,
+    strategy VARCHAR(20) NOT NULL DEFAULT 'priority' CHECK (strategy IN ('priority', 'closest')),
+    allow_split BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Les mouvements sont rattachés à un emplacement ; les transferts ont leurs motifs
+ALTER TABLE inventory_movements ADD COLUMN IF NOT EXISTS location_id UUID REFERENCES stock_locations(id);
+ALTER TABLE inventory_movements DROP CONSTRAINT IF EXISTS inventory_movements_reason_check;
+ALTER TABLE inventory_movements ADD CONSTRAINT inventory_movements_reason_check
+    CHECK (reason IN ('opening_balance', 'sale', 'return', 'restock', 'shrinkage', 'count_correction', 'transfer_out', 'transfer_in'));
+
+-- Emplacement par défaut pour chaque marchand disposant déjà de stock
+INSERT INTO stock_locations (merchant_id, name, code, is_default)
+SELECT DISTINCT p.merchant_id, 'Entrepôt principal', 'DEFAULT', TRUE
+FROM inventory i JOIN products p ON p.id = i.product_id
+ON CONFLICT (merchant_id, code) DO NOTHING;
+
+INSERT INTO inventory_levels (location_id, product_id, variant_id, quantity)
+SELECT l.id, i.product_id, i.variant_id, GREATEST(i.quantity, 0)
+FROM inventory i
+JOIN products p ON p.id = i.product_id
+JOIN stock_locations l ON l.merchant_id = p.merchant_id AND l.is_default;
+
+UPDATE inventory_movements m SET location_id = l.id
+FROM products p, stock_locations l
+WHERE p.id = m.product_id AND l.merchant_id = p.merchant_id AND l.is_default AND m.location_id IS NULL;
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS purchase_order_items;
+DROP TABLE IF EXISTS purchase_orders;
+DROP TABLE IF EXISTS stock_alerts;
+DROP TABLE IF EXISTS stock_alert_settings;
+ALTER TABLE inventory
+    DROP COLUMN IF EXISTS stock_status,
+    DROP COLUMN IF EXISTS supplier_id,
+    DROP COLUMN IF EXISTS reorder_quantity,
+    DROP COLUMN IF EXISTS reorder_point;
+DROP TABLE IF EXISTS suppliers;
@@ -0,0 +1,80 @@
+-- Migration pour les seuils de réapprovisionnement, les alertes de stock bas,
+-- les fournisseurs et les bons de commande fournisseur
+
+CREATE TABLE IF NOT EXISTS suppliers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    phone VARCHAR(50),
+    lead_time_days INTEGER NOT NULL DEFAULT 0 CHECK (lead_time_days >= 0),
+    notes TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (merchant_id, name)
+);
+
+-- Seuil et quantité de réapprovisionnement par produit/variante ; stock_status
+-- mémorise le dernier état signalé pour ne pas répéter les alertes
+ALTER TABLE inventory
+    ADD COLUMN IF NOT EXISTS reorder_point INTEGER CHECK (reorder_point >= 0),
+    ADD COLUMN IF NOT EXISTS reorder_quantity INTEGER CHECK (reorder_quantity > 0),
+    ADD COLUMN IF NOT EXISTS supplier_id UUID REFERENCES suppliers(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS stock_status VARCHAR(20) NOT NULL DEFAULT 'in_stock'
+        CHECK (stock_status IN ('in_stock', 'low_stock', 'out_of_stock'));
+
+CREATE TABLE IF NOT EXISTS stock_alert_settings (
+    merchant_id UUID PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    notify_email VARCHAR(255),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Alertes à publier (webhook et e-mail), rejouées jusqu'à livraison
+CREATE TABLE IF NOT EXISTS stock_alerts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id UUID REFERENCES product_variants(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('low_stock', 'out_of_stock')),
+    available INTEGER NOT NULL,
+    reorder_point INTEGER,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    delivered_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stock_alerts_merchant_id ON stock_alerts(merchant_id, created_at);
+CREATE INDEX idx_stock_alerts_pending ON stock_alerts(created_at) WHERE delivered_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS purchase_orders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    supplier_id UUID NOT NULL REFERENCES suppliers(id),
+    location_id UUID NOT NULL REFERENCES stock_locations(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'draft'
+        CHECK (status IN ('draft', 'ordered', 'partially_received', 'received', 'cancelled')),
+    expected_at DATE,
+    note TEXT,
+    ordered_at TIMESTAMP,
+    received_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_purchase_orders_merchant_id ON purchase_orders(merchant_id, status);
+
+CREATE TABLE IF NOT EXISTS purchase_order_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    purchase_order_id UUID NOT NULL REFERENCES purchase_orders(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id),
+    variant_id UUID REFERENCES product_variants(id),
+    quantity_ordered INTEGER NOT NULL CHECK (quantity_ordered > 0),
+    quantity_received INTEGER NOT NULL DEFAULT 0 CHECK (quantity_received >= 0),
+    unit_cost DECIMAL(10, 2),
+    CHECK (quantity_received <= quantity_ordered)
+);
+
+CREATE INDEX idx_purchase_order_items_order ON purchase_order_items(purchase_order_id);
+CREATE INDEX idx_purchase_order_items_product ON purchase_order_items(product_id, variant_id);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS inventory_backorders;
+ALTER TABLE inventory_reservations
+    DROP COLUMN IF EXISTS fulfilment,
+    DROP COLUMN IF EXISTS backordered;
+ALTER TABLE inventory
+    DROP COLUMN IF EXISTS preorder_until,
+    DROP COLUMN IF EXISTS backorder_lead_days,
+    DROP COLUMN IF EXISTS backorder_limit,
+    DROP COLUMN IF EXISTS policy;
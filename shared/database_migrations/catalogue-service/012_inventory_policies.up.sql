@@ -0,0 +1,35 @@
+-- Migration pour les politiques de stock : refus, vente en réapprovisionnement
+-- (backorder) et précommande
+
+ALTER TABLE inventory
+    ADD COLUMN IF NOT EXISTS policy VARCHAR(20) NOT NULL DEFAULT 'deny'
+        CHECK (policy IN ('deny', 'backorder', 'preorder')),
+    -- Nombre maximal d'unités vendables au-delà du stock (NULL : illimité)
+    ADD COLUMN IF NOT EXISTS backorder_limit INTEGER CHECK (backorder_limit >= 0),
+    -- Délai d'expédition annoncé pour les unités en réapprovisionnement
+    ADD COLUMN IF NOT EXISTS backorder_lead_days INTEGER CHECK (backorder_lead_days >= 0),
+    -- Date de sortie : la précommande est ouverte jusqu'à cette date (NULL : sans échéance)
+    ADD COLUMN IF NOT EXISTS preorder_until TIMESTAMP;
+
+-- Unités réservées au-delà du stock et mode d'exécution retenu à la réservation
+ALTER TABLE inventory_reservations
+    ADD COLUMN IF NOT EXISTS backordered INTEGER NOT NULL DEFAULT 0 CHECK (backordered >= 0),
+    ADD COLUMN IF NOT EXISTS fulfilment VARCHAR(20) NOT NULL DEFAULT 'in_stock'
+        CHECK (fulfilment IN ('in_stock', 'backorder', 'preorder'));
+
+-- Unités vendues sans stock, à expédier lorsque la marchandise arrive. Le total
+-- du réseau (inventory.quantity) peut devenir négatif du montant des reliquats ouverts.
+CREATE TABLE IF NOT EXISTS inventory_backorders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id UUID REFERENCES product_variants(id) ON DELETE CASCADE,
+    order_id VARCHAR(255) NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    fulfilment VARCHAR(20) NOT NULL CHECK (fulfilment IN ('backorder', 'preorder')),
+    location_id UUID REFERENCES stock_locations(id),
+    fulfilled_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_inventory_backorders_open ON inventory_backorders(product_id, variant_id, created_at) WHERE fulfilled_at IS NULL;
+CREATE INDEX idx_inventory_backorders_order ON inventory_backorders(order_id);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS storefront_versions;
+ALTER TABLE storefront_configs
+    DROP COLUMN IF EXISTS published_version,
+    DROP COLUMN IF EXISTS draft_updated_by,
+    DROP COLUMN IF EXISTS draft_updated_at,
+    DROP COLUMN IF EXISTS draft_theme,
+    DROP COLUMN IF EXISTS draft_sections;
@@ -0,0 +1,39 @@
+-- Migration pour les brouillons, l'historique des versions et la publication
+-- planifiée de la configuration du storefront
+
+-- sections/theme restent la configuration publiée (servie au storefront) ;
+-- draft_sections/draft_theme contiennent les modifications non publiées
+-- (NULL : identique à la version publiée)
+ALTER TABLE storefront_configs
+    ADD COLUMN IF NOT EXISTS draft_sections JSONB,
+    ADD COLUMN IF NOT EXISTS draft_theme JSONB,
+    ADD COLUMN IF NOT EXISTS draft_updated_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS draft_updated_by VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS published_version INTEGER;
+
+-- Versions publiées (ou planifiées) : instantanés immuables de la configuration
+CREATE TABLE IF NOT EXISTS storefront_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    version INTEGER NOT NULL,
+    sections JSONB,
+    theme JSONB,
+    status VARCHAR(20) NOT NULL DEFAULT 'published'
+        CHECK (status IN ('scheduled', 'published', 'cancelled')),
+    message TEXT,
+    author VARCHAR(255),
+    scheduled_at TIMESTAMP,
+    published_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (merchant_id, version)
+);
+
+CREATE INDEX idx_storefront_versions_scheduled ON storefront_versions(scheduled_at) WHERE status = 'scheduled';
+
+-- La configuration existante devient la version 1
+INSERT INTO storefront_versions (merchant_id, version, sections, theme, status, message, published_at)
+SELECT merchant_id, 1, sections, theme, 'published', 'Version initiale', COALESCE(updated_at, CURRENT_TIMESTAMP)
+FROM storefront_configs
+ON CONFLICT (merchant_id, version) DO NOTHING;
+
+UPDATE storefront_configs SET published_version = 1 WHERE published_version IS NULL;
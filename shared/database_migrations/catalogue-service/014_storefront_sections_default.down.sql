@@ -0,0 +1 @@
+ALTER TABLE storefront_configs ALTER COLUMN sections DROP DEFAULT;
@@ -0,0 +1,5 @@
+-- Une configuration créée par la sauvegarde du thème seul avait des sections NULL
+ALTER TABLE storefront_configs ALTER COLUMN sections SET DEFAULT '[]'::jsonb;
+
+UPDATE storefront_configs SET sections = '[]'::jsonb WHERE sections IS NULL;
+UPDATE storefront_versions SET sections = '[]'::jsonb WHERE sections IS NULL;
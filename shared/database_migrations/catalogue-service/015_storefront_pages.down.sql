@@ -0,0 +1,9 @@
+ALTER TABLE storefront_versions
+    DROP COLUMN IF EXISTS menus,
+    DROP COLUMN IF EXISTS pages;
+
+ALTER TABLE storefront_configs
+    DROP COLUMN IF EXISTS draft_menus,
+    DROP COLUMN IF EXISTS draft_pages,
+    DROP COLUMN IF EXISTS menus,
+    DROP COLUMN IF EXISTS pages;
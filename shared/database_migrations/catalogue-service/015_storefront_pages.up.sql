@@ -0,0 +1,12 @@
+-- Migration pour les pages multiples et les menus de navigation du storefront.
+-- sections reste l'accueil ; pages et menus suivent le même cycle brouillon /
+-- publication que les sections et le thème.
+ALTER TABLE storefront_configs
+    ADD COLUMN IF NOT EXISTS pages JSONB DEFAULT '[]'::jsonb,
+    ADD COLUMN IF NOT EXISTS menus JSONB DEFAULT '[]'::jsonb,
+    ADD COLUMN IF NOT EXISTS draft_pages JSONB,
+    ADD COLUMN IF NOT EXISTS draft_menus JSONB;
+
+ALTER TABLE storefront_versions
+    ADD COLUMN IF NOT EXISTS pages JSONB,
+    ADD COLUMN IF NOT EXISTS menus JSONB;
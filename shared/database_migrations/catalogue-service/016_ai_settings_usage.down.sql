@@ -0,0 +1,4 @@
+-- Rollback des réglages et de la consommation AI
+
+DROP TABLE IF EXISTS ai_usage;
+DROP TABLE IF EXISTS ai_settings;
@@ -0,0 +1,26 @@
+-- Migration pour les réglages de génération AI par marchand et la
+-- comptabilisation des tokens consommés
+
+-- Valeurs vides : défauts du service (LLM_PROVIDER, modèle du fournisseur, fr, persuasive)
+CREATE TABLE IF NOT EXISTS ai_settings (
+    merchant_id UUID PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL DEFAULT '',
+    model VARCHAR(100) NOT NULL DEFAULT '',
+    language VARCHAR(10) NOT NULL DEFAULT '',
+    tone VARCHAR(50) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Un enregistrement par appel réussi au fournisseur
+CREATE TABLE IF NOT EXISTS ai_usage (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    feature VARCHAR(50) NOT NULL,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_ai_usage_merchant_created ON ai_usage(merchant_id, created_at);
@@ -0,0 +1,11 @@
+-- Rollback de la génération de contenus AI en masse
+
+DROP TABLE IF EXISTS ai_generation_items;
+DROP TABLE IF EXISTS ai_generation_jobs;
+
+ALTER TABLE ai_settings
+    DROP COLUMN IF EXISTS monthly_token_limit;
+
+ALTER TABLE products
+    DROP COLUMN IF EXISTS meta_description,
+    DROP COLUMN IF EXISTS seo_title;
@@ -0,0 +1,56 @@
+-- Migration pour la génération de contenus AI en masse : champs SEO des
+-- produits, plafond mensuel par marchand, jobs et relecture par produit
+
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS seo_title VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS meta_description TEXT;
+
+-- Plafond de tokens consommés par mois civil (NULL : illimité)
+ALTER TABLE ai_settings
+    ADD COLUMN IF NOT EXISTS monthly_token_limit INTEGER CHECK (monthly_token_limit >= 0);
+
+CREATE TABLE IF NOT EXISTS ai_generation_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued'
+        CHECK (status IN ('queued', 'running', 'paused', 'completed', 'cancelled')),
+    fields TEXT[] NOT NULL,
+    filter JSONB NOT NULL DEFAULT '{}',
+    language VARCHAR(10) NOT NULL,
+    tone VARCHAR(50) NOT NULL,
+    -- Budget de tokens du job (NULL : plafond mensuel du marchand seul)
+    token_budget INTEGER CHECK (token_budget > 0),
+    tokens_used INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    -- Réservation par un worker ; expirée, le job est repris par un autre
+    lease_until TIMESTAMP,
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_ai_generation_jobs_merchant ON ai_generation_jobs(merchant_id, created_at DESC);
+CREATE INDEX idx_ai_generation_jobs_pending ON ai_generation_jobs(created_at) WHERE status IN ('queued', 'running');
+
+CREATE TABLE IF NOT EXISTS ai_generation_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    job_id UUID NOT NULL REFERENCES ai_generation_jobs(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'generated', 'failed', 'accepted', 'rejected')),
+    -- Contenu généré, puis contenu appliqué après relecture
+    generated JSONB,
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    reviewed_by VARCHAR(255),
+    reviewed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (job_id, product_id)
+);
+
+CREATE INDEX idx_ai_generation_items_job_status ON ai_generation_items(job_id, status);
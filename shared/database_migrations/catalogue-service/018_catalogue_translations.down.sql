@@ -0,0 +1,10 @@
+-- Rollback des champs localisés du catalogue
+
+DELETE FROM ai_generation_jobs WHERE kind = 'translation';
+ALTER TABLE ai_generation_jobs
+    DROP COLUMN IF EXISTS kind;
+
+DROP TABLE IF EXISTS category_translations;
+DROP TABLE IF EXISTS variant_translations;
+DROP TABLE IF EXISTS product_translations;
+DROP TABLE IF EXISTS merchant_locales;
@@ -0,0 +1,68 @@
+-- Migration pour les champs localisés du catalogue : langues proposées par
+-- marchand, traductions des produits, variantes et catégories, et jobs de
+-- traduction AI. Les colonnes des tables d'origine portent la langue par défaut.
+
+CREATE TABLE IF NOT EXISTS merchant_locales (
+    merchant_id UUID PRIMARY KEY,
+    default_locale VARCHAR(10) NOT NULL DEFAULT 'fr',
+    -- Langues proposées sur le storefront, langue par défaut comprise
+    locales TEXT[] NOT NULL DEFAULT ARRAY['fr'],
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS product_translations (
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    locale VARCHAR(10) NOT NULL,
+    -- Champ NULL : la valeur de la langue par défaut est utilisée
+    name VARCHAR(255),
+    description TEXT,
+    seo_title VARCHAR(255),
+    meta_description TEXT,
+    source VARCHAR(20) NOT NULL DEFAULT 'manual' CHECK (source IN ('manual', 'ai')),
+    search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector(
+            CASE locale
+                WHEN 'fr' THEN 'french'::regconfig
+                WHEN 'en' THEN 'english'::regconfig
+                WHEN 'de' THEN 'german'::regconfig
+                WHEN 'nl' THEN 'dutch'::regconfig
+                ELSE 'simple'::regconfig
+            END, COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector(
+            CASE locale
+                WHEN 'fr' THEN 'french'::regconfig
+                WHEN 'en' THEN 'english'::regconfig
+                WHEN 'de' THEN 'german'::regconfig
+                WHEN 'nl' THEN 'dutch'::regconfig
+                ELSE 'simple'::regconfig
+            END, COALESCE(description, '')), 'C')
+    ) STORED,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (product_id, locale)
+);
+
+CREATE INDEX idx_product_translations_search_vector ON product_translations USING GIN (search_vector);
+CREATE INDEX idx_product_translations_locale ON product_translations(locale);
+
+CREATE TABLE IF NOT EXISTS variant_translations (
+    variant_id UUID NOT NULL REFERENCES product_variants(id) ON DELETE CASCADE,
+    locale VARCHAR(10) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (variant_id, locale)
+);
+
+CREATE TABLE IF NOT EXISTS category_translations (
+    category_id UUID NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    locale VARCHAR(10) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (category_id, locale)
+);
+
+-- Un job de traduction écrit dans product_translations pour la langue du job
+-- au lieu de modifier le produit
+ALTER TABLE ai_generation_jobs
+    ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'content'
+        CHECK (kind IN ('content', 'translation'));
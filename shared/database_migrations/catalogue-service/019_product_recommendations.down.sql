@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS product_views;
+DROP TABLE IF EXISTS product_copurchases;
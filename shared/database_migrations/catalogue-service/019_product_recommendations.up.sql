@@ -0,0 +1,28 @@
+-- Migration pour les recommandations produits : matrice d'achats conjoints
+-- précalculée depuis les commandes du checkout et produits consultés
+
+-- Paires de produits achetés dans une même commande, recalculées
+-- périodiquement (les N meilleures paires par produit)
+CREATE TABLE IF NOT EXISTS product_copurchases (
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    related_product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    merchant_id UUID NOT NULL,
+    order_count INTEGER NOT NULL CHECK (order_count > 0),
+    computed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (product_id, related_product_id)
+);
+
+CREATE INDEX idx_product_copurchases_rank ON product_copurchases(product_id, order_count DESC);
+
+-- Produits consultés par visiteur (identifiant anonyme de la vitrine)
+CREATE TABLE IF NOT EXISTS product_views (
+    id BIGSERIAL PRIMARY KEY,
+    merchant_id UUID NOT NULL,
+    visitor_id VARCHAR(64) NOT NULL,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    viewed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_product_views_visitor ON product_views(merchant_id, visitor_id, viewed_at DESC);
+CREATE INDEX idx_product_views_viewed_at ON product_views(viewed_at);
+
@@ -0,0 +1,35 @@
+-- Migration pour les collections de produits : listes ordonnées choisies par
+-- le marchand (manual) et collections définies par des règles (smart)
+
+CREATE TABLE IF NOT EXISTS collections (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    handle VARCHAR(64) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    type VARCHAR(10) NOT NULL CHECK (type IN ('manual', 'smart')),
+    -- Règles d'une collection smart : [{"type": "tag_contains", "value": "été"}, ...]
+    rules JSONB NOT NULL DEFAULT '[]',
+    -- all : le produit respecte toutes les règles, any : au moins une
+    rules_match VARCHAR(3) NOT NULL DEFAULT 'all' CHECK (rules_match IN ('all', 'any')),
+    sort_order VARCHAR(20) NOT NULL DEFAULT 'manual'
+        CHECK (sort_order IN ('manual', 'newest', 'price_asc', 'price_desc', 'name')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (merchant_id, handle)
+);
+
+CREATE INDEX idx_collections_merchant_type ON collections(merchant_id, type);
+
+-- Produits des collections : saisis pour une collection manual, recalculés à
+-- chaque modification d'un produit ou des règles pour une collection smart
+CREATE TABLE IF NOT EXISTS collection_products (
+    collection_id UUID NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL DEFAULT 0,
+    added_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id, product_id)
+);
+
+CREATE INDEX idx_collection_products_position ON collection_products(collection_id, position);
+CREATE INDEX idx_collection_products_product_id ON collection_products(product_id);
@@ -0,0 +1,45 @@
+-- Migration pour les avis produits : avis d'acheteurs vérifiés, modération,
+-- réponse du marchand et note agrégée sur le produit
+
+-- Note moyenne et nombre des avis publiés, tenus à jour à chaque modération
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS rating_average NUMERIC(3, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS rating_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS product_reviews (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    -- Commande du checkout-service attestant l'achat
+    order_id UUID NOT NULL,
+    author_name VARCHAR(100) NOT NULL,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    title VARCHAR(255),
+    body TEXT NOT NULL,
+    photos TEXT[] NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'published', 'rejected', 'spam')),
+    -- Motif du filtre ou du modérateur
+    moderation_reason TEXT,
+    moderated_at TIMESTAMP,
+    merchant_reply TEXT,
+    replied_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    -- Un avis par client et par produit
+    UNIQUE (product_id, user_id)
+);
+
+CREATE INDEX idx_product_reviews_product_status ON product_reviews(product_id, status, created_at DESC);
+CREATE INDEX idx_product_reviews_merchant_status ON product_reviews(merchant_id, status, created_at DESC);
+
+-- Réglages de modération par marchand
+CREATE TABLE IF NOT EXISTS review_settings (
+    merchant_id UUID PRIMARY KEY,
+    -- Publication sans modération des avis acceptés par les filtres
+    auto_publish BOOLEAN NOT NULL DEFAULT false,
+    -- Mots bloqués en plus de la liste par défaut du filtre de grossièretés
+    blocked_words TEXT[] NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
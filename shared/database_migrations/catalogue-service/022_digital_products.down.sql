@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS license_keys;
+DROP TABLE IF EXISTS digital_downloads;
+DROP TABLE IF EXISTS digital_order_lines;
+DROP TABLE IF EXISTS digital_assets;
+
+ALTER TABLE product_variants
+    DROP COLUMN IF EXISTS requires_shipping,
+    DROP COLUMN IF EXISTS is_digital;
+
+ALTER TABLE products
+    DROP COLUMN IF EXISTS requires_shipping,
+    DROP COLUMN IF EXISTS is_digital;
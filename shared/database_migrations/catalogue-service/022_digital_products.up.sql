@@ -0,0 +1,77 @@
+-- Migration pour les produits numériques : fichiers téléchargeables, liens de
+-- téléchargement limités et réserves de clés de licence
+
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS is_digital BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS requires_shipping BOOLEAN NOT NULL DEFAULT true;
+
+-- NULL : valeur du produit
+ALTER TABLE product_variants
+    ADD COLUMN IF NOT EXISTS is_digital BOOLEAN,
+    ADD COLUMN IF NOT EXISTS requires_shipping BOOLEAN;
+
+-- Fichiers livrés avec un produit (ou une seule de ses variantes)
+CREATE TABLE IF NOT EXISTS digital_assets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id UUID REFERENCES product_variants(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    -- SHA-256 du contenu
+    checksum VARCHAR(64) NOT NULL,
+    storage_backend VARCHAR(20) NOT NULL,
+    storage_key TEXT NOT NULL,
+    -- Nombre de téléchargements accordés par ligne de commande
+    download_limit INTEGER NOT NULL DEFAULT 5 CHECK (download_limit > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_digital_assets_product ON digital_assets(product_id);
+
+-- Lignes de commande payées contenant un produit numérique
+CREATE TABLE IF NOT EXISTS digital_order_lines (
+    order_item_id UUID PRIMARY KEY,
+    order_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    merchant_id UUID NOT NULL,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id UUID,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_digital_order_lines_order ON digital_order_lines(order_id);
+CREATE INDEX idx_digital_order_lines_product ON digital_order_lines(product_id);
+
+-- Droits de téléchargement d'un fichier pour une ligne de commande
+CREATE TABLE IF NOT EXISTS digital_downloads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_item_id UUID NOT NULL REFERENCES digital_order_lines(order_item_id) ON DELETE CASCADE,
+    asset_id UUID NOT NULL REFERENCES digital_assets(id) ON DELETE CASCADE,
+    download_limit INTEGER NOT NULL,
+    download_count INTEGER NOT NULL DEFAULT 0,
+    last_downloaded_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (order_item_id, asset_id)
+);
+
+-- Réserve de clés de licence d'un produit ; variant_id NULL : clé valable pour
+-- toutes les variantes
+CREATE TABLE IF NOT EXISTS license_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id UUID REFERENCES product_variants(id) ON DELETE CASCADE,
+    license_key TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'available'
+        CHECK (status IN ('available', 'assigned', 'revoked')),
+    order_item_id UUID REFERENCES digital_order_lines(order_item_id) ON DELETE SET NULL,
+    assigned_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (product_id, license_key)
+);
+
+-- Une clé par ligne de commande
+CREATE UNIQUE INDEX idx_license_keys_order_item ON license_keys(order_item_id) WHERE order_item_id IS NOT NULL;
+CREATE INDEX idx_license_keys_available ON license_keys(product_id, created_at) WHERE status = 'available';
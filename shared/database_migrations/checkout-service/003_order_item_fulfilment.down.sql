@@ -0,0 +1,8 @@
+-- Rollback migration
+
+DROP INDEX IF EXISTS idx_order_items_fulfilment;
+
+ALTER TABLE order_items
+    DROP COLUMN IF EXISTS reservation_id,
+    DROP COLUMN IF EXISTS backordered_quantity,
+    DROP COLUMN IF EXISTS fulfilment;
@@ -0,0 +1,12 @@
+-- Migration pour le suivi d'exécution des lignes de commande : les lignes vendues
+-- en réapprovisionnement (backorder) ou en précommande sont signalées à la préparation
+
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS fulfilment VARCHAR(20) NOT NULL DEFAULT 'in_stock'
+        CHECK (fulfilment IN ('in_stock', 'backorder', 'preorder')),
+    -- Unités de la ligne vendues au-delà du stock
+    ADD COLUMN IF NOT EXISTS backordered_quantity INTEGER NOT NULL DEFAULT 0 CHECK (backordered_quantity >= 0),
+    -- Réservation de stock du catalogue-service
+    ADD COLUMN IF NOT EXISTS reservation_id UUID;
+
+CREATE INDEX idx_order_items_fulfilment ON order_items(order_id) WHERE fulfilment <> 'in_stock';
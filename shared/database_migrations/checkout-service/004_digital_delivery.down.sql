@@ -0,0 +1,5 @@
+-- Rollback migration
+
+ALTER TABLE order_items
+    DROP COLUMN IF EXISTS requires_shipping,
+    DROP COLUMN IF EXISTS is_digital;
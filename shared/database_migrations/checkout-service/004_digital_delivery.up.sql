@@ -0,0 +1,7 @@
+-- Migration pour la livraison des produits numériques : les lignes numériques ne
+-- réservent pas de stock et sont livrées par le catalogue-service après paiement ;
+-- l'adresse de livraison n'est exigée que si une ligne est expédiée
+
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS is_digital BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS requires_shipping BOOLEAN NOT NULL DEFAULT true;
@@ -55,6 +55,12 @@ export default function StoreBuilderPage() {
   const [theme, setTheme] = useState<Theme | null>(null)
   const [loading, setLoading] = useState(true)
   const [activeTab, setActiveTab] = useState<'sections' | 'theme'>('sections')
+  const [hasChanges, setHasChanges] = useState(false)
+  const [publishing, setPublishing] = useState(false)
+  const [publishedVersion, setPublishedVersion] = useState<number | null>(null)
+  const [fieldErrors, setFieldErrors] = useState<{ field: string; message: string }[]>([])
+  // Publications planifiées annulées par la dernière publication immédiate
+  const [cancelledVersions, setCancelledVersions] = useState<number[]>([])
 
   useEffect(() => {
     loadConfig()
@@ -63,13 +69,12 @@ export default function StoreBuilderPage() {
   const loadConfig = async () => {
     try {
       setLoading(true)
-      // TODO: Implémenter les endpoints backend
-      const [sectionsResponse, themeResponse] = await Promise.all([
-        api.get('/store-builder/config').catch(() => ({ data: { sections: [] } })),
-        api.get('/store-builder/theme').catch(() => ({ data: null })),
-      ])
-      setSections(sectionsResponse.data.sections || [])
-      setTheme(themeResponse.data || null)
+      // L'éditeur travaille sur le brouillon ; le storefront sert la version publiée
+      const draftResponse = await api.get('/store-builder/draft').catch(() => ({ data: { sections: [] } }))
+      setSections(draftResponse.data.sections || [])
+      setTheme(draftResponse.data.theme || null)
+      setHasChanges(!!draftResponse.data.has_changes)
+      setPublishedVersion(draftResponse.data.published_version ?? null)
     } catch (error) {
       console.error('Erreur:', error)
     } finally {
@@ -83,7 +88,11 @@ export default function StoreBuilderPage() {
       await api.post('/store-builder/config', {
         sections: newSections,
       })
-    } catch (error) {
+      setHasChanges(true)
+      setFieldErrors([])
+    } catch (error: any) {
+      // 422 : erreurs de validation par champ (schéma du type de section)
+      setFieldErrors(error.response?.data?.fields || [])
       console.error('Erreur lors de la sauvegarde:', error)
     }
   }
@@ -94,11 +103,41 @@ export default function StoreBuilderPage() {
       await api.post('/store-builder/theme', {
         theme: newTheme,
       })
-    } catch (error) {
+      setHasChanges(true)
+      setFieldErrors([])
+    } catch (error: any) {
+      setFieldErrors(error.response?.data?.fields || [])
       console.error('Erreur lors de la sauvegarde du thème:', error)
     }
   }
 
+  const handlePublish = async () => {
+    setPublishing(true)
+    try {
+      const response = await api.post('/store-builder/publish', {})
+      setPublishedVersion(response.data.version)
+      setCancelledVersions(response.data.cancelled_versions || [])
+      setHasChanges(false)
+      setFieldErrors([])
+    } catch (error: any) {
+      setFieldErrors(error.response?.data?.fields || [])
+      console.error('Erreur lors de la publication:', error)
+    } finally {
+      setPublishing(false)
+    }
+  }
+
+  const handlePreview = async () => {
+    try {
+      const response = await api.post('/store-builder/preview-token', {})
+      const storefrontURL = process.env.NEXT_PUBLIC_STOREFRONT_URL || 'http://localhost:3001'
+      const merchantId = localStorage.getItem('merchant_id') || ''
+      window.open(`${storefrontURL}/?merchant_id=${merchantId}&preview=${encodeURIComponent(response.data.token)}`, '_blank')
+    } catch (error) {
+      console.error('Erreur lors de la création du lien de prévisualisation:', error)
+    }
+  }
+
   if (loading) {
     return (
       <div className="container mx-auto px-4 py-8">
@@ -114,11 +153,52 @@ export default function StoreBuilderPage() {
       </Head>
 
       <div className="container mx-auto px-4 py-8">
-        <h1 className="text-3xl font-bold mb-6">Store Builder</h1>
+        <div className="flex items-center justify-between mb-6">
+          <h1 className="text-3xl font-bold">Store Builder</h1>
+          <div className="flex items-center space-x-3">
+            <span className="text-sm text-gray-500">
+              {hasChanges ? 'Modifications non publiées' : 'À jour'}
+              {publishedVersion !== null && ` · version ${publishedVersion} en ligne`}
+            </span>
+            <button
+              onClick={handlePreview}
+              className="px-4 py-2 text-sm font-medium border border-gray-300 rounded hover:bg-gray-50"
+            >
+              Prévisualiser
+            </button>
+            <button
+              onClick={handlePublish}
+              disabled={!hasChanges || publishing}
+              className="px-4 py-2 text-sm font-medium text-white bg-blue-600 rounded hover:bg-blue-700 disabled:opacity-50"
+            >
+              {publishing ? 'Publication...' : 'Publier'}
+            </button>
+          </div>
+        </div>
         <p className="text-gray-600 mb-8">
           Personnalisez votre boutique avec des sections modulaires et un thème personnalisé
         </p>
 
+        {cancelledVersions.length > 0 && (
+          <div className="mb-6 p-4 border border-yellow-200 bg-yellow-50 rounded text-sm text-yellow-800">
+            Publications planifiées annulées, remplacées par la version {publishedVersion} :{' '}
+            {cancelledVersions.map((version) => `version ${version}`).join(', ')}
+          </div>
+        )}
+
+        {fieldErrors.length > 0 && (
+          <div className="mb-6 p-4 border border-red-200 bg-red-50 rounded">
+            <p className="font-medium text-red-800 mb-2">Configuration invalide</p>
+            <ul className="text-sm text-red-700 list-disc pl-5">
+              {fieldErrors.map((fieldError) => (
+                <li key={fieldError.field}>
+                  <code>{fieldError.field}</code> : {fieldError.message}
+                </li>
+              ))}
+            </ul>
+          </div>
+        )}
+
         {/* Tabs */}
         <div className="border-b border-gray-200 mb-6">
           <nav className="flex space-x-1">
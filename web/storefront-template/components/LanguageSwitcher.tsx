@@ -0,0 +1,59 @@
+import React, { useState, useEffect } from 'react'
+import { useRouter } from 'next/router'
+import api from '../lib/api'
+import { localeLabels, storeLocale, StoreLocales } from '../lib/i18n'
+
+interface LanguageSwitcherProps {
+  merchantId: string
+  // Appelé lorsque le visiteur choisit une autre langue
+  onChange?: (locale: string) => void
+}
+
+export default function LanguageSwitcher({ merchantId, onChange }: LanguageSwitcherProps) {
+  const router = useRouter()
+  const [settings, setSettings] = useState<StoreLocales | null>(null)
+
+  useEffect(() => {
+    api.get('/locales', { params: { merchant_id: merchantId } })
+      .then((response) => setSettings(response.data))
+      .catch((error) => console.error('Erreur lors du chargement des langues:', error))
+  }, [merchantId])
+
+  useEffect(() => {
+    if (settings) {
+      document.documentElement.lang = settings.locale
+    }
+  }, [settings?.locale])
+
+  // Une boutique monolingue n'affiche pas de sélecteur
+  if (!settings || settings.locales.length < 2) return null
+
+  const handleChange = (locale: string) => {
+    storeLocale(locale)
+    setSettings({ ...settings, locale })
+    // La page est rechargée une fois l'URL à jour : ?locale= prime sur le choix enregistré
+    router
+      .replace({ pathname: router.pathname, query: { ...router.query, locale } })
+      .then(() => onChange?.(locale))
+  }
+
+  return (
+    <div className="fixed top-4 right-4 z-40">
+      <label htmlFor="language-switcher" className="sr-only">
+        Langue
+      </label>
+      <select
+        id="language-switcher"
+        value={settings.locale}
+        onChange={(e) => handleChange(e.target.value)}
+        className="px-3 py-2 border rounded bg-white text-sm shadow"
+      >
+        {settings.locales.map((locale) => (
+          <option key={locale} value={locale}>
+            {localeLabels[locale] || locale}
+          </option>
+        ))}
+      </select>
+    </div>
+  )
+}
@@ -0,0 +1,82 @@
+import { useState, useEffect } from 'react'
+import Link from 'next/link'
+import api from '../lib/api'
+import { visitorId } from '../lib/visitor'
+
+interface RecommendedProduct {
+  id: string
+  name: string
+  price: number
+  currency: string
+  images: string[]
+}
+
+type Recommendations = Record<string, RecommendedProduct[]>
+
+// Titre de chaque bloc, dans l'ordre d'affichage
+const sections: Array<[string, string]> = [
+  ['bought_together', 'Souvent achetés ensemble'],
+  ['similar', 'Produits similaires'],
+  ['recently_viewed', 'Récemment consultés'],
+]
+
+interface ProductRecommendationsProps {
+  productId: string
+}
+
+export default function ProductRecommendations({ productId }: ProductRecommendationsProps) {
+  const [recommendations, setRecommendations] = useState<Recommendations>({})
+
+  useEffect(() => {
+    const visitor = visitorId()
+    api
+      .get(`/products/${productId}/recommendations`, {
+        params: { visitor_id: visitor || undefined },
+      })
+      .then((response) => setRecommendations(response.data.recommendations || {}))
+      .catch((error) => console.error('Erreur lors du chargement des recommandations:', error))
+
+    // La consultation est enregistrée après la lecture des recommandations
+    // pour ne pas recommander le produit affiché
+    if (visitor) {
+      api
+        .post('/recommendations/views', { product_id: productId, visitor_id: visitor })
+        .catch(() => {})
+    }
+  }, [productId])
+
+  return (
+    <>
+      {sections.map(([strategy, title]) => {
+        const products = recommendations[strategy]
+        if (!products || products.length === 0) return null
+
+        return (
+          <section key={strategy} className="mt-12">
+            <h2 className="text-2xl font-bold mb-4">{title}</h2>
+            <div className="grid grid-cols-2 md:grid-cols-4 gap-6">
+              {products.map((product) => (
+                <Link key={product.id} href={`/products/${product.id}`} className="block group">
+                  {product.images && product.images.length > 0 && (
+                    <img
+                      src={product.images[0]}
+                      alt={product.name}
+                      className="w-full aspect-square object-cover rounded-lg mb-2"
+                    />
+                  )}
+                  <p className="font-medium group-hover:underline">{product.name}</p>
+                  <p className="text-blue-600">
+                    {new Intl.NumberFormat('fr-FR', {
+                      style: 'currency',
+                      currency: product.currency || 'EUR',
+                    }).format(product.price)}
+                  </p>
+                </Link>
+              ))}
+            </div>
+          </section>
+        )
+      })}
+    </>
+  )
+}
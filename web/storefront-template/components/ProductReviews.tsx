@@ -0,0 +1,164 @@
+import { useState, useEffect } from 'react'
+import api from '../lib/api'
+
+interface Review {
+  id: string
+  author_name: string
+  rating: number
+  title?: string
+  body: string
+  photos: string[]
+  merchant_reply?: string
+  created_at: string
+}
+
+interface ReviewSummary {
+  rating_average: number
+  rating_count: number
+  distribution: Record<string, number>
+}
+
+interface ProductReviewsProps {
+  productId: string
+}
+
+function Stars({ rating }: { rating: number }) {
+  const rounded = Math.round(rating)
+  return (
+    <span className="text-yellow-500" aria-label={`${rating} sur 5`}>
+      {'★'.repeat(rounded)}
+      <span className="text-gray-300">{'★'.repeat(5 - rounded)}</span>
+    </span>
+  )
+}
+
+export default function ProductReviews({ productId }: ProductReviewsProps) {
+  const [reviews, setReviews] = useState<Review[]>([])
+  const [summary, setSummary] = useState<ReviewSummary | null>(null)
+  const [structuredData, setStructuredData] = useState<string | null>(null)
+  const [form, setForm] = useState({ author_name: '', rating: 5, title: '', body: '' })
+  const [message, setMessage] = useState<string | null>(null)
+
+  useEffect(() => {
+    api
+      .get(`/products/${productId}/reviews`)
+      .then((response) => {
+        setReviews(response.data.reviews || [])
+        setSummary(response.data.summary)
+      })
+      .catch((error) => console.error('Erreur lors du chargement des avis:', error))
+
+    // Données structurées schema.org pour les moteurs de recherche
+    api
+      .get(`/products/${productId}/structured-data`)
+      .then((response) => setStructuredData(JSON.stringify(response.data)))
+      .catch(() => {})
+  }, [productId])
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault()
+    try {
+      const response = await api.post(`/products/${productId}/reviews`, form)
+      setMessage(
+        response.data.status === 'published'
+          ? 'Merci, votre avis est publié'
+          : 'Merci, votre avis sera publié après modération'
+      )
+    } catch (error: any) {
+      if (error.response?.status === 401) {
+        setMessage('Connectez-vous pour laisser un avis')
+      } else {
+        setMessage(error.response?.data?.error || 'Erreur lors de l\'envoi de l\'avis')
+      }
+    }
+  }
+
+  return (
+    <section className="mt-12">
+      {structuredData && (
+        <script type="application/ld+json" dangerouslySetInnerHTML={{ __html: structuredData }} />
+      )}
+
+      <h2 className="text-2xl font-bold mb-4">Avis clients</h2>
+      {summary && summary.rating_count > 0 ? (
+        <p className="mb-6">
+          <Stars rating={summary.rating_average} /> {summary.rating_average.toFixed(1)} / 5 (
+          {summary.rating_count} avis)
+        </p>
+      ) : (
+        <p className="mb-6 text-gray-600">Aucun avis pour le moment</p>
+      )}
+
+      <div className="space-y-6">
+        {reviews.map((review) => (
+          <article key={review.id} className="border-b pb-4">
+            <p>
+              <Stars rating={review.rating} />{' '}
+              {review.title && <span className="font-semibold">{review.title}</span>}
+            </p>
+            <p className="text-sm text-gray-500">
+              {review.author_name} · achat vérifié ·{' '}
+              {new Date(review.created_at).toLocaleDateString('fr-FR')}
+            </p>
+            <p className="mt-2 whitespace-pre-line">{review.body}</p>
+            {review.photos.length > 0 && (
+              <div className="flex gap-2 mt-2">
+                {review.photos.map((photo) => (
+                  <img key={photo} src={photo} alt="" className="w-20 h-20 object-cover rounded" />
+                ))}
+              </div>
+            )}
+            {review.merchant_reply && (
+              <p className="mt-2 ml-4 pl-4 border-l text-gray-700">
+                <span className="font-semibold">Réponse du vendeur : </span>
+                {review.merchant_reply}
+              </p>
+            )}
+          </article>
+        ))}
+      </div>
+
+      <form onSubmit={handleSubmit} className="mt-8 space-y-3 max-w-xl">
+        <h3 className="text-xl font-semibold">Donner votre avis</h3>
+        <input
+          type="text"
+          placeholder="Votre nom"
+          value={form.author_name}
+          onChange={(e) => setForm({ ...form, author_name: e.target.value })}
+          className="w-full border rounded px-3 py-2"
+          required
+        />
+        <select
+          value={form.rating}
+          onChange={(e) => setForm({ ...form, rating: Number(e.target.value) })}
+          className="w-full border rounded px-3 py-2"
+        >
+          {[5, 4, 3, 2, 1].map((rating) => (
+            <option key={rating} value={rating}>
+              {rating} / 5
+            </option>
+          ))}
+        </select>
+        <input
+          type="text"
+          placeholder="Titre (facultatif)"
+          value={form.title}
+          onChange={(e) => setForm({ ...form, title: e.target.value })}
+          className="w-full border rounded px-3 py-2"
+        />
+        <textarea
+          placeholder="Votre avis"
+          value={form.body}
+          onChange={(e) => setForm({ ...form, body: e.target.value })}
+          className="w-full border rounded px-3 py-2"
+          rows={4}
+          required
+        />
+        <button type="submit" className="bg-blue-600 text-white py-2 px-4 rounded-lg hover:bg-blue-700">
+          Envoyer
+        </button>
+        {message && <p className="text-gray-700">{message}</p>}
+      </form>
+    </section>
+  )
+}
@@ -14,6 +14,8 @@ interface ProductGridSectionProps {
     title?: string
     limit?: number
     category?: string
+    // Handle d'une collection : ses produits, dans l'ordre de la collection
+    collection?: string
   }
 }
 
@@ -28,7 +30,10 @@ export default function ProductGridSection({ data }: ProductGridSectionProps) {
   const loadProducts = async () => {
     try {
       setLoading(true)
-      const response = await api.get('/products', {
+      const path = data.collection
+        ? `/collections/${encodeURIComponent(data.collection)}/products`
+        : '/products'
+      const response = await api.get(path, {
         params: { limit: data.limit || 8 },
       })
       setProducts(response.data.products || [])
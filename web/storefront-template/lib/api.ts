@@ -1,4 +1,5 @@
 import axios from 'axios'
+import { currentLocale } from './i18n'
 
 const API_BASE_URL = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080/api/v1'
 
@@ -15,6 +16,11 @@ api.interceptors.request.use((config) => {
   if (token) {
     config.headers.Authorization = `Bearer ${token}`
   }
+  // Langue choisie via le sélecteur : produits, variantes et catégories traduits
+  const locale = currentLocale()
+  if (locale) {
+    config.params = { locale, ...config.params }
+  }
   return config
 })
 
@@ -0,0 +1,33 @@
+const LOCALE_STORAGE_KEY = 'locale'
+
+// Nom de chaque langue du catalogue, dans sa propre langue
+export const localeLabels: Record<string, string> = {
+  fr: 'Français',
+  en: 'English',
+  de: 'Deutsch',
+  nl: 'Nederlands',
+}
+
+export interface StoreLocales {
+  default_locale: string
+  locales: string[]
+  // Langue retenue par le catalogue-service (?locale=, puis Accept-Language)
+  locale: string
+}
+
+// currentLocale retourne la langue choisie par le visiteur : ?locale= dans
+// l'URL, puis le dernier choix enregistré. Sans choix, le catalogue-service
+// se base sur Accept-Language.
+export function currentLocale(): string | null {
+  if (typeof window === 'undefined') return null
+
+  const fromQuery = new URLSearchParams(window.location.search).get('locale')
+  if (fromQuery) {
+    return fromQuery
+  }
+  return localStorage.getItem(LOCALE_STORAGE_KEY)
+}
+
+export function storeLocale(locale: string) {
+  localStorage.setItem(LOCALE_STORAGE_KEY, locale)
+}
@@ -95,6 +95,17 @@ export function applyTheme(theme: Theme) {
   root.style.setProperty('--shadow', theme.layout.shadow)
 }
 
+// themeStylesheetURL retourne l'URL de la feuille de variables CSS compilée par
+// le catalogue-service à partir du thème publié (ou d'un lien de prévisualisation)
+export function themeStylesheetURL(merchantId: string, previewToken?: string): string {
+  const API_BASE_URL = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080/api/v1'
+  const params = new URLSearchParams({ merchant_id: merchantId })
+  if (previewToken) {
+    params.set('preview_token', previewToken)
+  }
+  return `${API_BASE_URL}/store-builder/theme.css?${params.toString()}`
+}
+
 export async function loadTheme(merchantId: string): Promise<Theme> {
   try {
     const API_BASE_URL = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080/api/v1'
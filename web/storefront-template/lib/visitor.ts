@@ -0,0 +1,14 @@
+const VISITOR_STORAGE_KEY = 'visitor_id'
+
+// visitorId retourne l'identifiant anonyme du visiteur, créé à la première
+// visite ; il sert uniquement aux produits récemment consultés
+export function visitorId(): string | null {
+  if (typeof window === 'undefined') return null
+
+  let id = localStorage.getItem(VISITOR_STORAGE_KEY)
+  if (!id) {
+    id = crypto.randomUUID()
+    localStorage.setItem(VISITOR_STORAGE_KEY, id)
+  }
+  return id
+}
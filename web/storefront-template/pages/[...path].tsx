@@ -0,0 +1,134 @@
+import { useState, useEffect } from 'react'
+import Head from 'next/head'
+import { useRouter } from 'next/router'
+import Link from 'next/link'
+import api from '../lib/api'
+import DynamicSectionRenderer from '../components/DynamicSectionRenderer'
+
+interface Section {
+  id: string
+  type: string
+  data: any
+  order: number
+}
+
+interface MenuItem {
+  label: string
+  url: string
+  items?: MenuItem[]
+}
+
+interface Menu {
+  handle: string
+  title: string
+  items: MenuItem[]
+}
+
+interface ResolvedPage {
+  path: string
+  type: string
+  handle?: string
+  title?: string
+  seo?: { title?: string; description?: string }
+  sections: Section[]
+}
+
+// Pages construites dans le store builder (à propos, FAQ, landing pages...),
+// résolues par chemin ; les pages natives (produits, compte...) restent prioritaires
+export default function BuilderPage() {
+  const router = useRouter()
+  const [page, setPage] = useState<ResolvedPage | null>(null)
+  const [headerMenu, setHeaderMenu] = useState<Menu | null>(null)
+  const [notFound, setNotFound] = useState(false)
+  const [loading, setLoading] = useState(true)
+
+  useEffect(() => {
+    if (!router.isReady) return
+    loadPage()
+  }, [router.isReady, router.query.path, router.query.merchant_id, router.query.preview])
+
+  const loadPage = async () => {
+    try {
+      setLoading(true)
+      setNotFound(false)
+      const merchantId = router.query.merchant_id as string || 'default'
+      const segments = (router.query.path as string[]) || []
+      const response = await api.get('/store-builder/resolve', {
+        params: {
+          merchant_id: merchantId,
+          path: '/' + segments.join('/'),
+          preview_token: router.query.preview as string | undefined,
+        },
+      })
+      setPage(response.data.page)
+      const menus: Menu[] = response.data.menus || []
+      setHeaderMenu(menus.find((menu) => menu.handle === 'header') || null)
+    } catch (error: any) {
+      if (error.response?.status === 404) {
+        setNotFound(true)
+      } else {
+        console.error('Erreur lors du chargement de la page:', error)
+      }
+      setPage(null)
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  if (loading) {
+    return (
+      <div className="text-center py-12">
+        <p className="text-gray-600">Chargement...</p>
+      </div>
+    )
+  }
+
+  if (notFound || !page) {
+    return (
+      <div className="container mx-auto px-4 py-16 text-center">
+        <h1 className="text-3xl font-bold mb-4">Page introuvable</h1>
+        <Link href="/" className="text-blue-600 hover:underline">
+          Retour à l'accueil
+        </Link>
+      </div>
+    )
+  }
+
+  return (
+    <>
+      <Head>
+        <title>{page.seo?.title || page.title || 'Boutique'} - OmniSphere</title>
+        {page.seo?.description && <meta name="description" content={page.seo.description} />}
+      </Head>
+
+      {headerMenu && (
+        <nav className="border-b border-gray-200">
+          <ul className="container mx-auto px-4 py-3 flex space-x-6">
+            {headerMenu.items.map((item) => (
+              <li key={item.url + item.label} className="relative group">
+                <Link href={item.url} className="text-gray-700 hover:text-gray-900">
+                  {item.label}
+                </Link>
+                {item.items && item.items.length > 0 && (
+                  <ul className="absolute hidden group-hover:block bg-white shadow-md rounded py-2 z-10">
+                    {item.items.map((child) => (
+                      <li key={child.url + child.label}>
+                        <Link href={child.url} className="block px-4 py-1 text-gray-700 hover:bg-gray-50">
+                          {child.label}
+                        </Link>
+                      </li>
+                    ))}
+                  </ul>
+                )}
+              </li>
+            ))}
+          </ul>
+        </nav>
+      )}
+
+      <main>
+        <DynamicSectionRenderer sections={page.sections} />
+      </main>
+    </>
+  )
+}
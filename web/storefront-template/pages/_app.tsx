@@ -1,32 +1,32 @@
 import type { AppProps } from 'next/app'
+import Head from 'next/head'
+import { useState } from 'react'
 import { QueryClient, QueryClientProvider } from '@tanstack/react-query'
-import { useEffect } from 'react'
 import { useRouter } from 'next/router'
 import '../styles/globals.css'
 import '../styles/theme-variables.css'
 import CookieBanner from '../components/CookieBanner'
-import { loadTheme, applyTheme } from '../lib/theme'
+import LanguageSwitcher from '../components/LanguageSwitcher'
+import { themeStylesheetURL } from '../lib/theme'
 
 const queryClient = new QueryClient()
 
 export default function App({ Component, pageProps }: AppProps) {
   const router = useRouter()
-
-  useEffect(() => {
-    const loadAndApplyTheme = async () => {
-      const merchantId = router.query.merchant_id as string || 'default'
-      const theme = await loadTheme(merchantId)
-      applyTheme(theme)
-    }
-
-    loadAndApplyTheme()
-  }, [router.query.merchant_id])
+  const merchantId = router.query.merchant_id as string || 'default'
+  const previewToken = router.query.preview as string | undefined
+  const [locale, setLocale] = useState<string | null>(null)
 
   return (
     <QueryClientProvider client={queryClient}>
-      <Component {...pageProps} />
+      <Head>
+        {/* Variables CSS compilées côté serveur (ETag) ; theme-variables.css sert de repli */}
+        <link rel="stylesheet" href={themeStylesheetURL(merchantId, previewToken)} />
+      </Head>
+      <LanguageSwitcher merchantId={merchantId} onChange={setLocale} />
+      {/* Changer de langue remonte la page, qui recharge ses données traduites */}
+      <Component key={locale || 'default'} {...pageProps} />
       <CookieBanner />
     </QueryClientProvider>
   )
 }
-
@@ -30,7 +30,7 @@ export default function Home() {
 
   useEffect(() => {
     loadConfig()
-  }, [router.query.merchant_id])
+  }, [router.query.merchant_id, router.query.preview])
 
   const loadConfig = async () => {
     try {
@@ -39,11 +39,10 @@ export default function Home() {
       
       // Charger la configuration du storefront
       // Note: Pour le storefront public, on passe merchant_id en paramètre
+      // Lien de prévisualisation signé : le brouillon remplace la version publiée
+      const previewToken = router.query.preview as string | undefined
       const configResponse = await api.get('/store-builder/config', {
-        params: { merchant_id: merchantId },
-        headers: {
-          'X-Merchant-ID': merchantId,
-        },
+        params: { merchant_id: merchantId, preview_token: previewToken },
       }).catch(() => ({ data: { sections: [] } }))
 
       const loadedSections = configResponse.data.sections || []
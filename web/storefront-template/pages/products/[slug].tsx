@@ -4,6 +4,8 @@ import Head from 'next/head'
 import ProductDetail from '../../components/ProductDetail'
 import ProductVariants from '../../components/ProductVariants'
 import Breadcrumbs from '../../components/Breadcrumbs'
+import ProductRecommendations from '../../components/ProductRecommendations'
+import ProductReviews from '../../components/ProductReviews'
 import api from '../../lib/api'
 
 interface Product {
@@ -134,6 +136,10 @@ export default function ProductPage() {
             </button>
           </div>
         </div>
+
+        <ProductReviews productId={product.id} />
+
+        <ProductRecommendations productId={product.id} />
       </div>
     </>
   )